@@ -0,0 +1,145 @@
+package pincer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/soul"
+)
+
+func composeSystemPrompt(s *soul.Soul, extra, skillPrompts string) string {
+	prompt := s.Render()
+	if extra != "" {
+		prompt += "\n" + extra
+	}
+	return prompt + skillPrompts
+}
+
+// buildAgentProfiles turns [[agents]] entries into runtime profiles. Each
+// agent inherits the default soul, model and sandbox unless it sets its own.
+func buildAgentProfiles(ctx context.Context, cfg *config.Config, logger *slog.Logger, deps *storeDeps, defaultSoul *soul.Soul, skillPrompts string) ([]agent.AgentProfile, error) {
+	profiles := make([]agent.AgentProfile, 0, len(cfg.Agents))
+	for _, ac := range cfg.Agents {
+		namespace := ac.MemoryNamespace
+		if namespace == "" {
+			namespace = ac.ID
+		}
+
+		soulDef := defaultSoul
+		if ac.Soul != "" {
+			var err error
+			soulDef, err = soul.Load(ac.Soul)
+			if err != nil {
+				return nil, fmt.Errorf("loading soul for agent %q: %w", ac.ID, err)
+			}
+		}
+		if err := soulDef.SeedMemory(ctx, deps.mem, namespace); err != nil {
+			logger.Warn("soul memory seeding had errors",
+				slog.String("agent", ac.ID),
+				slog.String("err", err.Error()),
+			)
+		}
+
+		extraPrompt := ac.SystemPrompt
+		if extraPrompt == "" {
+			extraPrompt = cfg.Agent.SystemPrompt
+		}
+
+		profile := agent.AgentProfile{
+			ID:              ac.ID,
+			Model:           ac.Model,
+			SystemPrompt:    composeSystemPrompt(soulDef, extraPrompt, skillPrompts),
+			Tools:           ac.Tools,
+			ToolOverrides:   []tools.Tool{&tools.SoulTool{Soul: soulDef}},
+			MemoryNamespace: namespace,
+		}
+
+		if agentCfg, ok := agentProviderConfig(cfg, ac); ok {
+			provider, err := createProvider(agentCfg, logger)
+			if err != nil {
+				return nil, fmt.Errorf("creating LLM provider for agent %q: %w", ac.ID, err)
+			}
+			profile.Provider = provider
+		}
+
+		if ac.Sandbox != nil {
+			agentCfg := *cfg
+			agentCfg.Sandbox = mergeSandbox(cfg.Sandbox, *ac.Sandbox)
+			policy := buildDefaultPolicy(&agentCfg)
+			profile.Policy = &policy
+		}
+
+		profiles = append(profiles, profile)
+		logger.Info("agent profile loaded",
+			slog.String("agent", ac.ID),
+			slog.String("soul", soulDef.Identity.Name),
+			slog.String("model", agentModel(cfg, ac)),
+			slog.Int("tools", len(ac.Tools)),
+		)
+	}
+	return profiles, nil
+}
+
+// agentProviderConfig returns cfg with the agent's provider settings applied,
+// or false when the agent uses the default provider.
+func agentProviderConfig(cfg *config.Config, ac config.AgentProfileConfig) (*config.Config, bool) {
+	if ac.Model == "" && ac.APIKeyEnv == "" && ac.BaseURL == "" && ac.AuthHeader == "" {
+		return nil, false
+	}
+	agentCfg := *cfg
+	if ac.Model != "" {
+		agentCfg.Agent.Model = ac.Model
+	}
+	if ac.APIKeyEnv != "" {
+		agentCfg.Agent.APIKeyEnv = ac.APIKeyEnv
+	}
+	if ac.BaseURL != "" {
+		agentCfg.Agent.BaseURL = ac.BaseURL
+	}
+	if ac.AuthHeader != "" {
+		agentCfg.Agent.AuthHeader = ac.AuthHeader
+	}
+	return &agentCfg, true
+}
+
+// mergeSandbox overlays the policy fields an agent's [agents.sandbox] sets
+// on the global [sandbox] section. The mode is always the global one.
+func mergeSandbox(base, override config.SandboxConfig) config.SandboxConfig {
+	if override.NetworkPolicy != "" {
+		base.NetworkPolicy = override.NetworkPolicy
+	}
+	if override.MaxTimeout != "" {
+		base.MaxTimeout = override.MaxTimeout
+	}
+	if override.AllowedPaths != nil {
+		base.AllowedPaths = override.AllowedPaths
+	}
+	if override.ReadOnlyPaths != nil {
+		base.ReadOnlyPaths = override.ReadOnlyPaths
+	}
+	return base
+}
+
+func agentModel(cfg *config.Config, ac config.AgentProfileConfig) string {
+	if ac.Model != "" {
+		return ac.Model
+	}
+	return cfg.Agent.Model
+}
+
+func buildRoutes(routes []config.RouteConfig) []agent.Route {
+	out := make([]agent.Route, 0, len(routes))
+	for _, r := range routes {
+		out = append(out, agent.Route{
+			Agent:   r.Agent,
+			Channel: r.Channel,
+			Chat:    r.Chat,
+			Peer:    r.Peer,
+		})
+	}
+	return out
+}
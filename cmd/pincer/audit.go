@@ -3,12 +3,10 @@ package pincer
 import (
 	"context"
 	"fmt"
-	"path/filepath"
 	"time"
 
 	"github.com/igorsilveira/pincer/pkg/audit"
 	"github.com/igorsilveira/pincer/pkg/config"
-	"github.com/igorsilveira/pincer/pkg/store"
 	"github.com/spf13/cobra"
 )
 
@@ -37,15 +35,9 @@ func init() {
 }
 
 func runAudit(cmd *cobra.Command, args []string) error {
-	cfg := config.Current()
-	dsn := cfg.Store.DSN
-	if dsn == "" {
-		dsn = filepath.Join(config.DataDir(), "pincer.db")
-	}
-
-	db, err := store.New(dsn)
+	db, err := openStore(config.Current())
 	if err != nil {
-		return fmt.Errorf("opening store: %w", err)
+		return err
 	}
 	defer db.Close()
 
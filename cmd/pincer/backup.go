@@ -1,184 +1,236 @@
 package pincer
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"context"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
+	"filippo.io/age"
+	"github.com/charmbracelet/huh"
+	"github.com/igorsilveira/pincer/pkg/backup"
 	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/store"
 	"github.com/spf13/cobra"
 )
 
 var backupCmd = &cobra.Command{
 	Use:   "backup [output-path]",
 	Short: "Snapshot the Pincer data directory to a tarball",
+	Long: `Write a gzipped tarball of the data directory. The SQLite database is
+copied with VACUUM INTO, so it is safe to back up while the gateway is
+running. The archive includes a manifest with checksums and the schema
+version.
+
+The archive is encrypted with age when [backup] lists recipients, when
+--recipient is given, or when the passphrase variable (default
+PINCER_BACKUP_PASSPHRASE) is set.`,
 	Example: `  pincer backup
-  pincer backup ~/backups/pincer-2025.tar.gz`,
+  pincer backup ~/backups/pincer-2025.tar.gz
+  pincer backup --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runBackup,
 }
 
 var restoreCmd = &cobra.Command{
-	Use:     "restore <backup-path>",
-	Short:   "Restore Pincer state from a backup tarball",
-	Example: "  pincer restore pincer-backup-20250101-120000.tar.gz",
-	Args:    cobra.ExactArgs(1),
-	RunE:    runRestore,
+	Use:   "restore <backup-path>",
+	Short: "Restore Pincer state from a backup tarball",
+	Long: `Verify a backup against its manifest and restore it into the data
+directory. Backups whose database schema is newer than this version of
+pincer are refused. Stop the gateway before restoring.`,
+	Example: `  pincer restore pincer-backup-20250101-120000.tar.gz
+  pincer restore --identity ~/.config/pincer/backup.key pincer-backup-20250101-120000.tar.gz.age
+  pincer restore --dry-run pincer-backup-20250101-120000.tar.gz`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
 }
 
-func runBackup(cmd *cobra.Command, args []string) error {
-	dataDir := config.DataDir()
-	if _, err := os.Stat(dataDir); err != nil {
-		return fmt.Errorf("data directory %s does not exist", dataDir)
-	}
+var (
+	backupRecipients []string
+	restoreIdentity  string
+	restoreDryRun    bool
+)
 
-	outPath := ""
-	if len(args) > 0 {
-		outPath = args[0]
-	} else {
-		outPath = fmt.Sprintf("pincer-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
-	}
+func init() {
+	backupCmd.Flags().StringArrayVar(&backupRecipients, "recipient", nil, "age public key to encrypt to (repeatable)")
+	restoreCmd.Flags().StringVar(&restoreIdentity, "identity", "", "age identity file for encrypted backups")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "verify the backup without restoring it")
+}
 
-	f, err := os.Create(outPath)
+// backupOptions describes a backup of the data directory and db. db may be
+// nil when there is no database yet.
+func backupOptions(cfg *config.Config, db *store.Store, extraRecipients []string) (backup.Options, error) {
+	recipients, err := parseBackupRecipients(cfg.Backup, extraRecipients)
 	if err != nil {
-		return fmt.Errorf("creating backup file: %w", err)
+		return backup.Options{}, err
 	}
-	defer f.Close()
-
-	gw := gzip.NewWriter(f)
-	defer gw.Close()
-
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+	opts := backup.Options{
+		DataDir:       config.DataDir(),
+		Store:         db,
+		Exclude:       []string{cfg.Backup.Dir},
+		Recipients:    recipients,
+		PincerVersion: version,
+	}
+	if db != nil && db.Driver() == store.DriverSQLite {
+		opts.DBPath = cfg.Store.ResolvedDSN()
+	}
+	return opts, nil
+}
 
-	count := 0
-	err = filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+func parseBackupRecipients(cfg config.BackupConfig, extra []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, r := range append(append([]string{}, cfg.Recipients...), extra...) {
+		rec, err := age.ParseX25519Recipient(r)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("backup recipient %q: %w", r, err)
 		}
-
-		if strings.HasSuffix(path, "-wal") || strings.HasSuffix(path, "-shm") {
-			return nil
+		recipients = append(recipients, rec)
+	}
+	// age does not allow a passphrase alongside public keys.
+	if len(recipients) == 0 && cfg.PassphraseEnv != "" {
+		if pass := os.Getenv(cfg.PassphraseEnv); pass != "" {
+			rec, err := age.NewScryptRecipient(pass)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, rec)
 		}
+	}
+	return recipients, nil
+}
 
-		relPath, err := filepath.Rel(dataDir, path)
+// backupIdentities returns the identities needed to read archive, prompting
+// for a passphrase when the archive is encrypted and none is configured.
+func backupIdentities(cfg config.BackupConfig, identityFile, archive string) ([]age.Identity, error) {
+	encrypted, err := backup.IsEncrypted(archive)
+	if err != nil || !encrypted {
+		return nil, err
+	}
+
+	var ids []age.Identity
+	if identityFile == "" {
+		identityFile = cfg.IdentityFile
+	}
+	if identityFile != "" {
+		f, err := os.Open(identityFile)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("opening identity file: %w", err)
 		}
-
-		header, err := tar.FileInfoHeader(info, "")
+		defer f.Close()
+		parsed, err := age.ParseIdentities(f)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("reading identity file: %w", err)
 		}
-		header.Name = filepath.Join("pincer-data", relPath)
+		ids = append(ids, parsed...)
+	}
 
-		if err := tw.WriteHeader(header); err != nil {
-			return err
+	pass := ""
+	if cfg.PassphraseEnv != "" {
+		pass = os.Getenv(cfg.PassphraseEnv)
+	}
+	if pass == "" && len(ids) == 0 {
+		err := huh.NewInput().
+			Title("Backup passphrase").
+			EchoMode(huh.EchoModePassword).
+			Value(&pass).
+			Run()
+		if err != nil {
+			return nil, fmt.Errorf("%w: pass --identity or set %s", backup.ErrEncrypted, cfg.PassphraseEnv)
 		}
-
-		if info.IsDir() {
-			return nil
+	}
+	if pass != "" {
+		id, err := age.NewScryptIdentity(pass)
+		if err != nil {
+			return nil, err
 		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func runBackup(cmd *cobra.Command, args []string) error {
+	dataDir := config.DataDir()
+	if _, err := os.Stat(dataDir); err != nil {
+		return fmt.Errorf("data directory %s does not exist", dataDir)
+	}
 
-		file, err := os.Open(path)
+	cfg := config.Current()
+	var db *store.Store
+	if cfg.Store.Driver == store.DriverPostgres {
+		fmt.Println("Note: the postgres database is not part of the archive; back it up with pg_dump.")
+	}
+	if _, err := os.Stat(cfg.Store.ResolvedDSN()); err == nil || cfg.Store.Driver == store.DriverPostgres {
+		var err error
+		db, err = openUnmigratedStore(cfg)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
+		defer db.Close()
+	}
 
-		if _, err := io.Copy(tw, file); err != nil {
-			return err
-		}
+	opts, err := backupOptions(cfg, db, backupRecipients)
+	if err != nil {
+		return err
+	}
 
-		count++
-		return nil
-	})
+	outPath := ""
+	if len(args) > 0 {
+		outPath = args[0]
+	} else {
+		outPath = backup.FileName(time.Now(), len(opts.Recipients) > 0)
+	}
 
+	f, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
+		return fmt.Errorf("creating backup file: %w", err)
+	}
+	manifest, err := backup.Write(context.Background(), f, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
 		return fmt.Errorf("creating backup: %w", err)
 	}
 
-	fmt.Printf("Backup created: %s (%d files)\n", outPath, count)
+	fmt.Printf("Backup created: %s (%d files, schema version %d", outPath, len(manifest.Files), manifest.SchemaVersion)
+	if len(opts.Recipients) > 0 {
+		fmt.Print(", encrypted")
+	}
+	fmt.Println(")")
 	return nil
 }
 
 func runRestore(cmd *cobra.Command, args []string) error {
 	backupPath := args[0]
 	dataDir := config.DataDir()
+	cfg := config.Current()
 
-	f, err := os.Open(backupPath)
+	ids, err := backupIdentities(cfg.Backup, restoreIdentity, backupPath)
 	if err != nil {
-		return fmt.Errorf("opening backup: %w", err)
+		return err
 	}
-	defer f.Close()
 
-	gr, err := gzip.NewReader(f)
+	report, err := backup.Inspect(context.Background(), backupPath, ids)
 	if err != nil {
-		return fmt.Errorf("reading gzip: %w", err)
+		return err
 	}
-	defer gr.Close()
-
-	tr := tar.NewReader(gr)
-
-	if err := os.MkdirAll(dataDir, 0700); err != nil {
-		return fmt.Errorf("creating data directory: %w", err)
+	if m := report.Manifest; m != nil {
+		fmt.Printf("Backup from %s (pincer %s), %d files verified, schema version %d (latest %d)\n",
+			m.CreatedAt.Local().Format("2006-01-02 15:04:05"), m.PincerVersion, report.Files,
+			report.SchemaVersion, store.LatestSchemaVersion())
+	} else {
+		fmt.Printf("Backup has no manifest; checksums not verified. Schema version %d (latest %d)\n",
+			report.SchemaVersion, store.LatestSchemaVersion())
 	}
-
-	count := 0
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("reading tar: %w", err)
-		}
-
-		relPath := header.Name
-		if idx := strings.Index(relPath, "/"); idx != -1 {
-			relPath = relPath[idx+1:]
-		}
-		if relPath == "" || relPath == "." {
-			continue
-		}
-
-		targetPath := filepath.Join(dataDir, filepath.Clean(relPath))
-
-		cleanTarget := filepath.Clean(targetPath)
-		cleanBase := filepath.Clean(dataDir) + string(filepath.Separator)
-		if !strings.HasPrefix(cleanTarget, cleanBase) && cleanTarget != filepath.Clean(dataDir) {
-			return fmt.Errorf("invalid path in backup: %s", header.Name)
-		}
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(targetPath, 0700); err != nil {
-				return fmt.Errorf("creating directory %s: %w", targetPath, err)
-			}
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0700); err != nil {
-				return err
-			}
-			mode := os.FileMode(header.Mode & 0o777)
-			outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
-			if err != nil {
-				return fmt.Errorf("creating file %s: %w", targetPath, err)
-			}
-			const maxFileSize = 512 * 1024 * 1024
-			if _, err := io.Copy(outFile, io.LimitReader(tr, maxFileSize)); err != nil {
-				outFile.Close()
-				return fmt.Errorf("writing file %s: %w", targetPath, err)
-			}
-			outFile.Close()
-			count++
-		}
+	if restoreDryRun {
+		return nil
 	}
 
+	count, err := backup.Restore(backupPath, ids, dataDir)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Restored %d files to %s\n", count, dataDir)
 	return nil
 }
@@ -0,0 +1,203 @@
+package pincer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/credentials"
+	"github.com/igorsilveira/pincer/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage credential scopes and the master key",
+	Long: `Tools use stored credentials through {{cred:NAME}} placeholders, which are
+resolved at execution time so the value never reaches the model. Scopes
+restrict which consumers may resolve a credential: tool:NAME, mcp:SERVER or
+skill:NAME, which admits the tools that skill declares. A credential without
+scopes is available to all of them.`,
+	Example: `  pincer credentials list
+  pincer credentials scope github tool:http_request mcp:github
+  pincer credentials scope github --clear
+  PINCER_NEW_MASTER_KEY=... pincer credentials rotate-master`,
+}
+
+var credentialsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List credential names and scopes",
+	Args:  cobra.NoArgs,
+	RunE:  runCredentialsList,
+}
+
+var credentialsScopeCmd = &cobra.Command{
+	Use:   "scope <name> [scope...]",
+	Short: "Restrict which tools, skills or MCP servers may use a credential",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runCredentialsScope,
+}
+
+var credentialsRotateCmd = &cobra.Command{
+	Use:   "rotate-master",
+	Short: "Re-encrypt all credentials under a new master key",
+	Long: `Decrypt every credential with the current master key and re-encrypt it
+under a new one with a fresh random salt, in a single transaction. The new
+key is read from --new-key-env or prompted for. Stop the gateway first and
+update the master key variable before starting it again.`,
+	Args: cobra.NoArgs,
+	RunE: runCredentialsRotate,
+}
+
+var (
+	credentialsClear     bool
+	credentialsNewKeyEnv string
+	credentialsYes       bool
+)
+
+func init() {
+	credentialsScopeCmd.Flags().BoolVar(&credentialsClear, "clear", false, "remove all scopes")
+	credentialsRotateCmd.Flags().StringVar(&credentialsNewKeyEnv, "new-key-env", "PINCER_NEW_MASTER_KEY", "environment variable holding the new master key")
+	credentialsRotateCmd.Flags().BoolVarP(&credentialsYes, "yes", "y", false, "skip the confirmation prompt")
+
+	credentialsCmd.AddCommand(credentialsListCmd, credentialsScopeCmd, credentialsRotateCmd)
+}
+
+func masterKeyEnv(cfg *config.Config) string {
+	if cfg.Credentials.MasterKeyEnv != "" {
+		return cfg.Credentials.MasterKeyEnv
+	}
+	return "PINCER_MASTER_KEY"
+}
+
+// openCredentials opens the configured store and the credential store in it.
+func openCredentials(cfg *config.Config) (*store.Store, *credentials.Store, error) {
+	env := masterKeyEnv(cfg)
+	key := os.Getenv(env)
+	if key == "" {
+		return nil, nil, fmt.Errorf("%s is not set", env)
+	}
+	db, err := openStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	creds, err := credentials.New(db.DB(), key)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return db, creds, nil
+}
+
+func runCredentialsList(cmd *cobra.Command, args []string) error {
+	db, creds, err := openCredentials(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	entries, err := creds.Entries(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No credentials stored.")
+		return nil
+	}
+	for _, e := range entries {
+		scopes := "any"
+		if len(e.Scopes) > 0 {
+			scopes = strings.Join(e.Scopes, ",")
+		}
+		fmt.Printf("%-24s %-40s %s\n", e.Name, scopes, e.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func runCredentialsScope(cmd *cobra.Command, args []string) error {
+	name, scopes := args[0], args[1:]
+	if len(scopes) == 0 && !credentialsClear {
+		return fmt.Errorf("give at least one scope, or --clear to allow every consumer")
+	}
+	if len(scopes) > 0 && credentialsClear {
+		return fmt.Errorf("--clear does not take scopes")
+	}
+
+	db, creds, err := openCredentials(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := creds.SetScopes(context.Background(), name, scopes); err != nil {
+		return err
+	}
+	if len(scopes) == 0 {
+		fmt.Printf("%s is available to every consumer\n", name)
+	} else {
+		fmt.Printf("%s is restricted to %s\n", name, strings.Join(scopes, ", "))
+	}
+	return nil
+}
+
+func runCredentialsRotate(cmd *cobra.Command, args []string) error {
+	cfg := config.Current()
+	db, creds, err := openCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	newKey := ""
+	if credentialsNewKeyEnv != "" {
+		newKey = os.Getenv(credentialsNewKeyEnv)
+	}
+	if newKey == "" {
+		var confirm string
+		err := huh.NewForm(huh.NewGroup(
+			huh.NewInput().Title("New master key").EchoMode(huh.EchoModePassword).Value(&newKey),
+			huh.NewInput().Title("Repeat new master key").EchoMode(huh.EchoModePassword).Value(&confirm),
+		)).Run()
+		if err != nil {
+			return fmt.Errorf("reading new master key: set %s instead", credentialsNewKeyEnv)
+		}
+		if newKey != confirm {
+			return fmt.Errorf("master keys do not match")
+		}
+	}
+	if newKey == "" {
+		return fmt.Errorf("new master key must not be empty")
+	}
+	if newKey == os.Getenv(masterKeyEnv(cfg)) {
+		return fmt.Errorf("new master key is the same as the current one")
+	}
+
+	if !credentialsYes {
+		var confirmed bool
+		err := huh.NewConfirm().
+			Title("Re-encrypt all credentials under the new master key?").
+			Description("The gateway must be restarted with the new key afterwards.").
+			Affirmative("Rotate").
+			Negative("Cancel").
+			Value(&confirmed).
+			Run()
+		if err != nil && !errors.Is(err, huh.ErrUserAborted) {
+			return fmt.Errorf("running confirm: %w", err)
+		}
+		if !confirmed {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	n, err := creds.RotateMasterKey(context.Background(), newKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Re-encrypted %d credentials. Set %s to the new key before starting pincer.\n", n, masterKeyEnv(cfg))
+	return nil
+}
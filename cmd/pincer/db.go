@@ -0,0 +1,174 @@
+package pincer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/huh"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and change the database schema version",
+	Long: `Pincer applies pending schema migrations when the gateway starts and
+refuses to start against a schema newer than it understands. These commands
+show and change the schema version explicitly.`,
+	Example: `  pincer db status
+  pincer db migrate
+  pincer db rollback --to 1`,
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending migrations",
+	Args:  cobra.NoArgs,
+	RunE:  runDBStatus,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending migrations",
+	Args:  cobra.NoArgs,
+	RunE:  runDBMigrate,
+}
+
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Revert migrations down to an earlier version",
+	Long: `Revert applied migrations, newest first. Without --to, only the latest
+migration is reverted. Reverting can drop tables and the data in them; take a
+backup first.`,
+	Args: cobra.NoArgs,
+	RunE: runDBRollback,
+}
+
+var (
+	dbTarget int
+	dbYes    bool
+)
+
+func init() {
+	dbMigrateCmd.Flags().IntVar(&dbTarget, "to", 0, "migrate up to this version (default: latest)")
+	dbRollbackCmd.Flags().IntVar(&dbTarget, "to", -1, "roll back to this version (default: one step)")
+	dbRollbackCmd.Flags().BoolVarP(&dbYes, "yes", "y", false, "skip the confirmation prompt")
+
+	dbCmd.AddCommand(dbStatusCmd, dbMigrateCmd, dbRollbackCmd)
+}
+
+// openUnmigratedStore opens the configured store without applying
+// migrations, so that its schema can be inspected or changed explicitly.
+func openUnmigratedStore(cfg *config.Config) (*store.Store, error) {
+	opts, err := storeOptions(cfg.Store)
+	if err != nil {
+		return nil, err
+	}
+	opts.SkipMigrations = true
+	db, err := store.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	return db, nil
+}
+
+func runDBStatus(cmd *cobra.Command, args []string) error {
+	db, err := openUnmigratedStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	states, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("reading migrations: %w", err)
+	}
+
+	fmt.Printf("driver:  %s\n", db.Driver())
+	fmt.Printf("schema:  version %d (latest %d)\n\n", version, store.LatestSchemaVersion())
+	for _, st := range states {
+		status := "pending"
+		if st.Applied() {
+			status = "applied " + st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  %4d  %-28s %s\n", st.Version, st.Name, status)
+	}
+
+	if err := db.CheckSchema(ctx); err != nil {
+		fmt.Printf("\n%s; upgrade pincer before starting it against this database\n", err)
+	}
+	return nil
+}
+
+func runDBMigrate(cmd *cobra.Command, args []string) error {
+	db, err := openUnmigratedStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := db.Migrate(context.Background(), dbTarget)
+	for _, m := range applied {
+		fmt.Printf("applied %d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date.")
+	}
+	return nil
+}
+
+func runDBRollback(cmd *cobra.Command, args []string) error {
+	db, err := openUnmigratedStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	target := dbTarget
+	if target < 0 {
+		target = version - 1
+	}
+	if version == 0 || target >= version {
+		fmt.Printf("Nothing to roll back (schema at version %d).\n", version)
+		return nil
+	}
+
+	if !dbYes {
+		var confirmed bool
+		err := huh.NewConfirm().
+			Title(fmt.Sprintf("Roll back the schema from version %d to %d?", version, target)).
+			Description("Reverted migrations may drop tables and their data.").
+			Affirmative("Roll back").
+			Negative("Cancel").
+			Value(&confirmed).
+			Run()
+		if err != nil && !errors.Is(err, huh.ErrUserAborted) {
+			return fmt.Errorf("running confirm: %w", err)
+		}
+		if !confirmed {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	reverted, err := db.Rollback(ctx, target)
+	for _, m := range reverted {
+		fmt.Printf("reverted %d %s\n", m.Version, m.Name)
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package pincer
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/mcp"
+	"github.com/igorsilveira/pincer/pkg/store"
 	"github.com/spf13/cobra"
 )
 
@@ -17,9 +20,28 @@ var doctorCmd = &cobra.Command{
 	Use:   "doctor",
 	Short: "Diagnose issues with the Pincer installation",
 	Long: `Run diagnostic checks on your Pincer setup including config validation,
-API key detection, database status, container runtime, and gateway health.`,
-	Example: "  pincer doctor",
-	RunE:    runDoctor,
+API key detection, database status, container runtime, and gateway health.
+When the gateway is running with an auth token, the state of its MCP server
+connections is included.
+
+With --deep, doctor also makes live calls: a one-token request to each
+configured LLM provider, token validation for each enabled channel, a
+connect, list-tools and ping for each MCP server, a smoke exec in the container
+sandbox, a decrypt of every stored credential with the master key, and
+signature and static analysis checks of installed skills.`,
+	Example: `  pincer doctor
+  pincer doctor --deep --json`,
+	RunE: runDoctor,
+}
+
+var (
+	doctorDeep bool
+	doctorJSON bool
+)
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorDeep, "deep", false, "run live provider, channel, MCP, sandbox, credential and skill probes")
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "print results as JSON")
 }
 
 type checkResult struct {
@@ -28,10 +50,27 @@ type checkResult struct {
 	detail string
 }
 
+type doctorCheckJSON struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+type doctorReportJSON struct {
+	Version  string            `json:"version"`
+	Platform string            `json:"platform"`
+	Deep     bool              `json:"deep"`
+	Checks   []doctorCheckJSON `json:"checks"`
+	Passed   int               `json:"passed"`
+	Failed   int               `json:"failed"`
+}
+
 func runDoctor(cmd *cobra.Command, args []string) error {
-	fmt.Printf("Pincer Doctor v%s\n", version)
-	fmt.Printf("Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
-	fmt.Printf("Go: %s\n\n", runtime.Version())
+	if !doctorJSON {
+		fmt.Printf("Pincer Doctor v%s\n", version)
+		fmt.Printf("Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		fmt.Printf("Go: %s\n\n", runtime.Version())
+	}
 
 	checks := []checkResult{
 		checkDataDir(),
@@ -44,22 +83,51 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 		checkChrome(),
 		checkGatewayHealth(),
 	}
+	cfg := config.Current()
+	checks = append(checks, checkGatewayMCP(cfg, fmt.Sprintf("http://127.0.0.1:%d", cfg.Gateway.Port))...)
+	if doctorDeep {
+		checks = append(checks, deepChecks(cmd.Context(), config.Current())...)
+	}
 
 	passed, failed := 0, 0
 	for _, c := range checks {
-		status := "✓"
-		if !c.ok {
-			status = "✗"
-			failed++
-		} else {
+		if c.ok {
 			passed++
+		} else {
+			failed++
 		}
-		fmt.Printf("  %s %s: %s\n", status, c.name, c.detail)
 	}
 
-	fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+	if doctorJSON {
+		report := doctorReportJSON{
+			Version:  version,
+			Platform: runtime.GOOS + "/" + runtime.GOARCH,
+			Deep:     doctorDeep,
+			Checks:   make([]doctorCheckJSON, 0, len(checks)),
+			Passed:   passed,
+			Failed:   failed,
+		}
+		for _, c := range checks {
+			report.Checks = append(report.Checks, doctorCheckJSON{Name: c.name, OK: c.ok, Detail: c.detail})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range checks {
+			status := "✓"
+			if !c.ok {
+				status = "✗"
+			}
+			fmt.Printf("  %s %s: %s\n", status, c.name, c.detail)
+		}
+		fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+	}
 
 	if failed > 0 {
+		cmd.SilenceUsage = true
 		return fmt.Errorf("%d checks failed", failed)
 	}
 	return nil
@@ -91,6 +159,14 @@ func checkConfig() checkResult {
 
 func checkDatabase() checkResult {
 	cfg := config.Current()
+	if cfg.Store.Driver == store.DriverPostgres {
+		db, err := openStore(cfg)
+		if err != nil {
+			return checkResult{"Database", false, fmt.Sprintf("postgres: %s", err)}
+		}
+		defer db.Close()
+		return checkResult{"Database", true, "postgres (connected)"}
+	}
 	dsn := cfg.Store.DSN
 	if dsn == "" {
 		dsn = filepath.Join(config.DataDir(), "pincer.db")
@@ -170,3 +246,48 @@ func checkGatewayHealth() checkResult {
 	}
 	return checkResult{"Gateway", false, fmt.Sprintf("unhealthy (status %d)", resp.StatusCode)}
 }
+
+// checkGatewayMCP reports the running gateway's MCP connections. It reads
+// them from the admin API, so it needs the gateway auth token; without one,
+// or with no gateway running, it reports nothing.
+func checkGatewayMCP(cfg *config.Config, baseURL string) []checkResult {
+	if !cfg.MCP.Enabled || cfg.Gateway.AuthToken == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/api/v1/mcp", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.Gateway.AuthToken)
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return []checkResult{{"MCP servers (gateway)", false, "no MCP server connected"}}
+	default:
+		return []checkResult{{"MCP servers (gateway)", false, fmt.Sprintf("status %d", resp.StatusCode)}}
+	}
+	var body struct {
+		Servers []mcp.ServerStatus `json:"servers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return []checkResult{{"MCP servers (gateway)", false, err.Error()}}
+	}
+
+	var checks []checkResult
+	for _, s := range body.Servers {
+		name := fmt.Sprintf("MCP %s (gateway)", s.Name)
+		if s.State == mcp.StateConnected {
+			checks = append(checks, checkResult{name, true, fmt.Sprintf("connected, %d tools, %d reconnects", s.Tools, s.Reconnects)})
+			continue
+		}
+		checks = append(checks, checkResult{name, false, fmt.Sprintf("%s for %s: %s", s.State, time.Since(s.Since).Round(time.Second), s.LastError)})
+	}
+	return checks
+}
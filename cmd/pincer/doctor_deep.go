@@ -0,0 +1,252 @@
+package pincer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/credentials"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/mcp"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+	"github.com/igorsilveira/pincer/pkg/skills"
+	"github.com/igorsilveira/pincer/pkg/store"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	probeTimeout     = 20 * time.Second
+	containerTimeout = 2 * time.Minute
+)
+
+// deepChecks actively exercises everything the config enables: providers,
+// channel tokens, MCP servers, the container sandbox, the credential master
+// key and installed skills. Probes for features that are not configured are
+// left out.
+func deepChecks(ctx context.Context, cfg *config.Config) []checkResult {
+	logger := slog.New(slog.DiscardHandler)
+
+	var checks []checkResult
+	checks = append(checks, checkProvider(ctx, "LLM provider", cfg, logger))
+	for _, ac := range cfg.Agents {
+		if agentCfg, ok := agentProviderConfig(cfg, ac); ok {
+			checks = append(checks, checkProvider(ctx, fmt.Sprintf("LLM provider (agent %s)", ac.ID), agentCfg, logger))
+		}
+	}
+	checks = append(checks, checkChannels(ctx, cfg)...)
+
+	creds, closeCreds, credCheck := checkCredentials(ctx, cfg)
+	defer closeCreds()
+	if credCheck != nil {
+		checks = append(checks, *credCheck)
+	}
+	checks = append(checks, checkMCPServers(ctx, cfg, creds, logger)...)
+	if cfg.Sandbox.Mode == "container" {
+		checks = append(checks, checkContainerSandbox(ctx, cfg))
+	}
+	checks = append(checks, checkSkills(cfg)...)
+	return checks
+}
+
+// checkProvider sends a one-token request, which fails fast on a bad key,
+// an unknown model or an unreachable endpoint.
+func checkProvider(ctx context.Context, name string, cfg *config.Config, logger *slog.Logger) checkResult {
+	model := cfg.Agent.Model
+	provider, err := createProvider(cfg, logger)
+	if err != nil {
+		return checkResult{name, false, err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	events, err := provider.Chat(ctx, llm.ChatRequest{
+		Model:     model,
+		Messages:  []llm.ChatMessage{{Role: llm.RoleUser, Content: "ping"}},
+		MaxTokens: 1,
+	})
+	if err != nil {
+		return checkResult{name, false, fmt.Sprintf("%s %s: %s", provider.Name(), model, err)}
+	}
+	for ev := range events {
+		if ev.Type == llm.EventError && ev.Error != nil {
+			return checkResult{name, false, fmt.Sprintf("%s %s: %s", provider.Name(), model, ev.Error)}
+		}
+	}
+	if ctx.Err() != nil {
+		return checkResult{name, false, fmt.Sprintf("%s %s: %s", provider.Name(), model, ctx.Err())}
+	}
+	return checkResult{name, true, fmt.Sprintf("%s %s (%s)", provider.Name(), model, time.Since(start).Round(time.Millisecond))}
+}
+
+func checkChannels(ctx context.Context, cfg *config.Config) []checkResult {
+	var checks []checkResult
+	for _, e := range adapterEntries() {
+		if !adapterWanted(cfg, e) {
+			continue
+		}
+		name := "Channel " + e.name
+		a, err := e.create(cfg)
+		if err != nil {
+			checks = append(checks, checkResult{name, false, err.Error()})
+			continue
+		}
+		v, ok := a.(channels.Verifier)
+		if !ok {
+			checks = append(checks, checkResult{name, true, "configured (no token to validate)"})
+			continue
+		}
+		pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+		account, err := v.Verify(pctx)
+		cancel()
+		if err != nil {
+			checks = append(checks, checkResult{name, false, err.Error()})
+			continue
+		}
+		checks = append(checks, checkResult{name, true, "authenticated as " + account})
+	}
+	return checks
+}
+
+// checkCredentials decrypts every stored credential with the master key,
+// opening the store read-only so the check never records key parameters. It
+// returns the credential store for resolving MCP env placeholders, or nil
+// when the master key is not set.
+func checkCredentials(ctx context.Context, cfg *config.Config) (*credentials.Store, func(), *checkResult) {
+	const name = "Credential master key"
+	noop := func() {}
+	env := masterKeyEnv(cfg)
+	key := os.Getenv(env)
+	if key == "" {
+		return nil, noop, nil
+	}
+
+	if cfg.Store.Driver != store.DriverPostgres {
+		if _, err := os.Stat(cfg.Store.ResolvedDSN()); err != nil {
+			return nil, noop, &checkResult{name, true, env + " set; no database yet"}
+		}
+	}
+	db, err := openUnmigratedStore(cfg)
+	if err != nil {
+		return nil, noop, &checkResult{name, false, err.Error()}
+	}
+	closeDB := func() { db.Close() }
+	creds, err := credentials.NewReadOnly(db.DB(), key)
+	if err != nil {
+		return nil, closeDB, &checkResult{name, false, err.Error()}
+	}
+	names, err := creds.List(ctx)
+	if err != nil {
+		return nil, closeDB, &checkResult{name, false, err.Error()}
+	}
+	for _, n := range names {
+		if _, err := creds.Get(ctx, n); err != nil {
+			return creds, closeDB, &checkResult{name, false, err.Error()}
+		}
+	}
+	return creds, closeDB, &checkResult{name, true, fmt.Sprintf("%s decrypts %d credentials", env, len(names))}
+}
+
+func checkMCPServers(ctx context.Context, cfg *config.Config, creds *credentials.Store, logger *slog.Logger) []checkResult {
+	if !cfg.MCP.Enabled {
+		return nil
+	}
+	var checks []checkResult
+	for _, srv := range cfg.MCP.Servers {
+		if srv.Enabled != nil && !*srv.Enabled {
+			continue
+		}
+		name := "MCP " + srv.Name
+		serverCfg, err := mcpServerConfig(ctx, cfg, creds, srv)
+		if err != nil {
+			checks = append(checks, checkResult{name, false, err.Error()})
+			continue
+		}
+
+		mgr := mcp.NewManager(logger)
+		pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+		mcpTools, err := mgr.Connect(pctx, serverCfg)
+		var latency time.Duration
+		if err == nil {
+			var sess *mcpsdk.ClientSession
+			if sess, err = mgr.Session(srv.Name); err == nil {
+				start := time.Now()
+				if err = sess.Ping(pctx, nil); err != nil {
+					err = fmt.Errorf("ping: %w", err)
+				}
+				latency = time.Since(start)
+			}
+		}
+		cancel()
+		mgr.DisconnectAll()
+		if err != nil {
+			checks = append(checks, checkResult{name, false, err.Error()})
+			continue
+		}
+		checks = append(checks, checkResult{name, true, fmt.Sprintf("%d tools, ping %s", len(mcpTools), latency.Round(time.Millisecond))})
+	}
+	return checks
+}
+
+func checkContainerSandbox(ctx context.Context, cfg *config.Config) checkResult {
+	const name = "Container sandbox"
+	sb, err := createSandbox(cfg)
+	if err != nil {
+		return checkResult{name, false, err.Error()}
+	}
+	policy := buildDefaultPolicy(cfg)
+	policy.Timeout = containerTimeout
+
+	start := time.Now()
+	res, err := sb.Exec(ctx, sandbox.Command{Name: "doctor", Program: "echo", Args: []string{"ok"}}, policy)
+	if err != nil {
+		return checkResult{name, false, err.Error()}
+	}
+	if res.ExitCode != 0 || strings.TrimSpace(res.Stdout) != "ok" {
+		detail := fmt.Sprintf("exit code %d", res.ExitCode)
+		if msg := strings.TrimSpace(res.Stderr + " " + res.Error); msg != "" {
+			detail += ": " + msg
+		}
+		return checkResult{name, false, detail}
+	}
+	return checkResult{name, true, fmt.Sprintf("smoke exec ok (%s)", time.Since(start).Round(time.Millisecond))}
+}
+
+// checkSkills reports the signature and static analysis status of each
+// skill, failing skills the engine would refuse to load.
+func checkSkills(cfg *config.Config) []checkResult {
+	if cfg.Skills.Dir == "" {
+		return nil
+	}
+	loaded, err := skills.LoadDir(cfg.Skills.Dir)
+	if err != nil {
+		return []checkResult{{"Skills", false, err.Error()}}
+	}
+
+	var checks []checkResult
+	for _, sk := range loaded {
+		// The engine has no trusted keys configured, so no signature can
+		// verify and unsigned skills load only with allow_unsigned.
+		sig := "unsigned"
+		if sk.Signature != "" {
+			sig = "signature not trusted"
+		}
+		if cfg.Skills.AllowUnsigned {
+			sig += " (allowed)"
+		} else {
+			sig += " (refused; set skills.allow_unsigned)"
+		}
+		details := []string{sig}
+		res := skills.Scan(sk)
+		for _, f := range res.Findings {
+			details = append(details, f.Rule+": "+f.Message)
+		}
+		checks = append(checks, checkResult{"Skill " + sk.Name, cfg.Skills.AllowUnsigned && res.Safe, strings.Join(details, "; ")})
+	}
+	return checks
+}
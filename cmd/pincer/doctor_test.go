@@ -0,0 +1,99 @@
+package pincer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/config"
+)
+
+func TestCheckProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"authentication_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"p"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{Agent: config.AgentConfig{Model: "claude-test", APIKeyEnv: "DOCTOR_TEST_KEY", BaseURL: srv.URL, AuthHeader: "x-api-key"}}
+
+	t.Setenv("DOCTOR_TEST_KEY", "good")
+	if c := checkProvider(context.Background(), "LLM provider", cfg, nil); !c.ok {
+		t.Errorf("valid key: %+v", c)
+	}
+
+	t.Setenv("DOCTOR_TEST_KEY", "revoked")
+	c := checkProvider(context.Background(), "LLM provider", cfg, nil)
+	if c.ok || !strings.Contains(c.detail, "401") {
+		t.Errorf("revoked key: %+v", c)
+	}
+}
+
+func TestCheckSkills(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("clean.json", `{"name":"clean","prompt":"Be concise."}`)
+	write("shady.json", `{"name":"shady","prompt":"#!/bin/sh\ncurl evil"}`)
+
+	cfg := &config.Config{Skills: config.SkillsConfig{Dir: dir, AllowUnsigned: true}}
+	got := map[string]checkResult{}
+	for _, c := range checkSkills(cfg) {
+		got[c.name] = c
+	}
+	if c := got["Skill clean"]; !c.ok {
+		t.Errorf("clean skill: %+v", c)
+	}
+	if c := got["Skill shady"]; c.ok || !strings.Contains(c.detail, "inline_script") {
+		t.Errorf("shady skill: %+v", c)
+	}
+
+	cfg.Skills.AllowUnsigned = false
+	for _, c := range checkSkills(cfg) {
+		if c.ok {
+			t.Errorf("%s passed although unsigned skills are refused", c.name)
+		}
+	}
+}
+
+func TestCheckGatewayMCP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/mcp" || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"servers":[
+			{"name":"github","state":"connected","tools":12,"reconnects":1},
+			{"name":"flaky","state":"reconnecting","since":"2026-01-01T00:00:00Z","last_error":"ping: timeout"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{MCP: config.MCPConfig{Enabled: true}, Gateway: config.GatewayConfig{AuthToken: "tok"}}
+	checks := checkGatewayMCP(cfg, srv.URL)
+	if len(checks) != 2 {
+		t.Fatalf("checks = %+v", checks)
+	}
+	if !checks[0].ok || checks[0].detail != "connected, 12 tools, 1 reconnects" {
+		t.Errorf("github = %+v", checks[0])
+	}
+	if checks[1].ok || !strings.HasSuffix(checks[1].detail, "ping: timeout") {
+		t.Errorf("flaky = %+v", checks[1])
+	}
+
+	cfg.Gateway.AuthToken = ""
+	if checks := checkGatewayMCP(cfg, srv.URL); len(checks) != 0 {
+		t.Errorf("without a token: %+v", checks)
+	}
+}
@@ -0,0 +1,157 @@
+package pincer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/eval"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval <suite>",
+	Short: "Run a suite of scripted conversations and check the agent's behaviour",
+	Long: `Run each conversation of a YAML or JSON suite through the agent, with
+the configured soul, skills and tools, and check the tool calls it makes, its
+replies, the memory it writes, its token usage and latency.
+
+Every case gets a fresh store in a temporary directory, removed when the case
+ends, and a stub sandbox: shell commands are not run but answered from the
+case's canned outputs. Tool approval is automatic. Give --model several times to compare models side by side; replay/
+models make the suite deterministic for CI.
+
+  name: basics
+  cases:
+    - name: remembers preferences
+      memory:              # seeded before the first turn
+        city: Lisbon
+      sandbox:             # regexp on the command line -> canned output
+        - match: "sh -c ls"
+          stdout: "notes.txt\n"
+      turns:
+        - say: My favourite colour is green, please remember it.
+          expect:
+            tool_calls:    # in order; other calls may come in between
+              - name: memory
+                input: '"colour"'
+            no_tool_calls: [shell]
+            text: (?i)green      # regexp on the final reply
+            not_text: (?i)sorry
+            judge: The reply confirms the colour was saved.
+            memory:
+              colour: green
+            max_tokens: 4000
+            max_latency: 30s
+
+judge expectations are answered by --judge-model, which defaults to the
+first model unless that is a replay/ or record/ model.`,
+	Example: `  pincer eval evals/basics.yaml
+  pincer eval evals/basics.yaml --model claude-sonnet-4-20250514 --model gpt-4o
+  pincer eval evals/basics.yaml --model replay/basics --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEval,
+}
+
+var (
+	evalModels     []string
+	evalJudgeModel string
+	evalJSON       bool
+)
+
+func init() {
+	evalCmd.Flags().StringArrayVar(&evalModels, "model", nil, "model to evaluate; repeat to compare models (default: agent.model)")
+	evalCmd.Flags().StringVar(&evalJudgeModel, "judge-model", "", "model answering judge expectations")
+	evalCmd.Flags().BoolVar(&evalJSON, "json", false, "print reports as JSON")
+}
+
+func runEval(cmd *cobra.Command, args []string) error {
+	cfg := config.Current()
+	suite, err := eval.LoadSuite(args[0])
+	if err != nil {
+		return err
+	}
+
+	models := evalModels
+	if len(models) == 0 {
+		models = []string{cfg.Agent.Model}
+	}
+	// The runtime logs through the default logger; keep the report readable.
+	logger := slog.New(slog.DiscardHandler)
+	slog.SetDefault(logger)
+
+	runner := &eval.Runner{
+		NewProvider: func(model string) (llm.Provider, error) {
+			return createProvider(evalConfig(cfg, model, ""), logger)
+		},
+	}
+	judgeModel := evalJudgeModel
+	if judgeModel == "" && !hasPrefix(models[0], "replay/") && !hasPrefix(models[0], "record/") {
+		judgeModel = models[0]
+	}
+	if judgeModel != "" {
+		judge, err := createProvider(evalConfig(cfg, judgeModel, ""), logger)
+		if err != nil {
+			return fmt.Errorf("creating judge provider: %w", err)
+		}
+		runner.Judge = &providerLLMChecker{provider: judge, model: judgeModel}
+	}
+
+	var reports []*eval.Report
+	for _, model := range models {
+		runner.NewRuntime = func(ctx context.Context, env *eval.Env, provider llm.Provider) (*agent.Runtime, error) {
+			auditLog, err := audit.New(env.Store.DB())
+			if err != nil {
+				return nil, err
+			}
+			deps := &storeDeps{db: env.Store, auditLog: auditLog, mem: env.Memory}
+			rt, _, _, _, err := assembleAgent(ctx, evalConfig(cfg, model, env.Dir), logger, deps, provider, env.Sandbox)
+			return rt, err
+		}
+		rep, err := runner.Run(cmd.Context(), suite, model)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, rep)
+	}
+
+	if evalJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else if err := eval.WriteReports(os.Stdout, reports); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range reports {
+		failed += r.Failed
+	}
+	if failed > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d eval cases failed", failed)
+	}
+	return nil
+}
+
+// evalConfig is the configuration of an eval run: the model under test,
+// automatic approval and a sandbox confined to the case's scratch directory.
+func evalConfig(cfg *config.Config, model, dir string) *config.Config {
+	c := *cfg
+	c.Agent.Model = model
+	c.Agent.ToolApproval = string(agent.ApprovalAuto)
+	c.Sandbox.NetworkPolicy = "deny"
+	if dir != "" {
+		c.Sandbox.AllowedPaths = []string{dir}
+		c.Sandbox.ReadOnlyPaths = nil
+	}
+	return &c
+}
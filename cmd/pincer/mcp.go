@@ -0,0 +1,134 @@
+package pincer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/mcp"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Use Pincer from MCP clients",
+	Long: `Pincer can act as an MCP server so that editors and other agent
+frameworks can use its sandboxed tools, talk to the agent and read its
+long-term memory.
+
+The server offers the agent's tools (shell, files, http, memory, browser and
+the like) under the configured sandbox and approval rules, a chat tool that
+runs a full agent turn, and memory entries as pincer://memory/<key>
+resources. Tools that need approval ask the client through elicitation and
+are denied when the client cannot answer.
+
+"pincer mcp serve" speaks MCP over stdio. A running gateway also serves
+streamable HTTP at /mcp when [mcp] serve is set, behind gateway.auth_token.`,
+}
+
+var mcpServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve Pincer's tools, chat and memory over stdio",
+	Long: `Serve Pincer as an MCP server on stdin and stdout. Logs go to stderr.
+
+Without --agent the agent is the one routed for the "mcp" channel.`,
+	Example: `  pincer mcp serve
+  pincer mcp serve --agent researcher
+
+  # In an MCP client configuration:
+  { "command": "pincer", "args": ["mcp", "serve"] }`,
+	Args: cobra.NoArgs,
+	RunE: runMCPServe,
+}
+
+var mcpServeAgent string
+
+func init() {
+	mcpServeCmd.Flags().StringVar(&mcpServeAgent, "agent", "", "agent whose tools, sessions and memory are served")
+
+	mcpCmd.AddCommand(mcpServeCmd)
+}
+
+func runMCPServe(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	path := cfgFile
+	if path == "" {
+		path = config.DefaultConfigPath()
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.EnsureDataDir(); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+
+	// stdout carries the protocol.
+	logger := telemetry.SetupLogger(cfg.Log.Level, cfg.Log.Format, os.Stderr)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ctx = telemetry.WithLogger(ctx, logger)
+
+	deps, err := initStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer deps.db.Close()
+
+	runtime, registry, approver, _, err := initAgent(ctx, cfg, logger, deps)
+	if err != nil {
+		return err
+	}
+	if mcpServeAgent != "" && !slices.Contains(runtime.Agents(), mcpServeAgent) {
+		return fmt.Errorf("unknown agent %q", mcpServeAgent)
+	}
+
+	mcpMgr := initMCPServers(ctx, cfg, logger, registry, deps.auditLog, deps.credStore)
+	if mcpMgr != nil {
+		defer mcpMgr.DisconnectAll()
+		runtime.SetCommands(&mcp.PromptCommands{Manager: mcpMgr})
+	}
+
+	registry.Register(&tools.SubagentTool{
+		RunSubturn: runtime.RunSubturn,
+		AuditLog:   audit.NewToolLogger(deps.auditLog, "subagent"),
+	})
+	if browserTool := initBrowserTool(ctx, cfg, logger, deps); browserTool != nil {
+		defer browserTool.Close()
+		registry.Register(browserTool)
+	}
+
+	serveCfg := mcpServeConfig(runtime, approver, deps, logger, mcpServeAgent)
+	logger.Info("serving mcp over stdio", slog.String("agent", serveCfg.AgentID))
+	if err := mcp.NewServer(serveCfg).Run(ctx, &mcpsdk.StdioTransport{}); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("mcp server: %w", err)
+	}
+	return nil
+}
+
+// mcpServeConfig configures the MCP server for agentID, or for the agent
+// routed for the mcp channel when it is empty.
+func mcpServeConfig(runtime *agent.Runtime, approver *agent.Approver, deps *storeDeps, logger *slog.Logger, agentID string) mcp.ServeConfig {
+	if agentID == "" {
+		agentID = runtime.AgentFor(mcp.ServeChannel, "", "")
+	}
+	return mcp.ServeConfig{
+		Runtime:  runtime,
+		Approver: approver,
+		Memory:   deps.mem,
+		AgentID:  agentID,
+		Version:  version,
+		Logger:   logger,
+	}
+}
@@ -39,7 +39,13 @@ func init() {
 	rootCmd.AddCommand(restoreCmd)
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(sessionsCmd)
+	rootCmd.AddCommand(storeCmd)
+	rootCmd.AddCommand(dbCmd)
+	rootCmd.AddCommand(credentialsCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(mcpCmd)
 }
 
 var versionCmd = &cobra.Command{
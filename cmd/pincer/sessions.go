@@ -0,0 +1,475 @@
+package pincer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/gateway"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/store"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List, inspect, export and fork conversations",
+	Long:  "Work with stored conversation sessions directly from the database.",
+	Example: `  pincer sessions list --channel telegram --since 2025-01-01
+  pincer sessions show tg-12345
+  pincer sessions export tg-12345 --format jsonl -o chat.jsonl
+  pincer sessions fork tg-12345`,
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sessions, most recently active first",
+	Args:  cobra.NoArgs,
+	RunE:  runSessionsList,
+}
+
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show <session-id>",
+	Short: "Print a session transcript including tool calls and results",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSessionsShow,
+}
+
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <session-id>",
+	Short: "Export a session as Markdown or JSONL",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSessionsExport,
+}
+
+var sessionsDeleteCmd = &cobra.Command{
+	Use:   "delete <session-id>",
+	Short: "Delete a session with its messages and checkpoints",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSessionsDelete,
+}
+
+var sessionsForkCmd = &cobra.Command{
+	Use:   "fork <session-id>",
+	Short: "Copy a session's history into a new session",
+	Long: `Copy the full message history of a session into a new session, leaving
+the original untouched. The fork is created on the api channel with an
+"api-" prefixed ID; continue it over the OpenAI-compatible API by sending
+that ID in the X-Pincer-Session header.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSessionsFork,
+}
+
+var (
+	sessionsChannel string
+	sessionsPeer    string
+	sessionsAgent   string
+	sessionsSince   string
+	sessionsUntil   string
+	sessionsLimit   int
+	sessionsFull    bool
+	sessionsFormat  string
+	sessionsOutput  string
+	sessionsYes     bool
+	sessionsForkID  string
+)
+
+const (
+	transcriptText     = "text"
+	transcriptMarkdown = "markdown"
+	transcriptJSONL    = "jsonl"
+
+	// showResultLimit caps tool results in `sessions show` unless --full.
+	showResultLimit = 500
+)
+
+func init() {
+	sessionsListCmd.Flags().StringVar(&sessionsChannel, "channel", "", "filter by channel")
+	sessionsListCmd.Flags().StringVar(&sessionsPeer, "peer", "", "filter by peer ID")
+	sessionsListCmd.Flags().StringVar(&sessionsAgent, "agent", "", "filter by agent ID")
+	sessionsListCmd.Flags().StringVar(&sessionsSince, "since", "", "active since (YYYY-MM-DD)")
+	sessionsListCmd.Flags().StringVar(&sessionsUntil, "until", "", "active until (YYYY-MM-DD, inclusive)")
+	sessionsListCmd.Flags().IntVar(&sessionsLimit, "limit", 50, "maximum number of sessions")
+
+	sessionsShowCmd.Flags().BoolVar(&sessionsFull, "full", false, "do not truncate tool results")
+
+	sessionsExportCmd.Flags().StringVar(&sessionsFormat, "format", transcriptMarkdown, "export format: markdown or jsonl")
+	sessionsExportCmd.Flags().StringVarP(&sessionsOutput, "output", "o", "", "write to file instead of stdout")
+
+	sessionsDeleteCmd.Flags().BoolVarP(&sessionsYes, "yes", "y", false, "skip the confirmation prompt")
+
+	sessionsForkCmd.Flags().StringVar(&sessionsForkID, "id", "", `ID for the new session, prefixed with "api-" (default: generated)`)
+
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsShowCmd, sessionsExportCmd, sessionsDeleteCmd, sessionsForkCmd)
+}
+
+func runSessionsList(cmd *cobra.Command, args []string) error {
+	filter := store.SessionFilter{
+		AgentID: sessionsAgent,
+		Channel: sessionsChannel,
+		PeerID:  sessionsPeer,
+		Limit:   sessionsLimit,
+	}
+	if sessionsSince != "" {
+		t, err := time.Parse("2006-01-02", sessionsSince)
+		if err != nil {
+			return fmt.Errorf("invalid --since format (use YYYY-MM-DD): %w", err)
+		}
+		filter.Since = t
+	}
+	if sessionsUntil != "" {
+		t, err := time.Parse("2006-01-02", sessionsUntil)
+		if err != nil {
+			return fmt.Errorf("invalid --until format (use YYYY-MM-DD): %w", err)
+		}
+		filter.Until = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	db, err := openStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	sessions, err := db.ListSessions(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("listing sessions: %w", err)
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sessions found.")
+		return nil
+	}
+
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	counts, err := db.MessageCounts(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("counting messages: %w", err)
+	}
+
+	fmt.Printf("%-36s %-10s %-10s %-20s %-19s %s\n", "ID", "AGENT", "CHANNEL", "PEER", "UPDATED", "MESSAGES")
+	for _, s := range sessions {
+		fmt.Printf("%-36s %-10s %-10s %-20s %-19s %d\n",
+			s.ID, s.AgentID, s.Channel, s.PeerID, s.UpdatedAt.Local().Format("2006-01-02 15:04:05"), counts[s.ID],
+		)
+	}
+
+	fmt.Printf("\n%d sessions\n", len(sessions))
+	return nil
+}
+
+func runSessionsShow(cmd *cobra.Command, args []string) error {
+	return printSession(args[0], transcriptText, os.Stdout)
+}
+
+func runSessionsExport(cmd *cobra.Command, args []string) error {
+	format := strings.ToLower(sessionsFormat)
+	if format == "md" {
+		format = transcriptMarkdown
+	}
+	if format != transcriptMarkdown && format != transcriptJSONL {
+		return fmt.Errorf("unknown format %q (use markdown or jsonl)", sessionsFormat)
+	}
+
+	if sessionsOutput == "" {
+		return printSession(args[0], format, os.Stdout)
+	}
+
+	f, err := os.Create(sessionsOutput)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	if err := printSession(args[0], format, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	fmt.Printf("exported %s to %s\n", args[0], sessionsOutput)
+	return nil
+}
+
+func printSession(id, format string, w io.Writer) error {
+	db, err := openStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	sess, err := db.GetSession(ctx, id)
+	if err != nil {
+		return sessionLookupError(id, err)
+	}
+	msgs, err := db.Messages(ctx, id)
+	if err != nil {
+		return fmt.Errorf("loading messages: %w", err)
+	}
+	return writeTranscript(w, sess, msgs, format, sessionsFull)
+}
+
+func runSessionsDelete(cmd *cobra.Command, args []string) error {
+	id := args[0]
+
+	db, err := openStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.GetSession(ctx, id); err != nil {
+		return sessionLookupError(id, err)
+	}
+	count, err := db.MessageCount(ctx, id)
+	if err != nil {
+		return fmt.Errorf("counting messages: %w", err)
+	}
+
+	if !sessionsYes {
+		var confirmed bool
+		err := huh.NewConfirm().
+			Title(fmt.Sprintf("Delete session %s?", id)).
+			Description(fmt.Sprintf("%d messages and all checkpoints will be removed.", count)).
+			Affirmative("Delete").
+			Negative("Cancel").
+			Value(&confirmed).
+			Run()
+		if err != nil && !errors.Is(err, huh.ErrUserAborted) {
+			return fmt.Errorf("running confirm: %w", err)
+		}
+		if !confirmed {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	if err := db.DeleteSession(ctx, id); err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	if err := os.RemoveAll(gateway.SessionAttachmentDir(id)); err != nil {
+		return fmt.Errorf("deleting attachments: %w", err)
+	}
+	fmt.Printf("deleted session %s (%d messages)\n", id, count)
+	return nil
+}
+
+func runSessionsFork(cmd *cobra.Command, args []string) error {
+	db, err := openStore(config.Current())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	fork, err := forkSession(ctx, db, args[0], sessionsForkID)
+	if err != nil {
+		return err
+	}
+	count, err := db.MessageCount(ctx, fork.ID)
+	if err != nil {
+		return fmt.Errorf("counting messages: %w", err)
+	}
+	fmt.Printf("forked %s into %s (%d messages)\n", args[0], fork.ID, count)
+	return nil
+}
+
+// forkSession copies srcID into a new session on the API channel, so the fork
+// can be continued over the OpenAI-compatible API. An empty newID is
+// generated.
+func forkSession(ctx context.Context, db *store.Store, srcID, newID string) (*store.Session, error) {
+	if newID == "" {
+		newID = "fork-" + uuid.NewString()[:8]
+	}
+	newID = gateway.APISessionID(newID)
+
+	if _, err := db.GetSession(ctx, newID); err == nil {
+		return nil, fmt.Errorf("session %s already exists", newID)
+	}
+	fork, err := db.ForkSession(ctx, srcID, newID)
+	if err != nil {
+		return nil, sessionLookupError(srcID, err)
+	}
+	if err := db.UpdateSessionChannel(ctx, fork.ID, gateway.APIChannel, fork.PeerID); err != nil {
+		return nil, fmt.Errorf("moving fork to the %s channel: %w", gateway.APIChannel, err)
+	}
+	fork.Channel = gateway.APIChannel
+	return fork, nil
+}
+
+func sessionLookupError(id string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("session %s not found", id)
+	}
+	return fmt.Errorf("loading session %s: %w", id, err)
+}
+
+// exportedMessage is one line of a JSONL export.
+type exportedMessage struct {
+	SessionID   string             `json:"session_id"`
+	ID          string             `json:"id"`
+	Role        string             `json:"role"`
+	ContentType string             `json:"content_type"`
+	Text        string             `json:"text,omitempty"`
+	ToolCalls   []llm.ToolCall     `json:"tool_calls,omitempty"`
+	ToolResults []llm.ToolResult   `json:"tool_results,omitempty"`
+	Images      []llm.ImageContent `json:"images,omitempty"`
+	TokenCount  int                `json:"token_count,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+func writeTranscript(w io.Writer, sess *store.Session, msgs []store.Message, format string, full bool) error {
+	switch format {
+	case transcriptJSONL:
+		enc := json.NewEncoder(w)
+		for _, m := range msgs {
+			decoded := agent.MessageToLLM(m)
+			if err := enc.Encode(exportedMessage{
+				SessionID:   m.SessionID,
+				ID:          m.ID,
+				Role:        m.Role,
+				ContentType: m.ContentType,
+				Text:        decoded.Content,
+				ToolCalls:   decoded.ToolCalls,
+				ToolResults: decoded.ToolResults,
+				Images:      decoded.Images,
+				TokenCount:  m.TokenCount,
+				CreatedAt:   m.CreatedAt,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case transcriptMarkdown:
+		return writeMarkdownTranscript(w, sess, msgs)
+	default:
+		return writeTextTranscript(w, sess, msgs, full)
+	}
+}
+
+func writeTextTranscript(w io.Writer, sess *store.Session, msgs []store.Message, full bool) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session %s  agent=%s channel=%s peer=%s\n", sess.ID, sess.AgentID, sess.Channel, sess.PeerID)
+	fmt.Fprintf(&b, "Created %s, updated %s, %d messages\n",
+		sess.CreatedAt.Local().Format(time.DateTime), sess.UpdatedAt.Local().Format(time.DateTime), len(msgs))
+
+	toolNames := make(map[string]string)
+	for _, m := range msgs {
+		decoded := agent.MessageToLLM(m)
+		ts := m.CreatedAt.Local().Format(time.DateTime)
+
+		switch {
+		case len(decoded.ToolCalls) > 0:
+			fmt.Fprintf(&b, "\n[%s] %s (tool calls):\n", ts, m.Role)
+			if decoded.Content != "" {
+				fmt.Fprintf(&b, "%s\n", decoded.Content)
+			}
+			for _, tc := range decoded.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				fmt.Fprintf(&b, "  -> %s %s\n", tc.Name, string(tc.Input))
+			}
+		case len(decoded.ToolResults) > 0:
+			fmt.Fprintf(&b, "\n[%s] tool results:\n", ts)
+			for _, tr := range decoded.ToolResults {
+				status := "ok"
+				if tr.IsError {
+					status = "error"
+				}
+				content := tr.Content
+				if !full && len(content) > showResultLimit {
+					content = content[:showResultLimit] + fmt.Sprintf("... (%d more bytes)", len(tr.Content)-showResultLimit)
+				}
+				fmt.Fprintf(&b, "  <- %s (%s): %s\n", toolName(toolNames, tr.ToolCallID), status, content)
+			}
+		default:
+			fmt.Fprintf(&b, "\n[%s] %s:\n%s\n", ts, m.Role, decoded.Content)
+			if len(decoded.Images) > 0 {
+				fmt.Fprintf(&b, "[%d image(s) attached]\n", len(decoded.Images))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownTranscript(w io.Writer, sess *store.Session, msgs []store.Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", sess.ID)
+	fmt.Fprintf(&b, "- Agent: %s\n- Channel: %s\n- Peer: %s\n- Created: %s\n- Updated: %s\n",
+		sess.AgentID, sess.Channel, sess.PeerID,
+		sess.CreatedAt.UTC().Format(time.RFC3339), sess.UpdatedAt.UTC().Format(time.RFC3339))
+
+	toolNames := make(map[string]string)
+	for _, m := range msgs {
+		decoded := agent.MessageToLLM(m)
+		ts := m.CreatedAt.UTC().Format(time.RFC3339)
+
+		switch {
+		case len(decoded.ToolCalls) > 0:
+			fmt.Fprintf(&b, "\n## %s: tool calls (%s)\n\n", m.Role, ts)
+			if decoded.Content != "" {
+				fmt.Fprintf(&b, "%s\n\n", decoded.Content)
+			}
+			for _, tc := range decoded.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				fence := markdownFence(string(tc.Input))
+				fmt.Fprintf(&b, "**%s**\n\n%sjson\n%s\n%s\n\n", tc.Name, fence, string(tc.Input), fence)
+			}
+		case len(decoded.ToolResults) > 0:
+			fmt.Fprintf(&b, "\n## tool results (%s)\n\n", ts)
+			for _, tr := range decoded.ToolResults {
+				label := toolName(toolNames, tr.ToolCallID)
+				if tr.IsError {
+					label += " (error)"
+				}
+				fence := markdownFence(tr.Content)
+				fmt.Fprintf(&b, "**%s**\n\n%s\n%s\n%s\n\n", label, fence, tr.Content, fence)
+			}
+		default:
+			fmt.Fprintf(&b, "\n## %s (%s)\n\n%s\n", m.Role, ts, decoded.Content)
+			if len(decoded.Images) > 0 {
+				fmt.Fprintf(&b, "\n_%d image(s) attached_\n", len(decoded.Images))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownFence returns a code fence longer than any backtick run in content,
+// so fences inside tool output cannot close the block early.
+func markdownFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func toolName(names map[string]string, callID string) string {
+	if name, ok := names[callID]; ok {
+		return name
+	}
+	return callID
+}
@@ -0,0 +1,148 @@
+package pincer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+func transcriptFixture() (*store.Session, []store.Message) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	sess := &store.Session{ID: "s-1", AgentID: "default", Channel: "telegram", PeerID: "42", CreatedAt: ts, UpdatedAt: ts}
+	msgs := []store.Message{
+		{ID: "1", SessionID: "s-1", Role: "user", ContentType: store.ContentTypeText, Content: "list files", CreatedAt: ts},
+		{ID: "2", SessionID: "s-1", Role: "assistant", ContentType: store.ContentTypeToolCalls,
+			Content: `{"tool_calls":[{"id":"call-1","name":"shell","input":{"cmd":"ls"}}]}`, CreatedAt: ts},
+		{ID: "3", SessionID: "s-1", Role: "user", ContentType: store.ContentTypeToolResults,
+			Content: `[{"tool_call_id":"call-1","content":"` + strings.Repeat("x", 600) + `"}]`, CreatedAt: ts},
+		{ID: "4", SessionID: "s-1", Role: "assistant", ContentType: store.ContentTypeText, Content: "done", CreatedAt: ts},
+	}
+	return sess, msgs
+}
+
+func TestWriteTranscriptText(t *testing.T) {
+	sess, msgs := transcriptFixture()
+
+	var b strings.Builder
+	if err := writeTranscript(&b, sess, msgs, transcriptText, false); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"list files", `-> shell {"cmd":"ls"}`, "<- shell (ok)", "(100 more bytes)", "done"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("transcript missing %q:\n%s", want, out)
+		}
+	}
+
+	b.Reset()
+	if err := writeTranscript(&b, sess, msgs, transcriptText, true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "more bytes") {
+		t.Error("full transcript truncated a tool result")
+	}
+}
+
+func TestWriteTranscriptMarkdown(t *testing.T) {
+	sess, msgs := transcriptFixture()
+
+	var b strings.Builder
+	if err := writeTranscript(&b, sess, msgs, transcriptMarkdown, false); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"# Session s-1", "- Channel: telegram", "**shell**\n\n```json\n{\"cmd\":\"ls\"}", "## assistant (2025-01-02T03:04:05Z)\n\ndone"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteTranscriptMarkdownEscapesFences(t *testing.T) {
+	sess, msgs := transcriptFixture()
+	output := "before\n```\n# not a heading\n````\nafter"
+	msgs[2].Content = `[{"tool_call_id":"call-1","content":` + strconv.Quote(output) + `}]`
+
+	var b strings.Builder
+	if err := writeTranscript(&b, sess, msgs, transcriptMarkdown, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "**shell**\n\n`````\n" + output + "\n`````\n"
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("markdown missing %q:\n%s", want, b.String())
+	}
+}
+
+func TestForkSessionOnAPIChannel(t *testing.T) {
+	db, err := store.New(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, _, err := db.GetOrCreateSession(ctx, "tg-1", "default", "telegram", "42"); err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err := forkSession(ctx, db, "tg-1", "mine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.ID != "api-mine" || fork.Channel != "api" {
+		t.Errorf("fork = %s on %s, want api-mine on api", fork.ID, fork.Channel)
+	}
+	stored, err := db.GetSession(ctx, fork.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Channel != "api" || stored.AgentID != "default" {
+		t.Errorf("stored fork = %+v", stored)
+	}
+
+	generated, err := forkSession(ctx, db, "tg-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(generated.ID, "api-fork-") {
+		t.Errorf("generated ID = %q", generated.ID)
+	}
+
+	if _, err := forkSession(ctx, db, "tg-1", "api-mine"); err == nil {
+		t.Error("forking onto an existing session should fail")
+	}
+	if _, err := forkSession(ctx, db, "missing", ""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("forking a missing session = %v", err)
+	}
+}
+
+func TestWriteTranscriptJSONL(t *testing.T) {
+	sess, msgs := transcriptFixture()
+
+	var b strings.Builder
+	if err := writeTranscript(&b, sess, msgs, transcriptJSONL, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []exportedMessage
+	sc := bufio.NewScanner(strings.NewReader(b.String()))
+	for sc.Scan() {
+		var m exportedMessage
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	if lines[1].ToolCalls[0].Name != "shell" || len(lines[2].ToolResults[0].Content) != 600 || lines[3].Text != "done" {
+		t.Errorf("decoded lines = %+v", lines)
+	}
+}
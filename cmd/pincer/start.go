@@ -2,11 +2,16 @@ package pincer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
@@ -19,6 +24,7 @@ import (
 	"github.com/igorsilveira/pincer/pkg/agent/tools"
 	"github.com/igorsilveira/pincer/pkg/agent/verification"
 	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/backup"
 	"github.com/igorsilveira/pincer/pkg/channels"
 	"github.com/igorsilveira/pincer/pkg/channels/discord"
 	"github.com/igorsilveira/pincer/pkg/channels/matrix"
@@ -33,6 +39,7 @@ import (
 	"github.com/igorsilveira/pincer/pkg/llm"
 	"github.com/igorsilveira/pincer/pkg/mcp"
 	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/redact"
 	"github.com/igorsilveira/pincer/pkg/sandbox"
 	"github.com/igorsilveira/pincer/pkg/scheduler"
 	"github.com/igorsilveira/pincer/pkg/skills"
@@ -61,11 +68,11 @@ type storeDeps struct {
 }
 
 func initStorage(cfg *config.Config, logger *slog.Logger) (*storeDeps, error) {
-	db, err := store.New(cfg.Store.DSN)
+	db, err := openStore(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("opening store: %w", err)
+		return nil, err
 	}
-	logger.Info("store ready", slog.String("dsn", cfg.Store.DSN))
+	logger.Info("store ready", slog.String("driver", db.Driver()))
 
 	auditLog, err := audit.New(db.DB())
 	if err != nil {
@@ -79,11 +86,7 @@ func initStorage(cfg *config.Config, logger *slog.Logger) (*storeDeps, error) {
 		slog.Int("immutable_keys", len(cfg.Memory.ImmutableKeys)),
 	)
 
-	masterKeyEnv := cfg.Credentials.MasterKeyEnv
-	if masterKeyEnv == "" {
-		masterKeyEnv = "PINCER_MASTER_KEY"
-	}
-	masterKey := os.Getenv(masterKeyEnv)
+	masterKey := os.Getenv(masterKeyEnv(cfg))
 	var credStore *credentials.Store
 	if masterKey != "" {
 		credStore, err = credentials.New(db.DB(), masterKey)
@@ -100,18 +103,6 @@ func initStorage(cfg *config.Config, logger *slog.Logger) (*storeDeps, error) {
 }
 
 func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, deps *storeDeps) (*agent.Runtime, *tools.Registry, *agent.Approver, *soul.Soul, error) {
-	soulDef, err := soul.Load(cfg.Soul.Path)
-	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("loading soul: %w", err)
-	}
-	if err := soulDef.SeedMemory(ctx, deps.mem, "default"); err != nil {
-		logger.Warn("soul memory seeding had errors", slog.String("err", err.Error()))
-	}
-	logger.Info("soul loaded",
-		slog.String("name", soulDef.Identity.Name),
-		slog.String("role", soulDef.Identity.Role),
-	)
-
 	provider, err := createProvider(cfg, logger)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("creating LLM provider: %w", err)
@@ -124,6 +115,32 @@ func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, dep
 	}
 	logger.Info("tool sandbox ready", slog.String("mode", cfg.Sandbox.Mode))
 
+	runtime, registry, approver, soulDef, err := assembleAgent(ctx, cfg, logger, deps, provider, sb)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	_ = deps.auditLog.Log(ctx, audit.EventConfigChg, "", "", "system",
+		fmt.Sprintf("pincer started version=%s provider=%s sandbox=%s", version, provider.Name(), cfg.Sandbox.Mode))
+
+	return runtime, registry, approver, soulDef, nil
+}
+
+// assembleAgent builds the runtime around an existing provider and sandbox:
+// soul, tools, skills, agent profiles and the reliability machinery.
+func assembleAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, deps *storeDeps, provider llm.Provider, sb sandbox.Sandbox) (*agent.Runtime, *tools.Registry, *agent.Approver, *soul.Soul, error) {
+	soulDef, err := soul.Load(cfg.Soul.Path)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("loading soul: %w", err)
+	}
+	if err := soulDef.SeedMemory(ctx, deps.mem, "default"); err != nil {
+		logger.Warn("soul memory seeding had errors", slog.String("err", err.Error()))
+	}
+	logger.Info("soul loaded",
+		slog.String("name", soulDef.Identity.Name),
+		slog.String("role", soulDef.Identity.Role),
+	)
+
 	fc := filecache.New()
 	fc.Start(ctx)
 
@@ -132,6 +149,8 @@ func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, dep
 	registry.Register(&tools.SoulTool{Soul: soulDef})
 	if deps.credStore != nil {
 		registry.Register(&tools.CredentialTool{Credentials: deps.credStore})
+		registry.Register(&tools.ShellTool{Secrets: deps.credStore})
+		registry.Register(&tools.HTTPTool{Secrets: deps.credStore})
 	}
 
 	engine := skills.NewEngine(skills.EngineConfig{
@@ -152,15 +171,28 @@ func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, dep
 			fmt.Sprintf("skill=%s safe=%v findings=%d", r.SkillName, r.Safe, len(r.Findings)))
 	}
 
-	systemPrompt := soulDef.Render()
-	if cfg.Agent.SystemPrompt != "" {
-		systemPrompt += "\n" + cfg.Agent.SystemPrompt
+	if deps.credStore != nil {
+		skillTools := make(map[string][]string)
+		for _, sk := range engine.List() {
+			for _, t := range sk.Tools {
+				skillTools[sk.Name] = append(skillTools[sk.Name], t.Name)
+			}
+		}
+		deps.credStore.SetSkillTools(skillTools)
 	}
+
+	var skillPrompts string
 	for _, sk := range engine.List() {
 		if sk.Prompt != "" {
-			systemPrompt += "\n\n" + sk.Prompt
+			skillPrompts += "\n\n" + sk.Prompt
 		}
 	}
+	systemPrompt := composeSystemPrompt(soulDef, cfg.Agent.SystemPrompt, skillPrompts)
+
+	profiles, err := buildAgentProfiles(ctx, cfg, logger, deps, soulDef, skillPrompts)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 
 	logger.Info("skill engine ready",
 		slog.Int("skills", len(engine.List())),
@@ -217,6 +249,7 @@ func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, dep
 				})
 			}
 		}
+		gates = append(gates, buildVerificationGates(cfg, sb)...)
 		if len(gates) > 0 {
 			verificationRunner = verification.NewRunner(
 				gates,
@@ -230,6 +263,16 @@ func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, dep
 		}
 	}
 
+	redactor, err := buildRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if redactor != nil {
+		logger.Info("message redaction enabled")
+	}
+	deps.auditLog.SetRedactor(redactor)
+	deps.mem.SetRedactor(redactor)
+
 	runtime := agent.NewRuntime(agent.RuntimeConfig{
 		Provider:          provider,
 		Store:             deps.db,
@@ -250,11 +293,12 @@ func initAgent(ctx context.Context, cfg *config.Config, logger *slog.Logger, dep
 		RetryCooldown:      time.Duration(cfg.Agent.Retry.CooldownMS) * time.Millisecond,
 		CheckpointMgr:     checkpointMgr,
 		VerificationRunner: verificationRunner,
+		Agents:             profiles,
+		Routes:             buildRoutes(cfg.Routes),
+		Redactor:           redactor,
+		Pricing:            cfg.Agent.Pricing,
 	})
 
-	_ = deps.auditLog.Log(ctx, audit.EventConfigChg, "", "", "system",
-		fmt.Sprintf("pincer started version=%s provider=%s sandbox=%s", version, provider.Name(), cfg.Sandbox.Mode))
-
 	return runtime, registry, approver, soulDef, nil
 }
 
@@ -285,6 +329,75 @@ func (p *providerLLMChecker) Check(ctx context.Context, prompt string) (string,
 	return result, nil
 }
 
+// buildVerificationGates builds the configured command and file gates.
+// Commands run through the sandbox under the default policy.
+func buildVerificationGates(cfg *config.Config, sb sandbox.Sandbox) []verification.Gate {
+	var gates []verification.Gate
+	for _, gc := range cfg.Agent.Verification.CommandGates {
+		policy := buildDefaultPolicy(cfg)
+		if d, err := time.ParseDuration(gc.Timeout); err == nil {
+			policy.Timeout = d
+		}
+		g := &verification.CommandOutputGate{
+			GateName:         gc.Name,
+			ToolNames:        gc.WhenTools,
+			PathPatterns:     gc.WhenPaths,
+			VerifyCommand:    gc.Command,
+			ExpectedExitCode: gc.ExpectExitCode,
+			Runner:           &sandboxCommandRunner{sb: sb, policy: policy, workDir: gc.WorkDir},
+		}
+		if gc.ExpectOutput != "" {
+			g.ExpectedPattern = regexp.MustCompile(gc.ExpectOutput)
+		}
+		gates = append(gates, g)
+	}
+	for _, fc := range cfg.Agent.Verification.FileGates {
+		g := &verification.FileGate{
+			GateName:     fc.Name,
+			ToolNames:    fc.WhenTools,
+			PathPatterns: fc.WhenPaths,
+			Root:         fc.Root,
+			CheckWritten: fc.CheckWritten,
+		}
+		for _, f := range fc.Files {
+			g.Files = append(g.Files, verification.FileCheck{Path: f.Path, SHA256: f.SHA256})
+		}
+		gates = append(gates, g)
+	}
+	return gates
+}
+
+// sandboxCommandRunner adapts a sandbox.Sandbox into a
+// verification.CommandRunner, running commands through /bin/sh.
+type sandboxCommandRunner struct {
+	sb      sandbox.Sandbox
+	policy  sandbox.Policy
+	workDir string
+}
+
+func (r *sandboxCommandRunner) Run(ctx context.Context, command string) (string, error) {
+	res, err := r.sb.Exec(ctx, sandbox.Command{
+		Name:    "verification",
+		Program: "/bin/sh",
+		Args:    []string{"-c", command},
+		WorkDir: r.workDir,
+	}, r.policy)
+	if err != nil {
+		return "", err
+	}
+	output := res.Stdout
+	if res.Stderr != "" {
+		output = strings.TrimRight(output, "\n") + "\n" + res.Stderr
+	}
+	if res.ExitCode != 0 {
+		if res.Error != "" {
+			output = strings.TrimRight(output, "\n") + "\n" + res.Error
+		}
+		return output, &verification.ExitError{Code: res.ExitCode, Output: output}
+	}
+	return output, nil
+}
+
 func buildRetryStrategies(cfg config.RetryConfig) []retry.Strategy {
 	var strategies []retry.Strategy
 	for _, name := range cfg.Strategies {
@@ -304,6 +417,72 @@ func buildRetryStrategies(cfg config.RetryConfig) []retry.Strategy {
 	return strategies
 }
 
+func buildRedactor(cfg config.RedactionConfig) (*redact.Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	builtins := cfg.Builtin
+	if builtins == nil {
+		builtins = redact.BuiltinRules()
+	}
+	patterns := make([]redact.Pattern, 0, len(cfg.Patterns))
+	for _, p := range cfg.Patterns {
+		patterns = append(patterns, redact.Pattern{Name: p.Name, Regex: p.Regex})
+	}
+	return redact.New(builtins, patterns)
+}
+
+func buildRetentionPolicy(cfg config.RetentionConfig) store.RetentionPolicy {
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	// Channel overrides: 0 inherits the global window, -1 keeps forever.
+	override := func(n, global int) time.Duration {
+		switch {
+		case n < 0:
+			return 0
+		case n == 0:
+			return days(global)
+		}
+		return days(n)
+	}
+
+	p := store.RetentionPolicy{
+		Default: store.RetentionWindow{
+			Messages:    days(cfg.MessagesDays),
+			ToolResults: days(cfg.ToolResultsDays),
+		},
+		Channels: make(map[string]store.RetentionWindow, len(cfg.Channels)),
+		Memory:   days(cfg.MemoryDays),
+		Audit:    days(cfg.AuditDays),
+	}
+	for name, c := range cfg.Channels {
+		p.Channels[name] = store.RetentionWindow{
+			Messages:    override(c.MessagesDays, cfg.MessagesDays),
+			ToolResults: override(c.ToolResultsDays, cfg.ToolResultsDays),
+		}
+	}
+
+	// Files are not tied to a channel, so they are kept as long as the
+	// longest window that could still reference them.
+	longest := func(window func(store.RetentionWindow) time.Duration) time.Duration {
+		keep := window(p.Default)
+		for _, w := range p.Channels {
+			if keep == 0 || window(w) == 0 {
+				return 0
+			}
+			keep = max(keep, window(w))
+		}
+		return keep
+	}
+	p.Files = make(map[string]time.Duration)
+	if keep := longest(func(w store.RetentionWindow) time.Duration { return w.Messages }); keep > 0 {
+		p.Files[config.AttachmentDir()] = keep
+	}
+	if keep := longest(func(w store.RetentionWindow) time.Duration { return w.ToolResults }); keep > 0 {
+		p.Files[config.MCPImageDir()] = keep
+	}
+	return p
+}
+
 func runStart(cmd *cobra.Command, args []string) error {
 	path := cfgFile
 	if path == "" {
@@ -364,9 +543,10 @@ func runStart(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	mcpMgr := initMCPServers(ctx, cfg, logger, registry, deps.auditLog)
+	mcpMgr := initMCPServers(ctx, cfg, logger, registry, deps.auditLog, deps.credStore)
 	if mcpMgr != nil {
 		defer mcpMgr.DisconnectAll()
+		runtime.SetCommands(&mcp.PromptCommands{Manager: mcpMgr})
 	}
 
 	webhookSecret := os.Getenv("PINCER_WEBHOOK_SECRET")
@@ -388,6 +568,69 @@ func runStart(cmd *cobra.Command, args []string) error {
 			},
 		})
 	}
+	backupOpts, err := backupOptions(cfg, deps.db, nil)
+	if err != nil {
+		return err
+	}
+	backups := &backup.Manager{Options: backupOpts, Dir: cfg.Backup.Dir, Keep: cfg.Backup.Keep}
+	if cfg.Backup.Schedule != "" {
+		err := sched.Add(scheduler.Job{
+			Name:     "backup",
+			Schedule: cfg.Backup.Schedule,
+			Func: func(ctx context.Context) error {
+				info, err := backups.Run(ctx)
+				if err != nil {
+					return err
+				}
+				telemetry.FromContext(ctx).Info("backup created",
+					slog.String("path", info.Path),
+					slog.Int64("bytes", info.Size),
+				)
+				_ = deps.auditLog.Log(ctx, audit.EventBackup, "", "", "system", map[string]any{
+					"name":  info.Name,
+					"bytes": info.Size,
+				})
+				return nil
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("scheduling backup job: %w", err)
+		}
+		logger.Info("scheduled backups enabled",
+			slog.String("schedule", cfg.Backup.Schedule),
+			slog.String("dir", cfg.Backup.Dir),
+			slog.Bool("encrypted", len(backupOpts.Recipients) > 0),
+		)
+	}
+
+	if cfg.Retention.Enabled {
+		policy := buildRetentionPolicy(cfg.Retention)
+		err := sched.Add(scheduler.Job{
+			Name:     "retention",
+			Schedule: cfg.Retention.Schedule,
+			Func: func(ctx context.Context) error {
+				res, err := deps.db.ApplyRetention(ctx, policy, time.Now().UTC())
+				if err != nil {
+					return err
+				}
+				telemetry.FromContext(ctx).Info("retention",
+					slog.Int64("messages", res.Messages),
+					slog.Int64("tool_results", res.ToolResults),
+					slog.Int64("sessions", res.Sessions),
+					slog.Int64("memory", res.Memory),
+					slog.Int64("audit", res.Audit),
+					slog.Int64("files", res.Files),
+				)
+				_ = deps.auditLog.Log(ctx, audit.EventRetention, "", "", "system",
+					fmt.Sprintf("messages=%d tool_results=%d sessions=%d memory=%d audit=%d files=%d",
+						res.Messages, res.ToolResults, res.Sessions, res.Memory, res.Audit, res.Files))
+				return nil
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("scheduling retention job: %w", err)
+		}
+	}
 	go sched.Start(ctx)
 
 	chat := webchat.New()
@@ -400,53 +643,60 @@ func runStart(cmd *cobra.Command, args []string) error {
 		AuditLog:   audit.NewToolLogger(deps.auditLog, "subagent"),
 	})
 
-	if cfg.Browser.Enabled {
-		idleTimeout := 10 * time.Minute
-		if cfg.Browser.IdleTimeout != "" {
-			if d, err := time.ParseDuration(cfg.Browser.IdleTimeout); err == nil {
-				idleTimeout = d
-			}
-		}
-		browserTool := &tools.BrowserTool{
-			BaseCtx:     ctx,
-			DataDir:     config.DataDir(),
-			Headless:    cfg.Browser.Headless,
-			IdleTimeout: idleTimeout,
-			AuditLog:    audit.NewToolLogger(deps.auditLog, "browser"),
-		}
-		browserTool.StartCleanup()
+	if browserTool := initBrowserTool(ctx, cfg, logger, deps); browserTool != nil {
 		defer browserTool.Close()
 		registry.Register(browserTool)
-		logger.Info("browser tool enabled",
-			slog.Bool("headless", cfg.Browser.Headless),
-			slog.String("idle_timeout", idleTimeout.String()),
-		)
 	}
 
 	channelAdapters := initChannelAdapters(ctx, cfg, logger)
 
-	if len(channelAdapters) > 0 {
-		router := gateway.NewChannelRouter(runtime, channelAdapters, approver, logger, deps.db, deps.auditLog)
-		router.Start(ctx)
-
-		registry.Register(&tools.NotifyTool{
-			BaseCtx:       ctx,
-			RunAndDeliver: router.RunAndDeliver,
-			Send:          router.SendToSession,
-			AuditLog:      audit.NewToolLogger(deps.auditLog, "notify"),
-		})
-		registry.Register(&tools.SpawnTool{
-			RunSpawn:   router.RunSpawnAgent,
-			CheckSpawn: router.CheckSpawn,
-			AuditLog:   audit.NewToolLogger(deps.auditLog, "spawn"),
-		})
+	// Webchat is routed too so that notify and send_file reach browser
+	// sessions; its inbound messages still arrive over the websocket.
+	router := gateway.NewChannelRouter(runtime, append(channelAdapters, chat), approver, logger, deps.db, deps.auditLog)
+	router.SetAccessControl(gateway.NewAccessControl(cfg))
+	for name, ch := range cfg.Channels {
+		if ch.Group.Respond != "" {
+			router.SetGroupRespondMode(name, channels.GroupRespondMode(ch.Group.Respond))
+		}
 	}
+	router.Start(ctx)
+
+	registry.Register(&tools.NotifyTool{
+		BaseCtx:       ctx,
+		RunAndDeliver: router.RunAndDeliver,
+		Send:          router.SendToSession,
+		AuditLog:      audit.NewToolLogger(deps.auditLog, "notify"),
+	})
+	registry.Register(&tools.SpawnTool{
+		RunSpawn:   router.RunSpawnAgent,
+		CheckSpawn: router.CheckSpawn,
+		AuditLog:   audit.NewToolLogger(deps.auditLog, "spawn"),
+	})
+	registry.Register(&tools.SendFileTool{
+		Send: router.SendFilesToSession,
+	})
 
 	var a2aHandler http.Handler
 	if cfg.A2A.Enabled {
 		a2aHandler = initA2AHandler(cfg, runtime, registry, soulDef, deps.auditLog, logger)
 	}
 
+	var mcpServer http.Handler
+	if cfg.MCP.Serve {
+		if cfg.Gateway.AuthToken == "" {
+			logger.Warn("mcp server disabled: gateway auth_token is not set")
+		} else {
+			srv := mcp.NewServer(mcpServeConfig(runtime, approver, deps, logger, ""))
+			mcpServer = mcpsdk.NewStreamableHTTPHandler(func(*http.Request) *mcpsdk.Server { return srv }, nil)
+			logger.Info("mcp server enabled", slog.String("path", "/mcp"))
+		}
+	}
+
+	var mcpStatus gateway.MCPStatus
+	if mcpMgr != nil {
+		mcpStatus = mcpMgr
+	}
+
 	gw := gateway.New(gateway.Config{
 		Bind:       cfg.Gateway.Bind,
 		Port:       cfg.Gateway.Port,
@@ -457,7 +707,19 @@ func runStart(cmd *cobra.Command, args []string) error {
 		Webhooks:   webhooks,
 		A2AHandler: a2aHandler,
 		AuthToken:  cfg.Gateway.AuthToken,
+		MCPServer:  mcpServer,
+
+		Store:       deps.db,
+		Memory:      deps.mem,
+		Credentials: deps.credStore,
+		AuditLog:    deps.auditLog,
+		Spawns:      router,
+		Backups:     backups,
+		MCP:         mcpStatus,
 	})
+	if cfg.Gateway.AuthToken == "" {
+		logger.Info("admin api disabled: gateway auth_token is not set")
+	}
 
 	logger.Info("pincer gateway ready",
 		slog.String("url", fmt.Sprintf("http://127.0.0.1:%d", cfg.Gateway.Port)),
@@ -473,6 +735,39 @@ func runStart(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// initBrowserTool returns the browser tool when it is enabled, with its idle
+// cleanup running. Callers register it and close it on shutdown.
+func initBrowserTool(ctx context.Context, cfg *config.Config, logger *slog.Logger, deps *storeDeps) *tools.BrowserTool {
+	if !cfg.Browser.Enabled {
+		return nil
+	}
+	idleTimeout := 10 * time.Minute
+	if cfg.Browser.IdleTimeout != "" {
+		if d, err := time.ParseDuration(cfg.Browser.IdleTimeout); err == nil {
+			idleTimeout = d
+		}
+	}
+	browserTool := &tools.BrowserTool{
+		BaseCtx:        ctx,
+		DataDir:        config.DataDir(),
+		Headless:       cfg.Browser.Headless,
+		IdleTimeout:    idleTimeout,
+		AuditLog:       audit.NewToolLogger(deps.auditLog, "browser"),
+		DefaultProfile: cfg.Browser.Profile,
+		DownloadDir:    cfg.Browser.DownloadDir,
+	}
+	if deps.credStore != nil {
+		browserTool.Secrets = deps.credStore
+	}
+	browserTool.StartCleanup()
+	logger.Info("browser tool enabled",
+		slog.Bool("headless", cfg.Browser.Headless),
+		slog.String("profile", cfg.Browser.Profile),
+		slog.String("idle_timeout", idleTimeout.String()),
+	)
+	return browserTool
+}
+
 func createProvider(cfg *config.Config, logger *slog.Logger) (llm.Provider, error) {
 	model := cfg.Agent.Model
 
@@ -487,6 +782,22 @@ func createProvider(cfg *config.Config, logger *slog.Logger) (llm.Provider, erro
 		return llm.NewGeminiProvider("")
 	case hasPrefix(model, "ollama/"):
 		return llm.NewOllamaProvider("", model[len("ollama/"):])
+	case hasPrefix(model, "replay/"):
+		return llm.NewReplayProviderFromFile(fixturePath(model[len("replay/"):]))
+	case hasPrefix(model, "record/"):
+		name, innerModel, ok := strings.Cut(model[len("record/"):], "/")
+		if !ok || name == "" || innerModel == "" {
+			return nil, fmt.Errorf("record: model must be record/<fixture>/<model>, got %q", model)
+		}
+		innerCfg := *cfg
+		innerCfg.Agent.Model = innerModel
+		inner, err := createProvider(&innerCfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		path := fixturePath(name)
+		logger.Info("recording provider responses", slog.String("fixture", path))
+		return llm.NewRecordingProvider(inner, innerModel, path)
 	default:
 
 		logger.Info("defaulting to anthropic provider", slog.String("model", model))
@@ -494,14 +805,27 @@ func createProvider(cfg *config.Config, logger *slog.Logger) (llm.Provider, erro
 	}
 }
 
+// fixturePath resolves the fixture of a replay/ or record/ model. Bare names
+// live in DataDir/fixtures; names with a separator or .json are paths.
+func fixturePath(name string) string {
+	if strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".json") {
+		return name
+	}
+	return filepath.Join(config.DataDir(), "fixtures", name+".json")
+}
+
 func createSandbox(cfg *config.Config) (sandbox.Sandbox, error) {
+	workDir := config.WorkspaceDir()
+	if err := os.MkdirAll(workDir, 0750); err != nil {
+		return nil, fmt.Errorf("creating workspace: %w", err)
+	}
 	switch cfg.Sandbox.Mode {
 	case "container":
 		return sandbox.NewContainerSandbox(sandbox.ContainerConfig{
-			WorkDir: config.DataDir(),
+			WorkDir: workDir,
 		})
 	default:
-		return sandbox.NewProcessSandbox(config.DataDir()), nil
+		return sandbox.NewProcessSandbox(workDir), nil
 	}
 }
 
@@ -515,8 +839,9 @@ type adapterEntry struct {
 	create func(cfg *config.Config) (channels.Adapter, error)
 }
 
-func initChannelAdapters(ctx context.Context, cfg *config.Config, logger *slog.Logger) []channels.Adapter {
-	entries := []adapterEntry{
+// adapterEntries lists the channel adapters pincer knows how to build.
+func adapterEntries() []adapterEntry {
+	return []adapterEntry{
 		{"telegram", "TELEGRAM_BOT_TOKEN", func(c *config.Config) (channels.Adapter, error) {
 			return telegram.New(channelToken(c, "telegram"))
 		}},
@@ -537,10 +862,18 @@ func initChannelAdapters(ctx context.Context, cfg *config.Config, logger *slog.L
 			return matrix.New(matrix.Config{})
 		}},
 	}
+}
 
+// adapterWanted reports whether an adapter should run: it is enabled in the
+// config or its environment variable is set.
+func adapterWanted(cfg *config.Config, e adapterEntry) bool {
+	return channelEnabled(cfg, e.name) || os.Getenv(e.envVar) != ""
+}
+
+func initChannelAdapters(ctx context.Context, cfg *config.Config, logger *slog.Logger) []channels.Adapter {
 	var adapters []channels.Adapter
-	for _, e := range entries {
-		if !channelEnabled(cfg, e.name) && os.Getenv(e.envVar) == "" {
+	for _, e := range adapterEntries() {
+		if !adapterWanted(cfg, e) {
 			continue
 		}
 		a, err := e.create(cfg)
@@ -548,6 +881,21 @@ func initChannelAdapters(ctx context.Context, cfg *config.Config, logger *slog.L
 			logger.Warn(e.name+" adapter skipped", slog.String("err", err.Error()))
 			continue
 		}
+		if limiter, ok := a.(channels.AttachmentLimiter); ok {
+			if ch, ok := cfg.Channels[e.name]; ok && ch.MaxAttachmentBytes > 0 {
+				limiter.SetMaxAttachmentBytes(ch.MaxAttachmentBytes)
+			}
+		}
+		if setter, ok := a.(channels.GroupSessionSetter); ok {
+			if ch, ok := cfg.Channels[e.name]; ok && ch.Group.Session != "" {
+				setter.SetGroupSessionMode(channels.GroupSessionMode(ch.Group.Session))
+			}
+		}
+		if setter, ok := a.(channels.GroupRespondSetter); ok {
+			if ch, ok := cfg.Channels[e.name]; ok && ch.Group.Respond != "" {
+				setter.SetGroupRespondMode(channels.GroupRespondMode(ch.Group.Respond))
+			}
+		}
 		if err := a.Start(ctx); err != nil {
 			logger.Error(e.name+" adapter failed to start", slog.String("err", err.Error()))
 			continue
@@ -621,12 +969,33 @@ func buildAgentCard(cfg *config.Config, registry *tools.Registry, soulDef *soul.
 	}
 }
 
-func initMCPServers(ctx context.Context, cfg *config.Config, logger *slog.Logger, registry *tools.Registry, auditLog *audit.Logger) *mcp.Manager {
+func initMCPServers(ctx context.Context, cfg *config.Config, logger *slog.Logger, registry *tools.Registry, auditLog *audit.Logger, creds *credentials.Store) *mcp.Manager {
 	if !cfg.MCP.Enabled || len(cfg.MCP.Servers) == 0 {
 		return nil
 	}
 
 	mgr := mcp.NewManager(logger)
+	imageDir := config.MCPImageDir()
+	resourceTool := &mcp.ResourceTool{Manager: mgr, ImageDir: imageDir}
+	registerTool := func(server string, t *mcpsdk.Tool) {
+		mt := mgr.NewTool(server, t)
+		mt.ImageDir = imageDir
+		registry.Register(mt)
+	}
+	// Also called when a server that was down at startup comes up.
+	mgr.OnToolsChanged(func(server string, mcpTools []*mcpsdk.Tool, removed []string) {
+		for _, name := range removed {
+			registry.Unregister(mcp.ToolName(server, name))
+		}
+		for _, t := range mcpTools {
+			registerTool(server, t)
+		}
+		if len(mgr.ResourceServers()) > 0 {
+			registry.Register(resourceTool)
+		}
+		_ = auditLog.Log(ctx, audit.EventMCPConnect, "", "", "system",
+			fmt.Sprintf("server=%s tools=%d removed=%d (list changed)", server, len(mcpTools), len(removed)))
+	})
 
 	for _, srv := range cfg.MCP.Servers {
 		if srv.Enabled != nil && !*srv.Enabled {
@@ -637,13 +1006,23 @@ func initMCPServers(ctx context.Context, cfg *config.Config, logger *slog.Logger
 			continue
 		}
 
-		mcpTools, err := mgr.Connect(ctx, mcp.ServerConfig{
-			Name:    srv.Name,
-			Command: srv.Command,
-			Args:    srv.Args,
-			Env:     srv.Env,
-			URL:     srv.URL,
-		})
+		serverCfg, err := mcpServerConfig(ctx, cfg, creds, srv)
+		if err != nil {
+			logger.Error("mcp server config failed",
+				slog.String("name", srv.Name),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		mcpTools, err := mgr.Connect(ctx, serverCfg)
+		if errors.Is(err, mcp.ErrReconnecting) {
+			logger.Warn("mcp server unavailable, retrying in the background",
+				slog.String("name", srv.Name),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
 		if err != nil {
 			logger.Error("mcp server connect failed",
 				slog.String("name", srv.Name),
@@ -653,9 +1032,7 @@ func initMCPServers(ctx context.Context, cfg *config.Config, logger *slog.Logger
 		}
 
 		for _, t := range mcpTools {
-			name := srv.Name
-			sessionFn := func() (*mcpsdk.ClientSession, error) { return mgr.Session(name) }
-			registry.Register(mcp.NewMCPTool(name, t, sessionFn))
+			registerTool(srv.Name, t)
 		}
 
 		_ = auditLog.Log(ctx, audit.EventMCPConnect, "", "", "system",
@@ -667,9 +1044,64 @@ func initMCPServers(ctx context.Context, cfg *config.Config, logger *slog.Logger
 		)
 	}
 
+	if servers := mgr.ResourceServers(); len(servers) > 0 {
+		registry.Register(resourceTool)
+		logger.Info("mcp resources available", slog.Any("servers", servers))
+	}
+
 	return mgr
 }
 
+// mcpServerConfig builds the manager's view of a configured server,
+// resolving credential placeholders in its env and headers.
+func mcpServerConfig(ctx context.Context, cfg *config.Config, creds *credentials.Store, srv config.MCPServerConfig) (mcp.ServerConfig, error) {
+	env, err := resolveMCPValues(ctx, creds, srv.Name, "env", srv.Env)
+	if err != nil {
+		return mcp.ServerConfig{}, err
+	}
+	headers, err := resolveMCPValues(ctx, creds, srv.Name, "header", srv.Headers)
+	if err != nil {
+		return mcp.ServerConfig{}, err
+	}
+	// Durations were checked when the config was loaded.
+	timeout, _ := time.ParseDuration(srv.Timeout)
+	ping, _ := time.ParseDuration(cfg.MCP.PingInterval)
+	return mcp.ServerConfig{
+		Name:            srv.Name,
+		Command:         srv.Command,
+		Args:            srv.Args,
+		Env:             env,
+		URL:             srv.URL,
+		Headers:         headers,
+		AllowTools:      srv.AllowTools,
+		DenyTools:       srv.DenyTools,
+		Timeout:         timeout,
+		RequireApproval: srv.RequireApproval,
+		PingInterval:    ping,
+	}, nil
+}
+
+// resolveMCPValues substitutes {{cred:NAME}} placeholders in an MCP server's
+// env or headers with credentials scoped to that server.
+func resolveMCPValues(ctx context.Context, creds *credentials.Store, server, kind string, values map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		if !credentials.HasPlaceholder(v) {
+			out[k] = v
+			continue
+		}
+		if creds == nil {
+			return nil, fmt.Errorf("%s %s uses a credential but the credential store is disabled", kind, k)
+		}
+		resolved, _, err := creds.Expand(ctx, v, credentials.MCPScope(server))
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", kind, k, err)
+		}
+		out[k] = resolved
+	}
+	return out, nil
+}
+
 func buildDefaultPolicy(cfg *config.Config) sandbox.Policy {
 	p := sandbox.DefaultPolicy()
 
@@ -690,6 +1122,11 @@ func buildDefaultPolicy(cfg *config.Config) sandbox.Policy {
 
 	p.AllowedPaths = cfg.Sandbox.AllowedPaths
 	p.ReadOnlyPaths = cfg.Sandbox.ReadOnlyPaths
+	if len(p.AllowedPaths) > 0 {
+		// Files received from channels must stay readable to the file tools.
+		p.AllowedPaths = append(slices.Clone(p.AllowedPaths), config.AttachmentDir())
+		p.ReadOnlyPaths = append(slices.Clone(p.ReadOnlyPaths), config.AttachmentDir())
+	}
 
 	return p
 }
@@ -0,0 +1,68 @@
+package pincer
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+)
+
+func TestBuildDefaultPolicyAllowsAttachments(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sandbox.AllowedPaths = []string{"/srv/app"}
+	p := buildDefaultPolicy(cfg)
+
+	dir := config.AttachmentDir()
+	if !slices.Contains(p.AllowedPaths, dir) || !slices.Contains(p.ReadOnlyPaths, dir) {
+		t.Errorf("policy = %+v, want %s readable but not writable", p, dir)
+	}
+	if len(cfg.Sandbox.AllowedPaths) != 1 {
+		t.Errorf("config allowed paths changed to %v", cfg.Sandbox.AllowedPaths)
+	}
+	if err := sandbox.CheckPathWritable(dir+"/s/a.txt", p.ReadOnlyPaths); err == nil {
+		t.Error("attachments should not be writable")
+	}
+
+	if p := buildDefaultPolicy(config.Default()); len(p.AllowedPaths) != 0 {
+		t.Errorf("unrestricted policy gained allowed paths %v", p.AllowedPaths)
+	}
+}
+
+func TestBuildRetentionPolicyFiles(t *testing.T) {
+	day := 24 * time.Hour
+	cfg := config.RetentionConfig{
+		MessagesDays:    30,
+		ToolResultsDays: 5,
+		Channels: map[string]config.ChannelRetentionConfig{
+			"telegram": {MessagesDays: 90},
+			"slack":    {ToolResultsDays: -1},
+		},
+	}
+	p := buildRetentionPolicy(cfg)
+	if got := p.Files[config.AttachmentDir()]; got != 90*day {
+		t.Errorf("attachments kept %v, want the longest message window", got)
+	}
+	if _, ok := p.Files[config.MCPImageDir()]; ok {
+		t.Error("images swept although slack keeps tool results forever")
+	}
+}
+
+func TestMergeSandboxKeepsUnsetFields(t *testing.T) {
+	base := config.SandboxConfig{
+		Mode:          "container",
+		NetworkPolicy: "deny",
+		MaxTimeout:    "30s",
+		AllowedPaths:  []string{"/srv/app"},
+		ReadOnlyPaths: []string{"/etc/app"},
+	}
+	got := mergeSandbox(base, config.SandboxConfig{NetworkPolicy: "allow", AllowedPaths: []string{"/srv/ops"}})
+
+	if got.Mode != "container" || got.MaxTimeout != "30s" || !slices.Equal(got.ReadOnlyPaths, base.ReadOnlyPaths) {
+		t.Errorf("unset fields not inherited: %+v", got)
+	}
+	if got.NetworkPolicy != "allow" || !slices.Equal(got.AllowedPaths, []string{"/srv/ops"}) {
+		t.Errorf("overrides not applied: %+v", got)
+	}
+}
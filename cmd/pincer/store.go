@@ -0,0 +1,141 @@
+package pincer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/store"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Manage the Pincer database",
+}
+
+var storeMigrateToCmd = &cobra.Command{
+	Use:   "migrate-to",
+	Short: "Copy all data from the configured store into another backend",
+	Long: `Copy sessions, messages, memory, credentials, checkpoints and the audit
+log from the store in the current config into a target database. Rows that
+already exist in the target are skipped, so an interrupted copy can be re-run.
+Stop the gateway first so that no writes are missed.
+
+Credentials stay encrypted with the current master key.`,
+	Example: `  pincer store migrate-to --driver postgres --dsn "postgres://pincer@db:5432/pincer"
+  pincer store migrate-to --driver postgres --dsn-env PINCER_PG_DSN
+  pincer store migrate-to --driver sqlite --dsn ./pincer-copy.db`,
+	Args: cobra.NoArgs,
+	RunE: runStoreMigrateTo,
+}
+
+var (
+	migrateDriver string
+	migrateDSN    string
+	migrateDSNEnv string
+)
+
+func init() {
+	storeMigrateToCmd.Flags().StringVar(&migrateDriver, "driver", store.DriverPostgres, "target driver: sqlite or postgres")
+	storeMigrateToCmd.Flags().StringVar(&migrateDSN, "dsn", "", "target DSN")
+	storeMigrateToCmd.Flags().StringVar(&migrateDSNEnv, "dsn-env", "", "environment variable holding the target DSN")
+
+	storeCmd.AddCommand(storeMigrateToCmd)
+}
+
+func storeOptions(cfg config.StoreConfig) (store.Options, error) {
+	opts := store.Options{
+		Driver:       cfg.Driver,
+		DSN:          cfg.ResolvedDSN(),
+		MaxOpenConns: cfg.MaxOpenConns,
+		MaxIdleConns: cfg.MaxIdleConns,
+	}
+	if cfg.ConnMaxLifetime != "" {
+		d, err := time.ParseDuration(cfg.ConnMaxLifetime)
+		if err != nil {
+			return opts, fmt.Errorf("invalid store conn_max_lifetime: %w", err)
+		}
+		opts.ConnMaxLifetime = d
+	}
+	return opts, nil
+}
+
+// storeDriver returns the driver a store config opens, which is SQLite when
+// none is set.
+func storeDriver(cfg config.StoreConfig) string {
+	if cfg.Driver == "" {
+		return store.DriverSQLite
+	}
+	return cfg.Driver
+}
+
+// openStore opens the database described by the [store] config section.
+func openStore(cfg *config.Config) (*store.Store, error) {
+	opts, err := storeOptions(cfg.Store)
+	if err != nil {
+		return nil, err
+	}
+	db, err := store.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	return db, nil
+}
+
+func runStoreMigrateTo(cmd *cobra.Command, args []string) error {
+	cfg := config.Current()
+
+	target := config.StoreConfig{Driver: migrateDriver, DSN: migrateDSN, DSNEnv: migrateDSNEnv}
+	if target.ResolvedDSN() == "" {
+		return fmt.Errorf("--dsn or --dsn-env is required")
+	}
+	if storeDriver(target) == storeDriver(cfg.Store) && target.ResolvedDSN() == cfg.Store.ResolvedDSN() {
+		return fmt.Errorf("target is the configured store")
+	}
+
+	src, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dstOpts, err := storeOptions(target)
+	if err != nil {
+		return err
+	}
+	dst, err := store.Open(dstOpts)
+	if err != nil {
+		return fmt.Errorf("opening target store: %w", err)
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	tables := []struct {
+		name string
+		copy func(ctx context.Context, src, dst *gorm.DB) (int64, error)
+	}{
+		{"sessions", store.CopyTable[store.Session]},
+		{"messages", store.CopyTable[store.Message]},
+		{"memory", store.CopyTable[store.Memory]},
+		{"credentials", store.CopyTable[store.Credential]},
+		{"credential_kdf", store.CopyTable[store.CredentialKDF]},
+		{"checkpoints", store.CopyTable[store.Checkpoint]},
+		{"audit_log", store.CopyTable[audit.Entry]},
+	}
+
+	fmt.Printf("Copying %s store into %s store\n", src.Driver(), dst.Driver())
+	for _, t := range tables {
+		n, err := t.copy(ctx, src.DB(), dst.DB())
+		if err != nil {
+			return fmt.Errorf("copying %s: %w", t.name, err)
+		}
+		fmt.Printf("  %-14s %d rows\n", t.name, n)
+	}
+
+	fmt.Println("\nDone. Point [store] at the new database to switch over.")
+	return nil
+}
@@ -0,0 +1,20 @@
+package pincer
+
+import (
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+func TestStoreDriverDefaultsToSQLite(t *testing.T) {
+	for driver, want := range map[string]string{
+		"":                   store.DriverSQLite,
+		store.DriverSQLite:   store.DriverSQLite,
+		store.DriverPostgres: store.DriverPostgres,
+	} {
+		if got := storeDriver(config.StoreConfig{Driver: driver}); got != want {
+			t.Errorf("storeDriver(%q) = %q, want %q", driver, got, want)
+		}
+	}
+}
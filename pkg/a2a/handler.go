@@ -12,6 +12,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/igorsilveira/pincer/pkg/agent"
 	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
@@ -212,9 +215,12 @@ func (h *Handler) handleSendMessageStream(w http.ResponseWriter, r *http.Request
 
 	task := h.getOrCreateTask(r.Context(), taskID, msg)
 	_ = h.store.Update(task.ID, TaskStateWorking)
+	ctx, span := startTaskSpan(r.Context(), task.ID)
+	defer span.End()
 
-	events, err := h.runtime.RunTurn(r.Context(), task.ID, text)
+	events, err := h.runtime.RunTurn(ctx, task.ID, text)
 	if err != nil {
+		telemetry.RecordError(span, err)
 		_ = h.store.Update(task.ID, TaskStateFailed)
 		h.auditLogEvent(r.Context(), audit.EventA2ATaskFail, task.ID)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -236,6 +242,7 @@ func (h *Handler) handleSendMessageStream(w http.ResponseWriter, r *http.Request
 		case agent.TurnDone:
 			fullResponse = ev.Message
 		case agent.TurnError:
+			telemetry.RecordError(span, ev.Error)
 			_ = h.store.Update(task.ID, TaskStateFailed)
 			h.auditLogEvent(r.Context(), audit.EventA2ATaskFail, task.ID)
 			writeSSE(w, flusher, canFlush, "status", TaskStatus{ID: task.ID, State: TaskStateFailed})
@@ -291,9 +298,12 @@ func (h *Handler) processMessage(ctx context.Context, taskID string, msg Message
 
 	task := h.getOrCreateTask(ctx, taskID, msg)
 	_ = h.store.Update(task.ID, TaskStateWorking)
+	ctx, span := startTaskSpan(ctx, task.ID)
+	defer span.End()
 
 	events, err := h.runtime.RunTurn(ctx, task.ID, text)
 	if err != nil {
+		telemetry.RecordError(span, err)
 		_ = h.store.Update(task.ID, TaskStateFailed)
 		h.auditLogEvent(ctx, audit.EventA2ATaskFail, task.ID)
 		return task, "", fmt.Errorf("agent turn: %w", err)
@@ -305,6 +315,7 @@ func (h *Handler) processMessage(ctx context.Context, taskID string, msg Message
 		case agent.TurnDone:
 			fullResponse = ev.Message
 		case agent.TurnError:
+			telemetry.RecordError(span, ev.Error)
 			_ = h.store.Update(task.ID, TaskStateFailed)
 			h.auditLogEvent(ctx, audit.EventA2ATaskFail, task.ID)
 			return task, "", fmt.Errorf("agent error: %w", ev.Error)
@@ -316,6 +327,15 @@ func (h *Handler) processMessage(ctx context.Context, taskID string, msg Message
 	return task, fullResponse, nil
 }
 
+// startTaskSpan starts the span of the agent work done for an A2A task. The
+// gateway has already continued the caller's trace from its headers.
+func startTaskSpan(ctx context.Context, taskID string) (context.Context, trace.Span) {
+	ctx, span := telemetry.Tracer().Start(ctx, "a2a.task",
+		trace.WithAttributes(attribute.String("a2a.task.id", taskID)),
+	)
+	return telemetry.WithTraceID(ctx), span
+}
+
 func (h *Handler) getOrCreateTask(ctx context.Context, taskID string, msg Message) *Task {
 	if taskID != "" {
 		if task, err := h.store.Get(taskID); err == nil {
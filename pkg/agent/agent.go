@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -21,22 +23,28 @@ import (
 	"github.com/igorsilveira/pincer/pkg/config"
 	"github.com/igorsilveira/pincer/pkg/llm"
 	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/redact"
 	"github.com/igorsilveira/pincer/pkg/sandbox"
 	"github.com/igorsilveira/pincer/pkg/store"
 	"github.com/igorsilveira/pincer/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 
-func (r *Runtime) chatWithRetry(ctx context.Context, logger *slog.Logger, req llm.ChatRequest, notify func(string)) (<-chan llm.ChatEvent, error) {
+func (r *Runtime) chatWithRetry(ctx context.Context, logger *slog.Logger, provider llm.Provider, req llm.ChatRequest, notify func(string)) (<-chan llm.ChatEvent, error) {
+	ctx, span := startChatSpan(ctx, provider, req)
 	var lastErr error
 	for attempt := 0; attempt <= config.LLMMaxRetries; attempt++ {
-		events, err := r.provider.Chat(ctx, req)
+		events, err := provider.Chat(ctx, req)
 		if err == nil {
-			return events, nil
+			return traceChat(span, events), nil
 		}
 
 		retryAfter, retryable := llm.IsRetryable(err)
 		if !retryable {
+			telemetry.EndSpan(span, err)
 			return nil, err
 		}
 
@@ -63,20 +71,31 @@ func (r *Runtime) chatWithRetry(ctx context.Context, logger *slog.Logger, req ll
 		if notify != nil {
 			notify(fmt.Sprintf("Rate limited, retrying in %s (%d/%d)...", delay.Round(time.Second), attempt+1, config.LLMMaxRetries))
 		}
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.String("error", err.Error()),
+		))
 
 		select {
 		case <-ctx.Done():
+			telemetry.EndSpan(span, ctx.Err())
 			return nil, ctx.Err()
 		case <-time.After(delay):
 		}
 	}
 
+	telemetry.EndSpan(span, lastErr)
 	return nil, lastErr
 }
 
 type agentCtxKey int
 
-const ctxKeyAutoApprove agentCtxKey = iota
+const (
+	ctxKeyAutoApprove agentCtxKey = iota
+	ctxKeyAllowedTools
+	ctxKeyDenyApprovals
+	ctxKeyApprovalScope
+)
 
 func WithAutoApprove(ctx context.Context) context.Context {
 	return context.WithValue(ctx, ctxKeyAutoApprove, true)
@@ -87,6 +106,53 @@ func autoApproveFromContext(ctx context.Context) bool {
 	return v
 }
 
+// WithApprovalsDenied makes tools that need approval fail instead of waiting
+// for an answer, for callers that cannot surface approval requests.
+func WithApprovalsDenied(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyDenyApprovals, true)
+}
+
+func approvalsDeniedFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(ctxKeyDenyApprovals).(bool)
+	return v
+}
+
+// WithApprovalScope tags approval requests made with ctx with scope, so only
+// the frontend that owns the scope can answer them. See ApprovalRequest.
+func WithApprovalScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, ctxKeyApprovalScope, scope)
+}
+
+func approvalScopeFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(ctxKeyApprovalScope).(string)
+	return v
+}
+
+// WithAllowedTools restricts the tools offered to the model for turns run
+// with ctx. An empty list offers no tools.
+func WithAllowedTools(ctx context.Context, names []string) context.Context {
+	if names == nil {
+		names = []string{}
+	}
+	return context.WithValue(ctx, ctxKeyAllowedTools, names)
+}
+
+func AllowedToolsFromContext(ctx context.Context) ([]string, bool) {
+	v, ok := ctx.Value(ctxKeyAllowedTools).([]string)
+	return v, ok
+}
+
+func restrictTools(ctx context.Context, registry *tools.Registry) *tools.Registry {
+	names, ok := AllowedToolsFromContext(ctx)
+	if !ok || registry == nil {
+		return registry
+	}
+	if len(names) == 0 {
+		return tools.NewRegistry()
+	}
+	return registry.Filter(names)
+}
+
 type TurnEvent struct {
 	Type            TurnEventType
 	Token           string
@@ -136,6 +202,11 @@ type Runtime struct {
 	retryCooldown      time.Duration
 	checkpointMgr      *checkpoint.Manager
 	verificationRunner *verification.Runner
+	agents             map[string]AgentProfile
+	routes             []Route
+	redactor           *redact.Redactor
+	commands           CommandExpander
+	pricing            map[string]config.ModelPricing
 }
 
 type RuntimeConfig struct {
@@ -159,6 +230,11 @@ type RuntimeConfig struct {
 	RetryCooldown      time.Duration
 	CheckpointMgr     *checkpoint.Manager
 	VerificationRunner *verification.Runner
+	Agents             []AgentProfile
+	Routes             []Route
+	Redactor           *redact.Redactor
+	// Pricing prices models for the cost metric.
+	Pricing map[string]config.ModelPricing
 }
 
 func NewRuntime(cfg RuntimeConfig) *Runtime {
@@ -190,6 +266,10 @@ func NewRuntime(cfg RuntimeConfig) *Runtime {
 	if toolTimeout == 0 {
 		toolTimeout = config.DefaultToolTimeout
 	}
+	agents := make(map[string]AgentProfile, len(cfg.Agents))
+	for _, p := range cfg.Agents {
+		agents[p.ID] = p
+	}
 	return &Runtime{
 		provider:        cfg.Provider,
 		store:           cfg.Store,
@@ -214,6 +294,10 @@ func NewRuntime(cfg RuntimeConfig) *Runtime {
 		retryCooldown:      cfg.RetryCooldown,
 		checkpointMgr:      cfg.CheckpointMgr,
 		verificationRunner: cfg.VerificationRunner,
+		agents:             agents,
+		routes:             cfg.Routes,
+		redactor:           cfg.Redactor,
+		pricing:            cfg.Pricing,
 	}
 }
 
@@ -250,7 +334,7 @@ func (r *Runtime) sessionLock(sessionID string) *sync.Mutex {
 	return mu
 }
 
-func (r *Runtime) RunTurn(ctx context.Context, sessionID, userMessage string) (<-chan TurnEvent, error) {
+func (r *Runtime) RunTurn(ctx context.Context, sessionID, userMessage string, images ...llm.ImageContent) (<-chan TurnEvent, error) {
 	logger := telemetry.FromContext(ctx)
 
 	session, err := r.getOrCreateSession(ctx, sessionID)
@@ -258,18 +342,40 @@ func (r *Runtime) RunTurn(ctx context.Context, sessionID, userMessage string) (<
 		return nil, fmt.Errorf("resolving session: %w", err)
 	}
 
-	mu := r.sessionLock(session.ID)
-	mu.Lock()
+	ctx, span := startTurnSpan(ctx, r.settingsFor(session.AgentID), session.ID)
+	ctx = telemetry.WithTraceID(ctx)
+	logger = telemetry.FromContext(ctx)
+
+	userMessage, failed := r.expandCommand(ctx, userMessage)
+	if failed != nil {
+		span.End()
+		return failed, nil
+	}
+
+	contentType := store.ContentTypeText
+	content := userMessage
+	if len(images) > 0 {
+		content, err = marshalMedia(userMessage, images)
+		if err != nil {
+			telemetry.EndSpan(span, err)
+			return nil, err
+		}
+		contentType = store.ContentTypeMedia
+	}
+
+	unlock := r.lockSession(session.ID)
 
 	userMsg := &store.Message{
-		ID:        uuid.NewString(),
-		SessionID: session.ID,
-		Role:      llm.RoleUser,
-		Content:   userMessage,
-		CreatedAt: time.Now().UTC(),
+		ID:          uuid.NewString(),
+		SessionID:   session.ID,
+		Role:        llm.RoleUser,
+		ContentType: contentType,
+		Content:     content,
+		CreatedAt:   time.Now().UTC(),
 	}
-	if err := r.store.AppendMessage(ctx, userMsg); err != nil {
-		mu.Unlock()
+	if err := r.appendMessage(ctx, userMsg); err != nil {
+		unlock()
+		telemetry.EndSpan(span, err)
 		return nil, fmt.Errorf("persisting user message: %w", err)
 	}
 
@@ -279,11 +385,33 @@ func (r *Runtime) RunTurn(ctx context.Context, sessionID, userMessage string) (<
 
 	out := make(chan TurnEvent, config.TurnEventBufferSize)
 	go func() {
-		defer mu.Unlock()
+		defer unlock()
 		r.runAgenticLoop(ctx, session.ID, out)
 	}()
 
-	return out, nil
+	return traceTurn(span, out), nil
+}
+
+// RecordMessage adds a user message to the session history without running a
+// turn, so later turns see it as context.
+func (r *Runtime) RecordMessage(ctx context.Context, sessionID, userMessage string) error {
+	session, err := r.getOrCreateSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("resolving session: %w", err)
+	}
+
+	mu := r.sessionLock(session.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return r.appendMessage(ctx, &store.Message{
+		ID:          uuid.NewString(),
+		SessionID:   session.ID,
+		Role:        llm.RoleUser,
+		ContentType: store.ContentTypeText,
+		Content:     userMessage,
+		CreatedAt:   time.Now().UTC(),
+	})
 }
 
 func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan<- TurnEvent) {
@@ -295,15 +423,18 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 		out <- TurnEvent{Type: TurnError, Error: fmt.Errorf("loading session: %w", err)}
 		return
 	}
-	ctx = tools.WithSessionInfo(ctx, sessionID, sess.AgentID)
+	agentCfg := r.settingsFor(sess.AgentID)
+	agentCfg.registry = restrictTools(ctx, agentCfg.registry)
+	ctx = tools.WithSessionInfo(ctx, sessionID, agentCfg.id)
+	ctx = tools.WithMemoryNamespace(ctx, agentCfg.memoryNS)
 
 	if err := r.CompactSession(ctx, sessionID); err != nil {
 		logger.Warn("session compaction failed", slog.String("err", err.Error()))
 	}
 
 	var toolDefs []llm.ToolDefinition
-	if r.registry != nil && r.provider.SupportsToolUse() {
-		toolDefs = r.registry.Definitions()
+	if agentCfg.registry != nil && agentCfg.provider.SupportsToolUse() {
+		toolDefs = agentCfg.registry.Definitions()
 	}
 
 	history, err := r.store.RecentMessages(ctx, sessionID, config.RecentMessagesLimit)
@@ -312,19 +443,20 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 		return
 	}
 
-	systemPrompt, chatMessages := r.buildSmartContext(ctx, sess.AgentID, sessionID, history)
+	systemPrompt, chatMessages := r.buildSmartContext(ctx, agentCfg, sessionID, history)
 
 	var llmErrors int
 	var verificationAttempts int
 	var lastCheckpointTokens int
 	var ephemeralContext string
 	var allToolsUsed []string
+	var allFilesWritten []string
 
 	// Extract the original user prompt from the most recent user message.
 	var originalPrompt string
 	for i := len(history) - 1; i >= 0; i-- {
 		if history[i].Role == llm.RoleUser && history[i].ContentType != store.ContentTypeToolResults {
-			originalPrompt = history[i].Content
+			originalPrompt = messageToLLM(history[i]).Content
 			break
 		}
 	}
@@ -351,8 +483,8 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 		}
 
 		llmStart := time.Now()
-		events, err := r.chatWithRetry(ctx, logger, llm.ChatRequest{
-			Model:     r.model,
+		events, err := r.chatWithRetry(ctx, logger, agentCfg.provider, llm.ChatRequest{
+			Model:     agentCfg.model,
 			System:    prompt,
 			Messages:  chatMessages,
 			MaxTokens: r.maxOutputTokens,
@@ -381,8 +513,13 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 		var toolCalls []llm.ToolCall
 		var usage *llm.Usage
 		var streamErr error
+		firstToken := true
 
 		for ev := range events {
+			if firstToken && (ev.Type == llm.EventToken || ev.Type == llm.EventToolCall) {
+				firstToken = false
+				telemetry.Metrics.LLMFirstToken.WithLabelValues(agentCfg.provider.Name(), agentCfg.model).Observe(time.Since(llmStart).Seconds())
+			}
 			switch ev.Type {
 			case llm.EventToken:
 				textContent = append(textContent, ev.Token...)
@@ -420,12 +557,9 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 		llmErrors = 0
 
 		llmElapsed := time.Since(llmStart)
-		telemetry.Metrics.LLMRequestsTotal.WithLabelValues("default", r.model).Inc()
-		telemetry.Metrics.LLMLatency.WithLabelValues("default", r.model).Observe(llmElapsed.Seconds())
-		if usage != nil {
-			telemetry.Metrics.TokensUsed.WithLabelValues("input", r.model).Add(float64(usage.InputTokens))
-			telemetry.Metrics.TokensUsed.WithLabelValues("output", r.model).Add(float64(usage.OutputTokens))
-		}
+		telemetry.Metrics.LLMRequestsTotal.WithLabelValues(agentCfg.provider.Name(), agentCfg.model).Inc()
+		telemetry.Metrics.LLMLatency.WithLabelValues(agentCfg.provider.Name(), agentCfg.model).Observe(llmElapsed.Seconds())
+		r.recordUsage(agentCfg.model, usage)
 		logger.Info("llm turn completed",
 			slog.Duration("duration", llmElapsed),
 			slog.Int("tool_calls", len(toolCalls)),
@@ -444,6 +578,7 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 					SessionID:    sessionID,
 					FinalMessage: string(textContent),
 					ToolsUsed:    allToolsUsed,
+					FilesWritten: allFilesWritten,
 				}
 				vResult := r.verificationRunner.Run(ctx, tr)
 				if vResult.Status == verification.Failed {
@@ -490,7 +625,7 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 			tasks[i] = executor.Task{
 				ID: tc.ID,
 				Fn: func(ctx context.Context) (string, error) {
-					result := r.executeTool(ctx, logger, sessionID, tc, out)
+					result := r.executeTool(ctx, logger, agentCfg, sessionID, tc, out)
 					toolResults[idx] = result
 					if result.IsError {
 						if result.ErrorKind() == llm.ToolErrorPermanent {
@@ -556,6 +691,7 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 				break
 			}
 		}
+		allFilesWritten = appendFilesWritten(allFilesWritten, toolCalls, toolResults)
 
 		if len(replanSummary.FailedTools) > 0 {
 			if rotator != nil {
@@ -569,6 +705,7 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 					errs[i] = fmt.Errorf("%s: %s", f.Name, f.Error)
 				}
 				if s, rf := rotator.Next(tc, errs); s != nil {
+					telemetry.Metrics.RetryStrategies.WithLabelValues(s.Name()).Inc()
 					ephemeralContext = rf.EphemeralHint
 					logger.Info("strategy rotation applied",
 						slog.String("strategy", s.Name()),
@@ -610,6 +747,8 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 			if r.checkpointMgr.ShouldCheckpoint(cpState) {
 				snap := r.checkpointMgr.BuildSnapshot(iteration+1, toolNames, string(textContent))
 				snap.SessionID = sessionID
+				// The summary is model output and is redacted like messages.
+				snap.ContextSummary, _ = r.redactor.String(snap.ContextSummary)
 				cpRecord := &store.Checkpoint{
 					ID:             snap.ID,
 					SessionID:      sessionID,
@@ -647,28 +786,49 @@ func (r *Runtime) runAgenticLoop(ctx context.Context, sessionID string, out chan
 	out <- TurnEvent{Type: TurnDone, Message: "(max tool iterations reached)"}
 }
 
-func (r *Runtime) executeTool(ctx context.Context, logger *slog.Logger, sessionID string, tc llm.ToolCall, out chan<- TurnEvent) llm.ToolResult {
+func (r *Runtime) executeTool(ctx context.Context, logger *slog.Logger, agentCfg agentSettings, sessionID string, tc llm.ToolCall, out chan<- TurnEvent) llm.ToolResult {
 	logger.Info("executing tool",
 		slog.String("tool", tc.Name),
 		slog.String("id", tc.ID),
 	)
 
-	if r.approver != nil && !autoApproveFromContext(ctx) {
+	mustAsk := requiresApproval(agentCfg.registry, tc.Name)
+	if r.approver != nil && (mustAsk || !autoApproveFromContext(ctx)) {
 		req := ApprovalRequest{
 			ID:        uuid.NewString(),
 			SessionID: sessionID,
 			ToolName:  tc.Name,
 			Input:     string(tc.Input),
+			Scope:     approvalScopeFromContext(ctx),
+		}
+		mode := r.approver.mode
+		if mustAsk && mode == ApprovalAuto {
+			mode = ApprovalAsk
 		}
 
-		if r.approver.mode == ApprovalAsk {
-			out <- TurnEvent{
-				Type:            TurnApprovalNeeded,
-				ApprovalRequest: &req,
+		var approved bool
+		var err error
+		if mode == ApprovalAsk && (approvalsDeniedFromContext(ctx) || autoApproveFromContext(ctx)) {
+			err = fmt.Errorf("approvals are not available to this client")
+		} else {
+			announce := func() {
+				if mode == ApprovalAsk {
+					out <- TurnEvent{
+						Type:            TurnApprovalNeeded,
+						ApprovalRequest: &req,
+					}
+				}
 			}
+			actx, span := telemetry.StartSpan(ctx, "agent.approval",
+				semconv.GenAIToolName(tc.Name),
+				attribute.String("approval.mode", string(mode)),
+			)
+			waitStart := time.Now()
+			approved, err = r.approver.request(actx, req, mode, announce)
+			span.SetAttributes(attribute.Bool("approval.approved", approved))
+			telemetry.EndSpan(span, err)
+			telemetry.Metrics.ApprovalWait.WithLabelValues(string(mode), approvalOutcome(approved, err)).Observe(time.Since(waitStart).Seconds())
 		}
-
-		approved, err := r.approver.RequestApproval(ctx, req)
 		if err != nil || !approved {
 			reason := "tool call denied by user"
 			if err != nil {
@@ -684,7 +844,7 @@ func (r *Runtime) executeTool(ctx context.Context, logger *slog.Logger, sessionI
 		r.auditLog(ctx, audit.EventToolApprove, sessionID, tc.Name, "")
 	}
 
-	policy := r.defaultPolicy
+	policy := agentCfg.policy
 	if policy.Timeout == 0 {
 		policy = sandbox.DefaultPolicy()
 	}
@@ -692,7 +852,7 @@ func (r *Runtime) executeTool(ctx context.Context, logger *slog.Logger, sessionI
 		policy.RequireApproval = false
 	}
 
-	result := runTool(ctx, logger, tc, r.registry, r.sandbox, policy)
+	result := runTool(ctx, logger, tc, agentCfg.registry, r.sandbox, policy)
 
 	if result.IsError {
 		r.auditLog(ctx, audit.EventToolExec, sessionID, tc.Name, result.Content)
@@ -719,9 +879,54 @@ func (r *Runtime) persistMessage(ctx context.Context, sessionID, role, contentTy
 		CreatedAt:   time.Now().UTC(),
 	}
 
+	return r.appendMessage(ctx, msg)
+}
+
+// appendMessage redacts msg and stores it. Redactions are audited by rule
+// and count only; the matched text never reaches the database.
+// AppendMessage stores msg in its session's history after redaction, for
+// messages that reach a session outside a turn.
+func (r *Runtime) AppendMessage(ctx context.Context, msg *store.Message) error {
+	return r.appendMessage(ctx, msg)
+}
+
+func (r *Runtime) appendMessage(ctx context.Context, msg *store.Message) error {
+	if r.redactor != nil {
+		var counts redact.Counts
+		msg.Content, counts = r.redactContent(msg.ContentType, msg.Content)
+		if counts.Total() > 0 {
+			r.auditLog(ctx, audit.EventRedaction, msg.SessionID, "system",
+				fmt.Sprintf("role=%s content_type=%s %s", msg.Role, msg.ContentType, counts))
+		}
+	}
 	return r.store.AppendMessage(ctx, msg)
 }
 
+func (r *Runtime) redactContent(contentType, content string) (string, redact.Counts) {
+	switch contentType {
+	case store.ContentTypeToolCalls, store.ContentTypeToolResults:
+		return r.redactor.JSON(content)
+	case store.ContentTypeMedia:
+		// Only the caption is redacted; image data is left intact.
+		var mc mediaContent
+		if err := json.Unmarshal([]byte(content), &mc); err != nil {
+			return r.redactor.String(content)
+		}
+		text, counts := r.redactor.String(mc.Text)
+		if counts.Total() == 0 {
+			return content, counts
+		}
+		mc.Text = text
+		data, err := json.Marshal(mc)
+		if err != nil {
+			return r.redactor.String(content)
+		}
+		return string(data), counts
+	default:
+		return r.redactor.String(content)
+	}
+}
+
 func (r *Runtime) persistAssistantMessage(ctx context.Context, sessionID, content string, usage *llm.Usage) error {
 	if err := r.persistMessage(ctx, sessionID, llm.RoleAssistant, store.ContentTypeText, content, usage); err != nil {
 		return err
@@ -743,6 +948,14 @@ func marshalToolCalls(text string, toolCalls []llm.ToolCall) (string, error) {
 	return string(data), nil
 }
 
+func marshalMedia(text string, images []llm.ImageContent) (string, error) {
+	data, err := json.Marshal(mediaContent{Text: text, Images: images})
+	if err != nil {
+		return "", fmt.Errorf("marshaling media message: %w", err)
+	}
+	return string(data), nil
+}
+
 func marshalToolResults(results []llm.ToolResult) (string, error) {
 	data, err := json.Marshal(results)
 	if err != nil {
@@ -767,21 +980,34 @@ func (r *Runtime) buildContext(history []store.Message) []llm.ChatMessage {
 }
 
 func (r *Runtime) getOrCreateSession(ctx context.Context, sessionID string) (*store.Session, error) {
-	sess, created, err := r.store.GetOrCreateSession(ctx, sessionID, "webchat", "anonymous")
+	return r.EnsureSession(ctx, sessionID, "", "webchat", "anonymous")
+}
+
+// EnsureSession creates sessionID for channel and peerID if it does not exist
+// yet. A non-empty agentID binds the session to that agent; otherwise new
+// sessions use the routed agent and existing ones keep theirs.
+func (r *Runtime) EnsureSession(ctx context.Context, sessionID, agentID, channel, peerID string) (*store.Session, error) {
+	if agentID == "" {
+		if sess, err := r.store.GetSession(ctx, sessionID); err == nil {
+			return sess, nil
+		}
+		agentID = r.AgentFor(channel, "", peerID)
+	}
+
+	sess, created, err := r.store.GetOrCreateSession(ctx, sessionID, agentID, channel, peerID)
 	if err != nil {
 		return nil, err
 	}
 	if created {
-		telemetry.Metrics.ActiveSessions.Inc()
 		r.auditLog(ctx, audit.EventSessionNew, sessionID, "system",
 			fmt.Sprintf("channel=%s peer=%s", sess.Channel, sess.PeerID))
 	}
 	return sess, nil
 }
 
-func (r *Runtime) buildSmartContext(ctx context.Context, agentID, sessionID string, history []store.Message) (string, []llm.ChatMessage) {
+func (r *Runtime) buildSmartContext(ctx context.Context, agentCfg agentSettings, sessionID string, history []store.Message) (string, []llm.ChatMessage) {
 	if r.ctxBuilder == nil {
-		return r.systemPrompt, r.buildContext(history)
+		return agentCfg.systemPrompt, r.buildContext(history)
 	}
 
 	var wsFiles []WorkspaceFile
@@ -793,7 +1019,7 @@ func (r *Runtime) buildSmartContext(ctx context.Context, agentID, sessionID stri
 			lastHashes = make(map[string]string)
 		}
 
-		memCtx, newHashes, err := r.memory.BuildContext(ctx, agentID, lastHashes)
+		memCtx, newHashes, err := r.memory.BuildContext(ctx, agentCfg.memoryNS, lastHashes)
 		if err == nil {
 			r.memoryHashes[sessionID] = newHashes
 			if memCtx != "" {
@@ -803,7 +1029,7 @@ func (r *Runtime) buildSmartContext(ctx context.Context, agentID, sessionID stri
 		r.memoryMu.Unlock()
 	}
 
-	return r.ctxBuilder.Build(wsFiles, history, r.systemPrompt)
+	return r.ctxBuilder.Build(wsFiles, history, agentCfg.systemPrompt)
 }
 
 func (r *Runtime) auditLog(ctx context.Context, eventType, sessionID, actor, detail string) {
@@ -813,7 +1039,7 @@ func (r *Runtime) auditLog(ctx context.Context, eventType, sessionID, actor, det
 	_ = r.audit.Log(ctx, eventType, sessionID, tools.AgentIDFromContext(ctx), actor, detail)
 }
 
-func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []string) (string, error) {
+func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []string) (reply string, err error) {
 	depth := tools.SubagentDepthFromContext(ctx)
 	if depth >= config.MaxSubagentDepth {
 		return "", fmt.Errorf("subagent depth limit exceeded (max %d)", config.MaxSubagentDepth)
@@ -822,15 +1048,20 @@ func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []
 	ctx = tools.WithSubagentDepth(ctx, depth+1)
 	ctx = WithAutoApprove(ctx)
 
-	registry := r.registry
+	agentCfg := r.settingsFor(tools.AgentIDFromContext(ctx))
+	ctx, span := startTurnSpan(ctx, agentCfg, tools.SessionIDFromContext(ctx))
+	span.SetAttributes(attribute.Int("subagent.depth", depth+1))
+	defer func() {
+		telemetry.Metrics.SubagentsTotal.WithLabelValues(statusLabel(err)).Inc()
+		telemetry.EndSpan(span, err)
+	}()
+	registry := restrictTools(ctx, agentCfg.registry)
 	if len(allowedTools) > 0 {
 		registry = registry.Filter(allowedTools)
 	}
 	registry = registry.Without([]string{"subagent", "spawn"})
 
-	sessionID := tools.SessionIDFromContext(ctx)
-	agentID := tools.AgentIDFromContext(ctx)
-	systemPrompt := r.buildSubagentContext(ctx, agentID, sessionID)
+	systemPrompt := r.buildSubagentContext(ctx, agentCfg)
 
 	logger := telemetry.FromContext(ctx)
 
@@ -841,14 +1072,14 @@ func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []
 	})
 
 	var toolDefs []llm.ToolDefinition
-	if registry != nil && r.provider.SupportsToolUse() {
+	if registry != nil && agentCfg.provider.SupportsToolUse() {
 		toolDefs = registry.Definitions()
 	}
 
 	var llmErrors int
 	for iteration := 0; iteration < r.maxToolIter; iteration++ {
-		events, err := r.chatWithRetry(ctx, logger, llm.ChatRequest{
-			Model:     r.model,
+		events, err := r.chatWithRetry(ctx, logger, agentCfg.provider, llm.ChatRequest{
+			Model:     agentCfg.model,
 			System:    systemPrompt,
 			Messages:  messages,
 			MaxTokens: r.maxOutputTokens,
@@ -881,6 +1112,8 @@ func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []
 				textContent = append(textContent, ev.Token...)
 			case llm.EventToolCall:
 				toolCalls = append(toolCalls, *ev.ToolCall)
+			case llm.EventDone:
+				r.recordUsage(agentCfg.model, ev.Usage)
 			case llm.EventError:
 				streamErr = ev.Error
 			}
@@ -923,7 +1156,12 @@ func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []
 			subTasks[i] = executor.Task{
 				ID: tc.ID,
 				Fn: func(ctx context.Context) (string, error) {
-					policy := r.defaultPolicy
+					if requiresApproval(registry, tc.Name) {
+						msg := "approval error: subagents cannot ask for approval"
+						toolResults[idx] = llm.ToolResult{ToolCallID: tc.ID, Content: msg, IsError: true}
+						return msg, &executor.PermanentError{Msg: msg}
+					}
+					policy := agentCfg.policy
 					if policy.Timeout == 0 {
 						policy = sandbox.DefaultPolicy()
 					}
@@ -952,11 +1190,11 @@ func (r *Runtime) RunSubturn(ctx context.Context, prompt string, allowedTools []
 	return "(max tool iterations reached)", nil
 }
 
-func (r *Runtime) buildSubagentContext(ctx context.Context, agentID, sessionID string) string {
-	systemPrompt := r.systemPrompt
+func (r *Runtime) buildSubagentContext(ctx context.Context, agentCfg agentSettings) string {
+	systemPrompt := agentCfg.systemPrompt
 
 	if r.memory != nil {
-		memCtx, _, err := r.memory.BuildContext(ctx, agentID, make(map[string]string))
+		memCtx, _, err := r.memory.BuildContext(ctx, agentCfg.memoryNS, make(map[string]string))
 		if err == nil && memCtx != "" {
 			systemPrompt += "\n\n" + memCtx
 		}
@@ -965,6 +1203,20 @@ func (r *Runtime) buildSubagentContext(ctx context.Context, agentID, sessionID s
 	return systemPrompt
 }
 
+// requiresApproval reports whether the named tool asks for approval on
+// every call regardless of the approval mode.
+func requiresApproval(registry *tools.Registry, name string) bool {
+	if registry == nil {
+		return false
+	}
+	t, err := registry.Get(name)
+	if err != nil {
+		return false
+	}
+	ar, ok := t.(tools.ApprovalRequirer)
+	return ok && ar.RequiresApproval()
+}
+
 func runTool(ctx context.Context, logger *slog.Logger, tc llm.ToolCall, registry *tools.Registry, sb sandbox.Sandbox, policy sandbox.Policy) llm.ToolResult {
 	if registry == nil {
 		result := llm.ToolResult{
@@ -987,9 +1239,16 @@ func runTool(ctx context.Context, logger *slog.Logger, tc llm.ToolCall, registry
 		return result
 	}
 
+	ctx = tools.WithToolCallID(ctx, tc.ID)
+	ctx, span := telemetry.Tracer().Start(ctx, "execute_tool "+tc.Name, trace.WithAttributes(
+		semconv.GenAIOperationNameExecuteTool,
+		semconv.GenAIToolName(tc.Name),
+		semconv.GenAIToolCallID(tc.ID),
+	))
 	start := time.Now()
 	output, err := tool.Execute(ctx, tc.Input, sb, policy)
 	elapsed := time.Since(start)
+	telemetry.EndSpan(span, err)
 
 	telemetry.Metrics.ToolDuration.WithLabelValues(tc.Name).Observe(elapsed.Seconds())
 
@@ -1037,6 +1296,31 @@ func ContentHash(content string) string {
 	return hex.EncodeToString(h[:])
 }
 
+// appendFilesWritten adds the paths of successful file_write calls to
+// written, resolved the same way the tool resolves them and without
+// duplicates.
+func appendFilesWritten(written []string, calls []llm.ToolCall, results []llm.ToolResult) []string {
+	for i, tc := range calls {
+		if tc.Name != "file_write" || i >= len(results) || results[i].IsError || results[i].ToolCallID == "" {
+			continue
+		}
+		var input struct {
+			Path string `json:"path"`
+		}
+		if json.Unmarshal(tc.Input, &input) != nil || input.Path == "" {
+			continue
+		}
+		path := input.Path
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if !slices.Contains(written, path) {
+			written = append(written, path)
+		}
+	}
+	return written
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -2,7 +2,11 @@ package agent
 
 import (
 	"context"
+	"path/filepath"
+	"slices"
 	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/llm"
 )
 
 func TestContentHash_Deterministic(t *testing.T) {
@@ -43,3 +47,26 @@ func TestAutoApproveFromContext_WrongType(t *testing.T) {
 		t.Error("non-bool value should return false")
 	}
 }
+
+func TestAppendFilesWritten(t *testing.T) {
+	calls := []llm.ToolCall{
+		{ID: "1", Name: "file_write", Input: []byte(`{"path":"/tmp/a.go","content":"x"}`)},
+		{ID: "2", Name: "file_write", Input: []byte(`{"path":"/tmp/b.go","content":"x"}`)},
+		{ID: "3", Name: "file_read", Input: []byte(`{"path":"/tmp/c.go"}`)},
+		{ID: "4", Name: "file_write", Input: []byte(`{"path":"rel.txt","content":"x"}`)},
+		{ID: "5", Name: "file_write", Input: []byte(`{"path":"/tmp/a.go","content":"y"}`)},
+	}
+	results := []llm.ToolResult{
+		{ToolCallID: "1"},
+		{ToolCallID: "2", IsError: true},
+		{ToolCallID: "3"},
+		{ToolCallID: "4"},
+		{ToolCallID: "5"},
+	}
+	rel, _ := filepath.Abs("rel.txt")
+	got := appendFilesWritten([]string{"/tmp/earlier.go"}, calls, results)
+	want := []string{"/tmp/earlier.go", "/tmp/a.go", rel}
+	if !slices.Equal(got, want) {
+		t.Errorf("files written = %v, want %v", got, want)
+	}
+}
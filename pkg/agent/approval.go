@@ -3,7 +3,9 @@ package agent
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 type ApprovalMode string
@@ -15,10 +17,15 @@ const (
 )
 
 type ApprovalRequest struct {
-	ID        string
-	SessionID string
-	ToolName  string
-	Input     string
+	ID          string
+	SessionID   string
+	ToolName    string
+	Input       string
+	RequestedAt time.Time
+	// Scope is empty for requests chat channels and the admin API may
+	// answer. Requests from other frontends carry the frontend's scope and
+	// are only answered through RespondIn with the same scope.
+	Scope string
 }
 
 type ApprovalResponse struct {
@@ -28,33 +35,49 @@ type ApprovalResponse struct {
 
 type Approver struct {
 	mode      ApprovalMode
-	pending   map[string]chan bool
+	pending   map[string]*pendingApproval
 	mu        sync.Mutex
 	onRequest func(req ApprovalRequest)
 }
 
+type pendingApproval struct {
+	req ApprovalRequest
+	ch  chan bool
+}
+
 func NewApprover(mode ApprovalMode, onRequest func(ApprovalRequest)) *Approver {
 	if mode == "" {
 		mode = ApprovalAsk
 	}
 	return &Approver{
 		mode:      mode,
-		pending:   make(map[string]chan bool),
+		pending:   make(map[string]*pendingApproval),
 		onRequest: onRequest,
 	}
 }
 
 func (a *Approver) RequestApproval(ctx context.Context, req ApprovalRequest) (bool, error) {
-	switch a.mode {
+	return a.request(ctx, req, a.mode, nil)
+}
+
+// request handles req under mode, which may be stricter than the
+// approver's own for tools that always need approval. announce, if set, is
+// called once req is pending, so an answer to it cannot arrive too early.
+func (a *Approver) request(ctx context.Context, req ApprovalRequest, mode ApprovalMode, announce func()) (bool, error) {
+	switch mode {
 	case ApprovalAuto:
 		return true, nil
 	case ApprovalDeny:
 		return false, nil
 	}
 
+	if req.RequestedAt.IsZero() {
+		req.RequestedAt = time.Now()
+	}
+
 	ch := make(chan bool, 1)
 	a.mu.Lock()
-	a.pending[req.ID] = ch
+	a.pending[req.ID] = &pendingApproval{req: req, ch: ch}
 	a.mu.Unlock()
 
 	defer func() {
@@ -63,7 +86,10 @@ func (a *Approver) RequestApproval(ctx context.Context, req ApprovalRequest) (bo
 		a.mu.Unlock()
 	}()
 
-	if a.onRequest != nil {
+	if announce != nil {
+		announce()
+	}
+	if a.onRequest != nil && req.Scope == "" {
 		a.onRequest(req)
 	}
 
@@ -75,15 +101,42 @@ func (a *Approver) RequestApproval(ctx context.Context, req ApprovalRequest) (bo
 	}
 }
 
-func (a *Approver) Respond(resp ApprovalResponse) {
+// Respond answers a pending request without a scope. It reports false when
+// no unscoped request with that ID is waiting.
+func (a *Approver) Respond(resp ApprovalResponse) bool {
+	return a.RespondIn("", resp)
+}
+
+// RespondIn answers a pending request made in scope.
+func (a *Approver) RespondIn(scope string, resp ApprovalResponse) bool {
 	a.mu.Lock()
-	ch, ok := a.pending[resp.RequestID]
+	p, ok := a.pending[resp.RequestID]
+	ok = ok && p.req.Scope == scope
 	a.mu.Unlock()
 
 	if ok {
 		select {
-		case ch <- resp.Approved:
+		case p.ch <- resp.Approved:
 		default:
 		}
 	}
+	return ok
+}
+
+// Pending lists the requests without a scope waiting for an answer, oldest
+// first.
+func (a *Approver) Pending() []ApprovalRequest {
+	a.mu.Lock()
+	reqs := make([]ApprovalRequest, 0, len(a.pending))
+	for _, p := range a.pending {
+		if p.req.Scope == "" {
+			reqs = append(reqs, p.req)
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].RequestedAt.Before(reqs[j].RequestedAt)
+	})
+	return reqs
 }
@@ -99,7 +99,42 @@ func TestApprover_AskMode_CallbackInvoked(t *testing.T) {
 
 func TestApprover_Respond_UnknownID(t *testing.T) {
 	a := NewApprover(ApprovalAsk, nil)
-	a.Respond(ApprovalResponse{RequestID: "nonexistent", Approved: true})
+	if a.Respond(ApprovalResponse{RequestID: "nonexistent", Approved: true}) {
+		t.Error("Respond reported an unknown request as pending")
+	}
+}
+
+func TestApprover_Pending(t *testing.T) {
+	requested := make(chan struct{}, 2)
+	a := NewApprover(ApprovalAsk, func(ApprovalRequest) { requested <- struct{}{} })
+
+	done := make(chan bool, 2)
+	for _, id := range []string{"p-1", "p-2"} {
+		go func() {
+			approved, _ := a.RequestApproval(context.Background(), ApprovalRequest{ID: id, ToolName: "shell"})
+			done <- approved
+		}()
+		<-requested
+	}
+
+	pending := a.Pending()
+	if len(pending) != 2 || pending[0].ID != "p-1" || pending[1].ID != "p-2" {
+		t.Fatalf("Pending() = %+v, want p-1 then p-2", pending)
+	}
+	if pending[0].RequestedAt.IsZero() {
+		t.Error("RequestedAt not set")
+	}
+
+	for _, p := range pending {
+		if !a.Respond(ApprovalResponse{RequestID: p.ID, Approved: true}) {
+			t.Errorf("Respond(%s) = false", p.ID)
+		}
+	}
+	<-done
+	<-done
+	if got := a.Pending(); len(got) != 0 {
+		t.Errorf("Pending() after answers = %+v", got)
+	}
 }
 
 func TestNewApprover_DefaultMode(t *testing.T) {
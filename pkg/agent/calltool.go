@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+)
+
+// ToolDefinitions lists the tools agentID's turns may use.
+func (r *Runtime) ToolDefinitions(agentID string) []llm.ToolDefinition {
+	registry := r.settingsFor(agentID).registry
+	if registry == nil {
+		return nil
+	}
+	return registry.Definitions()
+}
+
+// MemoryNamespace returns the memory namespace agentID reads and writes.
+func (r *Runtime) MemoryNamespace(agentID string) string {
+	return r.settingsFor(agentID).memoryNS
+}
+
+// CallTool runs a single tool call in sessionID outside a model turn, under
+// the session agent's tools, sandbox policy and approval rules. Approval
+// requests are announced on out as in RunTurn.
+func (r *Runtime) CallTool(ctx context.Context, sessionID string, tc llm.ToolCall, out chan<- TurnEvent) (llm.ToolResult, error) {
+	sess, err := r.store.GetSession(ctx, sessionID)
+	if err != nil {
+		return llm.ToolResult{}, fmt.Errorf("loading session: %w", err)
+	}
+	agentCfg := r.settingsFor(sess.AgentID)
+	agentCfg.registry = restrictTools(ctx, agentCfg.registry)
+	ctx = tools.WithSessionInfo(ctx, sessionID, agentCfg.id)
+	ctx = tools.WithMemoryNamespace(ctx, agentCfg.memoryNS)
+
+	ctx, cancel := context.WithTimeout(ctx, r.toolTimeout)
+	defer cancel()
+
+	if tc.ID == "" {
+		tc.ID = uuid.NewString()
+	}
+	return r.executeTool(ctx, telemetry.FromContext(ctx), agentCfg, sessionID, tc, out), nil
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+	"strings"
+)
+
+// CommandExpander turns a slash-command message such as "/name args" into
+// the prompt it stands for. Unknown commands report ok=false and reach the
+// model unchanged.
+type CommandExpander interface {
+	ExpandCommand(ctx context.Context, name, args string) (prompt string, ok bool, err error)
+}
+
+// SetCommands installs the slash-commands expanded before a turn. It must be
+// called before turns run.
+func (r *Runtime) SetCommands(c CommandExpander) {
+	r.commands = c
+}
+
+// parseSlashCommand splits "/name args" into name and args, dropping the
+// "@bot" suffix Telegram adds to commands in groups.
+func parseSlashCommand(msg string) (name, args string, ok bool) {
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, "/") || len(msg) == 1 {
+		return "", "", false
+	}
+	name, args, _ = strings.Cut(msg[1:], " ")
+	if i := strings.IndexAny(name, "\n\t"); i >= 0 {
+		name, args = name[:i], name[i+1:]+" "+args
+	}
+	name, _, _ = strings.Cut(name, "@")
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(args), true
+}
+
+// expandCommand replaces a known slash-command with its prompt. A command
+// that fails to expand ends the turn with the error as the reply, so the
+// user sees what went wrong.
+func (r *Runtime) expandCommand(ctx context.Context, userMessage string) (string, <-chan TurnEvent) {
+	if r.commands == nil {
+		return userMessage, nil
+	}
+	name, args, ok := parseSlashCommand(userMessage)
+	if !ok {
+		return userMessage, nil
+	}
+	prompt, known, err := r.commands.ExpandCommand(ctx, name, args)
+	if err != nil {
+		out := make(chan TurnEvent, 1)
+		out <- TurnEvent{Type: TurnDone, Message: "/" + name + ": " + err.Error()}
+		close(out)
+		return "", out
+	}
+	if !known {
+		return userMessage, nil
+	}
+	return prompt, nil
+}
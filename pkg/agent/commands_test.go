@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/llm"
+)
+
+func TestParseSlashCommand(t *testing.T) {
+	tests := []struct {
+		msg, name, args string
+		ok              bool
+	}{
+		{"/review main.go", "review", "main.go", true},
+		{"  /review  ", "review", "", true},
+		{"/review@pincer_bot main.go", "review", "main.go", true},
+		{"/review\nline two", "review", "line two", true},
+		{"review", "", "", false},
+		{"/", "", "", false},
+		{"/usr/bin/env is a path", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseSlashCommand(tt.msg)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("parseSlashCommand(%q) = %q, %q, %v", tt.msg, name, args, ok)
+		}
+	}
+}
+
+type fakeCommands struct{}
+
+func (fakeCommands) ExpandCommand(_ context.Context, name, args string) (string, bool, error) {
+	switch name {
+	case "greet":
+		return "Say hello to " + args, true, nil
+	case "broken":
+		return "", true, errors.New("missing required arguments: x")
+	}
+	return "", false, nil
+}
+
+func TestRunTurn_SlashCommands(t *testing.T) {
+	fp := &fakeProvider{events: []llm.ChatEvent{
+		{Type: llm.EventToken, Token: "ok"},
+		{Type: llm.EventDone, Usage: &llm.Usage{}},
+	}}
+	rt, s := newTestRuntime(t, fp)
+	rt.SetCommands(fakeCommands{})
+	ctx := context.Background()
+
+	ch, err := rt.RunTurn(ctx, "sess-cmd", "/greet Ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectTurnEvents(ch)
+	if got := fp.gotReq.Messages[len(fp.gotReq.Messages)-1].Content; got != "Say hello to Ada" {
+		t.Errorf("model saw %q", got)
+	}
+
+	ch, err = rt.RunTurn(ctx, "sess-cmd", "/unknown stays as is")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectTurnEvents(ch)
+	if got := fp.gotReq.Messages[len(fp.gotReq.Messages)-1].Content; got != "/unknown stays as is" {
+		t.Errorf("model saw %q", got)
+	}
+
+	calls := fp.calls
+	ch, err = rt.RunTurn(ctx, "sess-cmd", "/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := collectTurnEvents(ch)
+	if len(events) != 1 || events[0].Type != TurnDone || events[0].Message != "/broken: missing required arguments: x" {
+		t.Errorf("events = %+v", events)
+	}
+	if fp.calls != calls {
+		t.Error("a failed command should not reach the model")
+	}
+	msgs, _ := s.RecentMessages(ctx, "sess-cmd", 50)
+	for _, m := range msgs {
+		if m.Content == "/broken" {
+			t.Error("a failed command should not be persisted")
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
 	"github.com/igorsilveira/pincer/pkg/config"
 	"github.com/igorsilveira/pincer/pkg/llm"
 	"github.com/igorsilveira/pincer/pkg/store"
@@ -34,7 +35,7 @@ Use bullet points. Be specific and factual. Keep under 500 words.
 Conversation:
 %s`
 
-func (r *Runtime) CompactSession(ctx context.Context, sessionID string) error {
+func (r *Runtime) CompactSession(ctx context.Context, sessionID string) (err error) {
 	logger := telemetry.FromContext(ctx)
 
 	count, err := r.store.MessageCount(ctx, sessionID)
@@ -50,6 +51,9 @@ func (r *Runtime) CompactSession(ctx context.Context, sessionID string) error {
 		slog.String("session_id", sessionID),
 		slog.Int64("message_count", count),
 	)
+	defer func() {
+		telemetry.Metrics.Compactions.WithLabelValues(statusLabel(err)).Inc()
+	}()
 
 	messages, err := r.store.RecentMessages(ctx, sessionID, int(count))
 	if err != nil {
@@ -105,6 +109,11 @@ func (r *Runtime) CompactSession(ctx context.Context, sessionID string) error {
 			}
 			continue
 		}
+		if m.ContentType == store.ContentTypeMedia {
+			msg := messageToLLM(m)
+			fmt.Fprintf(&conv, "%s: %s [%d image(s) attached]\n\n", m.Role, msg.Content, len(msg.Images))
+			continue
+		}
 		if m.ContentType != store.ContentTypeText {
 			fmt.Fprintf(&conv, "[%s: %s interaction]\n", m.Role, m.ContentType)
 			continue
@@ -114,23 +123,30 @@ func (r *Runtime) CompactSession(ctx context.Context, sessionID string) error {
 
 	prompt := fmt.Sprintf(compactionPrompt, conv.String())
 
-	events, err := r.provider.Chat(ctx, llm.ChatRequest{
-		Model:     r.model,
+	agentCfg := r.settingsFor(tools.AgentIDFromContext(ctx))
+	req := llm.ChatRequest{
+		Model:     agentCfg.model,
 		System:    "You are a conversation summarizer for an AI assistant. Produce a structured, factual summary that preserves actionable context. Never fabricate information not present in the conversation.",
 		Messages:  []llm.ChatMessage{{Role: llm.RoleUser, Content: prompt}},
 		MaxTokens: config.CompactionMaxTokens,
 		Stream:    false,
-	})
+	}
+	chatCtx, span := startChatSpan(ctx, agentCfg.provider, req)
+	events, err := agentCfg.provider.Chat(chatCtx, req)
 	if err != nil {
+		telemetry.EndSpan(span, err)
 		return fmt.Errorf("calling LLM for summary: %w", err)
 	}
+	events = traceChat(span, events)
 
 	var summary strings.Builder
 	for ev := range events {
-		if ev.Type == llm.EventToken {
+		switch ev.Type {
+		case llm.EventToken:
 			summary.WriteString(ev.Token)
-		}
-		if ev.Type == llm.EventError {
+		case llm.EventDone:
+			r.recordUsage(agentCfg.model, ev.Usage)
+		case llm.EventError:
 			return fmt.Errorf("LLM summary error: %w", ev.Error)
 		}
 	}
@@ -148,10 +164,11 @@ func (r *Runtime) CompactSession(ctx context.Context, sessionID string) error {
 		CreatedAt:   recentMessages[0].CreatedAt.Add(-time.Second),
 	}
 
-	if err := r.store.AppendMessage(ctx, summaryMsg); err != nil {
+	if err := r.appendMessage(ctx, summaryMsg); err != nil {
 		return fmt.Errorf("inserting summary: %w", err)
 	}
 
+	telemetry.Metrics.CompactionSummary.Observe(float64(estimateTokens(summary.String())))
 	logger.Info("session compacted",
 		slog.String("session_id", sessionID),
 		slog.Int("removed", len(oldMessages)),
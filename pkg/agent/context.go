@@ -117,6 +117,16 @@ func (cb *ContextBuilder) selectHistory(history []store.Message, budget int) []l
 
 		chatMsg := messageToLLM(m)
 
+		if len(chatMsg.Images) > 0 {
+			if imageResultsSeen < config.MaxRecentImageMessages {
+				tokens += len(chatMsg.Images) * config.ImageTokenEstimate
+				cb.resolveImages(chatMsg.Images)
+				imageResultsSeen++
+			} else {
+				chatMsg.Images = nil
+			}
+		}
+
 		if len(chatMsg.ToolResults) > 0 {
 			hasImages := false
 			for j := range chatMsg.ToolResults {
@@ -178,18 +188,22 @@ func (cb *ContextBuilder) RebuildMessages(history []store.Message) []llm.ChatMes
 
 func (cb *ContextBuilder) resolveImageData(results []llm.ToolResult) {
 	for i := range results {
-		for j := range results[i].Images {
-			img := &results[i].Images[j]
-			if img.Data() == nil && img.Path != "" {
-				if cached, ok := cb.imageCache[img.Path]; ok {
-					img.SetData(cached)
-					continue
-				}
-				data, err := os.ReadFile(img.Path)
-				if err == nil {
-					img.SetData(data)
-					cb.imageCache[img.Path] = data
-				}
+		cb.resolveImages(results[i].Images)
+	}
+}
+
+func (cb *ContextBuilder) resolveImages(images []llm.ImageContent) {
+	for j := range images {
+		img := &images[j]
+		if img.Data() == nil && img.Path != "" {
+			if cached, ok := cb.imageCache[img.Path]; ok {
+				img.SetData(cached)
+				continue
+			}
+			data, err := os.ReadFile(img.Path)
+			if err == nil {
+				img.SetData(data)
+				cb.imageCache[img.Path] = data
 			}
 		}
 	}
@@ -218,8 +232,28 @@ func sanitizeToolPairs(msgs []llm.ChatMessage) []llm.ChatMessage {
 	return result
 }
 
+type mediaContent struct {
+	Text   string             `json:"text,omitempty"`
+	Images []llm.ImageContent `json:"images"`
+}
+
+// MessageToLLM decodes a stored message into text, tool calls, tool results
+// and images.
+func MessageToLLM(m store.Message) llm.ChatMessage {
+	return messageToLLM(m)
+}
+
 func messageToLLM(m store.Message) llm.ChatMessage {
 	switch m.ContentType {
+	case store.ContentTypeMedia:
+		var data mediaContent
+		if err := json.Unmarshal([]byte(m.Content), &data); err == nil {
+			return llm.ChatMessage{
+				Role:    m.Role,
+				Content: data.Text,
+				Images:  data.Images,
+			}
+		}
 	case store.ContentTypeToolCalls:
 		var data struct {
 			Text      string         `json:"text,omitempty"`
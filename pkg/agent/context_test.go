@@ -99,6 +99,45 @@ func TestMessageToLLM_ToolResults(t *testing.T) {
 	}
 }
 
+func TestMessageToLLM_Media(t *testing.T) {
+	content, err := marshalMedia("what is this?", []llm.ImageContent{{MediaType: "image/png", Path: "/tmp/shot.png"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := store.Message{
+		Role:        llm.RoleUser,
+		ContentType: store.ContentTypeMedia,
+		Content:     content,
+	}
+	got := messageToLLM(m)
+	if got.Content != "what is this?" {
+		t.Errorf("Content = %q, want %q", got.Content, "what is this?")
+	}
+	if len(got.Images) != 1 || got.Images[0].Path != "/tmp/shot.png" {
+		t.Fatalf("Images = %+v, want one image at /tmp/shot.png", got.Images)
+	}
+}
+
+func TestSelectHistory_LoadsUserImages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shot.png")
+	if err := os.WriteFile(path, []byte("fake png"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := marshalMedia("look", []llm.ImageContent{{MediaType: "image/png", Path: path}})
+
+	cb := NewContextBuilder(100000, 1000)
+	msgs := cb.selectHistory([]store.Message{
+		{Role: llm.RoleUser, ContentType: store.ContentTypeMedia, Content: content},
+	}, 50000)
+	if len(msgs) != 1 || len(msgs[0].Images) != 1 {
+		t.Fatalf("msgs = %+v, want one message with one image", msgs)
+	}
+	if string(msgs[0].Images[0].Data()) != "fake png" {
+		t.Errorf("image data = %q, want %q", msgs[0].Images[0].Data(), "fake png")
+	}
+}
+
 func TestMessageToLLM_InvalidJSON(t *testing.T) {
 	m := store.Message{
 		Role:        llm.RoleAssistant,
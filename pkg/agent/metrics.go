@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+)
+
+// lockSession takes sessionID's turn lock, counting the turn as queued while
+// an earlier turn in the session holds it. The session counts as active
+// until the returned function releases the lock.
+func (r *Runtime) lockSession(sessionID string) (unlock func()) {
+	mu := r.sessionLock(sessionID)
+	start := time.Now()
+	if !mu.TryLock() {
+		telemetry.Metrics.TurnsQueued.Inc()
+		mu.Lock()
+		telemetry.Metrics.TurnsQueued.Dec()
+	}
+	telemetry.Metrics.SessionLockWait.Observe(time.Since(start).Seconds())
+	telemetry.Metrics.ActiveSessions.Inc()
+	return func() {
+		telemetry.Metrics.ActiveSessions.Dec()
+		mu.Unlock()
+	}
+}
+
+// recordUsage counts a model call's tokens and, when the model is priced,
+// its cost.
+func (r *Runtime) recordUsage(model string, usage *llm.Usage) {
+	if usage == nil {
+		return
+	}
+	telemetry.Metrics.TokensUsed.WithLabelValues("input", model).Add(float64(usage.InputTokens))
+	telemetry.Metrics.TokensUsed.WithLabelValues("output", model).Add(float64(usage.OutputTokens))
+	if p, ok := r.pricing[model]; ok {
+		cost := (float64(usage.InputTokens)*p.Input + float64(usage.OutputTokens)*p.Output) / 1e6
+		telemetry.Metrics.LLMCost.WithLabelValues(model).Add(cost)
+	}
+}
+
+func statusLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func approvalOutcome(approved bool, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case approved:
+		return "approved"
+	default:
+		return "denied"
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/store"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRunTurn_Metrics(t *testing.T) {
+	fp := &fakeProvider{events: []llm.ChatEvent{
+		{Type: llm.EventToken, Token: "hi"},
+		{Type: llm.EventDone, Usage: &llm.Usage{InputTokens: 1000, OutputTokens: 200}},
+	}}
+	rt, _ := newTestRuntime(t, fp)
+	rt.model = "priced-1"
+	rt.pricing = map[string]config.ModelPricing{"priced-1": {Input: 3, Output: 15}}
+
+	active := metricValue(telemetry.Metrics.ActiveSessions)
+
+	ch, err := rt.RunTurn(context.Background(), "sess-metrics", "hello")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	collectTurnEvents(ch)
+
+	// The session lock is released after the last event is sent.
+	rt.sessionLock("sess-metrics").Lock()
+	if got := metricValue(telemetry.Metrics.ActiveSessions); got != active {
+		t.Errorf("active sessions = %v after the turn, want %v", got, active)
+	}
+	if got := metricValue(telemetry.Metrics.LLMCost.WithLabelValues("priced-1")); math.Abs(got-0.006) > 1e-9 {
+		t.Errorf("cost = %v, want 0.006", got)
+	}
+}
+
+func TestSubturnAndCompactionRecordUsage(t *testing.T) {
+	fp := &fakeProvider{events: []llm.ChatEvent{
+		{Type: llm.EventToken, Token: "summary"},
+		{Type: llm.EventDone, Usage: &llm.Usage{InputTokens: 1000, OutputTokens: 200}},
+	}}
+	rt, s := newTestRuntime(t, fp)
+	rt.model = "priced-2"
+	rt.pricing = map[string]config.ModelPricing{"priced-2": {Input: 3, Output: 15}}
+	input := telemetry.Metrics.TokensUsed.WithLabelValues("input", "priced-2")
+
+	ctx := tools.WithSessionInfo(context.Background(), "sess-usage", "")
+	if _, err := rt.RunSubturn(ctx, "say hi", nil); err != nil {
+		t.Fatalf("RunSubturn: %v", err)
+	}
+	if got := metricValue(input); got != 1000 {
+		t.Errorf("input tokens after subturn = %v, want 1000", got)
+	}
+
+	now := time.Now().UTC()
+	_ = s.CreateSession(ctx, &store.Session{
+		ID: "sess-usage", AgentID: "default", Channel: "test", PeerID: "test",
+		CreatedAt: now, UpdatedAt: now,
+	})
+	seedMessages(t, s, "sess-usage", 45)
+	if err := rt.CompactSession(ctx, "sess-usage"); err != nil {
+		t.Fatalf("CompactSession: %v", err)
+	}
+	if got := metricValue(input); got != 2000 {
+		t.Errorf("input tokens after compaction = %v, want 2000", got)
+	}
+	if got := metricValue(telemetry.Metrics.LLMCost.WithLabelValues("priced-2")); math.Abs(got-0.012) > 1e-9 {
+		t.Errorf("cost = %v, want 0.012", got)
+	}
+}
+
+func TestLockSessionCountsQueuedTurns(t *testing.T) {
+	rt, _ := newTestRuntime(t, &fakeProvider{})
+	queued := metricValue(telemetry.Metrics.TurnsQueued)
+
+	unlock := rt.lockSession("sess-queue")
+	acquired := make(chan func())
+	go func() { acquired <- rt.lockSession("sess-queue") }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for metricValue(telemetry.Metrics.TurnsQueued) != queued+1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second turn was never counted as queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	unlock()
+	(<-acquired)()
+	if got := metricValue(telemetry.Metrics.TurnsQueued); got != queued {
+		t.Errorf("queued turns = %v, want %v", got, queued)
+	}
+}
+
+func metricValue(m prometheus.Metric) float64 {
+	var d dto.Metric
+	if err := m.Write(&d); err != nil {
+		return math.NaN()
+	}
+	if d.Gauge != nil {
+		return d.Gauge.GetValue()
+	}
+	return d.Counter.GetValue()
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"sort"
+
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+)
+
+// AgentProfile describes a named agent served by the runtime alongside the
+// default one. Zero values fall back to the runtime's own settings.
+type AgentProfile struct {
+	ID              string
+	Provider        llm.Provider
+	Model           string
+	SystemPrompt    string
+	Tools           []string
+	ToolOverrides   []tools.Tool
+	Policy          *sandbox.Policy
+	MemoryNamespace string
+}
+
+// Route maps a conversation to an agent. Empty fields match anything.
+type Route struct {
+	Agent   string
+	Channel string
+	Chat    string
+	Peer    string
+}
+
+func (rt Route) matches(channel, chatID, peerID string) bool {
+	return (rt.Channel == "" || rt.Channel == channel) &&
+		(rt.Chat == "" || rt.Chat == chatID) &&
+		(rt.Peer == "" || rt.Peer == peerID)
+}
+
+// agentSettings is the resolved configuration a turn runs with.
+type agentSettings struct {
+	id           string
+	memoryNS     string
+	provider     llm.Provider
+	model        string
+	systemPrompt string
+	registry     *tools.Registry
+	policy       sandbox.Policy
+}
+
+func (r *Runtime) settingsFor(agentID string) agentSettings {
+	if agentID == "" {
+		agentID = config.DefaultAgentID
+	}
+	s := agentSettings{
+		id:           agentID,
+		memoryNS:     agentID,
+		provider:     r.provider,
+		model:        r.model,
+		systemPrompt: r.systemPrompt,
+		registry:     r.registry,
+		policy:       r.defaultPolicy,
+	}
+
+	p, ok := r.agents[agentID]
+	if !ok {
+		return s
+	}
+	if p.Provider != nil {
+		s.provider = p.Provider
+	}
+	if p.Model != "" {
+		s.model = p.Model
+	}
+	if p.SystemPrompt != "" {
+		s.systemPrompt = p.SystemPrompt
+	}
+	if p.Policy != nil {
+		s.policy = *p.Policy
+	}
+	if p.MemoryNamespace != "" {
+		s.memoryNS = p.MemoryNamespace
+	}
+	if s.registry != nil {
+		s.registry = s.registry.With(p.ToolOverrides...).Filter(p.Tools)
+	}
+	return s
+}
+
+// AgentFor returns the agent that should handle a conversation according to
+// the configured routes.
+func (r *Runtime) AgentFor(channel, chatID, peerID string) string {
+	if r == nil {
+		return config.DefaultAgentID
+	}
+	for _, rt := range r.routes {
+		if rt.matches(channel, chatID, peerID) {
+			return rt.Agent
+		}
+	}
+	return config.DefaultAgentID
+}
+
+// Agents lists the IDs of all agents the runtime serves.
+func (r *Runtime) Agents() []string {
+	ids := []string{config.DefaultAgentID}
+	for id := range r.agents {
+		if id != config.DefaultAgentID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids[1:])
+	return ids
+}
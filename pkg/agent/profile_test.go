@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+)
+
+func TestAgentFor(t *testing.T) {
+	rt := NewRuntime(RuntimeConfig{
+		Routes: []Route{
+			{Agent: "ops", Channel: "slack", Chat: "C-OPS"},
+			{Agent: "vip", Peer: "alice"},
+			{Agent: "docs", Channel: "discord"},
+		},
+	})
+
+	tests := []struct {
+		channel, chat, peer string
+		want                string
+	}{
+		{"slack", "C-OPS", "bob", "ops"},
+		{"slack", "C-GENERAL", "bob", "default"},
+		{"slack", "C-GENERAL", "alice", "vip"},
+		{"discord", "123", "bob", "docs"},
+		{"telegram", "42", "bob", "default"},
+	}
+	for _, tt := range tests {
+		if got := rt.AgentFor(tt.channel, tt.chat, tt.peer); got != tt.want {
+			t.Errorf("AgentFor(%q, %q, %q) = %q, want %q", tt.channel, tt.chat, tt.peer, got, tt.want)
+		}
+	}
+
+	var nilRuntime *Runtime
+	if got := nilRuntime.AgentFor("slack", "", ""); got != "default" {
+		t.Errorf("nil runtime AgentFor = %q, want default", got)
+	}
+}
+
+func TestSettingsForProfile(t *testing.T) {
+	base := &fakeProvider{}
+	ops := &fakeProvider{}
+	reg := tools.NewRegistry()
+	reg.Register(&tools.ShellTool{})
+	reg.Register(&tools.HTTPTool{})
+
+	policy := sandbox.Policy{AllowedPaths: []string{"/srv/ops"}}
+	rt := NewRuntime(RuntimeConfig{
+		Provider:     base,
+		Registry:     reg,
+		Model:        "base-model",
+		SystemPrompt: "base prompt",
+		Agents: []AgentProfile{{
+			ID:              "ops",
+			Provider:        ops,
+			Model:           "ops-model",
+			SystemPrompt:    "ops prompt",
+			Tools:           []string{"shell"},
+			Policy:          &policy,
+			MemoryNamespace: "team-ops",
+		}},
+	})
+
+	def := rt.settingsFor("")
+	if def.id != "default" || def.provider != base || def.model != "base-model" || len(def.registry.Definitions()) != 2 {
+		t.Errorf("default settings = %+v", def)
+	}
+
+	s := rt.settingsFor("ops")
+	if s.provider != ops || s.model != "ops-model" || s.systemPrompt != "ops prompt" {
+		t.Errorf("ops settings = %+v", s)
+	}
+	if s.memoryNS != "team-ops" {
+		t.Errorf("memoryNS = %q, want team-ops", s.memoryNS)
+	}
+	if defs := s.registry.Definitions(); len(defs) != 1 || defs[0].Name != "shell" {
+		t.Errorf("ops tools = %+v, want only shell", defs)
+	}
+	if len(s.policy.AllowedPaths) != 1 {
+		t.Errorf("ops policy = %+v", s.policy)
+	}
+
+	if got := rt.Agents(); len(got) != 2 || got[0] != "default" || got[1] != "ops" {
+		t.Errorf("Agents() = %v", got)
+	}
+}
+
+func TestRunTurn_UsesSessionAgent(t *testing.T) {
+	base := &fakeProvider{events: []llm.ChatEvent{{Type: llm.EventToken, Token: "base"}, {Type: llm.EventDone}}}
+	ops := &fakeProvider{events: []llm.ChatEvent{{Type: llm.EventToken, Token: "ops"}, {Type: llm.EventDone}}}
+	rt, s := newTestRuntime(t, base)
+	rt.agents = map[string]AgentProfile{"ops": {ID: "ops", Provider: ops, Model: "ops-model"}}
+
+	ctx := context.Background()
+	if _, _, err := s.GetOrCreateSession(ctx, "sess-ops", "ops", "slack", "u1"); err != nil {
+		t.Fatalf("GetOrCreateSession: %v", err)
+	}
+
+	ch, err := rt.RunTurn(ctx, "sess-ops", "status?")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	collectTurnEvents(ch)
+
+	if ops.calls != 1 || base.calls != 0 {
+		t.Fatalf("ops calls = %d, base calls = %d", ops.calls, base.calls)
+	}
+	if ops.gotReq.Model != "ops-model" {
+		t.Errorf("model = %q, want ops-model", ops.gotReq.Model)
+	}
+
+	sess, err := s.GetSession(ctx, "sess-ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Channel != "slack" || sess.AgentID != "ops" {
+		t.Errorf("session = %+v, RunTurn should not rebind it", sess)
+	}
+}
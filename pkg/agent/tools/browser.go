@@ -3,8 +3,10 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,6 +31,14 @@ type BrowserTool struct {
 	Headless    bool
 	IdleTimeout time.Duration
 	AuditLog    *audit.ToolLogger
+	// DefaultProfile is the persistent profile used when an action names
+	// none. Empty starts each session from a fresh temporary profile.
+	DefaultProfile string
+	// DownloadDir receives downloads and PDFs when no path is given. It
+	// defaults to DataDir/downloads and is writable even when the sandbox's
+	// AllowedPaths do not include it.
+	DownloadDir string
+	Secrets     SecretResolver
 
 	mu            sync.Mutex
 	sessions      map[string]*browserSession
@@ -42,6 +52,13 @@ type browserSession struct {
 	ctxCancel   context.CancelFunc
 	ctx         context.Context
 	lastUsed    time.Time
+	profile     string
+	// snapshot is the last page outline; once set, actions report changes
+	// against it instead of capturing screenshots.
+	snapshot *pageSnapshot
+	// secrets holds the credentials filled into the page. They are masked
+	// in everything the session reports, since fields echo their values.
+	secrets *secrets
 }
 
 type browserInput struct {
@@ -51,31 +68,38 @@ type browserInput struct {
 	Text     string `json:"text,omitempty"`
 	Script   string `json:"script,omitempty"`
 	Delta    int    `json:"delta,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+	Ref      int    `json:"ref,omitempty"`
 }
 
 func (t *BrowserTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        "browser",
-		Description: "Control a headless browser to navigate pages, interact with elements, and take screenshots. After most actions a screenshot is automatically captured so you can see the result.",
+		Description: "Control a headless browser to navigate pages, interact with elements, and take screenshots. After most actions a screenshot is automatically captured so you can see the result. Use snapshot for a compact text outline of the page where every interactive element has a numbered ref; pass that ref instead of a selector. Once a session has taken a snapshot, actions report what changed on the page instead of capturing screenshots.",
 		InputSchema: json.RawMessage(`{
 			"type": "object",
 			"properties": {
 				"action": {
 					"type": "string",
-					"enum": ["navigate", "click", "type", "screenshot", "get_text", "get_html", "wait", "evaluate", "scroll", "select", "back", "forward", "close"],
+					"enum": ["navigate", "snapshot", "click", "type", "screenshot", "get_text", "get_html", "wait", "evaluate", "scroll", "select", "back", "forward", "download", "upload", "save_pdf", "get_cookies", "set_cookies", "close"],
 					"description": "The browser action to perform."
 				},
 				"url": {
 					"type": "string",
-					"description": "URL to navigate to. Required for navigate."
+					"description": "URL to navigate to. Required for navigate. For download, a URL to fetch instead of clicking selector. For get_cookies, limits cookies to that URL."
+				},
+				"ref": {
+					"type": "integer",
+					"description": "Element ref from the latest snapshot. Can be used instead of selector."
 				},
 				"selector": {
 					"type": "string",
-					"description": "CSS selector for the target element. Required for click, type, wait, select. Optional for get_text, get_html."
+					"description": "CSS selector for the target element. Required for click, type, wait, select and upload (an input of type file). Optional for get_text, get_html, and for download (the element to click)."
 				},
 				"text": {
 					"type": "string",
-					"description": "Text to type into an element (for type action) or option text to select (for select action)."
+					"description": "Text to type into an element (for type action), option text to select (for select action) or a JSON array of cookies (for set_cookies). {{cred:NAME}} placeholders are replaced with stored credentials for type and set_cookies."
 				},
 				"script": {
 					"type": "string",
@@ -84,6 +108,14 @@ func (t *BrowserTool) Definition() llm.ToolDefinition {
 				"delta": {
 					"type": "integer",
 					"description": "Pixels to scroll vertically. Positive scrolls down, negative scrolls up. Default 500."
+				},
+				"path": {
+					"type": "string",
+					"description": "File path. The directory to download into, the file to upload, the PDF to write, the file to export cookies to (get_cookies) or import them from (set_cookies)."
+				},
+				"profile": {
+					"type": "string",
+					"description": "Named persistent profile whose cookies and logins are kept between sessions. Only takes effect when the browser session starts."
 				}
 			},
 			"required": ["action"]
@@ -91,7 +123,7 @@ func (t *BrowserTool) Definition() llm.ToolDefinition {
 	}
 }
 
-func (t *BrowserTool) Execute(ctx context.Context, input json.RawMessage, _ sandbox.Sandbox, _ sandbox.Policy) (string, error) {
+func (t *BrowserTool) Execute(ctx context.Context, input json.RawMessage, _ sandbox.Sandbox, policy sandbox.Policy) (string, error) {
 	params, err := parseInput[browserInput](input, "browser")
 	if err != nil {
 		return "", err
@@ -115,6 +147,21 @@ func (t *BrowserTool) Execute(ctx context.Context, input json.RawMessage, _ sand
 		)
 	}()
 
+	if err := t.resolveRef(sessionID, &params); err != nil {
+		return "", err
+	}
+
+	out, err := t.run(ctx, sessionID, params, policy)
+	if err != nil {
+		if msg := t.maskSecrets(sessionID, err.Error()); msg != err.Error() {
+			err = errors.New(msg)
+		}
+		return "", err
+	}
+	return t.maskSecrets(sessionID, out), nil
+}
+
+func (t *BrowserTool) run(ctx context.Context, sessionID string, params browserInput, policy sandbox.Policy) (string, error) {
 	switch params.Action {
 	case "navigate":
 		return t.doNavigate(ctx, sessionID, params)
@@ -124,6 +171,8 @@ func (t *BrowserTool) Execute(ctx context.Context, input json.RawMessage, _ sand
 		return t.doType(ctx, sessionID, params)
 	case "screenshot":
 		return t.doScreenshot(ctx, sessionID)
+	case "snapshot":
+		return t.doSnapshot(ctx, sessionID, params)
 	case "get_text":
 		return t.doGetText(ctx, sessionID, params)
 	case "get_html":
@@ -140,6 +189,16 @@ func (t *BrowserTool) Execute(ctx context.Context, input json.RawMessage, _ sand
 		return t.doBack(ctx, sessionID)
 	case "forward":
 		return t.doForward(ctx, sessionID)
+	case "download":
+		return t.doDownload(ctx, sessionID, params, policy)
+	case "upload":
+		return t.doUpload(ctx, sessionID, params, policy)
+	case "save_pdf":
+		return t.doSavePDF(ctx, sessionID, params, policy)
+	case "get_cookies":
+		return t.doGetCookies(ctx, sessionID, params, policy)
+	case "set_cookies":
+		return t.doSetCookies(ctx, sessionID, params, policy)
 	case "close":
 		return t.doClose(ctx, sessionID)
 	default:
@@ -235,7 +294,9 @@ func (t *BrowserTool) cleanIdleSessions(timeout time.Duration) {
 	}
 }
 
-func (t *BrowserTool) getOrCreateSession(sessionID string) (context.Context, error) {
+// getOrCreateSession returns the browser of a session, starting it with the
+// given profile, or DefaultProfile when empty, if it is not running.
+func (t *BrowserTool) getOrCreateSession(sessionID, profile string) (context.Context, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -247,6 +308,9 @@ func (t *BrowserTool) getOrCreateSession(sessionID string) (context.Context, err
 	}
 
 	if sess, ok := t.sessions[sessionID]; ok {
+		if profile != "" && profile != sess.profile {
+			return nil, fmt.Errorf("browser: session is using profile %q; close it before switching to %q", sess.profile, profile)
+		}
 		if sess.ctx.Err() == nil {
 			sess.lastUsed = time.Now()
 			return sess.ctx, nil
@@ -259,12 +323,32 @@ func (t *BrowserTool) getOrCreateSession(sessionID string) (context.Context, err
 		delete(t.sessions, sessionID)
 	}
 
+	if profile == "" {
+		profile = t.DefaultProfile
+	}
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.Flag("headless", t.Headless),
 		chromedp.Flag("no-sandbox", true),
 		chromedp.Flag("disable-gpu", true),
 		chromedp.WindowSize(1280, 720),
 	)
+	if profile != "" {
+		dir, err := t.profileDir(profile)
+		if err != nil {
+			return nil, err
+		}
+		// Chrome locks its user data directory, so a profile can back
+		// only one session at a time.
+		for id, other := range t.sessions {
+			if other.profile == profile {
+				return nil, fmt.Errorf("browser: profile %q is in use by session %s", profile, id)
+			}
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("browser: creating profile dir: %w", err)
+		}
+		opts = append(opts, chromedp.UserDataDir(dir))
+	}
 
 	baseCtx := t.BaseCtx
 	if baseCtx == nil {
@@ -294,6 +378,7 @@ func (t *BrowserTool) getOrCreateSession(sessionID string) (context.Context, err
 		ctxCancel:   taskCancel,
 		ctx:         taskCtx,
 		lastUsed:    time.Now(),
+		profile:     profile,
 	}
 	t.sessions[sessionID] = sess
 
@@ -328,7 +413,10 @@ func (t *BrowserTool) getOrCreateSession(sessionID string) (context.Context, err
 		t.mu.Unlock()
 	})
 
-	slog.Info("browser session created", slog.String("session_id", sessionID))
+	slog.Info("browser session created",
+		slog.String("session_id", sessionID),
+		slog.String("profile", profile),
+	)
 
 	return taskCtx, nil
 }
@@ -415,7 +503,7 @@ func (t *BrowserTool) doNavigate(ctx context.Context, sessionID string, params b
 		return "", fmt.Errorf("browser: url is required for navigate")
 	}
 
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -428,8 +516,7 @@ func (t *BrowserTool) doNavigate(ctx context.Context, sessionID string, params b
 
 	browserCtx = t.waitForStableURL(sessionID, 10*time.Second)
 	title, loc := t.pageInfo(browserCtx)
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Navigated to %s\nTitle: %s\nScreenshot: %s", loc, title, path), nil
+	return fmt.Sprintf("Navigated to %s\nTitle: %s\n%s", loc, title, t.observe(browserCtx, sessionID)), nil
 }
 
 func (t *BrowserTool) doClick(ctx context.Context, sessionID string, params browserInput) (string, error) {
@@ -437,7 +524,7 @@ func (t *BrowserTool) doClick(ctx context.Context, sessionID string, params brow
 		return "", fmt.Errorf("browser: selector is required for click")
 	}
 
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -451,37 +538,69 @@ func (t *BrowserTool) doClick(ctx context.Context, sessionID string, params brow
 
 	browserCtx = t.waitForStableURL(sessionID, 10*time.Second)
 	title, loc := t.pageInfo(browserCtx)
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Clicked %q\nPage: %s (%s)\nScreenshot: %s", params.Selector, loc, title, path), nil
+	return fmt.Sprintf("Clicked %q\nPage: %s (%s)\n%s", params.Selector, loc, title, t.observe(browserCtx, sessionID)), nil
 }
 
-func (t *BrowserTool) doType(_ context.Context, sessionID string, params browserInput) (string, error) {
+func (t *BrowserTool) doType(ctx context.Context, sessionID string, params browserInput) (string, error) {
 	if params.Selector == "" {
 		return "", fmt.Errorf("browser: selector is required for type")
 	}
 	if params.Text == "" {
 		return "", fmt.Errorf("browser: text is required for type")
 	}
+	sec := newSecrets(t.Secrets, "browser")
+	text, err := sec.expand(ctx, params.Text)
+	if err != nil {
+		return "", fmt.Errorf("browser: %w", err)
+	}
 
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
+	t.rememberSecrets(sessionID, sec)
 
 	if err := t.runWithTimeout(browserCtx, defaultActionTimeout,
 		chromedp.WaitVisible(params.Selector, chromedp.ByQuery),
 		chromedp.Clear(params.Selector, chromedp.ByQuery),
-		chromedp.SendKeys(params.Selector, params.Text, chromedp.ByQuery),
+		chromedp.SendKeys(params.Selector, text, chromedp.ByQuery),
 	); err != nil {
 		return "", fmt.Errorf("browser: type failed: %w", err)
 	}
 
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Typed %d chars into %q\nScreenshot: %s", len(params.Text), params.Selector, path), nil
+	return fmt.Sprintf("Typed %d chars into %q\n%s", len(params.Text), params.Selector, t.observe(browserCtx, sessionID)), nil
+}
+
+// rememberSecrets records credentials filled into a session's page so that
+// later output from the session masks them.
+func (t *BrowserTool) rememberSecrets(sessionID string, sec *secrets) {
+	if len(sec.used) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sess, ok := t.sessions[sessionID]
+	if !ok {
+		return
+	}
+	if sess.secrets == nil {
+		sess.secrets = sec
+		return
+	}
+	maps.Copy(sess.secrets.used, sec.used)
+}
+
+func (t *BrowserTool) maskSecrets(sessionID, text string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if sess, ok := t.sessions[sessionID]; ok && sess.secrets != nil {
+		return sess.secrets.mask(text)
+	}
+	return text
 }
 
 func (t *BrowserTool) doScreenshot(_ context.Context, sessionID string) (string, error) {
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, "")
 	if err != nil {
 		return "", err
 	}
@@ -495,7 +614,7 @@ func (t *BrowserTool) doScreenshot(_ context.Context, sessionID string) (string,
 }
 
 func (t *BrowserTool) doGetText(_ context.Context, sessionID string, params browserInput) (string, error) {
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -521,7 +640,7 @@ func (t *BrowserTool) doGetText(_ context.Context, sessionID string, params brow
 }
 
 func (t *BrowserTool) doGetHTML(_ context.Context, sessionID string, params browserInput) (string, error) {
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -551,7 +670,7 @@ func (t *BrowserTool) doWait(_ context.Context, sessionID string, params browser
 		return "", fmt.Errorf("browser: selector is required for wait")
 	}
 
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -570,7 +689,7 @@ func (t *BrowserTool) doEvaluate(_ context.Context, sessionID string, params bro
 		return "", fmt.Errorf("browser: script is required for evaluate")
 	}
 
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -587,7 +706,7 @@ func (t *BrowserTool) doEvaluate(_ context.Context, sessionID string, params bro
 }
 
 func (t *BrowserTool) doScroll(_ context.Context, sessionID string, params browserInput) (string, error) {
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -610,8 +729,7 @@ func (t *BrowserTool) doScroll(_ context.Context, sessionID string, params brows
 		direction = "up"
 	}
 
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Scrolled %s by %dpx\nScreenshot: %s", direction, abs(delta), path), nil
+	return fmt.Sprintf("Scrolled %s by %dpx\n%s", direction, abs(delta), t.observe(browserCtx, sessionID)), nil
 }
 
 func (t *BrowserTool) doSelect(_ context.Context, sessionID string, params browserInput) (string, error) {
@@ -622,7 +740,7 @@ func (t *BrowserTool) doSelect(_ context.Context, sessionID string, params brows
 		return "", fmt.Errorf("browser: text is required for select")
 	}
 
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
 	if err != nil {
 		return "", err
 	}
@@ -651,12 +769,11 @@ func (t *BrowserTool) doSelect(_ context.Context, sessionID string, params brows
 		return "", fmt.Errorf("browser: %s", result)
 	}
 
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Selected %q in %q\nScreenshot: %s", params.Text, params.Selector, path), nil
+	return fmt.Sprintf("Selected %q in %q\n%s", params.Text, params.Selector, t.observe(browserCtx, sessionID)), nil
 }
 
 func (t *BrowserTool) doBack(_ context.Context, sessionID string) (string, error) {
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, "")
 	if err != nil {
 		return "", err
 	}
@@ -667,12 +784,11 @@ func (t *BrowserTool) doBack(_ context.Context, sessionID string) (string, error
 
 	browserCtx = t.waitForStableURL(sessionID, 10*time.Second)
 	title, loc := t.pageInfo(browserCtx)
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Navigated back\nPage: %s (%s)\nScreenshot: %s", loc, title, path), nil
+	return fmt.Sprintf("Navigated back\nPage: %s (%s)\n%s", loc, title, t.observe(browserCtx, sessionID)), nil
 }
 
 func (t *BrowserTool) doForward(_ context.Context, sessionID string) (string, error) {
-	browserCtx, err := t.getOrCreateSession(sessionID)
+	browserCtx, err := t.getOrCreateSession(sessionID, "")
 	if err != nil {
 		return "", err
 	}
@@ -683,8 +799,7 @@ func (t *BrowserTool) doForward(_ context.Context, sessionID string) (string, er
 
 	browserCtx = t.waitForStableURL(sessionID, 10*time.Second)
 	title, loc := t.pageInfo(browserCtx)
-	path, _ := t.captureScreenshot(browserCtx, sessionID)
-	return fmt.Sprintf("Navigated forward\nPage: %s (%s)\nScreenshot: %s", loc, title, path), nil
+	return fmt.Sprintf("Navigated forward\nPage: %s (%s)\n%s", loc, title, t.observe(browserCtx, sessionID)), nil
 }
 
 func (t *BrowserTool) doClose(ctx context.Context, sessionID string) (string, error) {
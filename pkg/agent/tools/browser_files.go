@@ -0,0 +1,405 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+)
+
+const downloadTimeout = 5 * time.Minute
+
+var profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// profileDir returns the user data directory of a named profile. Chrome keeps
+// cookies, local storage and saved logins there, so they survive restarts.
+func (t *BrowserTool) profileDir(name string) (string, error) {
+	if !profileNameRe.MatchString(name) {
+		return "", fmt.Errorf("browser: invalid profile name %q (letters, digits, - and _ only)", name)
+	}
+	return filepath.Join(t.DataDir, "browser-profiles", name), nil
+}
+
+func (t *BrowserTool) downloadDir() string {
+	if t.DownloadDir != "" {
+		return t.DownloadDir
+	}
+	return filepath.Join(t.DataDir, "downloads")
+}
+
+// outputPath is allowedPath for files the browser writes. The download
+// directory belongs to the tool, so paths inside it are allowed even when
+// the policy's AllowedPaths do not list it.
+func (t *BrowserTool) outputPath(path string, policy sandbox.Policy) (string, error) {
+	if len(policy.AllowedPaths) > 0 {
+		dir, err := filepath.Abs(t.downloadDir())
+		if err != nil {
+			return "", fmt.Errorf("browser: resolving path: %w", err)
+		}
+		policy.AllowedPaths = append(slices.Clip(policy.AllowedPaths), dir)
+	}
+	return allowedPath(path, policy, true)
+}
+
+// allowedPath resolves path and checks it against the sandbox policy. Paths
+// written by the browser must also be outside the read-only paths.
+func allowedPath(path string, policy sandbox.Policy, write bool) (string, error) {
+	if !filepath.IsAbs(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", fmt.Errorf("browser: resolving path: %w", err)
+		}
+		path = abs
+	}
+	if err := sandbox.CheckPathAllowed(path, policy.AllowedPaths); err != nil {
+		return "", fmt.Errorf("browser: %w", err)
+	}
+	if write {
+		if err := sandbox.CheckPathWritable(path, policy.ReadOnlyPaths); err != nil {
+			return "", fmt.Errorf("browser: %w", err)
+		}
+	}
+	return path, nil
+}
+
+func (t *BrowserTool) doDownload(ctx context.Context, sessionID string, params browserInput, policy sandbox.Policy) (string, error) {
+	if params.URL == "" && params.Selector == "" {
+		return "", fmt.Errorf("browser: url or selector is required for download")
+	}
+	dir := params.Path
+	if dir == "" {
+		dir = t.downloadDir()
+	}
+	dir, err := t.outputPath(dir, policy)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("browser: creating download dir: %w", err)
+	}
+
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
+	if err != nil {
+		return "", err
+	}
+
+	listenCtx, cancel := context.WithTimeout(browserCtx, downloadTimeout)
+	defer cancel()
+	// names is only touched by the listener; the suggested name travels to
+	// this goroutine with the finished download.
+	names := make(map[string]string)
+	done := make(chan finishedDownload, 1)
+	chromedp.ListenTarget(listenCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *browser.EventDownloadWillBegin:
+			names[e.GUID] = e.SuggestedFilename
+		case *browser.EventDownloadProgress:
+			if e.State == browser.DownloadProgressStateCompleted || e.State == browser.DownloadProgressStateCanceled {
+				select {
+				case done <- finishedDownload{EventDownloadProgress: e, name: names[e.GUID]}:
+				default:
+				}
+			}
+		}
+	})
+
+	if err := chromedp.Run(browserCtx, browser.SetDownloadBehavior(browser.SetDownloadBehaviorBehaviorAllowAndName).
+		WithDownloadPath(dir).
+		WithEventsEnabled(true)); err != nil {
+		return "", fmt.Errorf("browser: enabling downloads: %w", err)
+	}
+
+	var trigger chromedp.Action
+	if params.Selector != "" {
+		trigger = chromedp.Click(params.Selector, chromedp.ByQuery)
+	} else {
+		trigger = chromedp.Navigate(params.URL)
+	}
+	// Navigating to a file that downloads aborts the navigation.
+	if err := t.runWithTimeout(browserCtx, navigationTimeout, trigger); err != nil && !strings.Contains(err.Error(), "net::ERR_ABORTED") {
+		return "", fmt.Errorf("browser: download failed: %w", err)
+	}
+
+	var ev finishedDownload
+	select {
+	case ev = <-done:
+	case <-listenCtx.Done():
+		return "", fmt.Errorf("browser: download did not finish within %s", downloadTimeout)
+	}
+	if ev.State == browser.DownloadProgressStateCanceled {
+		return "", fmt.Errorf("browser: download was canceled")
+	}
+
+	// With allowAndName Chrome saves the file under its GUID.
+	src := filepath.Join(dir, ev.GUID)
+	dst := uniquePath(filepath.Join(dir, safeFilename(ev.name, ev.GUID)))
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("browser: saving download: %w", err)
+	}
+
+	t.AuditLog.Log(ctx, "browser_download", sessionID, dst)
+	return fmt.Sprintf("Downloaded %s (%d bytes)", dst, int64(ev.ReceivedBytes)), nil
+}
+
+// finishedDownload is a completed or canceled download with the file name
+// the page suggested for it.
+type finishedDownload struct {
+	*browser.EventDownloadProgress
+	name string
+}
+
+func (t *BrowserTool) doUpload(ctx context.Context, sessionID string, params browserInput, policy sandbox.Policy) (string, error) {
+	if params.Selector == "" {
+		return "", fmt.Errorf("browser: selector is required for upload")
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("browser: path is required for upload")
+	}
+	path, err := allowedPath(params.Path, policy, false)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("browser: upload: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("browser: upload: %s is a directory", path)
+	}
+
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
+	if err != nil {
+		return "", err
+	}
+	if err := t.runWithTimeout(browserCtx, defaultActionTimeout,
+		chromedp.SetUploadFiles(params.Selector, []string{path}, chromedp.ByQuery),
+	); err != nil {
+		return "", fmt.Errorf("browser: upload failed: %w", err)
+	}
+
+	t.AuditLog.Log(ctx, "browser_upload", sessionID, path)
+	return fmt.Sprintf("Attached %s to %q\n%s", path, params.Selector, t.observe(browserCtx, sessionID)), nil
+}
+
+func (t *BrowserTool) doSavePDF(ctx context.Context, sessionID string, params browserInput, policy sandbox.Policy) (string, error) {
+	path := params.Path
+	if path == "" {
+		path = filepath.Join(t.downloadDir(), fmt.Sprintf("%d.pdf", time.Now().UnixMilli()))
+	}
+	path, err := t.outputPath(path, policy)
+	if err != nil {
+		return "", err
+	}
+
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
+	if err != nil {
+		return "", err
+	}
+	var buf []byte
+	if err := t.runWithTimeout(browserCtx, defaultActionTimeout, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		buf, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+		return err
+	})); err != nil {
+		return "", fmt.Errorf("browser: save_pdf failed: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("browser: creating pdf dir: %w", err)
+	}
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		return "", fmt.Errorf("browser: writing pdf: %w", err)
+	}
+	t.AuditLog.Log(ctx, "browser_pdf", sessionID, path)
+	return fmt.Sprintf("Saved PDF %s (%d bytes)", path, len(buf)), nil
+}
+
+// browserCookie is the import and export format of cookies. Its field names
+// follow the DevTools protocol, so cookies exported by other tools load too.
+type browserCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	Expires  float64 `json:"expires,omitempty"`
+	HTTPOnly bool    `json:"httpOnly,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	SameSite string  `json:"sameSite,omitempty"`
+}
+
+func (t *BrowserTool) doGetCookies(ctx context.Context, sessionID string, params browserInput, policy sandbox.Policy) (string, error) {
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
+	if err != nil {
+		return "", err
+	}
+
+	var cookies []*network.Cookie
+	if err := t.runWithTimeout(browserCtx, defaultActionTimeout, chromedp.ActionFunc(func(ctx context.Context) error {
+		req := network.GetCookies()
+		if params.URL != "" {
+			req = req.WithURLs([]string{params.URL})
+		}
+		var err error
+		cookies, err = req.Do(ctx)
+		return err
+	})); err != nil {
+		return "", fmt.Errorf("browser: get_cookies failed: %w", err)
+	}
+
+	out := make([]browserCookie, 0, len(cookies))
+	for _, c := range cookies {
+		bc := browserCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			HTTPOnly: c.HTTPOnly,
+			Secure:   c.Secure,
+			SameSite: string(c.SameSite),
+		}
+		if !c.Session {
+			bc.Expires = c.Expires
+		}
+		out = append(out, bc)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if params.Path == "" {
+		return string(data), nil
+	}
+	path, err := allowedPath(params.Path, policy, true)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("browser: writing cookies: %w", err)
+	}
+	t.AuditLog.Log(ctx, "browser_cookies_export", sessionID, path)
+	return fmt.Sprintf("Exported %d cookies to %s", len(out), path), nil
+}
+
+func (t *BrowserTool) doSetCookies(ctx context.Context, sessionID string, params browserInput, policy sandbox.Policy) (string, error) {
+	data := params.Text
+	switch {
+	case data != "" && params.Path != "":
+		return "", fmt.Errorf("browser: set_cookies takes text or path, not both")
+	case params.Path != "":
+		path, err := allowedPath(params.Path, policy, false)
+		if err != nil {
+			return "", err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("browser: reading cookies: %w", err)
+		}
+		data = string(b)
+	case data == "":
+		return "", fmt.Errorf("browser: text or path is required for set_cookies")
+	}
+	sec := newSecrets(t.Secrets, "browser")
+	data, err := sec.expand(ctx, data)
+	if err != nil {
+		return "", fmt.Errorf("browser: %w", err)
+	}
+	cookies, err := parseCookies(data)
+	if err != nil {
+		return "", err
+	}
+
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
+	if err != nil {
+		return "", err
+	}
+	t.rememberSecrets(sessionID, sec)
+	var current string
+	_ = chromedp.Run(browserCtx, chromedp.Location(&current))
+	if !strings.HasPrefix(current, "http") {
+		current = params.URL
+	}
+	for _, c := range cookies {
+		if c.URL == "" && c.Domain == "" {
+			if current == "" {
+				return "", fmt.Errorf("browser: cookie %q needs a domain or url", c.Name)
+			}
+			c.URL = current
+		}
+	}
+
+	if err := t.runWithTimeout(browserCtx, defaultActionTimeout, network.SetCookies(cookies)); err != nil {
+		return "", fmt.Errorf("browser: set_cookies failed: %w", err)
+	}
+	t.AuditLog.Log(ctx, "browser_cookies_import", sessionID, fmt.Sprintf("%d cookies", len(cookies)))
+	return fmt.Sprintf("Set %d cookies", len(cookies)), nil
+}
+
+// parseCookies reads a JSON array of cookies in the browserCookie format.
+func parseCookies(data string) ([]*network.CookieParam, error) {
+	var in []browserCookie
+	if err := json.Unmarshal([]byte(data), &in); err != nil {
+		return nil, fmt.Errorf("browser: cookies must be a JSON array: %w", err)
+	}
+	out := make([]*network.CookieParam, 0, len(in))
+	for _, c := range in {
+		if c.Name == "" {
+			return nil, fmt.Errorf("browser: every cookie needs a name")
+		}
+		p := &network.CookieParam{
+			Name:     c.Name,
+			Value:    c.Value,
+			URL:      c.URL,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			HTTPOnly: c.HTTPOnly,
+			Secure:   c.Secure,
+			SameSite: network.CookieSameSite(c.SameSite),
+		}
+		if c.Expires > 0 {
+			sec := int64(c.Expires)
+			exp := cdp.TimeSinceEpoch(time.Unix(sec, 0))
+			p.Expires = &exp
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// safeFilename keeps the base name of a suggested download name, falling
+// back when it is empty or only dots.
+func safeFilename(name, fallback string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if strings.Trim(name, ".") == "" || name == "/" {
+		return fallback
+	}
+	return name
+}
+
+// uniquePath appends a counter to path until it does not exist.
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+const maxSnapshotNodes = 400
+
+// snapshotScript outlines the visible headings and interactive elements of
+// the page. Interactive elements are tagged with a data-pincer-ref attribute
+// that survives later snapshots, so refs stay stable while the page lives.
+const snapshotScript = `(() => {
+	const max = %d;
+	const interactive = new Set(["button", "link", "checkbox", "radio", "tab", "menuitem", "menuitemcheckbox",
+		"menuitemradio", "option", "switch", "textbox", "searchbox", "combobox", "listbox", "slider",
+		"spinbutton", "treeitem", "file"]);
+	const visible = el => {
+		const r = el.getBoundingClientRect();
+		const s = getComputedStyle(el);
+		return r.width > 0 && r.height > 0 && s.visibility !== "hidden" && s.display !== "none";
+	};
+	const roleOf = el => {
+		const explicit = el.getAttribute("role");
+		if (explicit) return explicit.split(" ")[0];
+		const tag = el.tagName.toLowerCase();
+		switch (tag) {
+		case "a": return el.hasAttribute("href") ? "link" : "";
+		case "button": case "summary": return "button";
+		case "select": return el.multiple ? "listbox" : "combobox";
+		case "textarea": return "textbox";
+		case "h1": case "h2": case "h3": case "h4": case "h5": case "h6": return "heading";
+		case "input": {
+			const t = (el.type || "text").toLowerCase();
+			if (t === "hidden") return "";
+			if (["button", "submit", "reset", "image"].includes(t)) return "button";
+			if (t === "checkbox" || t === "radio" || t === "file") return t;
+			if (t === "range") return "slider";
+			if (t === "number") return "spinbutton";
+			if (t === "search") return "searchbox";
+			return "textbox";
+		}
+		}
+		return el.isContentEditable && !el.parentElement?.isContentEditable ? "textbox" : "";
+	};
+	const nameOf = el => {
+		const aria = el.getAttribute("aria-label");
+		if (aria) return aria;
+		const by = el.getAttribute("aria-labelledby");
+		if (by) {
+			const t = by.split(/\s+/).map(id => document.getElementById(id)?.innerText || "").join(" ").trim();
+			if (t) return t;
+		}
+		if (el.labels && el.labels.length) return el.labels[0].innerText;
+		if (el.tagName === "INPUT" && ["button", "submit", "reset"].includes(el.type)) return el.value;
+		return el.getAttribute("alt") || el.innerText || el.getAttribute("placeholder") ||
+			el.getAttribute("title") || el.getAttribute("name") || "";
+	};
+	let next = window.__pincerNextRef || 1;
+	const nodes = [];
+	let truncated = false;
+	for (const el of document.querySelectorAll("body *")) {
+		const role = roleOf(el);
+		if (!role || (role !== "heading" && !interactive.has(role)) || !visible(el)) continue;
+		if (nodes.length >= max) { truncated = true; break; }
+		const n = {role, name: nameOf(el).replace(/\s+/g, " ").trim().slice(0, 80)};
+		if (role === "heading") {
+			n.level = +el.tagName.slice(1) || +el.getAttribute("aria-level") || 0;
+			nodes.push(n);
+			continue;
+		}
+		let ref = el.getAttribute("data-pincer-ref");
+		if (!ref) {
+			ref = String(next++);
+			el.setAttribute("data-pincer-ref", ref);
+		}
+		n.ref = +ref;
+		const states = [];
+		if (el.disabled || el.getAttribute("aria-disabled") === "true") states.push("disabled");
+		if ((el.type === "checkbox" || el.type === "radio") ? el.checked : el.getAttribute("aria-checked") === "true") states.push("checked");
+		if (el.hasAttribute("aria-expanded")) states.push(el.getAttribute("aria-expanded") === "true" ? "expanded" : "collapsed");
+		if (el.getAttribute("aria-selected") === "true") states.push("selected");
+		if (el.required) states.push("required");
+		n.states = states;
+		let value = "";
+		if (el.tagName === "SELECT") value = el.selectedOptions[0]?.text || "";
+		else if (["INPUT", "TEXTAREA"].includes(el.tagName) && el.type !== "password" && role !== "checkbox" && role !== "radio") value = el.value;
+		if (value) n.value = String(value).slice(0, 80);
+		nodes.push(n);
+	}
+	window.__pincerNextRef = next;
+	return {title: document.title, url: location.href, nodes, truncated};
+})()`
+
+// pageSnapshot is the outline returned by snapshotScript.
+type pageSnapshot struct {
+	Title     string         `json:"title"`
+	URL       string         `json:"url"`
+	Nodes     []snapshotNode `json:"nodes"`
+	Truncated bool           `json:"truncated"`
+}
+
+type snapshotNode struct {
+	Ref    int      `json:"ref,omitempty"`
+	Role   string   `json:"role"`
+	Name   string   `json:"name"`
+	Level  int      `json:"level,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	States []string `json:"states,omitempty"`
+}
+
+func (n snapshotNode) String() string {
+	var b strings.Builder
+	if n.Ref > 0 {
+		fmt.Fprintf(&b, "[%d] ", n.Ref)
+	}
+	fmt.Fprintf(&b, "%s %q", n.Role, n.Name)
+	if n.Level > 0 {
+		fmt.Fprintf(&b, " level=%d", n.Level)
+	}
+	if n.Value != "" {
+		fmt.Fprintf(&b, " value=%q", n.Value)
+	}
+	for _, s := range n.States {
+		b.WriteString(" " + s)
+	}
+	return b.String()
+}
+
+func (s *pageSnapshot) lines() []string {
+	lines := make([]string, len(s.Nodes))
+	for i, n := range s.Nodes {
+		lines[i] = n.String()
+	}
+	return lines
+}
+
+func (s *pageSnapshot) format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Page: %s (%s)\n", s.Title, s.URL)
+	if len(s.Nodes) == 0 {
+		b.WriteString("No headings or interactive elements.\n")
+	}
+	for _, l := range s.lines() {
+		b.WriteString(l + "\n")
+	}
+	if s.Truncated {
+		fmt.Fprintf(&b, "... (truncated at %d elements)\n", maxSnapshotNodes)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// diff describes how cur differs from prev. A different URL means a new page,
+// so the whole snapshot is returned instead.
+func (s *pageSnapshot) diff(prev *pageSnapshot) string {
+	if prev == nil || prev.URL != s.URL {
+		return s.format()
+	}
+
+	count := make(map[string]int)
+	for _, l := range prev.lines() {
+		count[l]++
+	}
+	var added []string
+	for _, l := range s.lines() {
+		if count[l] > 0 {
+			count[l]--
+			continue
+		}
+		added = append(added, "+ "+l)
+	}
+	var removed []string
+	for _, l := range prev.lines() {
+		if count[l] > 0 {
+			count[l]--
+			removed = append(removed, "- "+l)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Page: %s (%s)\n", s.Title, s.URL)
+	if len(added) == 0 && len(removed) == 0 {
+		b.WriteString("No changes since the last snapshot.")
+		return b.String()
+	}
+	b.WriteString("Changes since the last snapshot:\n")
+	b.WriteString(strings.Join(append(removed, added...), "\n"))
+	return b.String()
+}
+
+func refSelector(ref int) string {
+	return `[data-pincer-ref="` + strconv.Itoa(ref) + `"]`
+}
+
+// resolveRef turns an element ref from a snapshot into a selector, checking
+// that the element is still on the page.
+func (t *BrowserTool) resolveRef(sessionID string, params *browserInput) error {
+	if params.Ref == 0 {
+		return nil
+	}
+	if params.Selector != "" {
+		return fmt.Errorf("browser: give either ref or selector, not both")
+	}
+	browserCtx := t.currentContext(sessionID)
+	if browserCtx == nil {
+		return fmt.Errorf("browser: ref %d is unknown; take a snapshot first", params.Ref)
+	}
+	sel := refSelector(params.Ref)
+	var found bool
+	if err := t.runWithTimeout(browserCtx, defaultActionTimeout,
+		chromedp.Evaluate(fmt.Sprintf("document.querySelector(%q) !== null", sel), &found),
+	); err != nil {
+		return fmt.Errorf("browser: resolving ref %d: %w", params.Ref, err)
+	}
+	if !found {
+		return fmt.Errorf("browser: ref %d is no longer on the page; take a new snapshot", params.Ref)
+	}
+	params.Selector = sel
+	return nil
+}
+
+// takeSnapshot outlines the current page and remembers it for later diffs.
+func (t *BrowserTool) takeSnapshot(browserCtx context.Context, sessionID string) (cur, prev *pageSnapshot, err error) {
+	cur = &pageSnapshot{}
+	if err := t.runWithTimeout(browserCtx, defaultActionTimeout,
+		chromedp.Evaluate(fmt.Sprintf(snapshotScript, maxSnapshotNodes), cur),
+	); err != nil {
+		return nil, nil, fmt.Errorf("browser: snapshot failed: %w", err)
+	}
+
+	t.mu.Lock()
+	if sess, ok := t.sessions[sessionID]; ok {
+		prev = sess.snapshot
+		sess.snapshot = cur
+	}
+	t.mu.Unlock()
+	return cur, prev, nil
+}
+
+func (t *BrowserTool) doSnapshot(_ context.Context, sessionID string, params browserInput) (string, error) {
+	browserCtx, err := t.getOrCreateSession(sessionID, params.Profile)
+	if err != nil {
+		return "", err
+	}
+	cur, _, err := t.takeSnapshot(browserCtx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return cur.format(), nil
+}
+
+// observe reports the state of the page after an action. Once the session
+// has taken a snapshot, this is a diff against the previous one; otherwise
+// it is a screenshot.
+func (t *BrowserTool) observe(browserCtx context.Context, sessionID string) string {
+	t.mu.Lock()
+	sess := t.sessions[sessionID]
+	snapshotting := sess != nil && sess.snapshot != nil
+	t.mu.Unlock()
+
+	if snapshotting {
+		if cur, prev, err := t.takeSnapshot(browserCtx, sessionID); err == nil {
+			return cur.diff(prev)
+		}
+	}
+	path, _ := t.captureScreenshot(browserCtx, sessionID)
+	return "Screenshot: " + path
+}
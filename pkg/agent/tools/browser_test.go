@@ -3,7 +3,12 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -237,6 +242,212 @@ func TestBrowserTool_StartCleanupAndClose(t *testing.T) {
 	bt.Close()
 }
 
+func TestBrowserTool_FileActionsCheckPolicy(t *testing.T) {
+	bt := &BrowserTool{DataDir: t.TempDir(), Headless: true}
+	ctx := WithSessionInfo(context.Background(), "test-session", "default")
+	allowed := t.TempDir()
+	policy := sandbox.Policy{AllowedPaths: []string{allowed}, ReadOnlyPaths: []string{filepath.Join(allowed, "ro")}}
+
+	tests := []struct {
+		name  string
+		input browserInput
+	}{
+		{"download without target", browserInput{Action: "download", Path: allowed}},
+		{"download outside allowed paths", browserInput{Action: "download", URL: "http://example.com/f", Path: "/etc"}},
+		{"default download dir outside allowed paths", browserInput{Action: "download", URL: "http://example.com/f"}},
+		{"download into read-only path", browserInput{Action: "download", URL: "http://example.com/f", Path: filepath.Join(allowed, "ro")}},
+		{"upload without path", browserInput{Action: "upload", Selector: "input"}},
+		{"upload outside allowed paths", browserInput{Action: "upload", Selector: "input", Path: "/etc/passwd"}},
+		{"upload missing file", browserInput{Action: "upload", Selector: "input", Path: filepath.Join(allowed, "missing.txt")}},
+		{"pdf outside allowed paths", browserInput{Action: "save_pdf", Path: "/tmp/elsewhere/page.pdf"}},
+		{"set_cookies without cookies", browserInput{Action: "set_cookies"}},
+		{"set_cookies with invalid json", browserInput{Action: "set_cookies", Text: "session=abc"}},
+		{"set_cookies placeholder without store", browserInput{Action: "set_cookies", Text: `[{"name":"s","value":"{{cred:sso}}"}]`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(tt.input)
+			if _, err := bt.Execute(ctx, input, nil, policy); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	if bt.sessions != nil && len(bt.sessions) > 0 {
+		t.Error("failed actions should not start a browser")
+	}
+}
+
+func TestBrowserTool_Profiles(t *testing.T) {
+	bt := &BrowserTool{DataDir: t.TempDir()}
+	if _, err := bt.profileDir("../escape"); err == nil {
+		t.Error("profile names with path separators should be rejected")
+	}
+	dir, err := bt.profileDir("sso-dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(bt.DataDir, "browser-profiles", "sso-dashboard"); dir != want {
+		t.Errorf("profileDir = %q, want %q", dir, want)
+	}
+
+	bt.sessions = map[string]*browserSession{
+		"a": {profile: "work", ctx: context.Background(), ctxCancel: func() {}, allocCancel: func() {}},
+	}
+	if _, err := bt.getOrCreateSession("a", "personal"); err == nil || !strings.Contains(err.Error(), "close it") {
+		t.Errorf("switching profile of a running session: err = %v", err)
+	}
+	if _, err := bt.getOrCreateSession("b", "work"); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("sharing a profile between sessions: err = %v", err)
+	}
+	if _, err := bt.getOrCreateSession("a", ""); err != nil {
+		t.Errorf("reusing a session without naming its profile: %v", err)
+	}
+}
+
+func TestParseCookies(t *testing.T) {
+	cookies, err := parseCookies(`[{"name":"sid","value":"x","domain":".corp.example","path":"/","expires":1900000000,"httpOnly":true,"secure":true,"sameSite":"Lax"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cookies[0]
+	if c.Name != "sid" || c.Domain != ".corp.example" || !c.HTTPOnly || !c.Secure || c.SameSite != "Lax" {
+		t.Errorf("cookie = %+v", c)
+	}
+	if c.Expires == nil || c.Expires.Time().Unix() != 1900000000 {
+		t.Errorf("expires = %v", c.Expires)
+	}
+	if _, err := parseCookies(`[{"value":"x"}]`); err == nil {
+		t.Error("expected error for cookie without name")
+	}
+}
+
+func TestOutputPathAllowsDownloadDir(t *testing.T) {
+	bt := &BrowserTool{DataDir: t.TempDir()}
+	workspace := t.TempDir()
+	policy := sandbox.Policy{AllowedPaths: []string{workspace}}
+
+	if _, err := bt.outputPath(bt.downloadDir(), policy); err != nil {
+		t.Errorf("default download dir rejected: %v", err)
+	}
+	if _, err := bt.outputPath(filepath.Join(bt.downloadDir(), "page.pdf"), policy); err != nil {
+		t.Errorf("file in download dir rejected: %v", err)
+	}
+	if _, err := bt.outputPath(filepath.Join(workspace, "page.pdf"), policy); err != nil {
+		t.Errorf("allowed path rejected: %v", err)
+	}
+	if _, err := bt.outputPath(filepath.Join(t.TempDir(), "page.pdf"), policy); err == nil {
+		t.Error("path outside the policy and download dir should be rejected")
+	}
+
+	policy.ReadOnlyPaths = []string{bt.downloadDir()}
+	if _, err := bt.outputPath(bt.downloadDir(), policy); err == nil {
+		t.Error("read-only download dir should be rejected")
+	}
+	if len(policy.AllowedPaths) != 1 {
+		t.Errorf("outputPath changed the caller's AllowedPaths: %v", policy.AllowedPaths)
+	}
+}
+
+func TestSafeFilenameAndUniquePath(t *testing.T) {
+	for in, want := range map[string]string{
+		"report.csv":       "report.csv",
+		"../../etc/passwd": "passwd",
+		`..\windows\a.txt`: "a.txt",
+		"..":               "guid",
+		"":                 "guid",
+	} {
+		if got := safeFilename(in, "guid"); got != want {
+			t.Errorf("safeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+	if got := uniquePath(path); got != path {
+		t.Errorf("uniquePath = %q, want %q", got, path)
+	}
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uniquePath(path), filepath.Join(dir, "report (1).csv"); got != want {
+		t.Errorf("uniquePath = %q, want %q", got, want)
+	}
+}
+
+func TestPageSnapshot_FormatAndDiff(t *testing.T) {
+	prev := &pageSnapshot{
+		Title: "Sign in",
+		URL:   "https://sso.example/login",
+		Nodes: []snapshotNode{
+			{Role: "heading", Name: "Welcome", Level: 1},
+			{Ref: 1, Role: "textbox", Name: "Email"},
+			{Ref: 2, Role: "checkbox", Name: "Remember me"},
+			{Ref: 3, Role: "button", Name: "Sign in", States: []string{"disabled"}},
+		},
+	}
+	want := `Page: Sign in (https://sso.example/login)
+heading "Welcome" level=1
+[1] textbox "Email"
+[2] checkbox "Remember me"
+[3] button "Sign in" disabled`
+	if got := prev.format(); got != want {
+		t.Errorf("format =\n%s\nwant\n%s", got, want)
+	}
+	if got := prev.diff(nil); got != want {
+		t.Errorf("diff without previous snapshot should be the full outline, got\n%s", got)
+	}
+
+	cur := &pageSnapshot{
+		Title: "Sign in",
+		URL:   "https://sso.example/login",
+		Nodes: []snapshotNode{
+			{Role: "heading", Name: "Welcome", Level: 1},
+			{Ref: 1, Role: "textbox", Name: "Email", Value: "me@corp.example"},
+			{Ref: 2, Role: "checkbox", Name: "Remember me"},
+			{Ref: 3, Role: "button", Name: "Sign in"},
+		},
+	}
+	got := cur.diff(prev)
+	for _, line := range []string{
+		`- [1] textbox "Email"`,
+		`- [3] button "Sign in" disabled`,
+		`+ [1] textbox "Email" value="me@corp.example"`,
+		`+ [3] button "Sign in"`,
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("diff missing %q:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "Remember me") {
+		t.Errorf("diff should leave out unchanged elements:\n%s", got)
+	}
+	if got := cur.diff(cur); !strings.Contains(got, "No changes") {
+		t.Errorf("diff of identical snapshots = %q", got)
+	}
+
+	next := &pageSnapshot{Title: "Home", URL: "https://dash.example/", Nodes: []snapshotNode{{Ref: 4, Role: "link", Name: "Reports"}}}
+	if got := next.diff(cur); got != next.format() {
+		t.Errorf("a new page should return the full outline, got\n%s", got)
+	}
+}
+
+func TestBrowserTool_RefRequiresSnapshot(t *testing.T) {
+	bt := &BrowserTool{DataDir: t.TempDir(), Headless: true}
+	ctx := WithSessionInfo(context.Background(), "test-session", "default")
+
+	input, _ := json.Marshal(browserInput{Action: "click", Ref: 3})
+	if _, err := bt.Execute(ctx, input, nil, sandbox.Policy{}); err == nil || !strings.Contains(err.Error(), "snapshot") {
+		t.Errorf("click by ref without a session: err = %v", err)
+	}
+	input, _ = json.Marshal(browserInput{Action: "click", Ref: 3, Selector: "#go"})
+	if _, err := bt.Execute(ctx, input, nil, sandbox.Policy{}); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("click with ref and selector: err = %v", err)
+	}
+	if got := refSelector(12); got != `[data-pincer-ref="12"]` {
+		t.Errorf("refSelector = %s", got)
+	}
+}
+
 func skipIfNoChrome(t *testing.T) {
 	t.Helper()
 	paths := []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser"}
@@ -302,3 +513,115 @@ func TestBrowserTool_NavigateIntegration(t *testing.T) {
 		t.Errorf("result = %q, want %q", result, "browser session closed")
 	}
 }
+
+func TestBrowserTool_DownloadAndCookiesIntegration(t *testing.T) {
+	skipIfNoChrome(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report.csv" {
+			w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+			w.Write([]byte("a,b\n1,2\n"))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc"})
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer srv.Close()
+
+	bt := &BrowserTool{DataDir: t.TempDir(), Headless: true, IdleTimeout: time.Minute}
+	bt.StartCleanup()
+	defer bt.Close()
+	ctx := WithSessionInfo(context.Background(), "download-test", "default")
+	dir := t.TempDir()
+
+	run := func(in browserInput) string {
+		t.Helper()
+		input, _ := json.Marshal(in)
+		result, err := bt.Execute(ctx, input, nil, sandbox.Policy{AllowedPaths: []string{dir}})
+		if err != nil {
+			t.Fatalf("%s failed: %v", in.Action, err)
+		}
+		return result
+	}
+
+	run(browserInput{Action: "navigate", URL: srv.URL, Profile: "test"})
+	if out := run(browserInput{Action: "get_cookies"}); !strings.Contains(out, `"sid"`) {
+		t.Errorf("get_cookies = %s", out)
+	}
+	run(browserInput{Action: "download", URL: srv.URL + "/report.csv", Path: dir})
+	data, err := os.ReadFile(filepath.Join(dir, "report.csv"))
+	if err != nil || string(data) != "a,b\n1,2\n" {
+		t.Errorf("downloaded file = %q, %v", data, err)
+	}
+}
+
+func TestBrowserTool_MasksFilledCredentials(t *testing.T) {
+	store := newTestCredentialStore(t)
+	ctx := context.Background()
+	_ = store.Set(ctx, "pw", "hunter2")
+
+	bt := &BrowserTool{sessions: map[string]*browserSession{"s1": {}}}
+	sec := newSecrets(store, "browser")
+	if _, err := sec.expand(ctx, "{{cred:pw}}"); err != nil {
+		t.Fatal(err)
+	}
+	bt.rememberSecrets("s1", sec)
+
+	snap := (&pageSnapshot{Nodes: []snapshotNode{{Ref: 1, Role: "textbox", Name: "Code", Value: "hunter2"}}}).format()
+	if got := bt.maskSecrets("s1", snap); strings.Contains(got, "hunter2") || !strings.Contains(got, `value="{{cred:pw}}"`) {
+		t.Errorf("masked snapshot = %q", got)
+	}
+	if got := bt.maskSecrets("s2", "hunter2"); got != "hunter2" {
+		t.Errorf("other session masked to %q", got)
+	}
+}
+
+func TestBrowserTool_SnapshotIntegration(t *testing.T) {
+	skipIfNoChrome(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><h1>Login</h1>
+<label for="u">User</label><input id="u">
+<button onclick="document.getElementById('msg').hidden = false">Go</button>
+<a id="msg" href="/next" hidden>Continue</a>
+</body></html>`))
+	}))
+	defer srv.Close()
+
+	bt := &BrowserTool{DataDir: t.TempDir(), Headless: true, IdleTimeout: time.Minute}
+	bt.StartCleanup()
+	defer bt.Close()
+	ctx := WithSessionInfo(context.Background(), "snapshot-test", "default")
+
+	run := func(in browserInput) string {
+		t.Helper()
+		input, _ := json.Marshal(in)
+		result, err := bt.Execute(ctx, input, nil, sandbox.Policy{})
+		if err != nil {
+			t.Fatalf("%s failed: %v", in.Action, err)
+		}
+		return result
+	}
+
+	run(browserInput{Action: "navigate", URL: srv.URL})
+	snap := run(browserInput{Action: "snapshot"})
+	for _, want := range []string{`heading "Login" level=1`, `[1] textbox "User"`, `[2] button "Go"`} {
+		if !strings.Contains(snap, want) {
+			t.Errorf("snapshot missing %q:\n%s", want, snap)
+		}
+	}
+	if out := run(browserInput{Action: "type", Ref: 1, Text: "alice"}); !strings.Contains(out, `+ [1] textbox "User" value="alice"`) {
+		t.Errorf("type result should include the change:\n%s", out)
+	}
+	if out := run(browserInput{Action: "click", Ref: 2}); !strings.Contains(out, `+ [3] link "Continue"`) {
+		t.Errorf("click result should show the new link:\n%s", out)
+	}
+
+	creds := newTestCredentialStore(t)
+	_ = creds.Set(ctx, "user", "s3cret-user")
+	bt.Secrets = creds
+	run(browserInput{Action: "type", Ref: 1, Text: "{{cred:user}}"})
+	if snap := run(browserInput{Action: "snapshot"}); strings.Contains(snap, "s3cret-user") || !strings.Contains(snap, `value="{{cred:user}}"`) {
+		t.Errorf("snapshot should mask the typed credential:\n%s", snap)
+	}
+}
@@ -8,6 +8,8 @@ const (
 	ctxKeySessionID contextKey = iota
 	ctxKeyAgentID
 	ctxKeySubagentDepth
+	ctxKeyMemoryNamespace
+	ctxKeyToolCallID
 )
 
 func WithSessionInfo(ctx context.Context, sessionID, agentID string) context.Context {
@@ -30,6 +32,33 @@ func AgentIDFromContext(ctx context.Context) string {
 	return "default"
 }
 
+func WithMemoryNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, ctxKeyMemoryNamespace, namespace)
+}
+
+// MemoryNamespaceFromContext returns the namespace memory tools read and
+// write, which is the agent ID unless the agent is configured otherwise.
+func MemoryNamespaceFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKeyMemoryNamespace).(string); ok && v != "" {
+		return v
+	}
+	return AgentIDFromContext(ctx)
+}
+
+// WithToolCallID records the ID of the tool call a tool is executing, so
+// output collected after Execute can be matched to its call when several
+// calls of one tool run in parallel.
+func WithToolCallID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyToolCallID, id)
+}
+
+func ToolCallIDFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKeyToolCallID).(string); ok {
+		return v
+	}
+	return ""
+}
+
 func WithSubagentDepth(ctx context.Context, depth int) context.Context {
 	return context.WithValue(ctx, ctxKeySubagentDepth, depth)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/igorsilveira/pincer/pkg/credentials"
@@ -24,7 +25,7 @@ type credentialInput struct {
 func (t *CredentialTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        "credential",
-		Description: "Encrypted credential store for managing secrets and API keys. Actions: get, set, delete, list.",
+		Description: "Encrypted credential store for managing secrets and API keys. Actions: get, set, delete, list. Values are not returned by get; pass {{cred:NAME}} to http_request (url, headers, body) or shell (env values) and the value is inserted at execution time.",
 		InputSchema: json.RawMessage(`{
 			"type": "object",
 			"properties": {
@@ -58,11 +59,17 @@ func (t *CredentialTool) Execute(ctx context.Context, input json.RawMessage, _ s
 		if params.Name == "" {
 			return "", fmt.Errorf("credential: name is required for get")
 		}
-		val, err := t.Credentials.Get(ctx, params.Name)
+		// Only credentials explicitly scoped to this tool are revealed to the
+		// model; everything else is used through placeholders.
+		scopes, err := t.Credentials.Scopes(ctx, params.Name)
 		if err != nil {
 			return "", err
 		}
-		return val, nil
+		if !slices.Contains(scopes, credentials.ToolScope("credential")) {
+			return fmt.Sprintf("credential %q exists; its value is not shown. Use %s where it is needed.",
+				params.Name, credentials.Placeholder(params.Name)), nil
+		}
+		return t.Credentials.Resolve(ctx, params.Name, credentials.ToolScope("credential"))
 
 	case "set":
 		if params.Name == "" {
@@ -54,6 +54,17 @@ func TestCredentialTool_Get(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Execute: %v", err)
 	}
+	if strings.Contains(output, "mytoken") || !strings.Contains(output, "{{cred:token}}") {
+		t.Errorf("output = %q, want the placeholder and not the value", output)
+	}
+
+	if err := store.SetScopes(ctx, "token", []string{"tool:credential"}); err != nil {
+		t.Fatalf("SetScopes: %v", err)
+	}
+	output, err = tool.Execute(ctx, input, nil, sandbox.Policy{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
 	if output != "mytoken" {
 		t.Errorf("output = %q, want %q", output, "mytoken")
 	}
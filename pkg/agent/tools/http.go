@@ -13,7 +13,11 @@ import (
 	"github.com/igorsilveira/pincer/pkg/sandbox"
 )
 
-type HTTPTool struct{}
+type HTTPTool struct {
+	// Secrets resolves {{cred:NAME}} placeholders in the url, headers and
+	// body. Nil leaves placeholders unsupported.
+	Secrets SecretResolver
+}
 
 type httpInput struct {
 	URL     string            `json:"url"`
@@ -25,7 +29,7 @@ type httpInput struct {
 func (t *HTTPTool) Definition() llm.ToolDefinition {
 	return llm.ToolDefinition{
 		Name:        "http_request",
-		Description: "Make an HTTP request to a URL and return the response. Supports GET, POST, PUT, PATCH, DELETE methods.",
+		Description: "Make an HTTP request to a URL and return the response. Supports GET, POST, PUT, PATCH, DELETE methods. Use {{cred:NAME}} in the url, headers or body to insert a stored credential without seeing its value.",
 		InputSchema: json.RawMessage(`{
 			"type": "object",
 			"properties": {
@@ -67,6 +71,19 @@ func (t *HTTPTool) Execute(ctx context.Context, input json.RawMessage, sb sandbo
 		return "", fmt.Errorf("http_request: network access denied by sandbox policy")
 	}
 
+	sec := newSecrets(t.Secrets, "http_request")
+	if params.URL, err = sec.expand(ctx, params.URL); err != nil {
+		return "", fmt.Errorf("http_request: %w", err)
+	}
+	for k, v := range params.Headers {
+		if params.Headers[k], err = sec.expand(ctx, v); err != nil {
+			return "", fmt.Errorf("http_request: %w", err)
+		}
+	}
+	if params.Body, err = sec.expand(ctx, params.Body); err != nil {
+		return "", fmt.Errorf("http_request: %w", err)
+	}
+
 	method := params.Method
 	if method == "" {
 		method = "GET"
@@ -87,7 +104,7 @@ func (t *HTTPTool) Execute(ctx context.Context, input json.RawMessage, sb sandbo
 
 	req, err := http.NewRequestWithContext(ctx, method, params.URL, bodyReader)
 	if err != nil {
-		return "", fmt.Errorf("http_request: creating request: %w", err)
+		return "", fmt.Errorf("http_request: creating request: %s", sec.mask(err.Error()))
 	}
 
 	for k, v := range params.Headers {
@@ -96,7 +113,7 @@ func (t *HTTPTool) Execute(ctx context.Context, input json.RawMessage, sb sandbo
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("http_request: %w", err)
+		return "", fmt.Errorf("http_request: %s", sec.mask(err.Error()))
 	}
 	defer resp.Body.Close()
 
@@ -111,5 +128,5 @@ func (t *HTTPTool) Execute(ctx context.Context, input json.RawMessage, sb sandbo
 	}
 
 	result := fmt.Sprintf("HTTP %d %s\n\n%s", resp.StatusCode, resp.Status, string(body))
-	return result, nil
+	return sec.mask(result), nil
 }
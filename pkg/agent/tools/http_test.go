@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/igorsilveira/pincer/pkg/sandbox"
@@ -40,3 +41,35 @@ func TestHTTPTool_NetworkAllowPasses(t *testing.T) {
 		t.Error("expected non-empty result")
 	}
 }
+
+func TestHTTPTool_ResolvesCredentialPlaceholders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("auth=" + r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	store := newTestCredentialStore(t)
+	ctx := context.Background()
+	_ = store.Set(ctx, "api", "sk-secret")
+
+	tool := &HTTPTool{Secrets: store}
+	input, _ := json.Marshal(httpInput{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer {{cred:api}}"}})
+
+	result, err := tool.Execute(ctx, input, nil, sandbox.Policy{NetworkAccess: sandbox.NetworkAllow})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if strings.Contains(result, "sk-secret") {
+		t.Errorf("secret leaked into result: %q", result)
+	}
+	if !strings.Contains(result, "auth=Bearer {{cred:api}}") {
+		t.Errorf("result = %q, want the echoed header masked", result)
+	}
+
+	if err := store.SetScopes(ctx, "api", []string{"mcp:github"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tool.Execute(ctx, input, nil, sandbox.Policy{NetworkAccess: sandbox.NetworkAllow}); err == nil {
+		t.Error("expected an error for a credential scoped to another consumer")
+	}
+}
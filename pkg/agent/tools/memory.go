@@ -58,7 +58,7 @@ func (t *MemoryTool) Execute(ctx context.Context, input json.RawMessage, _ sandb
 		return "", err
 	}
 
-	agentID := AgentIDFromContext(ctx)
+	agentID := MemoryNamespaceFromContext(ctx)
 
 	switch params.Action {
 	case "get":
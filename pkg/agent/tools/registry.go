@@ -17,6 +17,12 @@ type Tool interface {
 	Execute(ctx context.Context, input json.RawMessage, sb sandbox.Sandbox, policy sandbox.Policy) (string, error)
 }
 
+// ApprovalRequirer is implemented by tools that must be approved on every
+// call, even when tool approval is otherwise automatic.
+type ApprovalRequirer interface {
+	RequiresApproval() bool
+}
+
 type Registry struct {
 	mu    sync.RWMutex
 	tools map[string]Tool
@@ -92,6 +98,24 @@ func (r *Registry) Without(names []string) *Registry {
 	return filtered
 }
 
+// With returns a copy of the registry in which the given tools replace any
+// registered under the same name.
+func (r *Registry) With(overrides ...Tool) *Registry {
+	if len(overrides) == 0 {
+		return r
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	merged := NewRegistry()
+	for name, t := range r.tools {
+		merged.tools[name] = t
+	}
+	for _, t := range overrides {
+		merged.tools[t.Definition().Name] = t
+	}
+	return merged
+}
+
 func DefaultRegistry(fc *filecache.Cache) *Registry {
 	r := NewRegistry()
 	r.Register(&ShellTool{})
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/igorsilveira/pincer/pkg/credentials"
+)
+
+// SecretResolver substitutes {{cred:NAME}} placeholders at execution time,
+// so that credential values never pass through the model.
+type SecretResolver interface {
+	Expand(ctx context.Context, text, consumer string) (string, map[string]string, error)
+}
+
+// secrets expands placeholders for one tool call and remembers the values it
+// substituted, so they can be masked in what the tool returns.
+type secrets struct {
+	resolver SecretResolver
+	consumer string
+	used     map[string]string
+}
+
+func newSecrets(r SecretResolver, tool string) *secrets {
+	return &secrets{resolver: r, consumer: credentials.ToolScope(tool), used: map[string]string{}}
+}
+
+func (s *secrets) expand(ctx context.Context, text string) (string, error) {
+	if !credentials.HasPlaceholder(text) {
+		return text, nil
+	}
+	if s.resolver == nil {
+		return "", fmt.Errorf("credential placeholders need the credential store to be enabled")
+	}
+	out, used, err := s.resolver.Expand(ctx, text, s.consumer)
+	if err != nil {
+		return "", err
+	}
+	for name, v := range used {
+		s.used[name] = v
+	}
+	return out, nil
+}
+
+// mask replaces substituted values in text with their placeholders.
+func (s *secrets) mask(text string) string {
+	for name, v := range s.used {
+		if v != "" {
+			text = strings.ReplaceAll(text, v, credentials.Placeholder(name))
+		}
+	}
+	return text
+}
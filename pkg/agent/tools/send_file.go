@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+)
+
+const maxSendFiles = 10
+
+type SendFileTool struct {
+	Send     func(ctx context.Context, sessionID, caption string, files []channels.Attachment) error
+	MaxBytes int64
+}
+
+type sendFileInput struct {
+	Paths   []string `json:"paths"`
+	Caption string   `json:"caption,omitempty"`
+}
+
+func (t *SendFileTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        "send_file",
+		Description: "Send one or more files (images, documents, generated reports) to the user in the current chat. Images are shown inline where the channel supports it.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"paths": {
+					"type": "array",
+					"items": {"type": "string"},
+					"description": "Paths of the files to send"
+				},
+				"caption": {
+					"type": "string",
+					"description": "Optional text sent along with the files"
+				}
+			},
+			"required": ["paths"]
+		}`),
+	}
+}
+
+func (t *SendFileTool) Execute(ctx context.Context, input json.RawMessage, _ sandbox.Sandbox, policy sandbox.Policy) (string, error) {
+	params, err := parseInput[sendFileInput](input, "send_file")
+	if err != nil {
+		return "", err
+	}
+
+	sessionID := SessionIDFromContext(ctx)
+	if sessionID == "" {
+		return "", fmt.Errorf("send_file: no session in context")
+	}
+	if len(params.Paths) == 0 {
+		return "", fmt.Errorf("send_file: at least one path is required")
+	}
+	if len(params.Paths) > maxSendFiles {
+		return "", fmt.Errorf("send_file: at most %d files per call", maxSendFiles)
+	}
+
+	maxBytes := t.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = channels.DefaultMaxAttachmentBytes
+	}
+
+	files := make([]channels.Attachment, 0, len(params.Paths))
+	for _, p := range params.Paths {
+		att, err := loadAttachment(p, policy, maxBytes)
+		if err != nil {
+			return "", fmt.Errorf("send_file: %w", err)
+		}
+		files = append(files, att)
+	}
+
+	if err := t.Send(ctx, sessionID, params.Caption, files); err != nil {
+		return "", fmt.Errorf("send_file: send failed: %w", err)
+	}
+
+	if len(files) == 1 {
+		return fmt.Sprintf("sent %s", files[0].Filename), nil
+	}
+	return fmt.Sprintf("sent %d files", len(files)), nil
+}
+
+func loadAttachment(path string, policy sandbox.Policy, maxBytes int64) (channels.Attachment, error) {
+	if !filepath.IsAbs(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return channels.Attachment{}, fmt.Errorf("resolving path: %w", err)
+		}
+		path = abs
+	}
+
+	if err := sandbox.CheckPathAllowed(path, policy.AllowedPaths); err != nil {
+		return channels.Attachment{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return channels.Attachment{}, err
+	}
+	if info.IsDir() {
+		return channels.Attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+	if err := channels.CheckAttachmentSize(info.Size(), maxBytes); err != nil {
+		return channels.Attachment{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return channels.Attachment{}, err
+	}
+
+	return channels.Attachment{
+		Filename:  filepath.Base(path),
+		MediaType: channels.DetectMediaType(mime.TypeByExtension(filepath.Ext(path)), data),
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+)
+
+func TestSendFileTool_Send(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotSession, gotCaption string
+	var gotFiles []channels.Attachment
+	tool := &SendFileTool{
+		Send: func(_ context.Context, sessionID, caption string, files []channels.Attachment) error {
+			gotSession, gotCaption, gotFiles = sessionID, caption, files
+			return nil
+		},
+	}
+	input, _ := json.Marshal(sendFileInput{Paths: []string{path}, Caption: "latest numbers"})
+
+	output, err := tool.Execute(notifyCtx(), input, nil, sandbox.Policy{AllowedPaths: []string{dir}})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if output != "sent report.csv" {
+		t.Errorf("output = %q", output)
+	}
+	if gotSession != "sess-notify" || gotCaption != "latest numbers" {
+		t.Errorf("session = %q, caption = %q", gotSession, gotCaption)
+	}
+	if len(gotFiles) != 1 {
+		t.Fatalf("files = %d, want 1", len(gotFiles))
+	}
+	if gotFiles[0].Filename != "report.csv" || !strings.HasPrefix(gotFiles[0].MediaType, "text/") {
+		t.Errorf("file = %s (%s)", gotFiles[0].Filename, gotFiles[0].MediaType)
+	}
+}
+
+func TestSendFileTool_DisallowedPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	tool := &SendFileTool{
+		Send: func(context.Context, string, string, []channels.Attachment) error {
+			called = true
+			return nil
+		},
+	}
+	input, _ := json.Marshal(sendFileInput{Paths: []string{path}})
+
+	if _, err := tool.Execute(notifyCtx(), input, nil, sandbox.Policy{AllowedPaths: []string{t.TempDir()}}); err == nil {
+		t.Fatal("expected error for path outside allowed paths")
+	}
+	if called {
+		t.Error("Send should not be called when a path is rejected")
+	}
+}
+
+func TestSendFileTool_TooLarge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(path, make([]byte, 64), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := &SendFileTool{
+		Send:     func(context.Context, string, string, []channels.Attachment) error { return nil },
+		MaxBytes: 16,
+	}
+	input, _ := json.Marshal(sendFileInput{Paths: []string{path}})
+
+	_, err := tool.Execute(notifyCtx(), input, nil, sandbox.Policy{AllowedPaths: []string{dir}})
+	if err == nil || !strings.Contains(err.Error(), "size limit") {
+		t.Fatalf("err = %v, want size limit error", err)
+	}
+}
@@ -10,11 +10,16 @@ import (
 	"github.com/igorsilveira/pincer/pkg/sandbox"
 )
 
-type ShellTool struct{}
+type ShellTool struct {
+	// Secrets resolves {{cred:NAME}} placeholders in env values. Nil leaves
+	// placeholders unsupported.
+	Secrets SecretResolver
+}
 
 type shellInput struct {
-	Command string `json:"command"`
-	WorkDir string `json:"work_dir,omitempty"`
+	Command string            `json:"command"`
+	WorkDir string            `json:"work_dir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
 }
 
 func (t *ShellTool) Definition() llm.ToolDefinition {
@@ -31,6 +36,11 @@ func (t *ShellTool) Definition() llm.ToolDefinition {
 				"work_dir": {
 					"type": "string",
 					"description": "Optional working directory for the command"
+				},
+				"env": {
+					"type": "object",
+					"description": "Optional environment variables. Values may use {{cred:NAME}} to pass a stored credential, e.g. {\"TOKEN\": \"{{cred:github}}\"}, then reference $TOKEN in the command.",
+					"additionalProperties": { "type": "string" }
 				}
 			},
 			"required": ["command"]
@@ -60,6 +70,17 @@ func (t *ShellTool) Execute(ctx context.Context, input json.RawMessage, sb sandb
 		WorkDir: params.WorkDir,
 	}
 
+	// Placeholders are only resolved in env values, never in the command
+	// itself, so secrets do not end up in process listings or shell history.
+	sec := newSecrets(t.Secrets, "shell")
+	for k, v := range params.Env {
+		val, err := sec.expand(ctx, v)
+		if err != nil {
+			return "", fmt.Errorf("shell: env %s: %w", k, err)
+		}
+		cmd.Env = append(cmd.Env, k+"="+val)
+	}
+
 	result, err := sb.Exec(ctx, cmd, policy)
 	if err != nil {
 		return "", fmt.Errorf("shell: execution failed: %w", err)
@@ -76,5 +97,5 @@ func (t *ShellTool) Execute(ctx context.Context, input json.RawMessage, sb sandb
 		output += "\nError: " + result.Error
 	}
 
-	return output, nil
+	return sec.mask(output), nil
 }
@@ -107,3 +107,35 @@ func TestShellTool_WorkDir(t *testing.T) {
 		t.Errorf("WorkDir = %q, want %q", sb.gotCmd.WorkDir, "/tmp/test")
 	}
 }
+
+func TestShellTool_EnvResolvesCredentials(t *testing.T) {
+	store := newTestCredentialStore(t)
+	ctx := context.Background()
+	_ = store.Set(ctx, "gh", "ghp_secret")
+
+	sb := &fakeSandbox{
+		result: &sandbox.Result{Stdout: "token is ghp_secret", ExitCode: 0},
+	}
+	tool := &ShellTool{Secrets: store}
+	input, _ := json.Marshal(shellInput{Command: "echo token is $TOKEN", Env: map[string]string{"TOKEN": "{{cred:gh}}"}})
+
+	output, err := tool.Execute(ctx, input, sb, sandbox.Policy{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(sb.gotCmd.Env) != 1 || sb.gotCmd.Env[0] != "TOKEN=ghp_secret" {
+		t.Errorf("Env = %v", sb.gotCmd.Env)
+	}
+	if output != "token is {{cred:gh}}" {
+		t.Errorf("output = %q, want the secret masked", output)
+	}
+}
+
+func TestShellTool_PlaceholderWithoutStore(t *testing.T) {
+	tool := &ShellTool{}
+	input, _ := json.Marshal(shellInput{Command: "env", Env: map[string]string{"TOKEN": "{{cred:gh}}"}})
+
+	if _, err := tool.Execute(context.Background(), input, &fakeSandbox{}, sandbox.Policy{}); err == nil {
+		t.Error("expected an error when no credential store is configured")
+	}
+}
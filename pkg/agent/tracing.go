@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startTurnSpan starts the span of an agent turn in sessionID. The turn's
+// model calls and tool executions are its children.
+func startTurnSpan(ctx context.Context, agentCfg agentSettings, sessionID string) (context.Context, trace.Span) {
+	return telemetry.Tracer().Start(ctx, "invoke_agent "+agentCfg.id,
+		trace.WithAttributes(
+			semconv.GenAIOperationNameInvokeAgent,
+			semconv.GenAIAgentID(agentCfg.id),
+			semconv.GenAIConversationID(sessionID),
+			semconv.GenAIProviderNameKey.String(agentCfg.provider.Name()),
+			semconv.GenAIRequestModel(agentCfg.model),
+		),
+	)
+}
+
+// traceTurn forwards a turn's events and ends span when the turn is over,
+// marking it failed if the turn reported an error.
+func traceTurn(span trace.Span, events <-chan TurnEvent) <-chan TurnEvent {
+	if !span.IsRecording() {
+		span.End()
+		return events
+	}
+	out := make(chan TurnEvent, cap(events))
+	go func() {
+		defer close(out)
+		var err error
+		for ev := range events {
+			if ev.Type == TurnError {
+				err = ev.Error
+			}
+			out <- ev
+		}
+		telemetry.EndSpan(span, err)
+	}()
+	return out
+}
+
+// startChatSpan starts the client span of a model call.
+func startChatSpan(ctx context.Context, provider llm.Provider, req llm.ChatRequest) (context.Context, trace.Span) {
+	return telemetry.Tracer().Start(ctx, "chat "+req.Model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameChat,
+			semconv.GenAIProviderNameKey.String(provider.Name()),
+			semconv.GenAIRequestModel(req.Model),
+			semconv.GenAIRequestMaxTokens(req.MaxTokens),
+		),
+	)
+}
+
+// traceChat forwards a model's response stream and ends span with the token
+// usage and outcome once the stream is drained.
+func traceChat(span trace.Span, events <-chan llm.ChatEvent) <-chan llm.ChatEvent {
+	if !span.IsRecording() {
+		span.End()
+		return events
+	}
+	out := make(chan llm.ChatEvent, cap(events))
+	go func() {
+		defer close(out)
+		var err error
+		finish := "stop"
+		for ev := range events {
+			switch ev.Type {
+			case llm.EventToolCall:
+				finish = "tool_calls"
+			case llm.EventDone:
+				if ev.Usage != nil {
+					span.SetAttributes(
+						semconv.GenAIUsageInputTokens(ev.Usage.InputTokens),
+						semconv.GenAIUsageOutputTokens(ev.Usage.OutputTokens),
+					)
+				}
+			case llm.EventError:
+				err = ev.Error
+				finish = "error"
+			}
+			out <- ev
+		}
+		span.SetAttributes(semconv.GenAIResponseFinishReasons(finish))
+		telemetry.EndSpan(span, err)
+	}()
+	return out
+}
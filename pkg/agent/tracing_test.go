@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		tp.Shutdown(context.Background())
+	})
+	return exp
+}
+
+func spansByName(spans tracetest.SpanStubs) map[string][]tracetest.SpanStub {
+	m := make(map[string][]tracetest.SpanStub)
+	for _, s := range spans {
+		m[s.Name] = append(m[s.Name], s)
+	}
+	return m
+}
+
+func TestRunTurn_Tracing(t *testing.T) {
+	exp := recordSpans(t)
+	fp := &fakeProviderMulti{
+		responses: [][]llm.ChatEvent{
+			toolCallEvents("tc-1", "shell", json.RawMessage(`{"command":"echo hi"}`)),
+			{
+				{Type: llm.EventToken, Token: "done"},
+				{Type: llm.EventDone, Usage: &llm.Usage{InputTokens: 12, OutputTokens: 3}},
+			},
+		},
+	}
+	rt, _ := newTestRuntime(t, fp)
+
+	ch, err := rt.RunTurn(context.Background(), "sess-trace", "run echo")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	collectTurnEvents(ch)
+
+	byName := spansByName(exp.GetSpans())
+	turns := byName["invoke_agent default"]
+	if len(turns) != 1 {
+		t.Fatalf("spans = %v, want one invoke_agent span", byName)
+	}
+	turn := turns[0]
+	if !hasAttr(turn, semconv.GenAIConversationID("sess-trace")) {
+		t.Errorf("turn attributes = %v", turn.Attributes)
+	}
+
+	chats := byName["chat fake-1"]
+	if len(chats) != 2 {
+		t.Fatalf("chat spans = %d, want 2", len(chats))
+	}
+	for _, c := range chats {
+		if c.Parent.SpanID() != turn.SpanContext.SpanID() {
+			t.Errorf("chat span parent = %v, want the turn", c.Parent.SpanID())
+		}
+	}
+	if !hasAttr(chats[0], semconv.GenAIResponseFinishReasons("tool_calls")) {
+		t.Errorf("first chat attributes = %v", chats[0].Attributes)
+	}
+	if !hasAttr(chats[1], semconv.GenAIUsageInputTokens(12)) || !hasAttr(chats[1], semconv.GenAIUsageOutputTokens(3)) {
+		t.Errorf("second chat attributes = %v", chats[1].Attributes)
+	}
+
+	tools := byName["execute_tool shell"]
+	if len(tools) != 1 {
+		t.Fatalf("tool spans = %d, want 1", len(tools))
+	}
+	if tools[0].Parent.SpanID() != turn.SpanContext.SpanID() || !hasAttr(tools[0], semconv.GenAIToolCallID("tc-1")) {
+		t.Errorf("tool span = %+v", tools[0])
+	}
+}
+
+func TestRunTurn_TracingError(t *testing.T) {
+	exp := recordSpans(t)
+	fp := &fakeProvider{events: []llm.ChatEvent{{Type: llm.EventError, Error: errors.New("stream broke")}}}
+	rt, _ := newTestRuntime(t, fp)
+
+	ch, err := rt.RunTurn(context.Background(), "sess-trace-err", "hi")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	collectTurnEvents(ch)
+
+	turns := spansByName(exp.GetSpans())["invoke_agent default"]
+	if len(turns) != 1 || turns[0].Status.Code != codes.Error {
+		t.Errorf("turn spans = %+v, want one failed span", turns)
+	}
+}
+
+func hasAttr(s tracetest.SpanStub, want attribute.KeyValue) bool {
+	for _, kv := range s.Attributes {
+		if kv.Key == want.Key {
+			return kv.Value == want.Value
+		}
+	}
+	return false
+}
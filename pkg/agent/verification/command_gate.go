@@ -2,35 +2,61 @@ package verification
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// maxReasonOutput bounds how much command output is quoted back to the agent
+// when a gate fails. The tail is kept, since that is where test runners
+// print their summary.
+const maxReasonOutput = 2000
+
 // CommandRunner abstracts the execution of a shell command.
 type CommandRunner interface {
 	Run(ctx context.Context, cmd string) (string, error)
 }
 
-// CommandOutputGate runs a verification command and checks whether its output
-// contains the expected string.
+// ExitError is returned by a CommandRunner when the command ran but exited
+// with a non-zero status.
+type ExitError struct {
+	Code   int
+	Output string
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit code %d", e.Code) }
+
+// CommandOutputGate runs a verification command and checks its output and
+// exit code. It applies when one of ToolNames was used or a written file
+// matches one of PathPatterns; with neither set it always applies.
 type CommandOutputGate struct {
-	ToolNames      []string
-	VerifyCommand  string
-	ExpectedOutput string
-	Runner         CommandRunner
+	// GateName identifies the gate in results; it defaults to
+	// "command_output".
+	GateName      string
+	ToolNames     []string
+	PathPatterns  []string
+	VerifyCommand string
+	// ExpectedOutput must be contained in the output, and ExpectedPattern
+	// must match it. Empty values are not checked.
+	ExpectedOutput  string
+	ExpectedPattern *regexp.Regexp
+	// ExpectedExitCode is the exit code that counts as success. Nil
+	// requires the command to succeed.
+	ExpectedExitCode *int
+	Runner           CommandRunner
 }
 
-func (g *CommandOutputGate) Name() string { return "command_output" }
+func (g *CommandOutputGate) Name() string {
+	if g.GateName != "" {
+		return g.GateName
+	}
+	return "command_output"
+}
 
 func (g *CommandOutputGate) AppliesTo(tr TaskResult) bool {
-	for _, used := range tr.ToolsUsed {
-		for _, target := range g.ToolNames {
-			if used == target {
-				return true
-			}
-		}
-	}
-	return false
+	return appliesTo(g.ToolNames, g.PathPatterns, tr)
 }
 
 func (g *CommandOutputGate) Verify(ctx context.Context, tr TaskResult) Result {
@@ -38,17 +64,92 @@ func (g *CommandOutputGate) Verify(ctx context.Context, tr TaskResult) Result {
 		return Result{Status: Uncertain, Evidence: "no command runner configured"}
 	}
 	output, err := g.Runner.Run(ctx, g.VerifyCommand)
+	code := 0
 	if err != nil {
-		return Result{Status: Failed, Reason: fmt.Sprintf("verification command failed: %v", err)}
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) {
+			return Result{Status: Failed, Reason: fmt.Sprintf("verification command failed: %v", err)}
+		}
+		code = exitErr.Code
+		if output == "" {
+			output = exitErr.Output
+		}
 	}
 	output = strings.TrimSpace(output)
+
+	wantCode := 0
+	if g.ExpectedExitCode != nil {
+		wantCode = *g.ExpectedExitCode
+	}
+	if code != wantCode {
+		return Result{
+			Status:     Failed,
+			Reason:     fmt.Sprintf("%s: `%s` exited with %d, want %d. Output:\n%s", g.Name(), g.VerifyCommand, code, wantCode, tail(output)),
+			Suggestion: "Fix the problems reported by the command and try again",
+		}
+	}
+
 	expected := strings.TrimSpace(g.ExpectedOutput)
-	if strings.Contains(output, expected) {
-		return Result{Status: Confirmed, Evidence: fmt.Sprintf("output contains %q", expected)}
+	if expected != "" && !strings.Contains(output, expected) {
+		return Result{
+			Status:     Failed,
+			Reason:     fmt.Sprintf("expected output containing %q, got %q", expected, tail(output)),
+			Suggestion: "Re-run the task or check the command output manually",
+		}
+	}
+	if g.ExpectedPattern != nil && !g.ExpectedPattern.MatchString(output) {
+		return Result{
+			Status:     Failed,
+			Reason:     fmt.Sprintf("%s: output of `%s` does not match %q. Output:\n%s", g.Name(), g.VerifyCommand, g.ExpectedPattern, tail(output)),
+			Suggestion: "Re-run the task or check the command output manually",
+		}
 	}
-	return Result{
-		Status:     Failed,
-		Reason:     fmt.Sprintf("expected output containing %q, got %q", expected, output),
-		Suggestion: "Re-run the task or check the command output manually",
+
+	evidence := fmt.Sprintf("`%s` exited with %d", g.VerifyCommand, code)
+	if expected != "" {
+		evidence = fmt.Sprintf("output contains %q", expected)
+	}
+	return Result{Status: Confirmed, Evidence: evidence}
+}
+
+// appliesTo reports whether a gate with the given triggers applies to tr.
+func appliesTo(toolNames, pathPatterns []string, tr TaskResult) bool {
+	if len(toolNames) == 0 && len(pathPatterns) == 0 {
+		return true
+	}
+	for _, used := range tr.ToolsUsed {
+		for _, target := range toolNames {
+			if used == target {
+				return true
+			}
+		}
+	}
+	for _, path := range tr.FilesWritten {
+		for _, pattern := range pathPatterns {
+			if matchPath(pattern, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPath matches a glob against the whole path, or against the base name
+// when the pattern has no separator, so "*.go" matches any Go file.
+func matchPath(pattern, path string) bool {
+	if ok, _ := filepath.Match(pattern, path); ok {
+		return true
+	}
+	if !strings.ContainsRune(pattern, filepath.Separator) {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}
+	return false
+}
+
+func tail(s string) string {
+	if len(s) <= maxReasonOutput {
+		return s
 	}
+	return "..." + s[len(s)-maxReasonOutput:]
 }
@@ -2,6 +2,7 @@ package verification
 
 import (
 	"context"
+	"regexp"
 	"testing"
 )
 
@@ -55,3 +56,45 @@ func TestCommandOutputGate_Failed(t *testing.T) {
 		t.Errorf("status = %v, want Failed", result.Status)
 	}
 }
+
+func TestCommandOutputGate_ExitCodeAndPattern(t *testing.T) {
+	two := 2
+	tests := []struct {
+		name   string
+		gate   CommandOutputGate
+		runner *stubCommandRunner
+		want   Status
+	}{
+		{"nonzero exit fails by default", CommandOutputGate{}, &stubCommandRunner{err: &ExitError{Code: 1, Output: "FAIL"}}, Failed},
+		{"expected exit code", CommandOutputGate{ExpectedExitCode: &two}, &stubCommandRunner{err: &ExitError{Code: 2}}, Confirmed},
+		{"unexpected success", CommandOutputGate{ExpectedExitCode: &two}, &stubCommandRunner{output: "ok"}, Failed},
+		{"pattern matches", CommandOutputGate{ExpectedPattern: regexp.MustCompile(`^ok\s+\S+`)}, &stubCommandRunner{output: "ok  pkg/store 0.1s"}, Confirmed},
+		{"pattern does not match", CommandOutputGate{ExpectedPattern: regexp.MustCompile(`^ok`)}, &stubCommandRunner{output: "FAIL pkg/store"}, Failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.gate
+			g.VerifyCommand = "go test ./..."
+			g.Runner = tt.runner
+			if got := g.Verify(context.Background(), TaskResult{}); got.Status != tt.want {
+				t.Errorf("status = %v, want %v (%s)", got.Status, tt.want, got.Reason)
+			}
+		})
+	}
+}
+
+func TestCommandOutputGate_AppliesToWrittenPaths(t *testing.T) {
+	g := &CommandOutputGate{PathPatterns: []string{"*.sql", "/srv/app/migrations/*"}}
+	if !g.AppliesTo(TaskResult{FilesWritten: []string{"/tmp/x/001_init.sql"}}) {
+		t.Error("should apply to a written .sql file")
+	}
+	if !g.AppliesTo(TaskResult{FilesWritten: []string{"/srv/app/migrations/002"}}) {
+		t.Error("should apply to a file under migrations")
+	}
+	if g.AppliesTo(TaskResult{FilesWritten: []string{"/srv/app/main.go"}, ToolsUsed: []string{"shell"}}) {
+		t.Error("should not apply to unrelated files")
+	}
+	if !(&CommandOutputGate{}).AppliesTo(TaskResult{}) {
+		t.Error("a gate without triggers should always apply")
+	}
+}
@@ -0,0 +1,114 @@
+package verification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileCheck expects a file to exist. Path may be a glob, in which case at
+// least one file must match. SHA256, when set, must match the file's hex
+// digest and is only checked for paths without wildcards.
+type FileCheck struct {
+	Path   string
+	SHA256 string
+}
+
+// FileGate checks that files exist with the expected content. With
+// CheckWritten set it also requires every file the agent reported writing to
+// still exist. Relative paths are resolved against Root.
+type FileGate struct {
+	GateName     string
+	ToolNames    []string
+	PathPatterns []string
+	Root         string
+	Files        []FileCheck
+	CheckWritten bool
+}
+
+func (g *FileGate) Name() string {
+	if g.GateName != "" {
+		return g.GateName
+	}
+	return "file_check"
+}
+
+func (g *FileGate) AppliesTo(tr TaskResult) bool {
+	return appliesTo(g.ToolNames, g.PathPatterns, tr)
+}
+
+func (g *FileGate) Verify(_ context.Context, tr TaskResult) Result {
+	var problems []string
+	checked := 0
+	for _, fc := range g.Files {
+		path := g.resolve(fc.Path)
+		if strings.ContainsAny(fc.Path, "*?[") {
+			matches, err := filepath.Glob(path)
+			if err != nil || len(matches) == 0 {
+				problems = append(problems, fmt.Sprintf("no file matches %s", fc.Path))
+			}
+			checked += len(matches)
+			continue
+		}
+		checked++
+		if err := checkFile(path, fc.SHA256); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if g.CheckWritten {
+		for _, path := range tr.FilesWritten {
+			checked++
+			if err := checkFile(g.resolve(path), ""); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return Result{
+			Status:     Failed,
+			Reason:     fmt.Sprintf("%s: %s", g.Name(), strings.Join(problems, "; ")),
+			Suggestion: "Create or fix the missing files",
+		}
+	}
+	return Result{Status: Confirmed, Evidence: fmt.Sprintf("%d files present", checked)}
+}
+
+func (g *FileGate) resolve(path string) string {
+	if filepath.IsAbs(path) || g.Root == "" {
+		return path
+	}
+	return filepath.Join(g.Root, path)
+}
+
+func checkFile(path, wantSHA256 string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s does not exist", path)
+		}
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return err
+	} else if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if wantSHA256 == "" {
+		return nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, wantSHA256) {
+		return fmt.Errorf("%s has sha256 %s, want %s", path, got, wantSHA256)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package verification
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileGate(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "migrations"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "migrations", "003_add.sql"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const helloSHA = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	tests := []struct {
+		name string
+		gate FileGate
+		tr   TaskResult
+		want Status
+	}{
+		{"glob matches", FileGate{Files: []FileCheck{{Path: "migrations/*.sql"}}}, TaskResult{}, Confirmed},
+		{"glob matches nothing", FileGate{Files: []FileCheck{{Path: "migrations/*.go"}}}, TaskResult{}, Failed},
+		{"checksum matches", FileGate{Files: []FileCheck{{Path: "migrations/003_add.sql", SHA256: helloSHA}}}, TaskResult{}, Confirmed},
+		{"checksum differs", FileGate{Files: []FileCheck{{Path: "migrations/003_add.sql", SHA256: "00"}}}, TaskResult{}, Failed},
+		{"written file exists", FileGate{CheckWritten: true}, TaskResult{FilesWritten: []string{filepath.Join(root, "migrations", "003_add.sql")}}, Confirmed},
+		{"written file removed", FileGate{CheckWritten: true}, TaskResult{FilesWritten: []string{filepath.Join(root, "gone.txt")}}, Failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.gate
+			g.Root = root
+			if got := g.Verify(context.Background(), tt.tr); got.Status != tt.want {
+				t.Errorf("status = %v, want %v (%s)", got.Status, tt.want, got.Reason)
+			}
+		})
+	}
+}
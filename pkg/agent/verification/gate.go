@@ -2,7 +2,11 @@
 // whether a completed task actually succeeded.
 package verification
 
-import "context"
+import (
+	"context"
+
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+)
 
 // Status represents the outcome of a verification gate.
 type Status int
@@ -13,6 +17,18 @@ const (
 	Uncertain
 )
 
+func (s Status) String() string {
+	switch s {
+	case Confirmed:
+		return "confirmed"
+	case Failed:
+		return "failed"
+	case Uncertain:
+		return "uncertain"
+	}
+	return "unknown"
+}
+
 // Result is what a verification gate returns.
 type Result struct {
 	Status     Status
@@ -71,6 +87,7 @@ func (r *Runner) Run(ctx context.Context, tr TaskResult) Result {
 
 	for _, g := range applicable {
 		result := g.Verify(ctx, tr)
+		telemetry.Metrics.VerificationGates.WithLabelValues(g.Name(), result.Status.String()).Inc()
 		switch result.Status {
 		case Failed:
 			return result
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/redact"
 	"gorm.io/gorm"
 )
 
@@ -24,6 +25,9 @@ const (
 	EventNotifySchedule = "notify_schedule"
 	EventNotifyDeliver  = "notify_deliver"
 	EventNotifySend     = "notify_send"
+	EventFileSend       = "file_send"
+	EventAccessDeny     = "access_deny"
+	EventApprovalAnswer = "approval_answer"
 	EventMCPConnect     = "mcp_connect"
 	EventMCPDisconnect  = "mcp_disconnect"
 	EventA2ATaskNew     = "a2a_task_new"
@@ -36,15 +40,19 @@ const (
 	EventSpawnStart     = "spawn_start"
 	EventSpawnDeliver   = "spawn_deliver"
 	EventSpawnError     = "spawn_error"
+	EventSpawnCancel    = "spawn_cancel"
 	EventBrowserNav     = "browser_nav"
 	EventBrowserClose   = "browser_close"
+	EventRedaction      = "redaction"
+	EventRetention      = "retention"
+	EventBackup         = "backup"
 )
 
 type Entry struct {
 	ID        string    `gorm:"primaryKey;column:id"`
 	Timestamp time.Time `gorm:"column:timestamp;not null;index:idx_audit_timestamp"`
 	EventType string    `gorm:"column:event_type;not null"`
-	SessionID string    `gorm:"column:session_id;not null;default:''"`
+	SessionID string    `gorm:"column:session_id;not null;default:'';index:idx_audit_session"`
 	AgentID   string    `gorm:"column:agent_id;not null;default:''"`
 	Actor     string    `gorm:"column:actor;not null;default:''"`
 	Detail    string    `gorm:"column:detail;not null;default:''"`
@@ -55,17 +63,22 @@ func (Entry) TableName() string {
 }
 
 type Logger struct {
-	db *gorm.DB
+	db       *gorm.DB
+	redactor *redact.Redactor
 }
 
+// New returns a logger writing to db. The audit_log table is created by the
+// store migrations.
 func New(db *gorm.DB) (*Logger, error) {
-	if err := db.AutoMigrate(&Entry{}); err != nil {
-		return nil, fmt.Errorf("audit: running migrations: %w", err)
-	}
-
 	return &Logger{db: db}, nil
 }
 
+// SetRedactor masks personal data in details before they are stored. Details
+// carry tool output and the prompts of notifications and spawns.
+func (l *Logger) SetRedactor(r *redact.Redactor) {
+	l.redactor = r
+}
+
 func (l *Logger) Log(ctx context.Context, eventType, sessionID, agentID, actor string, detail any) error {
 	var detailStr string
 	switch v := detail.(type) {
@@ -80,6 +93,8 @@ func (l *Logger) Log(ctx context.Context, eventType, sessionID, agentID, actor s
 		}
 	}
 
+	detailStr, _ = l.redactor.String(detailStr)
+
 	entry := &Entry{
 		ID:        uuid.NewString(),
 		Timestamp: time.Now().UTC(),
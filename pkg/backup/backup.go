@@ -0,0 +1,490 @@
+// Package backup writes, verifies and restores archives of the Pincer data
+// directory. The database is copied with SQLite's VACUUM INTO, so backups are
+// consistent while the gateway is running, and every archive carries a
+// manifest with per-file checksums and the schema version.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+const (
+	// ManifestName is the archive entry holding the manifest. It sits
+	// outside the data root and is not restored.
+	ManifestName = "manifest.json"
+
+	dataRoot      = "pincer-data"
+	formatVersion = 1
+)
+
+// maxFileSize caps every file in an archive, both when writing and when
+// reading one back.
+var maxFileSize int64 = 512 * 1024 * 1024
+
+var (
+	// ErrEncrypted is returned when reading an encrypted archive without an
+	// identity.
+	ErrEncrypted = errors.New("backup is encrypted")
+	// ErrChecksum is returned when archive contents do not match the
+	// manifest.
+	ErrChecksum = errors.New("backup checksum mismatch")
+	// ErrFileTooLarge is returned for files over the per-file size limit.
+	ErrFileTooLarge = errors.New("file exceeds the backup size limit")
+)
+
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	FormatVersion int         `json:"format_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	PincerVersion string      `json:"pincer_version,omitempty"`
+	Driver        string      `json:"driver"`
+	SchemaVersion int         `json:"schema_version"`
+	Files         []FileEntry `json:"files"`
+}
+
+// Options controls what Write puts in an archive.
+type Options struct {
+	DataDir string
+	// Store is snapshotted into the archive when it uses SQLite. DBPath is
+	// its file, which is skipped during the directory walk.
+	Store  *store.Store
+	DBPath string
+	// Exclude lists paths under DataDir to leave out, such as the
+	// directory scheduled backups are written to.
+	Exclude []string
+	// Recipients encrypt the archive with age when set.
+	Recipients    []age.Recipient
+	PincerVersion string
+}
+
+// Write streams a gzipped tar of the data directory to w.
+func Write(ctx context.Context, w io.Writer, opts Options) (*Manifest, error) {
+	m := &Manifest{
+		FormatVersion: formatVersion,
+		CreatedAt:     time.Now().UTC(),
+		PincerVersion: opts.PincerVersion,
+	}
+
+	var snapshot string
+	if opts.Store != nil {
+		m.Driver = opts.Store.Driver()
+		v, err := opts.Store.SchemaVersion(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading schema version: %w", err)
+		}
+		m.SchemaVersion = v
+
+		if opts.Store.Driver() == store.DriverSQLite {
+			tmpDir, err := os.MkdirTemp("", "pincer-backup-")
+			if err != nil {
+				return nil, err
+			}
+			defer os.RemoveAll(tmpDir)
+			snapshot = filepath.Join(tmpDir, "pincer.db")
+			if err := opts.Store.Snapshot(ctx, snapshot); err != nil {
+				return nil, fmt.Errorf("snapshotting database: %w", err)
+			}
+		}
+	}
+
+	out := w
+	var encrypter io.WriteCloser
+	if len(opts.Recipients) > 0 {
+		var err error
+		encrypter, err = age.Encrypt(w, opts.Recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("initializing encryption: %w", err)
+		}
+		out = encrypter
+	}
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+
+	skip := map[string]bool{}
+	for _, p := range opts.Exclude {
+		skip[filepath.Clean(p)] = true
+	}
+	dbName := "pincer.db"
+	if opts.DBPath != "" {
+		db := filepath.Clean(opts.DBPath)
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			skip[db+suffix] = true
+		}
+		if rel, err := filepath.Rel(opts.DataDir, db); err == nil && !strings.HasPrefix(rel, "..") {
+			dbName = filepath.ToSlash(rel)
+		}
+	}
+
+	err := filepath.Walk(opts.DataDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skip[filepath.Clean(p)] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(opts.DataDir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(dataRoot, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = name + "/"
+			return tw.WriteHeader(header)
+		case info.Mode().IsRegular():
+			entry, err := addFile(tw, p, name)
+			if err != nil {
+				return err
+			}
+			m.Files = append(m.Files, entry)
+		}
+		// Symlinks, sockets and other special files are not backed up.
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("archiving %s: %w", opts.DataDir, err)
+	}
+
+	if snapshot != "" {
+		entry, err := addFile(tw, snapshot, path.Join(dataRoot, dbName))
+		if err != nil {
+			return nil, fmt.Errorf("archiving database: %w", err)
+		}
+		m.Files = append(m.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	header := &tar.Header{Name: ManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: m.CreatedAt, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return nil, fmt.Errorf("finishing encryption: %w", err)
+		}
+	}
+	return m, nil
+}
+
+func addFile(tw *tar.Writer, src, name string) (FileEntry, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if info.Size() > maxFileSize {
+		return FileEntry{}, fmt.Errorf("%s: %w (%d bytes, limit %d)", src, ErrFileTooLarge, info.Size(), maxFileSize)
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return FileEntry{}, err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return FileEntry{}, err
+	}
+
+	h := sha256.New()
+	// Copy exactly the size recorded in the header, in case the file grows
+	// while it is read.
+	n, err := io.Copy(io.MultiWriter(tw, h), io.LimitReader(f, info.Size()))
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if n != info.Size() {
+		return FileEntry{}, fmt.Errorf("%s shrank while being archived", src)
+	}
+	return FileEntry{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// copyEntry copies an archive entry, failing instead of truncating it when it
+// is over maxFileSize.
+func copyEntry(dst io.Writer, r io.Reader) (int64, error) {
+	n, err := io.Copy(dst, io.LimitReader(r, maxFileSize+1))
+	if err == nil && n > maxFileSize {
+		err = ErrFileTooLarge
+	}
+	return n, err
+}
+
+// Decrypt returns a reader over the plain archive. Unencrypted archives are
+// passed through; encrypted ones need one of identities.
+func Decrypt(r io.Reader, identities []age.Identity) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	peek, _ := br.Peek(len(armor.Header))
+	switch {
+	case bytes.HasPrefix(peek, []byte("age-encryption.org/")):
+	case bytes.Equal(peek, []byte(armor.Header)):
+		r = armor.NewReader(br)
+		br = bufio.NewReader(r)
+	default:
+		return br, nil
+	}
+	if len(identities) == 0 {
+		return nil, ErrEncrypted
+	}
+	plain, err := age.Decrypt(br, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting backup: %w", err)
+	}
+	return plain, nil
+}
+
+// IsEncrypted reports whether the archive at path is age-encrypted.
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = Decrypt(f, nil)
+	if errors.Is(err, ErrEncrypted) {
+		return true, nil
+	}
+	return false, err
+}
+
+// walkArchive calls fn for every entry of the archive at path.
+func walkArchive(path string, identities []age.Identity, fn func(h *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening backup: %w", err)
+	}
+	defer f.Close()
+
+	plain, err := Decrypt(f, identities)
+	if err != nil {
+		return err
+	}
+	gr, err := gzip.NewReader(plain)
+	if err != nil {
+		return fmt.Errorf("reading gzip: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %w", err)
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Report describes an archive checked by Inspect.
+type Report struct {
+	// Manifest is nil for archives written before manifests existed.
+	Manifest      *Manifest
+	SchemaVersion int
+	Files         int
+}
+
+// Inspect reads the whole archive, verifies every file against the manifest
+// and checks that this binary understands the database schema inside it.
+func Inspect(ctx context.Context, archive string, identities []age.Identity) (*Report, error) {
+	tmpDir, err := os.MkdirTemp("", "pincer-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	report := &Report{}
+	sums := map[string]FileEntry{}
+	dbPath := ""
+	err = walkArchive(archive, identities, func(h *tar.Header, r io.Reader) error {
+		if h.Typeflag != tar.TypeReg {
+			return nil
+		}
+		if h.Name == ManifestName {
+			report.Manifest = &Manifest{}
+			if err := json.NewDecoder(r).Decode(report.Manifest); err != nil {
+				return fmt.Errorf("reading manifest: %w", err)
+			}
+			return nil
+		}
+		report.Files++
+
+		var dst io.Writer = io.Discard
+		base := path.Base(h.Name)
+		if base == "pincer.db" || base == "pincer.db-wal" {
+			out, err := os.Create(filepath.Join(tmpDir, base))
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			dst = out
+			if base == "pincer.db" {
+				dbPath = out.Name()
+			}
+		}
+
+		hash := sha256.New()
+		n, err := copyEntry(io.MultiWriter(dst, hash), r)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", h.Name, err)
+		}
+		sums[h.Name] = FileEntry{Path: h.Name, Size: n, SHA256: hex.EncodeToString(hash.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if m := report.Manifest; m != nil {
+		if m.FormatVersion > formatVersion {
+			return nil, fmt.Errorf("backup format %d is newer than this version of pincer supports", m.FormatVersion)
+		}
+		for _, want := range m.Files {
+			got, ok := sums[want.Path]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s is missing", ErrChecksum, want.Path)
+			}
+			if got != want {
+				return nil, fmt.Errorf("%w: %s", ErrChecksum, want.Path)
+			}
+			delete(sums, want.Path)
+		}
+		for name := range sums {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrChecksum, name)
+		}
+		report.SchemaVersion = m.SchemaVersion
+	}
+
+	if dbPath != "" {
+		db, err := store.Open(store.Options{Driver: store.DriverSQLite, DSN: dbPath, SkipMigrations: true})
+		if err != nil {
+			return nil, fmt.Errorf("opening backup database: %w", err)
+		}
+		defer db.Close()
+		if err := db.CheckSchema(ctx); err != nil {
+			return nil, fmt.Errorf("backup cannot be restored: %w", err)
+		}
+		if report.SchemaVersion, err = db.SchemaVersion(ctx); err != nil {
+			return nil, err
+		}
+	} else if report.SchemaVersion > store.LatestSchemaVersion() {
+		return nil, fmt.Errorf("backup cannot be restored: %w (backup at %d, pincer supports %d)",
+			store.ErrSchemaTooNew, report.SchemaVersion, store.LatestSchemaVersion())
+	}
+	return report, nil
+}
+
+// Restore extracts the archive into dataDir and returns the number of files
+// written. Run Inspect first; Restore does not verify checksums.
+func Restore(archive string, identities []age.Identity, dataDir string) (int, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return 0, fmt.Errorf("creating data directory: %w", err)
+	}
+	base := filepath.Clean(dataDir)
+
+	count := 0
+	err := walkArchive(archive, identities, func(h *tar.Header, r io.Reader) error {
+		rel, ok := strings.CutPrefix(h.Name, dataRoot+"/")
+		if !ok {
+			// Older archives used any top-level directory name.
+			if _, after, found := strings.Cut(h.Name, "/"); found && h.Name != ManifestName {
+				rel = after
+			} else {
+				return nil
+			}
+		}
+		if rel == "" || rel == "." {
+			return nil
+		}
+
+		target := filepath.Join(base, filepath.Clean(rel))
+		if !strings.HasPrefix(target, base+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in backup: %s", h.Name)
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return fmt.Errorf("creating directory %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode&0o777))
+			if err != nil {
+				return fmt.Errorf("creating file %s: %w", target, err)
+			}
+			if _, err := copyEntry(out, r); err != nil {
+				out.Close()
+				return fmt.Errorf("writing file %s: %w", target, err)
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+			// A write-ahead log left over from the replaced database would
+			// be replayed on top of the restored one.
+			if strings.HasSuffix(target, ".db") {
+				_ = os.Remove(target + "-wal")
+				_ = os.Remove(target + "-shm")
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+// fixture returns a data directory holding a live database with one session,
+// an uncheckpointed WAL and a config file.
+func fixture(t *testing.T) (string, *store.Store) {
+	t.Helper()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "pincer.db")
+	s, err := store.New(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if _, _, err := s.GetOrCreateSession(context.Background(), "s1", "a", "c", "p"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pincer.toml"), []byte("[gateway]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, s
+}
+
+func writeArchive(t *testing.T, opts Options) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := Write(context.Background(), f, opts); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return path
+}
+
+func TestWriteInspectRestore(t *testing.T) {
+	dataDir, s := fixture(t)
+	archive := writeArchive(t, Options{DataDir: dataDir, Store: s, DBPath: filepath.Join(dataDir, "pincer.db"), PincerVersion: "test"})
+
+	report, err := Inspect(context.Background(), archive, nil)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if report.Manifest == nil || report.Manifest.PincerVersion != "test" {
+		t.Fatalf("manifest = %+v", report.Manifest)
+	}
+	if report.SchemaVersion != store.LatestSchemaVersion() {
+		t.Errorf("SchemaVersion = %d", report.SchemaVersion)
+	}
+	if report.Files != 2 {
+		t.Errorf("Files = %d, want 2", report.Files)
+	}
+
+	restoreDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(restoreDir, "pincer.db-wal"), []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := Restore(archive, nil, restoreDir)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("restored %d files, want 2", n)
+	}
+	if _, err := os.Stat(filepath.Join(restoreDir, "pincer.db-wal")); !os.IsNotExist(err) {
+		t.Error("stale WAL was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(restoreDir, ManifestName)); !os.IsNotExist(err) {
+		t.Error("manifest was restored into the data directory")
+	}
+
+	restored, err := store.New(filepath.Join(restoreDir, "pincer.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if _, err := restored.GetSession(context.Background(), "s1"); err != nil {
+		t.Errorf("restored database is missing data: %v", err)
+	}
+}
+
+func TestFileSizeLimit(t *testing.T) {
+	dataDir, s := fixture(t)
+	opts := Options{DataDir: dataDir, Store: s, DBPath: filepath.Join(dataDir, "pincer.db")}
+	archive := writeArchive(t, opts)
+
+	limit := maxFileSize
+	maxFileSize = 8
+	t.Cleanup(func() { maxFileSize = limit })
+
+	if _, err := Write(context.Background(), io.Discard, opts); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Write err = %v, want ErrFileTooLarge", err)
+	}
+	if _, err := Inspect(context.Background(), archive, nil); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Inspect err = %v, want ErrFileTooLarge", err)
+	}
+	if _, err := Restore(archive, nil, t.TempDir()); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Restore err = %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestEncryptedArchive(t *testing.T) {
+	dataDir, s := fixture(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := writeArchive(t, Options{DataDir: dataDir, Store: s, DBPath: filepath.Join(dataDir, "pincer.db"), Recipients: []age.Recipient{identity.Recipient()}})
+
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("pincer-data")) {
+		t.Error("archive contents are readable without the key")
+	}
+	if enc, err := IsEncrypted(archive); err != nil || !enc {
+		t.Errorf("IsEncrypted = %v, %v", enc, err)
+	}
+
+	if _, err := Inspect(context.Background(), archive, nil); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Inspect without identity: err = %v, want ErrEncrypted", err)
+	}
+	other, _ := age.GenerateX25519Identity()
+	if _, err := Inspect(context.Background(), archive, []age.Identity{other}); err == nil {
+		t.Error("Inspect with the wrong identity succeeded")
+	}
+	if _, err := Inspect(context.Background(), archive, []age.Identity{identity}); err != nil {
+		t.Errorf("Inspect: %v", err)
+	}
+}
+
+func TestInspectDetectsTampering(t *testing.T) {
+	dataDir, s := fixture(t)
+	archive := writeArchive(t, Options{DataDir: dataDir, Store: s, DBPath: filepath.Join(dataDir, "pincer.db")})
+
+	// Re-pack the archive with a modified config file but the original
+	// manifest.
+	src, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name == "pincer-data/pincer.toml" {
+			data = []byte("[gateway]\nport = 1\n")
+			h.Size = int64(len(data))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+
+	path := filepath.Join(t.TempDir(), "tampered.tar.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inspect(context.Background(), path, nil); !errors.Is(err, ErrChecksum) {
+		t.Errorf("err = %v, want ErrChecksum", err)
+	}
+}
+
+func TestInspectRefusesNewerSchema(t *testing.T) {
+	dataDir, s := fixture(t)
+	if err := s.DB().Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'future', ?)",
+		store.LatestSchemaVersion()+1, time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	archive := writeArchive(t, Options{DataDir: dataDir, Store: s, DBPath: filepath.Join(dataDir, "pincer.db")})
+	if _, err := Inspect(context.Background(), archive, nil); !errors.Is(err, store.ErrSchemaTooNew) {
+		t.Errorf("err = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestManagerRotates(t *testing.T) {
+	dataDir, s := fixture(t)
+	backupDir := filepath.Join(dataDir, "backups")
+	m := &Manager{Options: Options{DataDir: dataDir, Store: s, DBPath: filepath.Join(dataDir, "pincer.db")}, Dir: backupDir, Keep: 2}
+
+	for i := range 3 {
+		name := FileName(time.Date(2025, 1, 1, 0, 0, i, 0, time.UTC), false)
+		if err := os.MkdirAll(backupDir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(backupDir, name), []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := m.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, f := range info.Manifest.Files {
+		if filepath.Dir(f.Path) == "pincer-data/backups" {
+			t.Errorf("backup directory was archived: %s", f.Path)
+		}
+	}
+
+	list, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("kept %d backups, want 2", len(list))
+	}
+	if list[0].Name != info.Name {
+		t.Errorf("newest backup = %s, want %s", list[0].Name, info.Name)
+	}
+}
@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const filePrefix = "pincer-backup-"
+
+// Info describes a backup file in the manager's directory.
+type Info struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Encrypted bool      `json:"encrypted"`
+	Manifest  *Manifest `json:"manifest,omitempty"`
+}
+
+// Manager writes backups into Dir and keeps the newest Keep of them. It is
+// used by the scheduler and the admin API.
+type Manager struct {
+	Options Options
+	Dir     string
+	// Keep is how many backups to retain; zero keeps all of them.
+	Keep int
+
+	mu sync.Mutex
+}
+
+// FileName returns the conventional name for a backup taken at t.
+func FileName(t time.Time, encrypted bool) string {
+	name := filePrefix + t.Format("20060102-150405") + ".tar.gz"
+	if encrypted {
+		name += ".age"
+	}
+	return name
+}
+
+// Run writes a new backup and prunes old ones.
+func (m *Manager) Run(ctx context.Context) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return Info{}, fmt.Errorf("creating backup directory: %w", err)
+	}
+
+	opts := m.Options
+	opts.Exclude = append(append([]string{}, opts.Exclude...), m.Dir)
+
+	now := time.Now()
+	encrypted := len(opts.Recipients) > 0
+	final := filepath.Join(m.Dir, FileName(now, encrypted))
+	tmp, err := os.CreateTemp(m.Dir, ".partial-*")
+	if err != nil {
+		return Info{}, fmt.Errorf("creating backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := Write(ctx, tmp, opts)
+	if err != nil {
+		tmp.Close()
+		return Info{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return Info{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp.Name(), final); err != nil {
+		return Info{}, fmt.Errorf("finalizing backup: %w", err)
+	}
+
+	info, err := os.Stat(final)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := m.prune(); err != nil {
+		return Info{}, fmt.Errorf("rotating backups: %w", err)
+	}
+	return Info{
+		Name:      filepath.Base(final),
+		Path:      final,
+		Size:      info.Size(),
+		CreatedAt: manifest.CreatedAt,
+		Encrypted: encrypted,
+		Manifest:  manifest,
+	}, nil
+}
+
+// List returns the backups in Dir, newest first.
+func (m *Manager) List() ([]Info, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var out []Info
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, filePrefix) {
+			continue
+		}
+		if !strings.HasSuffix(name, ".tar.gz") && !strings.HasSuffix(name, ".tar.gz.age") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, Info{
+			Name:      name,
+			Path:      filepath.Join(m.Dir, name),
+			Size:      fi.Size(),
+			CreatedAt: fi.ModTime().UTC(),
+			Encrypted: strings.HasSuffix(name, ".age"),
+		})
+	}
+	// Names embed the timestamp, so they sort chronologically.
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out, nil
+}
+
+func (m *Manager) prune() error {
+	if m.Keep <= 0 {
+		return nil
+	}
+	backups, err := m.List()
+	if err != nil {
+		return err
+	}
+	for i := m.Keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const DefaultMaxAttachmentBytes int64 = 20 << 20
+
+var ErrAttachmentTooLarge = errors.New("attachment exceeds size limit")
+
+type Attachment struct {
+	Filename  string
+	MediaType string
+	Data      []byte
+}
+
+// IsImage reports whether the attachment can be forwarded to the model as
+// image content. Other media types are treated as documents.
+func (a Attachment) IsImage() bool {
+	switch a.MediaType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+type AttachmentLimiter interface {
+	SetMaxAttachmentBytes(n int64)
+}
+
+func CheckAttachmentSize(size, maxBytes int64) error {
+	if maxBytes > 0 && size > maxBytes {
+		return fmt.Errorf("%w: %d > %d bytes", ErrAttachmentTooLarge, size, maxBytes)
+	}
+	return nil
+}
+
+func DownloadAttachment(ctx context.Context, client *http.Client, url string, header http.Header, maxBytes int64) ([]byte, string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating request: %w", err)
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("downloading attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("downloading attachment: status %d", resp.StatusCode)
+	}
+	if err := CheckAttachmentSize(resp.ContentLength, maxBytes); err != nil {
+		return nil, "", err
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading attachment: %w", err)
+	}
+	if err := CheckAttachmentSize(int64(len(data)), maxBytes); err != nil {
+		return nil, "", err
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return data, strings.TrimSpace(mediaType), nil
+}
+
+// DetectMediaType returns declared with any parameters stripped, falling
+// back to sniffing data when the sender did not provide a type.
+func DetectMediaType(declared string, data []byte) string {
+	if i := strings.Index(declared, ";"); i >= 0 {
+		declared = declared[:i]
+	}
+	declared = strings.TrimSpace(declared)
+	if declared != "" && declared != "application/octet-stream" {
+		return declared
+	}
+	mt := http.DetectContentType(data)
+	if i := strings.Index(mt, ";"); i >= 0 {
+		mt = mt[:i]
+	}
+	return mt
+}
@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadAttachment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png; charset=binary")
+		_, _ = w.Write([]byte("png-bytes"))
+	}))
+	defer srv.Close()
+
+	header := http.Header{"Authorization": []string{"Bearer tok"}}
+	data, mediaType, err := DownloadAttachment(context.Background(), nil, srv.URL, header, 1024)
+	if err != nil {
+		t.Fatalf("DownloadAttachment: %v", err)
+	}
+	if string(data) != "png-bytes" {
+		t.Errorf("data = %q, want %q", data, "png-bytes")
+	}
+	if mediaType != "image/png" {
+		t.Errorf("mediaType = %q, want %q", mediaType, "image/png")
+	}
+
+	if _, _, err := DownloadAttachment(context.Background(), nil, srv.URL, nil, 1024); err == nil {
+		t.Error("expected error for unauthorized download")
+	}
+}
+
+func TestDownloadAttachment_TooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Transfer-Encoding", "chunked")
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	_, _, err := DownloadAttachment(context.Background(), nil, srv.URL, nil, 10)
+	if !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("err = %v, want ErrAttachmentTooLarge", err)
+	}
+}
+
+func TestDetectMediaType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	tests := []struct {
+		declared string
+		data     []byte
+		want     string
+	}{
+		{"application/pdf", nil, "application/pdf"},
+		{"image/jpeg; q=1", nil, "image/jpeg"},
+		{"", png, "image/png"},
+		{"application/octet-stream", png, "image/png"},
+	}
+	for _, tt := range tests {
+		if got := DetectMediaType(tt.declared, tt.data); got != tt.want {
+			t.Errorf("DetectMediaType(%q) = %q, want %q", tt.declared, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentIsImage(t *testing.T) {
+	if !(Attachment{MediaType: "image/webp"}).IsImage() {
+		t.Error("image/webp should be an image")
+	}
+	if (Attachment{MediaType: "image/heic"}).IsImage() {
+		t.Error("image/heic is not supported by providers and should be a document")
+	}
+	if (Attachment{MediaType: "application/pdf"}).IsImage() {
+		t.Error("application/pdf should not be an image")
+	}
+}
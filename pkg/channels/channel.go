@@ -1,18 +1,39 @@
 package channels
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type InboundMessage struct {
 	ChannelName      string
 	SessionID        string
+	ChatID           string
 	PeerID           string
 	Content          string
+	Attachments      []Attachment
 	ApprovalResponse *InboundApprovalResponse
+
+	// IsGroup is set for chats with more than one human participant.
+	// Mentioned is set when the bot was mentioned or replied to.
+	IsGroup    bool
+	Mentioned  bool
+	SenderName string
 }
 
 type OutboundMessage struct {
-	SessionID string
-	Content   string
+	SessionID   string
+	Content     string
+	Attachments []Attachment
+}
+
+// TextChunks splits Content into pieces of at most maxLen bytes. A message
+// that only carries attachments yields no chunks.
+func (m OutboundMessage) TextChunks(maxLen int) []string {
+	if m.Content == "" && len(m.Attachments) > 0 {
+		return nil
+	}
+	return SplitMessage(m.Content, maxLen)
 }
 
 type ChannelCaps struct {
@@ -20,6 +41,11 @@ type ChannelCaps struct {
 	SupportsMedia     bool
 	SupportsReactions bool
 	SupportsEditing   bool
+
+	// MaxMessageLength is the longest text a single message may carry.
+	// EditInterval is the minimum delay between edits of one message.
+	MaxMessageLength int
+	EditInterval     time.Duration
 }
 
 type ApprovalRequest struct {
@@ -42,6 +68,13 @@ type TypingIndicator interface {
 	SendTyping(ctx context.Context, sessionID string) error
 }
 
+// MessageEditor is implemented by adapters that can update a message after
+// sending it, which the router uses to stream responses as they are produced.
+type MessageEditor interface {
+	SendEditable(ctx context.Context, sessionID, content string) (messageID string, err error)
+	EditMessage(ctx context.Context, sessionID, messageID, content string) error
+}
+
 type ToolPhase int
 
 const (
@@ -57,6 +90,12 @@ type ToolProgress struct {
 	Message  string
 }
 
+// Verifier is implemented by adapters that can check their credentials
+// without starting. Verify returns the account the credentials belong to.
+type Verifier interface {
+	Verify(ctx context.Context) (string, error)
+}
+
 type ProgressRenderer interface {
 	SendProgress(ctx context.Context, sessionID string, progress ToolProgress) error
 }
@@ -1,11 +1,13 @@
 package discord
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/igorsilveira/pincer/pkg/channels"
@@ -13,11 +15,12 @@ import (
 )
 
 type Adapter struct {
-	token    string
-	session  *discordgo.Session
-	inbound  chan channels.InboundMessage
-	sessions *channels.SessionMap[string]
-	done     chan struct{}
+	token         string
+	session       *discordgo.Session
+	inbound       chan channels.InboundMessage
+	sessions      *channels.SessionMap[string]
+	done          chan struct{}
+	maxAttachment int64
 }
 
 func New(token string) (*Adapter, error) {
@@ -28,15 +31,28 @@ func New(token string) (*Adapter, error) {
 		return nil, fmt.Errorf("discord: bot token not set")
 	}
 	return &Adapter{
-		token:    token,
-		inbound:  make(chan channels.InboundMessage, 256),
-		sessions: channels.NewSessionMap[string]("dc", func(k string) string { return k }),
-		done:     make(chan struct{}),
+		token:         token,
+		inbound:       make(chan channels.InboundMessage, 256),
+		sessions:      channels.NewSessionMap[string]("dc", func(k string) string { return k }),
+		done:          make(chan struct{}),
+		maxAttachment: channels.DefaultMaxAttachmentBytes,
 	}, nil
 }
 
 func (a *Adapter) Name() string { return "discord" }
 
+func (a *Adapter) Verify(ctx context.Context) (string, error) {
+	dg, err := discordgo.New("Bot " + a.token)
+	if err != nil {
+		return "", fmt.Errorf("discord: creating session: %w", err)
+	}
+	u, err := dg.User("@me", discordgo.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("discord: %w", err)
+	}
+	return u.Username, nil
+}
+
 func (a *Adapter) Start(ctx context.Context) error {
 	logger := telemetry.FromContext(ctx)
 
@@ -82,12 +98,26 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 		return fmt.Errorf("discord: no channel for session %s", msg.SessionID)
 	}
 
-	chunks := channels.SplitMessage(msg.Content, 2000)
-	for _, chunk := range chunks {
+	for _, chunk := range msg.TextChunks(2000) {
 		if _, err := a.session.ChannelMessageSend(channelID, chunk); err != nil {
 			return fmt.Errorf("discord: sending message: %w", err)
 		}
 	}
+
+	if len(msg.Attachments) == 0 {
+		return nil
+	}
+	files := make([]*discordgo.File, 0, len(msg.Attachments))
+	for _, att := range msg.Attachments {
+		files = append(files, &discordgo.File{
+			Name:        att.Filename,
+			ContentType: att.MediaType,
+			Reader:      bytes.NewReader(att.Data),
+		})
+	}
+	if _, err := a.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Files: files}); err != nil {
+		return fmt.Errorf("discord: sending files: %w", err)
+	}
 	return nil
 }
 
@@ -97,12 +127,48 @@ func (a *Adapter) Receive() <-chan channels.InboundMessage {
 
 func (a *Adapter) Capabilities() channels.ChannelCaps {
 	return channels.ChannelCaps{
-		SupportsStreaming: false,
+		SupportsStreaming: true,
 		SupportsMedia:     true,
 		SupportsReactions: true,
+		SupportsEditing:   true,
+		MaxMessageLength:  2000,
+		EditInterval:      time.Second,
+	}
+}
+
+func (a *Adapter) SendEditable(ctx context.Context, sessionID, content string) (string, error) {
+	if a.session == nil {
+		return "", fmt.Errorf("discord: not connected")
+	}
+	channelID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return "", fmt.Errorf("discord: no channel for session %s", sessionID)
+	}
+	m, err := a.session.ChannelMessageSend(channelID, content)
+	if err != nil {
+		return "", fmt.Errorf("discord: sending message: %w", err)
+	}
+	return m.ID, nil
+}
+
+func (a *Adapter) EditMessage(ctx context.Context, sessionID, messageID, content string) error {
+	if a.session == nil {
+		return fmt.Errorf("discord: not connected")
 	}
+	channelID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return fmt.Errorf("discord: no channel for session %s", sessionID)
+	}
+	if _, err := a.session.ChannelMessageEdit(channelID, messageID, content); err != nil {
+		return fmt.Errorf("discord: editing message: %w", err)
+	}
+	return nil
 }
 
+func (a *Adapter) SetMaxAttachmentBytes(n int64) { a.maxAttachment = n }
+
+func (a *Adapter) SetGroupSessionMode(mode channels.GroupSessionMode) { a.sessions.SetGroupMode(mode) }
+
 func (a *Adapter) SendApprovalRequest(ctx context.Context, req channels.ApprovalRequest) error {
 	if a.session == nil {
 		return fmt.Errorf("discord: not connected")
@@ -201,22 +267,65 @@ func (a *Adapter) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate
 		return
 	}
 
-	if m.Content == "" {
+	attachments := a.downloadAttachments(m.Attachments)
+	if m.Content == "" && len(attachments) == 0 {
 		return
 	}
 
-	sessionID := a.sessions.GetOrCreate(m.ChannelID)
+	isGroup := m.GuildID != ""
+	sessionID := a.sessions.ForMessage(m.ChannelID, m.Author.ID, isGroup)
 
 	slog.Debug("discord message received",
 		slog.String("channel_id", m.ChannelID),
 		slog.String("author", m.Author.Username),
+		slog.Int("attachments", len(attachments)),
 	)
 
 	a.inbound <- channels.InboundMessage{
 		ChannelName: "discord",
 		SessionID:   sessionID,
+		ChatID:      m.ChannelID,
 		PeerID:      m.Author.ID,
 		Content:     m.Content,
+		Attachments: attachments,
+		IsGroup:     isGroup,
+		Mentioned:   mentionsBot(m.Message, s.State.User.ID),
+		SenderName:  m.Author.Username,
+	}
+}
+
+func mentionsBot(m *discordgo.Message, botID string) bool {
+	for _, u := range m.Mentions {
+		if u.ID == botID {
+			return true
+		}
 	}
+	ref := m.ReferencedMessage
+	return ref != nil && ref.Author != nil && ref.Author.ID == botID
 }
 
+func (a *Adapter) downloadAttachments(files []*discordgo.MessageAttachment) []channels.Attachment {
+	var attachments []channels.Attachment
+	for _, f := range files {
+		if err := channels.CheckAttachmentSize(int64(f.Size), a.maxAttachment); err != nil {
+			slog.Warn("discord attachment skipped", slog.String("file", f.Filename), slog.String("err", err.Error()))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		data, mediaType, err := channels.DownloadAttachment(ctx, nil, f.URL, nil, a.maxAttachment)
+		cancel()
+		if err != nil {
+			slog.Warn("discord attachment download failed", slog.String("file", f.Filename), slog.String("err", err.Error()))
+			continue
+		}
+		if f.ContentType != "" {
+			mediaType = f.ContentType
+		}
+		attachments = append(attachments, channels.Attachment{
+			Filename:  f.Filename,
+			MediaType: channels.DetectMediaType(mediaType, data),
+			Data:      data,
+		})
+	}
+	return attachments
+}
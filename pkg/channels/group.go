@@ -0,0 +1,63 @@
+package channels
+
+import "fmt"
+
+// GroupSessionMode controls how messages in a group chat map to sessions.
+type GroupSessionMode string
+
+const (
+	GroupSessionShared  GroupSessionMode = "shared"
+	GroupSessionPerUser GroupSessionMode = "per_user"
+)
+
+// GroupRespondMode controls when the agent answers in a group chat.
+type GroupRespondMode string
+
+const (
+	// GroupRespondMention answers only when the bot is mentioned or replied
+	// to. Other messages are kept as context.
+	GroupRespondMention GroupRespondMode = "mention"
+	GroupRespondAlways  GroupRespondMode = "always"
+	// GroupRespondPassive never answers and only records the conversation.
+	GroupRespondPassive GroupRespondMode = "passive"
+)
+
+// ShouldRespond reports whether msg should start an agent turn. Direct
+// messages are always answered.
+func (m GroupRespondMode) ShouldRespond(msg InboundMessage) bool {
+	if !msg.IsGroup {
+		return true
+	}
+	switch m {
+	case GroupRespondAlways:
+		return true
+	case GroupRespondPassive:
+		return false
+	default:
+		return msg.Mentioned
+	}
+}
+
+// GroupSessionSetter is implemented by adapters that can tell group chats
+// apart from direct messages.
+type GroupSessionSetter interface {
+	SetGroupSessionMode(mode GroupSessionMode)
+}
+
+// GroupRespondSetter is implemented by adapters that can skip work, such as
+// downloading media, for group messages the agent will not answer.
+type GroupRespondSetter interface {
+	SetGroupRespondMode(mode GroupRespondMode)
+}
+
+// Sender describes who wrote msg, for attributing group messages.
+func (m InboundMessage) Sender() string {
+	switch {
+	case m.SenderName == "":
+		return m.PeerID
+	case m.PeerID == "" || m.SenderName == m.PeerID:
+		return m.SenderName
+	default:
+		return fmt.Sprintf("%s (%s)", m.SenderName, m.PeerID)
+	}
+}
@@ -3,7 +3,10 @@ package matrix
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/igorsilveira/pincer/pkg/channels"
@@ -14,12 +17,16 @@ import (
 )
 
 type Adapter struct {
-	client     *mautrix.Client
-	homeserver string
-	userID     string
-	token      string
-	inbound    chan channels.InboundMessage
-	sessions   *channels.SessionMap[id.RoomID]
+	client        *mautrix.Client
+	homeserver    string
+	userID        string
+	token         string
+	inbound       chan channels.InboundMessage
+	sessions      *channels.SessionMap[id.RoomID]
+	maxAttachment int64
+
+	groupRoomsMu sync.Mutex
+	groupRooms   map[id.RoomID]bool
 }
 
 type Config struct {
@@ -44,16 +51,30 @@ func New(cfg Config) (*Adapter, error) {
 	}
 
 	return &Adapter{
-		homeserver: cfg.Homeserver,
-		userID:     cfg.UserID,
-		token:      cfg.AccessToken,
-		inbound:    make(chan channels.InboundMessage, 256),
-		sessions:   channels.NewSessionMap[id.RoomID]("mx", func(k id.RoomID) string { return string(k) }),
+		homeserver:    cfg.Homeserver,
+		userID:        cfg.UserID,
+		token:         cfg.AccessToken,
+		inbound:       make(chan channels.InboundMessage, 256),
+		sessions:      channels.NewSessionMap[id.RoomID]("mx", func(k id.RoomID) string { return string(k) }),
+		maxAttachment: channels.DefaultMaxAttachmentBytes,
+		groupRooms:    make(map[id.RoomID]bool),
 	}, nil
 }
 
 func (a *Adapter) Name() string { return "matrix" }
 
+func (a *Adapter) Verify(ctx context.Context) (string, error) {
+	client, err := mautrix.NewClient(a.homeserver, id.UserID(a.userID), a.token)
+	if err != nil {
+		return "", fmt.Errorf("matrix: creating client: %w", err)
+	}
+	resp, err := client.Whoami(ctx)
+	if err != nil {
+		return "", fmt.Errorf("matrix: %w", err)
+	}
+	return string(resp.UserID), nil
+}
+
 func (a *Adapter) Start(ctx context.Context) error {
 	logger := telemetry.FromContext(ctx)
 
@@ -65,7 +86,12 @@ func (a *Adapter) Start(ctx context.Context) error {
 
 	syncer := client.Syncer.(*mautrix.DefaultSyncer)
 	syncer.OnEventType(event.EventMessage, func(ctx context.Context, evt *event.Event) {
-		a.handleMessage(evt)
+		a.handleMessage(ctx, evt)
+	})
+	syncer.OnEventType(event.StateMember, func(_ context.Context, evt *event.Event) {
+		a.groupRoomsMu.Lock()
+		delete(a.groupRooms, evt.RoomID)
+		a.groupRoomsMu.Unlock()
 	})
 
 	logger.Info("matrix adapter started", "homeserver", a.homeserver)
@@ -92,27 +118,85 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 		return fmt.Errorf("matrix: no room for session %s", msg.SessionID)
 	}
 
-	chunks := channels.SplitMessage(msg.Content, 65536)
-	for _, chunk := range chunks {
+	for _, chunk := range msg.TextChunks(65536) {
 		if _, err := a.client.SendText(ctx, roomID, chunk); err != nil {
 			return err
 		}
 	}
+
+	for _, att := range msg.Attachments {
+		if err := a.sendAttachment(ctx, roomID, att); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (a *Adapter) sendAttachment(ctx context.Context, roomID id.RoomID, att channels.Attachment) error {
+	up, err := a.client.UploadBytes(ctx, att.Data, att.MediaType)
+	if err != nil {
+		return fmt.Errorf("matrix: uploading %s: %w", att.Filename, err)
+	}
+
+	msgType := event.MsgFile
+	if att.IsImage() {
+		msgType = event.MsgImage
+	}
+	_, err = a.client.SendMessageEvent(ctx, roomID, event.EventMessage, &event.MessageEventContent{
+		MsgType:  msgType,
+		Body:     att.Filename,
+		FileName: att.Filename,
+		URL:      up.ContentURI.CUString(),
+		Info: &event.FileInfo{
+			MimeType: att.MediaType,
+			Size:     len(att.Data),
+		},
+	})
+	return err
+}
+
 func (a *Adapter) Receive() <-chan channels.InboundMessage {
 	return a.inbound
 }
 
 func (a *Adapter) Capabilities() channels.ChannelCaps {
 	return channels.ChannelCaps{
-		SupportsStreaming: false,
+		SupportsStreaming: true,
 		SupportsMedia:     true,
 		SupportsReactions: true,
+		SupportsEditing:   true,
+		MaxMessageLength:  65536,
+		EditInterval:      time.Second,
 	}
 }
 
+func (a *Adapter) SendEditable(ctx context.Context, sessionID, content string) (string, error) {
+	roomID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return "", fmt.Errorf("matrix: no room for session %s", sessionID)
+	}
+	resp, err := a.client.SendText(ctx, roomID, content)
+	if err != nil {
+		return "", err
+	}
+	return resp.EventID.String(), nil
+}
+
+func (a *Adapter) EditMessage(ctx context.Context, sessionID, messageID, content string) error {
+	roomID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return fmt.Errorf("matrix: no room for session %s", sessionID)
+	}
+	edit := &event.MessageEventContent{MsgType: event.MsgText, Body: content}
+	edit.SetEdit(id.EventID(messageID))
+	_, err := a.client.SendMessageEvent(ctx, roomID, event.EventMessage, edit)
+	return err
+}
+
+func (a *Adapter) SetMaxAttachmentBytes(n int64) { a.maxAttachment = n }
+
+func (a *Adapter) SetGroupSessionMode(mode channels.GroupSessionMode) { a.sessions.SetGroupMode(mode) }
+
 func (a *Adapter) SendTyping(ctx context.Context, sessionID string) error {
 	roomID, ok := a.sessions.Reverse(sessionID)
 	if !ok {
@@ -122,24 +206,107 @@ func (a *Adapter) SendTyping(ctx context.Context, sessionID string) error {
 	return err
 }
 
-func (a *Adapter) handleMessage(evt *event.Event) {
+func (a *Adapter) handleMessage(ctx context.Context, evt *event.Event) {
 
 	if evt.Sender.String() == a.userID {
 		return
 	}
 
 	content := evt.Content.AsMessage()
-	if content == nil || content.Body == "" {
+	if content == nil {
 		return
 	}
 
-	sessionID := a.sessions.GetOrCreate(evt.RoomID)
+	text := content.Body
+	var attachments []channels.Attachment
+	switch content.MsgType {
+	case event.MsgImage, event.MsgFile, event.MsgAudio, event.MsgVideo:
+		if att, ok := a.downloadAttachment(ctx, content); ok {
+			attachments = append(attachments, att)
+			if text == att.Filename {
+				text = ""
+			}
+		}
+	}
+	if text == "" && len(attachments) == 0 {
+		return
+	}
+
+	isGroup := a.isGroupRoom(ctx, evt.RoomID)
+	sessionID := a.sessions.ForMessage(evt.RoomID, evt.Sender.String(), isGroup)
 
 	a.inbound <- channels.InboundMessage{
 		ChannelName: "matrix",
 		SessionID:   sessionID,
+		ChatID:      evt.RoomID.String(),
 		PeerID:      evt.Sender.String(),
-		Content:     content.Body,
+		Content:     text,
+		Attachments: attachments,
+		IsGroup:     isGroup,
+		Mentioned:   content.Mentions.Has(id.UserID(a.userID)) || strings.Contains(content.Body, a.userID),
+		SenderName:  evt.Sender.Localpart(),
+	}
+}
+
+// isGroupRoom reports whether more than two users are joined to roomID. The
+// answer is cached until the room's membership changes.
+func (a *Adapter) isGroupRoom(ctx context.Context, roomID id.RoomID) bool {
+	a.groupRoomsMu.Lock()
+	group, ok := a.groupRooms[roomID]
+	a.groupRoomsMu.Unlock()
+	if ok {
+		return group
+	}
+
+	resp, err := a.client.JoinedMembers(ctx, roomID)
+	if err != nil {
+		slog.Warn("matrix: listing room members failed", slog.String("room", roomID.String()), slog.String("err", err.Error()))
+		return false
 	}
+	group = len(resp.Joined) > 2
+
+	a.groupRoomsMu.Lock()
+	a.groupRooms[roomID] = group
+	a.groupRoomsMu.Unlock()
+	return group
 }
 
+func (a *Adapter) downloadAttachment(ctx context.Context, content *event.MessageEventContent) (channels.Attachment, bool) {
+	name := content.FileName
+	if name == "" {
+		name = content.Body
+	}
+	var mediaType string
+	if content.Info != nil {
+		mediaType = content.Info.MimeType
+		if err := channels.CheckAttachmentSize(int64(content.Info.Size), a.maxAttachment); err != nil {
+			slog.Warn("matrix attachment skipped", slog.String("file", name), slog.String("err", err.Error()))
+			return channels.Attachment{}, false
+		}
+	}
+	if content.File != nil {
+		slog.Warn("matrix encrypted attachment not supported", slog.String("file", name))
+		return channels.Attachment{}, false
+	}
+
+	uri, err := content.URL.Parse()
+	if err != nil {
+		slog.Warn("matrix attachment has invalid url", slog.String("file", name), slog.String("err", err.Error()))
+		return channels.Attachment{}, false
+	}
+	data, err := a.client.DownloadBytes(ctx, uri)
+	if err != nil {
+		slog.Warn("matrix attachment download failed", slog.String("file", name), slog.String("err", err.Error()))
+		return channels.Attachment{}, false
+	}
+	if err := channels.CheckAttachmentSize(int64(len(data)), a.maxAttachment); err != nil {
+		slog.Warn("matrix attachment skipped", slog.String("file", name), slog.String("err", err.Error()))
+		return channels.Attachment{}, false
+	}
+
+	return channels.Attachment{
+		Filename:  name,
+		MediaType: channels.DetectMediaType(mediaType, data),
+		Data:      data,
+	}, true
+}
@@ -5,26 +5,62 @@ import (
 	"sync"
 )
 
+type sessionKey[K comparable] struct {
+	chat K
+	peer string
+}
+
 type SessionMap[K comparable] struct {
-	mu      sync.RWMutex
-	forward map[K]string
-	reverse map[string]K
-	prefix  string
-	toKey   func(K) string
+	mu        sync.RWMutex
+	forward   map[sessionKey[K]]string
+	reverse   map[string]K
+	prefix    string
+	toKey     func(K) string
+	groupMode GroupSessionMode
 }
 
 func NewSessionMap[K comparable](prefix string, toKey func(K) string) *SessionMap[K] {
 	return &SessionMap[K]{
-		forward: make(map[K]string),
-		reverse: make(map[string]K),
-		prefix:  prefix,
-		toKey:   toKey,
+		forward:   make(map[sessionKey[K]]string),
+		reverse:   make(map[string]K),
+		prefix:    prefix,
+		toKey:     toKey,
+		groupMode: GroupSessionShared,
 	}
 }
 
+// SetGroupMode controls whether group chats share one session or give each
+// participant their own.
+func (sm *SessionMap[K]) SetGroupMode(mode GroupSessionMode) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.groupMode = mode
+}
+
 func (sm *SessionMap[K]) GetOrCreate(channelID K) string {
+	return sm.getOrCreate(sessionKey[K]{chat: channelID})
+}
+
+// ForMessage returns the session for a message from peerID in channelID,
+// honouring the group session mode when isGroup is set. Replies to any of
+// these sessions are delivered to channelID.
+func (sm *SessionMap[K]) ForMessage(channelID K, peerID string, isGroup bool) string {
+	key := sessionKey[K]{chat: channelID}
+	if isGroup && peerID != "" && sm.mode() == GroupSessionPerUser {
+		key.peer = peerID
+	}
+	return sm.getOrCreate(key)
+}
+
+func (sm *SessionMap[K]) mode() GroupSessionMode {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.groupMode
+}
+
+func (sm *SessionMap[K]) getOrCreate(key sessionKey[K]) string {
 	sm.mu.RLock()
-	sid, ok := sm.forward[channelID]
+	sid, ok := sm.forward[key]
 	sm.mu.RUnlock()
 
 	if ok {
@@ -34,20 +70,23 @@ func (sm *SessionMap[K]) GetOrCreate(channelID K) string {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if sid, ok := sm.forward[channelID]; ok {
+	if sid, ok := sm.forward[key]; ok {
 		return sid
 	}
 
-	sid = fmt.Sprintf("%s-%s", sm.prefix, sm.toKey(channelID))
-	sm.forward[channelID] = sid
-	sm.reverse[sid] = channelID
+	sid = fmt.Sprintf("%s-%s", sm.prefix, sm.toKey(key.chat))
+	if key.peer != "" {
+		sid += "-" + key.peer
+	}
+	sm.forward[key] = sid
+	sm.reverse[sid] = key.chat
 	return sid
 }
 
 func (sm *SessionMap[K]) Lookup(channelID K) (string, bool) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	sid, ok := sm.forward[channelID]
+	sid, ok := sm.forward[sessionKey[K]{chat: channelID}]
 	return sid, ok
 }
 
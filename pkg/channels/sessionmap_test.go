@@ -83,3 +83,51 @@ func TestSessionMapConcurrency(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionMapForMessage(t *testing.T) {
+	sm := NewSessionMap[string]("dc", func(k string) string { return k })
+
+	if got := sm.ForMessage("chan", "u1", true); got != "dc-chan" {
+		t.Errorf("shared group session = %q, want dc-chan", got)
+	}
+
+	sm.SetGroupMode(GroupSessionPerUser)
+	u1 := sm.ForMessage("chan", "u1", true)
+	u2 := sm.ForMessage("chan", "u2", true)
+	if u1 != "dc-chan-u1" || u2 != "dc-chan-u2" {
+		t.Errorf("per-user sessions = %q, %q", u1, u2)
+	}
+	if got := sm.ForMessage("dm", "u1", false); got != "dc-dm" {
+		t.Errorf("direct session = %q, want dc-dm", got)
+	}
+
+	for _, sid := range []string{u1, u2} {
+		if chat, ok := sm.Reverse(sid); !ok || chat != "chan" {
+			t.Errorf("Reverse(%q) = %q, %v", sid, chat, ok)
+		}
+	}
+}
+
+func TestGroupRespondMode(t *testing.T) {
+	direct := InboundMessage{}
+	quiet := InboundMessage{IsGroup: true}
+	mentioned := InboundMessage{IsGroup: true, Mentioned: true}
+
+	tests := []struct {
+		mode GroupRespondMode
+		msg  InboundMessage
+		want bool
+	}{
+		{"", direct, true},
+		{"", quiet, false},
+		{"", mentioned, true},
+		{GroupRespondAlways, quiet, true},
+		{GroupRespondPassive, mentioned, false},
+		{GroupRespondPassive, direct, true},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.ShouldRespond(tt.msg); got != tt.want {
+			t.Errorf("%q.ShouldRespond(%+v) = %v, want %v", tt.mode, tt.msg, got, tt.want)
+		}
+	}
+}
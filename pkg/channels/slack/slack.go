@@ -1,11 +1,14 @@
 package slack
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/igorsilveira/pincer/pkg/channels"
 	"github.com/igorsilveira/pincer/pkg/telemetry"
@@ -15,13 +18,15 @@ import (
 )
 
 type Adapter struct {
-	botToken string
-	appToken string
-	client   *slackapi.Client
-	socket   *socketmode.Client
-	inbound  chan channels.InboundMessage
-	sessions *channels.SessionMap[string]
-	done     chan struct{}
+	botToken      string
+	appToken      string
+	client        *slackapi.Client
+	socket        *socketmode.Client
+	inbound       chan channels.InboundMessage
+	sessions      *channels.SessionMap[string]
+	done          chan struct{}
+	maxAttachment int64
+	botUserID     string
 }
 
 func New(botToken, appToken string) (*Adapter, error) {
@@ -35,16 +40,31 @@ func New(botToken, appToken string) (*Adapter, error) {
 		return nil, fmt.Errorf("slack: bot token and app token required (set SLACK_BOT_TOKEN and SLACK_APP_TOKEN)")
 	}
 	return &Adapter{
-		botToken: botToken,
-		appToken: appToken,
-		inbound:  make(chan channels.InboundMessage, 256),
-		sessions: channels.NewSessionMap[string]("sl", func(k string) string { return k }),
-		done:     make(chan struct{}),
+		botToken:      botToken,
+		appToken:      appToken,
+		inbound:       make(chan channels.InboundMessage, 256),
+		sessions:      channels.NewSessionMap[string]("sl", func(k string) string { return k }),
+		done:          make(chan struct{}),
+		maxAttachment: channels.DefaultMaxAttachmentBytes,
 	}, nil
 }
 
 func (a *Adapter) Name() string { return "slack" }
 
+// Verify checks the bot token with auth.test and the app token by opening
+// (and abandoning) a socket mode connection URL.
+func (a *Adapter) Verify(ctx context.Context) (string, error) {
+	client := slackapi.New(a.botToken, slackapi.OptionAppLevelToken(a.appToken))
+	auth, err := client.AuthTestContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("slack: bot token: %w", err)
+	}
+	if _, _, err := client.StartSocketModeContext(ctx); err != nil {
+		return "", fmt.Errorf("slack: app token: %w", err)
+	}
+	return auth.User + "@" + auth.Team, nil
+}
+
 func (a *Adapter) Start(ctx context.Context) error {
 	logger := telemetry.FromContext(ctx)
 
@@ -55,6 +75,12 @@ func (a *Adapter) Start(ctx context.Context) error {
 
 	a.socket = socketmode.New(a.client)
 
+	if auth, err := a.client.AuthTestContext(ctx); err == nil {
+		a.botUserID = auth.UserID
+	} else {
+		logger.Warn("slack: could not resolve bot identity, group mentions disabled", slog.String("err", err.Error()))
+	}
+
 	go a.listenEvents(ctx)
 	go func() {
 		if err := a.socket.Run(); err != nil {
@@ -81,14 +107,24 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 		return fmt.Errorf("slack: no channel for session %s", msg.SessionID)
 	}
 
-	chunks := channels.SplitMessage(msg.Content, 40000)
-	for _, chunk := range chunks {
+	for _, chunk := range msg.TextChunks(40000) {
 		if _, _, err := a.client.PostMessageContext(ctx, channelID,
 			slackapi.MsgOptionText(chunk, false),
 		); err != nil {
 			return err
 		}
 	}
+
+	for _, att := range msg.Attachments {
+		if _, err := a.client.UploadFileContext(ctx, slackapi.UploadFileParameters{
+			Reader:   bytes.NewReader(att.Data),
+			FileSize: len(att.Data),
+			Filename: att.Filename,
+			Channel:  channelID,
+		}); err != nil {
+			return fmt.Errorf("slack: uploading %s: %w", att.Filename, err)
+		}
+	}
 	return nil
 }
 
@@ -98,12 +134,43 @@ func (a *Adapter) Receive() <-chan channels.InboundMessage {
 
 func (a *Adapter) Capabilities() channels.ChannelCaps {
 	return channels.ChannelCaps{
-		SupportsStreaming: false,
+		SupportsStreaming: true,
 		SupportsMedia:     true,
 		SupportsReactions: true,
+		SupportsEditing:   true,
+		MaxMessageLength:  40000,
+		EditInterval:      1500 * time.Millisecond,
+	}
+}
+
+func (a *Adapter) SendEditable(ctx context.Context, sessionID, content string) (string, error) {
+	if a.client == nil {
+		return "", fmt.Errorf("slack: not connected")
+	}
+	channelID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return "", fmt.Errorf("slack: no channel for session %s", sessionID)
+	}
+	_, ts, err := a.client.PostMessageContext(ctx, channelID, slackapi.MsgOptionText(content, false))
+	return ts, err
+}
+
+func (a *Adapter) EditMessage(ctx context.Context, sessionID, messageID, content string) error {
+	if a.client == nil {
+		return fmt.Errorf("slack: not connected")
 	}
+	channelID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return fmt.Errorf("slack: no channel for session %s", sessionID)
+	}
+	_, _, _, err := a.client.UpdateMessageContext(ctx, channelID, messageID, slackapi.MsgOptionText(content, false))
+	return err
 }
 
+func (a *Adapter) SetMaxAttachmentBytes(n int64) { a.maxAttachment = n }
+
+func (a *Adapter) SetGroupSessionMode(mode channels.GroupSessionMode) { a.sessions.SetGroupMode(mode) }
+
 func (a *Adapter) SendApprovalRequest(ctx context.Context, req channels.ApprovalRequest) error {
 	if a.client == nil {
 		return fmt.Errorf("slack: not connected")
@@ -205,24 +272,68 @@ func (a *Adapter) handleEventsAPI(event slackevents.EventsAPIEvent) {
 		inner := event.InnerEvent
 		switch ev := inner.Data.(type) {
 		case *slackevents.MessageEvent:
-			if ev.SubType != "" || ev.Text == "" {
+			if ev.SubType != "" && ev.SubType != "file_share" {
+				return
+			}
+			if a.botUserID != "" && ev.User == a.botUserID {
 				return
 			}
 
-			sessionID := a.sessions.GetOrCreate(ev.Channel)
+			var attachments []channels.Attachment
+			if ev.Message != nil {
+				attachments = a.downloadAttachments(ev.Message.Files)
+			}
+			if ev.Text == "" && len(attachments) == 0 {
+				return
+			}
+
+			isGroup := ev.ChannelType != slackapi.TYPE_IM
+			sessionID := a.sessions.ForMessage(ev.Channel, ev.User, isGroup)
 
 			slog.Debug("slack message received",
 				slog.String("channel", ev.Channel),
 				slog.String("user", ev.User),
+				slog.Int("attachments", len(attachments)),
 			)
 
 			a.inbound <- channels.InboundMessage{
 				ChannelName: "slack",
 				SessionID:   sessionID,
+				ChatID:      ev.Channel,
 				PeerID:      ev.User,
 				Content:     ev.Text,
+				Attachments: attachments,
+				IsGroup:     isGroup,
+				Mentioned:   a.botUserID != "" && strings.Contains(ev.Text, "<@"+a.botUserID+">"),
 			}
 		}
 	}
 }
 
+func (a *Adapter) downloadAttachments(files []slackapi.File) []channels.Attachment {
+	var attachments []channels.Attachment
+	header := http.Header{"Authorization": []string{"Bearer " + a.botToken}}
+	for _, f := range files {
+		if err := channels.CheckAttachmentSize(int64(f.Size), a.maxAttachment); err != nil {
+			slog.Warn("slack attachment skipped", slog.String("file", f.Name), slog.String("err", err.Error()))
+			continue
+		}
+		url := f.URLPrivateDownload
+		if url == "" {
+			url = f.URLPrivate
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		data, _, err := channels.DownloadAttachment(ctx, nil, url, header, a.maxAttachment)
+		cancel()
+		if err != nil {
+			slog.Warn("slack attachment download failed", slog.String("file", f.Name), slog.String("err", err.Error()))
+			continue
+		}
+		attachments = append(attachments, channels.Attachment{
+			Filename:  f.Name,
+			MediaType: channels.DetectMediaType(f.Mimetype, data),
+			Data:      data,
+		})
+	}
+	return attachments
+}
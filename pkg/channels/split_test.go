@@ -165,3 +165,15 @@ func TestSplitMessageUTF8Safety(t *testing.T) {
 		}
 	}
 }
+
+func TestOutboundMessageTextChunks(t *testing.T) {
+	withFile := OutboundMessage{Attachments: []Attachment{{Filename: "a.png"}}}
+	if got := withFile.TextChunks(10); len(got) != 0 {
+		t.Errorf("attachment-only message chunks = %q, want none", got)
+	}
+
+	plain := OutboundMessage{Content: "hello world"}
+	if got := plain.TextChunks(5); len(got) < 2 {
+		t.Errorf("chunks = %q, want split content", got)
+	}
+}
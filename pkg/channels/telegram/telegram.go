@@ -1,12 +1,16 @@
 package telegram
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"html"
 	"log/slog"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -15,10 +19,14 @@ import (
 )
 
 type Adapter struct {
-	token    string
-	bot      *bot.Bot
-	inbound  chan channels.InboundMessage
-	sessions *channels.SessionMap[int64]
+	token         string
+	bot           *bot.Bot
+	inbound       chan channels.InboundMessage
+	sessions      *channels.SessionMap[int64]
+	maxAttachment int64
+	groupRespond  channels.GroupRespondMode
+	botID         int64
+	botUsername   string
 }
 
 func New(token string) (*Adapter, error) {
@@ -29,14 +37,27 @@ func New(token string) (*Adapter, error) {
 		return nil, fmt.Errorf("telegram: bot token not set")
 	}
 	return &Adapter{
-		token:    token,
-		inbound:  make(chan channels.InboundMessage, 256),
-		sessions: channels.NewSessionMap[int64]("tg", func(k int64) string { return fmt.Sprintf("%d", k) }),
+		token:         token,
+		inbound:       make(chan channels.InboundMessage, 256),
+		sessions:      channels.NewSessionMap[int64]("tg", func(k int64) string { return fmt.Sprintf("%d", k) }),
+		maxAttachment: channels.DefaultMaxAttachmentBytes,
 	}, nil
 }
 
 func (a *Adapter) Name() string { return "telegram" }
 
+func (a *Adapter) Verify(ctx context.Context) (string, error) {
+	b, err := bot.New(a.token, bot.WithSkipGetMe())
+	if err != nil {
+		return "", fmt.Errorf("telegram: creating bot: %w", err)
+	}
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		return "", fmt.Errorf("telegram: %w", err)
+	}
+	return "@" + me.Username, nil
+}
+
 func (a *Adapter) Start(ctx context.Context) error {
 	logger := telemetry.FromContext(ctx)
 
@@ -51,6 +72,13 @@ func (a *Adapter) Start(ctx context.Context) error {
 	}
 	a.bot = b
 
+	if me, err := b.GetMe(ctx); err == nil {
+		a.botID = me.ID
+		a.botUsername = me.Username
+	} else {
+		logger.Warn("telegram: could not resolve bot identity, group mentions disabled", slog.String("err", err.Error()))
+	}
+
 	logger.Info("telegram adapter started")
 
 	go b.Start(ctx)
@@ -68,8 +96,7 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 		return fmt.Errorf("telegram: no chat for session %s", msg.SessionID)
 	}
 
-	chunks := channels.SplitMessage(msg.Content, 4096)
-	for _, chunk := range chunks {
+	for _, chunk := range msg.TextChunks(4096) {
 		if _, err := a.bot.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: chatID,
 			Text:   chunk,
@@ -77,21 +104,71 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 			return err
 		}
 	}
+
+	for _, att := range msg.Attachments {
+		if err := a.sendAttachment(ctx, chatID, att); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (a *Adapter) sendAttachment(ctx context.Context, chatID int64, att channels.Attachment) error {
+	file := &models.InputFileUpload{Filename: att.Filename, Data: bytes.NewReader(att.Data)}
+	if att.IsImage() {
+		_, err := a.bot.SendPhoto(ctx, &bot.SendPhotoParams{ChatID: chatID, Photo: file})
+		return err
+	}
+	_, err := a.bot.SendDocument(ctx, &bot.SendDocumentParams{ChatID: chatID, Document: file})
+	return err
+}
+
 func (a *Adapter) Receive() <-chan channels.InboundMessage {
 	return a.inbound
 }
 
 func (a *Adapter) Capabilities() channels.ChannelCaps {
 	return channels.ChannelCaps{
-		SupportsStreaming: false,
+		SupportsStreaming: true,
 		SupportsMedia:     true,
 		SupportsReactions: true,
+		SupportsEditing:   true,
+		MaxMessageLength:  4096,
+		EditInterval:      time.Second,
 	}
 }
 
+func (a *Adapter) SendEditable(ctx context.Context, sessionID, content string) (string, error) {
+	chatID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return "", fmt.Errorf("telegram: no chat for session %s", sessionID)
+	}
+	m, err := a.bot.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: content})
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
+
+func (a *Adapter) EditMessage(ctx context.Context, sessionID, messageID, content string) error {
+	chatID, ok := a.sessions.Reverse(sessionID)
+	if !ok {
+		return fmt.Errorf("telegram: no chat for session %s", sessionID)
+	}
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("telegram: invalid message id %q", messageID)
+	}
+	_, err = a.bot.EditMessageText(ctx, &bot.EditMessageTextParams{ChatID: chatID, MessageID: id, Text: content})
+	return err
+}
+
+func (a *Adapter) SetMaxAttachmentBytes(n int64) { a.maxAttachment = n }
+
+func (a *Adapter) SetGroupSessionMode(mode channels.GroupSessionMode) { a.sessions.SetGroupMode(mode) }
+
+func (a *Adapter) SetGroupRespondMode(mode channels.GroupRespondMode) { a.groupRespond = mode }
+
 func (a *Adapter) SendApprovalRequest(ctx context.Context, req channels.ApprovalRequest) error {
 	chatID, ok := a.sessions.Reverse(req.SessionID)
 	if !ok {
@@ -190,25 +267,130 @@ func (a *Adapter) handleCallbackQuery(ctx context.Context, b *bot.Bot, update *m
 }
 
 func (a *Adapter) handleUpdate(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if update.Message == nil || update.Message.Text == "" {
+	if update.Message == nil {
+		return
+	}
+
+	text := update.Message.Text
+	if text == "" {
+		text = update.Message.Caption
+	}
+	isGroup := update.Message.Chat.Type != models.ChatTypePrivate
+	mentioned := a.mentionsBot(update.Message, text)
+
+	// Group messages the agent will not answer are only kept as context, so
+	// their media is not worth downloading.
+	var attachments []channels.Attachment
+	if a.groupRespond.ShouldRespond(channels.InboundMessage{IsGroup: isGroup, Mentioned: mentioned}) {
+		attachments = a.downloadAttachments(ctx, b, update.Message)
+	}
+	if text == "" && len(attachments) == 0 {
 		return
 	}
 
 	chatID := update.Message.Chat.ID
 	peerID := fmt.Sprintf("%d", update.Message.From.ID)
 
-	sessionID := a.sessions.GetOrCreate(chatID)
+	sessionID := a.sessions.ForMessage(chatID, peerID, isGroup)
 
 	slog.Debug("telegram message received",
 		slog.Int64("chat_id", chatID),
 		slog.String("peer_id", peerID),
+		slog.Int("attachments", len(attachments)),
 	)
 
 	a.inbound <- channels.InboundMessage{
 		ChannelName: "telegram",
 		SessionID:   sessionID,
+		ChatID:      strconv.FormatInt(chatID, 10),
 		PeerID:      peerID,
-		Content:     update.Message.Text,
+		Content:     text,
+		Attachments: attachments,
+		IsGroup:     isGroup,
+		Mentioned:   mentioned,
+		SenderName:  senderName(update.Message.From),
+	}
+}
+
+func (a *Adapter) mentionsBot(m *models.Message, text string) bool {
+	if a.botID == 0 {
+		return false
+	}
+	if r := m.ReplyToMessage; r != nil && r.From != nil && r.From.ID == a.botID {
+		return true
+	}
+	for _, e := range append(m.Entities, m.CaptionEntities...) {
+		if e.Type == models.MessageEntityTypeTextMention && e.User != nil && e.User.ID == a.botID {
+			return true
+		}
+	}
+	return a.botUsername != "" && strings.Contains(strings.ToLower(text), "@"+strings.ToLower(a.botUsername))
+}
+
+func senderName(u *models.User) string {
+	if u == nil {
+		return ""
 	}
+	if u.Username != "" {
+		return u.Username
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+type telegramFile struct {
+	id        string
+	name      string
+	mediaType string
+	size      int64
+}
+
+func messageFiles(m *models.Message) []telegramFile {
+	var files []telegramFile
+	if len(m.Photo) > 0 {
+		largest := m.Photo[len(m.Photo)-1]
+		files = append(files, telegramFile{id: largest.FileID, name: largest.FileUniqueID + ".jpg", mediaType: "image/jpeg", size: int64(largest.FileSize)})
+	}
+	if d := m.Document; d != nil {
+		files = append(files, telegramFile{id: d.FileID, name: d.FileName, mediaType: d.MimeType, size: d.FileSize})
+	}
+	if v := m.Voice; v != nil {
+		files = append(files, telegramFile{id: v.FileID, name: v.FileUniqueID + ".ogg", mediaType: v.MimeType, size: v.FileSize})
+	}
+	if au := m.Audio; au != nil {
+		files = append(files, telegramFile{id: au.FileID, name: au.FileName, mediaType: au.MimeType, size: au.FileSize})
+	}
+	return files
 }
 
+func (a *Adapter) downloadAttachments(ctx context.Context, b *bot.Bot, m *models.Message) []channels.Attachment {
+	var attachments []channels.Attachment
+	for _, f := range messageFiles(m) {
+		if err := channels.CheckAttachmentSize(f.size, a.maxAttachment); err != nil {
+			slog.Warn("telegram attachment skipped", slog.String("file", f.name), slog.String("err", err.Error()))
+			continue
+		}
+		file, err := b.GetFile(ctx, &bot.GetFileParams{FileID: f.id})
+		if err != nil {
+			slog.Warn("telegram attachment lookup failed", slog.String("file", f.name), slog.String("err", err.Error()))
+			continue
+		}
+		data, mediaType, err := channels.DownloadAttachment(ctx, nil, b.FileDownloadLink(file), nil, a.maxAttachment)
+		if err != nil {
+			slog.Warn("telegram attachment download failed", slog.String("file", f.name), slog.String("err", err.Error()))
+			continue
+		}
+		if f.mediaType != "" {
+			mediaType = f.mediaType
+		}
+		name := f.name
+		if name == "" {
+			name = path.Base(file.FilePath)
+		}
+		attachments = append(attachments, channels.Attachment{
+			Filename:  name,
+			MediaType: channels.DetectMediaType(mediaType, data),
+			Data:      data,
+		})
+	}
+	return attachments
+}
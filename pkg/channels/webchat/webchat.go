@@ -18,7 +18,7 @@ type Adapter struct {
 
 type Client struct {
 	SessionID string
-	Send      chan string
+	Send      chan channels.OutboundMessage
 }
 
 func New() *Adapter {
@@ -59,7 +59,7 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 	}
 
 	select {
-	case client.Send <- msg.Content:
+	case client.Send <- msg:
 	default:
 		slog.Warn("webchat: client send buffer full", slog.String("session_id", msg.SessionID))
 	}
@@ -73,7 +73,7 @@ func (a *Adapter) Receive() <-chan channels.InboundMessage {
 func (a *Adapter) Capabilities() channels.ChannelCaps {
 	return channels.ChannelCaps{
 		SupportsStreaming: true,
-		SupportsMedia:     false,
+		SupportsMedia:     true,
 		SupportsReactions: false,
 	}
 }
@@ -81,7 +81,7 @@ func (a *Adapter) Capabilities() channels.ChannelCaps {
 func (a *Adapter) RegisterClient(sessionID string) *Client {
 	client := &Client{
 		SessionID: sessionID,
-		Send:      make(chan string, 64),
+		Send:      make(chan channels.OutboundMessage, 64),
 	}
 	a.mu.Lock()
 	a.clients[sessionID] = client
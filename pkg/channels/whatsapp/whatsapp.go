@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/igorsilveira/pincer/pkg/channels"
 	qrcode "github.com/skip2/go-qrcode"
@@ -17,11 +18,12 @@ import (
 )
 
 type Adapter struct {
-	client    *whatsmeow.Client
-	dbPath    string
-	allowList map[string]struct{}
-	inbound   chan channels.InboundMessage
-	sessions  *channels.SessionMap[types.JID]
+	client        *whatsmeow.Client
+	dbPath        string
+	allowList     map[string]struct{}
+	inbound       chan channels.InboundMessage
+	sessions      *channels.SessionMap[types.JID]
+	maxAttachment int64
 }
 
 func New(dbPath string, allowList []string) (*Adapter, error) {
@@ -36,10 +38,11 @@ func New(dbPath string, allowList []string) (*Adapter, error) {
 		al[v] = struct{}{}
 	}
 	return &Adapter{
-		dbPath:    dbPath,
-		allowList: al,
-		inbound:   make(chan channels.InboundMessage, 256),
-		sessions:  channels.NewSessionMap[types.JID]("wa", func(k types.JID) string { return k.User }),
+		dbPath:        dbPath,
+		allowList:     al,
+		inbound:       make(chan channels.InboundMessage, 256),
+		sessions:      channels.NewSessionMap[types.JID]("wa", func(k types.JID) string { return k.User }),
+		maxAttachment: channels.DefaultMaxAttachmentBytes,
 	}, nil
 }
 
@@ -105,18 +108,60 @@ func (a *Adapter) Send(ctx context.Context, msg channels.OutboundMessage) error
 		return fmt.Errorf("whatsapp: no chat for session %s", msg.SessionID)
 	}
 
-	formatted := markdownToWhatsApp(msg.Content)
-	chunks := channels.SplitMessage(formatted, 65536)
-	for _, chunk := range chunks {
+	msg.Content = markdownToWhatsApp(msg.Content)
+	for _, chunk := range msg.TextChunks(65536) {
 		if _, err := a.client.SendMessage(ctx, jid, &waE2E.Message{
 			Conversation: new(chunk),
 		}); err != nil {
 			return err
 		}
 	}
+
+	for _, att := range msg.Attachments {
+		if err := a.sendAttachment(ctx, jid, att); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (a *Adapter) sendAttachment(ctx context.Context, jid types.JID, att channels.Attachment) error {
+	mediaType := whatsmeow.MediaDocument
+	if att.IsImage() {
+		mediaType = whatsmeow.MediaImage
+	}
+	up, err := a.client.Upload(ctx, att.Data, mediaType)
+	if err != nil {
+		return fmt.Errorf("whatsapp: uploading %s: %w", att.Filename, err)
+	}
+
+	var waMsg *waE2E.Message
+	if att.IsImage() {
+		waMsg = &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Mimetype:      new(att.MediaType),
+			URL:           new(up.URL),
+			DirectPath:    new(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    new(up.FileLength),
+		}}
+	} else {
+		waMsg = &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			Mimetype:      new(att.MediaType),
+			FileName:      new(att.Filename),
+			URL:           new(up.URL),
+			DirectPath:    new(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    new(up.FileLength),
+		}}
+	}
+	_, err = a.client.SendMessage(ctx, jid, waMsg)
+	return err
+}
+
 func (a *Adapter) Receive() <-chan channels.InboundMessage {
 	return a.inbound
 }
@@ -129,6 +174,10 @@ func (a *Adapter) Capabilities() channels.ChannelCaps {
 	}
 }
 
+func (a *Adapter) SetMaxAttachmentBytes(n int64) { a.maxAttachment = n }
+
+func (a *Adapter) SetGroupSessionMode(mode channels.GroupSessionMode) { a.sessions.SetGroupMode(mode) }
+
 func (a *Adapter) SendTyping(ctx context.Context, sessionID string) error {
 	jid, ok := a.sessions.Reverse(sessionID)
 	if !ok {
@@ -160,18 +209,124 @@ func (a *Adapter) handleEvent(evt interface{}) {
 		if text == "" && v.Message.GetExtendedTextMessage() != nil {
 			text = v.Message.GetExtendedTextMessage().GetText()
 		}
+		attachments, caption := a.downloadAttachments(v.Message)
 		if text == "" {
+			text = caption
+		}
+		if text == "" && len(attachments) == 0 {
 			return
 		}
 
 		sender := v.Info.Sender.ToNonAD()
-		sessionID := a.sessions.GetOrCreate(sender)
+		var sessionID string
+		if v.Info.IsGroup {
+			sessionID = a.sessions.ForMessage(v.Info.Chat, sender.User, true)
+		} else {
+			sessionID = a.sessions.GetOrCreate(sender)
+		}
 
 		a.inbound <- channels.InboundMessage{
 			ChannelName: "whatsapp",
 			SessionID:   sessionID,
+			ChatID:      v.Info.Chat.String(),
 			PeerID:      sender.String(),
 			Content:     text,
+			Attachments: attachments,
+			IsGroup:     v.Info.IsGroup,
+			Mentioned:   a.mentionsBot(v.Message),
+			SenderName:  v.Info.PushName,
+		}
+	}
+}
+
+// mentionsBot reports whether m mentions the linked account or quotes one of
+// its messages.
+func (a *Adapter) mentionsBot(m *waE2E.Message) bool {
+	if a.client == nil || a.client.Store.ID == nil {
+		return false
+	}
+	own := map[string]struct{}{a.client.Store.ID.ToNonAD().String(): {}}
+	if lid := a.client.Store.LID; !lid.IsEmpty() {
+		own[lid.ToNonAD().String()] = struct{}{}
+	}
+
+	var info *waE2E.ContextInfo
+	switch {
+	case m.GetExtendedTextMessage() != nil:
+		info = m.GetExtendedTextMessage().GetContextInfo()
+	case m.GetImageMessage() != nil:
+		info = m.GetImageMessage().GetContextInfo()
+	case m.GetDocumentMessage() != nil:
+		info = m.GetDocumentMessage().GetContextInfo()
+	}
+	if info == nil {
+		return false
+	}
+	if _, ok := own[nonAD(info.GetParticipant())]; ok {
+		return true
+	}
+	for _, jid := range info.GetMentionedJID() {
+		if _, ok := own[nonAD(jid)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func nonAD(jid string) string {
+	parsed, err := types.ParseJID(jid)
+	if err != nil {
+		return jid
+	}
+	return parsed.ToNonAD().String()
+}
+
+type mediaMessage struct {
+	msg       whatsmeow.DownloadableMessage
+	name      string
+	mediaType string
+	size      uint64
+}
+
+func (a *Adapter) downloadAttachments(m *waE2E.Message) ([]channels.Attachment, string) {
+	var media []mediaMessage
+	var caption string
+	if img := m.GetImageMessage(); img != nil {
+		media = append(media, mediaMessage{msg: img, name: "image", mediaType: img.GetMimetype(), size: img.GetFileLength()})
+		caption = img.GetCaption()
+	}
+	if doc := m.GetDocumentMessage(); doc != nil {
+		media = append(media, mediaMessage{msg: doc, name: doc.GetFileName(), mediaType: doc.GetMimetype(), size: doc.GetFileLength()})
+		if caption == "" {
+			caption = doc.GetCaption()
+		}
+	}
+	if audio := m.GetAudioMessage(); audio != nil {
+		media = append(media, mediaMessage{msg: audio, name: "audio", mediaType: audio.GetMimetype(), size: audio.GetFileLength()})
+	}
+
+	var attachments []channels.Attachment
+	for _, mm := range media {
+		if err := channels.CheckAttachmentSize(int64(mm.size), a.maxAttachment); err != nil {
+			slog.Warn("whatsapp attachment skipped", slog.String("file", mm.name), slog.String("err", err.Error()))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		data, err := a.client.Download(ctx, mm.msg)
+		cancel()
+		if err != nil {
+			slog.Warn("whatsapp attachment download failed", slog.String("file", mm.name), slog.String("err", err.Error()))
+			continue
+		}
+		if err := channels.CheckAttachmentSize(int64(len(data)), a.maxAttachment); err != nil {
+			slog.Warn("whatsapp attachment skipped", slog.String("file", mm.name), slog.String("err", err.Error()))
+			continue
 		}
+		attachments = append(attachments, channels.Attachment{
+			Filename:  mm.name,
+			MediaType: channels.DetectMediaType(mm.mediaType, data),
+			Data:      data,
+		})
 	}
+	return attachments, caption
 }
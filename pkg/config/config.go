@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -24,6 +27,12 @@ type Config struct {
 	MCP         MCPConfig                `toml:"mcp"`
 	A2A         A2AConfig                `toml:"a2a"`
 	Browser     BrowserConfig            `toml:"browser"`
+	Agents      []AgentProfileConfig     `toml:"agents"`
+	Routes      []RouteConfig            `toml:"routes"`
+	Access      AccessConfig             `toml:"access"`
+	Retention   RetentionConfig          `toml:"retention"`
+	Redaction   RedactionConfig          `toml:"redaction"`
+	Backup      BackupConfig             `toml:"backup"`
 }
 
 type GatewayConfig struct {
@@ -47,6 +56,38 @@ type AgentConfig struct {
 	Retry             RetryConfig        `toml:"retry"`
 	Checkpoint        CheckpointConfig   `toml:"checkpoint"`
 	Verification      VerificationConfig `toml:"verification"`
+	// Pricing maps model names to their prices, for cost metrics.
+	Pricing map[string]ModelPricing `toml:"pricing"`
+}
+
+// ModelPricing is a model's price in US dollars per million tokens.
+type ModelPricing struct {
+	Input  float64 `toml:"input"`
+	Output float64 `toml:"output"`
+}
+
+// AgentProfileConfig declares an additional named agent. Unset fields fall
+// back to [agent], [soul] and [sandbox].
+type AgentProfileConfig struct {
+	ID              string         `toml:"id"`
+	Soul            string         `toml:"soul"`
+	Model           string         `toml:"model"`
+	APIKeyEnv       string         `toml:"api_key_env"`
+	BaseURL         string         `toml:"base_url"`
+	AuthHeader      string         `toml:"auth_header"`
+	SystemPrompt    string         `toml:"system_prompt"`
+	Tools           []string       `toml:"tools"`
+	MemoryNamespace string         `toml:"memory_namespace"`
+	Sandbox         *SandboxConfig `toml:"sandbox"`
+}
+
+// RouteConfig binds conversations to an agent. Empty fields match anything;
+// the first matching route wins.
+type RouteConfig struct {
+	Agent   string `toml:"agent"`
+	Channel string `toml:"channel"`
+	Chat    string `toml:"chat"`
+	Peer    string `toml:"peer"`
 }
 
 type RetryConfig struct {
@@ -62,17 +103,83 @@ type CheckpointConfig struct {
 }
 
 type VerificationConfig struct {
-	Enabled             bool     `toml:"enabled"`
-	ConfidenceThreshold float64  `toml:"confidence_threshold"`
-	MaxAttempts         int      `toml:"max_attempts"`
-	Gates               []string `toml:"gates"`
+	Enabled             bool                `toml:"enabled"`
+	ConfidenceThreshold float64             `toml:"confidence_threshold"`
+	MaxAttempts         int                 `toml:"max_attempts"`
+	Gates               []string            `toml:"gates"`
+	CommandGates        []CommandGateConfig `toml:"command_gates"`
+	FileGates           []FileGateConfig    `toml:"file_gates"`
+}
+
+// CommandGateConfig runs a command in the sandbox after a task and fails
+// verification unless it exits with ExpectExitCode (default 0) and its output
+// matches ExpectOutput. The gate only runs when one of WhenTools was used or
+// a written file matches one of WhenPaths; with neither set it always runs.
+type CommandGateConfig struct {
+	Name           string   `toml:"name"`
+	Command        string   `toml:"command"`
+	WorkDir        string   `toml:"workdir"`
+	ExpectOutput   string   `toml:"expect_output"`
+	ExpectExitCode *int     `toml:"expect_exit_code"`
+	Timeout        string   `toml:"timeout"`
+	WhenTools      []string `toml:"when_tools"`
+	WhenPaths      []string `toml:"when_paths"`
+}
+
+// FileGateConfig checks that files exist, optionally with a given SHA-256.
+// CheckWritten also requires every file written during the task to exist.
+type FileGateConfig struct {
+	Name         string            `toml:"name"`
+	Root         string            `toml:"root"`
+	Files        []FileCheckConfig `toml:"files"`
+	CheckWritten bool              `toml:"check_written"`
+	WhenTools    []string          `toml:"when_tools"`
+	WhenPaths    []string          `toml:"when_paths"`
+}
+
+type FileCheckConfig struct {
+	Path   string `toml:"path"`
+	SHA256 string `toml:"sha256"`
 }
 
 type ChannelConfig struct {
-	Enabled   bool     `toml:"enabled"`
-	Token     string   `toml:"token"`
-	TokenEnv  string   `toml:"token_env"`
-	AllowList []string `toml:"allow_list"`
+	Enabled            bool        `toml:"enabled"`
+	Token              string      `toml:"token"`
+	TokenEnv           string      `toml:"token_env"`
+	AllowList          []string    `toml:"allow_list"`
+	MaxAttachmentBytes int64       `toml:"max_attachment_bytes"`
+	Group              GroupConfig `toml:"group"`
+}
+
+// GroupConfig controls behaviour in group chats. Session is "shared" (one
+// session per group) or "per_user". Respond is "mention", "always" or
+// "passive".
+type GroupConfig struct {
+	Session string `toml:"session"`
+	Respond string `toml:"respond"`
+}
+
+// AccessConfig maps channel peers to users and roles. Peers are written as
+// "channel:peer_id", e.g. "telegram:12345". Unknown is the role given to
+// peers that are neither listed here nor in a channel allow_list, or "deny".
+type AccessConfig struct {
+	Unknown string                `toml:"unknown"`
+	Users   []AccessUserConfig    `toml:"users"`
+	Roles   map[string]RoleConfig `toml:"roles"`
+}
+
+type AccessUserConfig struct {
+	Name  string   `toml:"name"`
+	Role  string   `toml:"role"`
+	Peers []string `toml:"peers"`
+}
+
+// RoleConfig describes what a role may do. A nil Tools list allows every
+// tool and an empty one allows none. RateLimit caps messages per minute.
+type RoleConfig struct {
+	Tools     []string `toml:"tools"`
+	Approve   bool     `toml:"approve"`
+	RateLimit int      `toml:"rate_limit"`
 }
 
 type SandboxConfig struct {
@@ -92,6 +199,69 @@ type MemoryConfig struct {
 type StoreConfig struct {
 	Driver string `toml:"driver"`
 	DSN    string `toml:"dsn"`
+	DSNEnv string `toml:"dsn_env"`
+
+	// Connection pool settings, used by the postgres driver.
+	MaxOpenConns    int    `toml:"max_open_conns"`
+	MaxIdleConns    int    `toml:"max_idle_conns"`
+	ConnMaxLifetime string `toml:"conn_max_lifetime"`
+}
+
+// ResolvedDSN returns the DSN from DSNEnv when that variable is set, falling
+// back to DSN.
+func (s StoreConfig) ResolvedDSN() string {
+	if s.DSNEnv != "" {
+		if v := os.Getenv(s.DSNEnv); v != "" {
+			return v
+		}
+	}
+	return s.DSN
+}
+
+// RetentionConfig sets how many days each kind of data is kept. Zero keeps
+// it forever. Channels override messages_days and tool_results_days for
+// sessions on that channel; a zero there inherits the global value and -1
+// keeps the data forever.
+type RetentionConfig struct {
+	Enabled         bool                              `toml:"enabled"`
+	Schedule        string                            `toml:"schedule"`
+	MessagesDays    int                               `toml:"messages_days"`
+	ToolResultsDays int                               `toml:"tool_results_days"`
+	MemoryDays      int                               `toml:"memory_days"`
+	AuditDays       int                               `toml:"audit_days"`
+	Channels        map[string]ChannelRetentionConfig `toml:"channels"`
+}
+
+type ChannelRetentionConfig struct {
+	MessagesDays    int `toml:"messages_days"`
+	ToolResultsDays int `toml:"tool_results_days"`
+}
+
+// RedactionConfig masks personal data in messages before they are stored.
+// Builtin selects from "email", "phone" and "api_key"; leaving it unset
+// enables all of them.
+type RedactionConfig struct {
+	Enabled  bool                     `toml:"enabled"`
+	Builtin  []string                 `toml:"builtin"`
+	Patterns []RedactionPatternConfig `toml:"patterns"`
+}
+
+type RedactionPatternConfig struct {
+	Name  string `toml:"name"`
+	Regex string `toml:"regex"`
+}
+
+// BackupConfig controls scheduled backups and archive encryption. Archives
+// are encrypted with age for Recipients, or with the passphrase in
+// PassphraseEnv when that variable is set. IdentityFile holds age identities
+// used to decrypt on restore.
+type BackupConfig struct {
+	Dir           string   `toml:"dir"`
+	Schedule      string   `toml:"schedule"`
+	Keep          int      `toml:"keep"`
+	Recipients    []string `toml:"recipients"`
+	PassphraseEnv string   `toml:"passphrase_env"`
+	IdentityFile  string   `toml:"identity_file"`
 }
 
 type LogConfig struct {
@@ -118,7 +288,13 @@ type SoulConfig struct {
 }
 
 type MCPConfig struct {
-	Enabled bool              `toml:"enabled"`
+	Enabled bool `toml:"enabled"`
+	// PingInterval is how often connected servers are pinged to detect dead
+	// connections. Defaults to DefaultMCPPingInterval.
+	PingInterval string `toml:"ping_interval"`
+	// Serve exposes Pincer's own tools, chat and memory to MCP clients at
+	// /mcp on the gateway. It needs gateway.auth_token.
+	Serve   bool              `toml:"serve"`
 	Servers []MCPServerConfig `toml:"servers"`
 }
 
@@ -128,7 +304,19 @@ type MCPServerConfig struct {
 	Args    []string          `toml:"args"`
 	Env     map[string]string `toml:"env"`
 	URL     string            `toml:"url"`
-	Enabled *bool             `toml:"enabled"`
+	// Headers are sent with every request to an HTTP server. Like env, values
+	// may use {{cred:NAME}} placeholders.
+	Headers map[string]string `toml:"headers"`
+	// AllowTools and DenyTools filter the server's tools by name with glob
+	// patterns. Deny wins over allow.
+	AllowTools []string `toml:"allow_tools"`
+	DenyTools  []string `toml:"deny_tools"`
+	// RequireApproval asks before every call to the server's tools, even
+	// when agent.tool_approval is "auto".
+	RequireApproval bool `toml:"require_approval"`
+	// Timeout bounds each tool call, within the agent's tool_timeout.
+	Timeout string `toml:"timeout"`
+	Enabled *bool  `toml:"enabled"`
 }
 
 type A2AConfig struct {
@@ -141,6 +329,10 @@ type BrowserConfig struct {
 	Enabled     bool   `toml:"enabled"`
 	Headless    bool   `toml:"headless"`
 	IdleTimeout string `toml:"idle_timeout"`
+	// Profile names the persistent profile used when the agent names none.
+	// Profiles live under DataDir/browser-profiles.
+	Profile     string `toml:"profile"`
+	DownloadDir string `toml:"download_dir"`
 }
 
 func Default() *Config {
@@ -193,6 +385,14 @@ func Default() *Config {
 			Headless:    true,
 			IdleTimeout: "10m",
 		},
+		Retention: RetentionConfig{
+			Schedule: "@daily",
+		},
+		Backup: BackupConfig{
+			Dir:           filepath.Join(DataDir(), "backups"),
+			Keep:          7,
+			PassphraseEnv: "PINCER_BACKUP_PASSPHRASE",
+		},
 	}
 }
 
@@ -215,6 +415,33 @@ func Load(path string) (*Config, error) {
 	if err := toml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
+	if err := validateAgents(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateChannels(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateAccess(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateStore(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateRetention(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateRedaction(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateBackup(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateVerification(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateMCP(cfg); err != nil {
+		return nil, err
+	}
 
 	if cfg.Store.DSN == "" {
 		cfg.Store.DSN = filepath.Join(DataDir(), "pincer.db")
@@ -225,6 +452,9 @@ func Load(path string) (*Config, error) {
 	if cfg.Skills.Dir == "" {
 		cfg.Skills.Dir = filepath.Join(DataDir(), "skills")
 	}
+	if cfg.Backup.Dir == "" {
+		cfg.Backup.Dir = filepath.Join(DataDir(), "backups")
+	}
 
 	mu.Lock()
 	current = cfg
@@ -233,6 +463,226 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+func validateAgents(cfg *Config) error {
+	ids := map[string]bool{DefaultAgentID: true}
+	for _, a := range cfg.Agents {
+		if a.ID == "" {
+			return fmt.Errorf("agents: every agent needs an id")
+		}
+		if ids[a.ID] {
+			return fmt.Errorf("agents: duplicate agent id %q", a.ID)
+		}
+		// All agents share the one sandbox built from [sandbox]; only its
+		// policy can differ per agent.
+		if a.Sandbox != nil && a.Sandbox.Mode != "" {
+			return fmt.Errorf("agents %q: sandbox.mode cannot be set per agent; set it in [sandbox]", a.ID)
+		}
+		ids[a.ID] = true
+	}
+	for i, r := range cfg.Routes {
+		if !ids[r.Agent] {
+			return fmt.Errorf("routes[%d]: unknown agent %q", i, r.Agent)
+		}
+	}
+	for model, p := range cfg.Agent.Pricing {
+		if p.Input < 0 || p.Output < 0 {
+			return fmt.Errorf("agent.pricing.%s: prices cannot be negative", model)
+		}
+	}
+	return nil
+}
+
+func validateChannels(cfg *Config) error {
+	for name, ch := range cfg.Channels {
+		switch ch.Group.Session {
+		case "", "shared", "per_user":
+		default:
+			return fmt.Errorf("channels.%s.group: unknown session mode %q", name, ch.Group.Session)
+		}
+		switch ch.Group.Respond {
+		case "", "mention", "always", "passive":
+		default:
+			return fmt.Errorf("channels.%s.group: unknown respond mode %q", name, ch.Group.Respond)
+		}
+	}
+	return nil
+}
+
+func validateStore(cfg *Config) error {
+	switch cfg.Store.Driver {
+	case "", "sqlite":
+	case "postgres":
+		// The default DSN is a SQLite file path, so a postgres store must set
+		// its own.
+		if cfg.Store.DSNEnv == "" && (cfg.Store.DSN == "" || cfg.Store.DSN == Default().Store.DSN) {
+			return fmt.Errorf("store: the postgres driver needs dsn or dsn_env")
+		}
+	default:
+		return fmt.Errorf("store: unknown driver %q", cfg.Store.Driver)
+	}
+	if d := cfg.Store.ConnMaxLifetime; d != "" {
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("store: invalid conn_max_lifetime %q: %w", d, err)
+		}
+	}
+	return nil
+}
+
+func validateRetention(cfg *Config) error {
+	r := cfg.Retention
+	for name, days := range map[string]int{
+		"messages_days":     r.MessagesDays,
+		"tool_results_days": r.ToolResultsDays,
+		"memory_days":       r.MemoryDays,
+		"audit_days":        r.AuditDays,
+	} {
+		if days < 0 {
+			return fmt.Errorf("retention: %s must not be negative", name)
+		}
+	}
+	for channel, c := range r.Channels {
+		if c.MessagesDays < -1 || c.ToolResultsDays < -1 {
+			return fmt.Errorf("retention.channels.%s: days must be -1 (forever), 0 (inherit) or positive", channel)
+		}
+	}
+	return nil
+}
+
+func validateBackup(cfg *Config) error {
+	if cfg.Backup.Keep < 0 {
+		return fmt.Errorf("backup: keep must not be negative")
+	}
+	for _, r := range cfg.Backup.Recipients {
+		if !strings.HasPrefix(r, "age1") {
+			return fmt.Errorf("backup: recipient %q is not an age public key", r)
+		}
+	}
+	return nil
+}
+
+func validateVerification(cfg *Config) error {
+	v := cfg.Agent.Verification
+	for i, g := range v.CommandGates {
+		if strings.TrimSpace(g.Command) == "" {
+			return fmt.Errorf("agent.verification.command_gates[%d]: command is required", i)
+		}
+		if _, err := regexp.Compile(g.ExpectOutput); err != nil {
+			return fmt.Errorf("agent.verification.command_gates[%d]: invalid expect_output: %w", i, err)
+		}
+		if g.Timeout != "" {
+			if _, err := time.ParseDuration(g.Timeout); err != nil {
+				return fmt.Errorf("agent.verification.command_gates[%d]: invalid timeout %q: %w", i, g.Timeout, err)
+			}
+		}
+		if err := validateGlobs(g.WhenPaths); err != nil {
+			return fmt.Errorf("agent.verification.command_gates[%d]: %w", i, err)
+		}
+	}
+	for i, g := range v.FileGates {
+		if len(g.Files) == 0 && !g.CheckWritten {
+			return fmt.Errorf("agent.verification.file_gates[%d]: set files or check_written", i)
+		}
+		for _, f := range g.Files {
+			if f.Path == "" {
+				return fmt.Errorf("agent.verification.file_gates[%d]: every file needs a path", i)
+			}
+			if f.SHA256 != "" && !sha256Re.MatchString(f.SHA256) {
+				return fmt.Errorf("agent.verification.file_gates[%d]: %s: sha256 must be 64 hex characters", i, f.Path)
+			}
+		}
+		if err := validateGlobs(g.WhenPaths); err != nil {
+			return fmt.Errorf("agent.verification.file_gates[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+var sha256Re = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+func validateMCP(cfg *Config) error {
+	if d := cfg.MCP.PingInterval; d != "" {
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("mcp: invalid ping_interval %q: %w", d, err)
+		}
+	}
+	seen := make(map[string]bool)
+	for i, srv := range cfg.MCP.Servers {
+		if srv.Name == "" {
+			return fmt.Errorf("mcp.servers[%d]: name is required", i)
+		}
+		if seen[srv.Name] {
+			return fmt.Errorf("mcp.servers[%d]: duplicate name %q", i, srv.Name)
+		}
+		seen[srv.Name] = true
+		if len(srv.Headers) > 0 && srv.URL == "" {
+			return fmt.Errorf("mcp.servers.%s: headers need a url", srv.Name)
+		}
+		if srv.Timeout != "" {
+			if _, err := time.ParseDuration(srv.Timeout); err != nil {
+				return fmt.Errorf("mcp.servers.%s: invalid timeout %q: %w", srv.Name, srv.Timeout, err)
+			}
+		}
+		if err := validateGlobs(srv.AllowTools); err != nil {
+			return fmt.Errorf("mcp.servers.%s: allow_tools: %w", srv.Name, err)
+		}
+		if err := validateGlobs(srv.DenyTools); err != nil {
+			return fmt.Errorf("mcp.servers.%s: deny_tools: %w", srv.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q", p)
+		}
+	}
+	return nil
+}
+
+func validateRedaction(cfg *Config) error {
+	for _, name := range cfg.Redaction.Builtin {
+		switch name {
+		case "email", "phone", "api_key":
+		default:
+			return fmt.Errorf("redaction: unknown builtin rule %q", name)
+		}
+	}
+	for i, p := range cfg.Redaction.Patterns {
+		if p.Name == "" {
+			return fmt.Errorf("redaction.patterns[%d]: name is required", i)
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("redaction.patterns %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateAccess(cfg *Config) error {
+	roles := DefaultRoles()
+	for name, role := range cfg.Access.Roles {
+		roles[name] = role
+	}
+	if u := cfg.Access.Unknown; u != "" && u != AccessDeny {
+		if _, ok := roles[u]; !ok {
+			return fmt.Errorf("access: unknown role %q for unknown peers", u)
+		}
+	}
+	for _, u := range cfg.Access.Users {
+		if _, ok := roles[u.Role]; !ok {
+			return fmt.Errorf("access.users %q: unknown role %q", u.Name, u.Role)
+		}
+		for _, p := range u.Peers {
+			if channel, id, ok := strings.Cut(p, ":"); !ok || channel == "" || id == "" {
+				return fmt.Errorf("access.users %q: peer %q must be \"channel:peer_id\"", u.Name, p)
+			}
+		}
+	}
+	return nil
+}
+
 func Current() *Config {
 	mu.RLock()
 	defer mu.RUnlock()
@@ -249,6 +699,24 @@ func DataDir() string {
 	return ".pincer"
 }
 
+// WorkspaceDir is the agent's working directory. Sandboxed commands run in
+// it, and the container sandbox mounts it as /workspace.
+func WorkspaceDir() string {
+	return filepath.Join(DataDir(), "workspace")
+}
+
+// AttachmentDir holds files received from channels and the API, one
+// subdirectory per session. It lives in the workspace so the agent's tools
+// can open them.
+func AttachmentDir() string {
+	return filepath.Join(WorkspaceDir(), "attachments")
+}
+
+// MCPImageDir holds images returned by MCP tools and resources.
+func MCPImageDir() string {
+	return filepath.Join(DataDir(), "mcp-images")
+}
+
 func DefaultConfigPath() string {
 	return filepath.Join(DataDir(), "pincer.toml")
 }
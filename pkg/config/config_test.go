@@ -101,6 +101,27 @@ func TestDataDir(t *testing.T) {
 	}
 }
 
+func TestLoadPricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.toml")
+	content := `
+[agent.pricing."claude-sonnet-4-20250514"]
+input = 3
+output = 15
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	p, ok := cfg.Agent.Pricing["claude-sonnet-4-20250514"]
+	if !ok || p.Input != 3 || p.Output != 15 {
+		t.Errorf("Pricing = %+v", cfg.Agent.Pricing)
+	}
+}
+
 func TestLoadRetryConfig(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "retry.toml")
@@ -195,6 +216,61 @@ gates = ["llm_self_check", "command_output"]
 	}
 }
 
+func TestLoadVerificationGates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gates.toml")
+	content := `
+[agent.verification]
+enabled = true
+
+[[agent.verification.command_gates]]
+name = "tests"
+command = "go test ./..."
+expect_output = "^ok"
+when_paths = ["*.go"]
+
+[[agent.verification.command_gates]]
+command = "grep -q TODO notes.md"
+expect_exit_code = 1
+when_tools = ["file_write"]
+
+[[agent.verification.file_gates]]
+check_written = true
+files = [{ path = "CHANGELOG.md" }]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	v := cfg.Agent.Verification
+	if len(v.CommandGates) != 2 || v.CommandGates[0].Command != "go test ./..." || v.CommandGates[0].WhenPaths[0] != "*.go" {
+		t.Errorf("CommandGates = %+v", v.CommandGates)
+	}
+	if c := v.CommandGates[1].ExpectExitCode; c == nil || *c != 1 {
+		t.Errorf("ExpectExitCode = %v, want 1", c)
+	}
+	if len(v.FileGates) != 1 || !v.FileGates[0].CheckWritten || v.FileGates[0].Files[0].Path != "CHANGELOG.md" {
+		t.Errorf("FileGates = %+v", v.FileGates)
+	}
+
+	for _, bad := range []string{
+		"[[agent.verification.command_gates]]\nexpect_output = \"ok\"\n",
+		"[[agent.verification.command_gates]]\ncommand = \"true\"\nexpect_output = \"(\"\n",
+		"[[agent.verification.file_gates]]\nname = \"empty\"\n",
+		"[[agent.verification.file_gates]]\nfiles = [{ path = \"a\", sha256 = \"abc\" }]\n",
+	} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%q) should fail", bad)
+		}
+	}
+}
+
 func TestDataDirEnv(t *testing.T) {
 	t.Setenv("PINCER_DATA_DIR", "/tmp/custom-pincer")
 	dir := DataDir()
@@ -202,3 +278,276 @@ func TestDataDirEnv(t *testing.T) {
 		t.Errorf("DataDir = %q, want /tmp/custom-pincer", dir)
 	}
 }
+
+func TestLoadAgentsAndRoutes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agents.toml")
+	content := `
+[[agents]]
+id = "ops"
+model = "gpt-4o"
+tools = ["shell"]
+
+[agents.sandbox]
+network_policy = "allow"
+
+[[agents]]
+id = "docs"
+
+[[routes]]
+agent = "ops"
+channel = "slack"
+chat = "C123"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.Agents) != 2 || cfg.Agents[0].ID != "ops" || cfg.Agents[1].ID != "docs" {
+		t.Fatalf("Agents = %+v", cfg.Agents)
+	}
+	if cfg.Agents[0].Sandbox == nil || cfg.Agents[0].Sandbox.NetworkPolicy != "allow" {
+		t.Errorf("ops sandbox = %+v", cfg.Agents[0].Sandbox)
+	}
+	if cfg.Agents[1].Sandbox != nil {
+		t.Error("docs should inherit the global sandbox")
+	}
+	if len(cfg.Routes) != 1 || cfg.Routes[0].Chat != "C123" {
+		t.Errorf("Routes = %+v", cfg.Routes)
+	}
+}
+
+func TestLoadAgentsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"missing id":     "[[agents]]\nmodel = \"gpt-4o\"\n",
+		"duplicate id":   "[[agents]]\nid = \"ops\"\n[[agents]]\nid = \"ops\"\n",
+		"unknown agent":  "[[routes]]\nagent = \"ghost\"\nchannel = \"slack\"\n",
+		"group session":  "[channels.discord.group]\nsession = \"per_thread\"\n",
+		"group respond":  "[channels.discord.group]\nrespond = \"sometimes\"\n",
+		"negative price": "[agent.pricing.\"gpt-4o\"]\ninput = -1\n",
+		"sandbox mode":   "[[agents]]\nid = \"ops\"\n[agents.sandbox]\nmode = \"container\"\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.toml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadChannelGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "group.toml")
+	content := `
+[channels.discord]
+enabled = true
+
+[channels.discord.group]
+session = "per_user"
+respond = "passive"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	group := cfg.Channels["discord"].Group
+	if group.Session != "per_user" || group.Respond != "passive" {
+		t.Errorf("group = %+v", group)
+	}
+}
+
+func TestLoadAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.toml")
+	content := `
+[access]
+unknown = "guest"
+
+[[access.users]]
+name = "alice"
+role = "admin"
+peers = ["telegram:42"]
+
+[access.roles.guest]
+tools = []
+rate_limit = 2
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	guest := cfg.Access.Roles["guest"]
+	if guest.Tools == nil || len(guest.Tools) != 0 || guest.RateLimit != 2 {
+		t.Errorf("guest role = %+v", guest)
+	}
+	if len(cfg.Access.Users) != 1 || cfg.Access.Users[0].Peers[0] != "telegram:42" {
+		t.Errorf("users = %+v", cfg.Access.Users)
+	}
+}
+
+func TestLoadAccessInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown role":     "[[access.users]]\nname = \"a\"\nrole = \"owner\"\npeers = [\"telegram:1\"]\n",
+		"bad peer":         "[[access.users]]\nname = \"a\"\nrole = \"admin\"\npeers = [\"12345\"]\n",
+		"unknown fallback": "[access]\nunknown = \"visitor\"\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.toml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadStorePostgres(t *testing.T) {
+	t.Setenv("TEST_PINCER_DSN", "postgres://pincer@db/pincer")
+	path := filepath.Join(t.TempDir(), "pg.toml")
+	content := "[store]\ndriver = \"postgres\"\ndsn_env = \"TEST_PINCER_DSN\"\nmax_open_conns = 40\nconn_max_lifetime = \"1h\"\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := cfg.Store.ResolvedDSN(); got != "postgres://pincer@db/pincer" {
+		t.Errorf("ResolvedDSN = %q", got)
+	}
+	if cfg.Store.MaxOpenConns != 40 {
+		t.Errorf("MaxOpenConns = %d", cfg.Store.MaxOpenConns)
+	}
+}
+
+func TestLoadStoreInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown driver":  "[store]\ndriver = \"mysql\"\n",
+		"postgres no dsn": "[store]\ndriver = \"postgres\"\n",
+		"bad lifetime":    "[store]\nconn_max_lifetime = \"forever\"\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.toml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadRetentionAndRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "privacy.toml")
+	content := `[retention]
+enabled = true
+messages_days = 90
+tool_results_days = 30
+
+[retention.channels.telegram]
+messages_days = 14
+tool_results_days = -1
+
+[redaction]
+enabled = true
+builtin = ["email"]
+
+[[redaction.patterns]]
+name = "iban"
+regex = '\bDE\d{20}\b'
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Retention.Schedule != "@daily" {
+		t.Errorf("Schedule = %q, want default @daily", cfg.Retention.Schedule)
+	}
+	if got := cfg.Retention.Channels["telegram"]; got.MessagesDays != 14 || got.ToolResultsDays != -1 {
+		t.Errorf("telegram retention = %+v", got)
+	}
+	if len(cfg.Redaction.Patterns) != 1 || cfg.Redaction.Patterns[0].Name != "iban" {
+		t.Errorf("Patterns = %+v", cfg.Redaction.Patterns)
+	}
+}
+
+func TestLoadRetentionAndRedactionInvalid(t *testing.T) {
+	tests := map[string]string{
+		"negative days":   "[retention]\naudit_days = -5\n",
+		"channel days":    "[retention.channels.telegram]\nmessages_days = -2\n",
+		"unknown builtin": "[redaction]\nbuiltin = [\"ssn\"]\n",
+		"bad regex":       "[[redaction.patterns]]\nname = \"x\"\nregex = \"(\"\n",
+		"unnamed pattern": "[[redaction.patterns]]\nregex = \"x\"\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.toml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadMCPServers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.toml")
+	content := "[mcp]\nenabled = true\nping_interval = \"1m\"\n\n[[mcp.servers]]\nname = \"linear\"\nurl = \"https://mcp.linear.app/mcp\"\nheaders = { Authorization = \"Bearer {{cred:linear}}\" }\ndeny_tools = [\"delete_*\"]\nrequire_approval = true\ntimeout = \"45s\"\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	srv := cfg.MCP.Servers[0]
+	if srv.Headers["Authorization"] != "Bearer {{cred:linear}}" || !srv.RequireApproval || srv.Timeout != "45s" || len(srv.DenyTools) != 1 {
+		t.Errorf("server = %+v", srv)
+	}
+}
+
+func TestLoadMCPInvalid(t *testing.T) {
+	tests := map[string]string{
+		"bad ping interval": "[mcp]\nping_interval = \"often\"\n",
+		"unnamed server":    "[[mcp.servers]]\ncommand = \"x\"\n",
+		"duplicate name":    "[[mcp.servers]]\nname = \"a\"\ncommand = \"x\"\n[[mcp.servers]]\nname = \"a\"\ncommand = \"y\"\n",
+		"headers on stdio":  "[[mcp.servers]]\nname = \"a\"\ncommand = \"x\"\nheaders = { X = \"y\" }\n",
+		"bad timeout":       "[[mcp.servers]]\nname = \"a\"\ncommand = \"x\"\ntimeout = \"soon\"\n",
+		"bad glob":          "[[mcp.servers]]\nname = \"a\"\ncommand = \"x\"\nallow_tools = [\"[\"]\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.toml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
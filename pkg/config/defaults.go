@@ -3,6 +3,8 @@ package config
 import "time"
 
 const (
+	DefaultAgentID = "default"
+
 	DefaultMaxContextTokens  = 128000
 	DefaultMaxOutputTokens   = 4096
 	DefaultMaxToolIterations = 25
@@ -41,4 +43,31 @@ const (
 	DefaultRecoveryRetries = 2
 	RecoveryBaseDelay      = 1 * time.Second
 	RecoveryMaxDelay       = 10 * time.Second
+
+	DefaultMCPPingInterval = 30 * time.Second
+	MCPPingTimeout         = 10 * time.Second
+	MCPConnectTimeout      = 30 * time.Second
+	MCPReconnectBaseDelay  = 1 * time.Second
+	MCPReconnectMaxDelay   = 2 * time.Minute
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleGuest  = "guest"
+
+	// AccessDeny as [access] unknown drops messages from unlisted peers.
+	AccessDeny = "deny"
+
+	DefaultGuestRateLimit = 5
 )
+
+// DefaultRoles returns the built-in roles. Entries in [access.roles] with
+// the same name replace them.
+func DefaultRoles() map[string]RoleConfig {
+	return map[string]RoleConfig{
+		RoleAdmin:  {Approve: true},
+		RoleMember: {},
+		RoleGuest:  {Tools: []string{}, RateLimit: DefaultGuestRateLimit},
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,39 +20,117 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrOutOfScope     = errors.New("not in scope")
+	ErrWrongMasterKey = errors.New("master key does not match the stored credentials")
+	ErrReadOnly       = errors.New("store is read-only")
+)
+
 type Credential struct {
 	ID             string    `gorm:"primaryKey;column:id"`
 	Name           string    `gorm:"column:name;not null;uniqueIndex"`
 	EncryptedValue []byte    `gorm:"column:encrypted_value;not null"`
+	Scopes         string    `gorm:"column:scopes;not null;default:''"`
 	CreatedAt      time.Time `gorm:"column:created_at;not null"`
 }
 
+// KDFParams holds the random salt the cipher key is derived with and a
+// verifier that detects a wrong master key. Stores whose credentials predate
+// it keep the legacy salt until the master key is rotated.
+type KDFParams struct {
+	ID        int       `gorm:"primaryKey;column:id;autoIncrement:false"`
+	Salt      []byte    `gorm:"column:salt;not null"`
+	Verifier  []byte    `gorm:"column:verifier;not null"`
+	RotatedAt time.Time `gorm:"column:rotated_at;not null"`
+}
+
+func (KDFParams) TableName() string { return "credential_kdf" }
+
+const kdfID = 1
+
+var verifierPlaintext = []byte("pincer-credentials")
+
 type Store struct {
-	db  *gorm.DB
-	gcm cipher.AEAD
+	db       *gorm.DB
+	gcm      cipher.AEAD
+	readOnly bool
+
+	mu sync.RWMutex
+	// skillTools maps each installed skill to the tools it declares, which
+	// a skill:NAME scope admits.
+	skillTools map[string][]string
 }
 
 func New(db *gorm.DB, masterKey string) (*Store, error) {
+	return newStore(db, masterKey, false)
+}
+
+// NewReadOnly opens the store without ever writing to db: a store with no
+// credentials yet keeps its key parameters as they are instead of having a
+// fresh salt recorded, and every method that modifies the store fails with
+// ErrReadOnly. A master key that does not match recorded key parameters
+// fails with ErrWrongMasterKey even when no credentials are stored.
+func NewReadOnly(db *gorm.DB, masterKey string) (*Store, error) {
+	return newStore(db, masterKey, true)
+}
+
+func newStore(db *gorm.DB, masterKey string, readOnly bool) (*Store, error) {
 	if masterKey == "" {
 		return nil, fmt.Errorf("credentials: master key must not be empty")
 	}
 
-	derivedKey := deriveKey(masterKey)
-
-	block, err := aes.NewCipher(derivedKey)
-	if err != nil {
-		return nil, fmt.Errorf("credentials: creating cipher: %w", err)
+	s := &Store{db: db, readOnly: readOnly}
+	if !db.Migrator().HasTable(&KDFParams{}) {
+		return s, s.useLegacyKey(masterKey)
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("credentials: creating GCM: %w", err)
+	var params KDFParams
+	err := db.First(&params, "id = ?", kdfID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("credentials: loading key parameters: %w", err)
+	}
+	if err == nil {
+		gcm, err := newGCM(deriveKey(masterKey, params.Salt))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := open(gcm, params.Verifier); err == nil {
+			s.gcm = gcm
+			return s, nil
+		}
 	}
 
-	return &Store{db: db, gcm: gcm}, nil
+	var count int64
+	if err := db.Model(&Credential{}).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("credentials: counting credentials: %w", err)
+	}
+	switch {
+	case count == 0 && readOnly && params.ID == kdfID:
+		// The salt cannot be replaced, so the key has to match it.
+		return nil, fmt.Errorf("credentials: %w", ErrWrongMasterKey)
+	case count == 0 && readOnly:
+		// Nothing to decrypt, and recording a new salt would be a write.
+		return s, s.useLegacyKey(masterKey)
+	case count == 0:
+		// Nothing is encrypted yet, so (re)start with a fresh salt.
+		gcm, err := saveNewKey(context.Background(), db, masterKey)
+		if err != nil {
+			return nil, err
+		}
+		s.gcm = gcm
+		return s, nil
+	case params.ID == kdfID:
+		return nil, fmt.Errorf("credentials: %w", ErrWrongMasterKey)
+	default:
+		return s, s.useLegacyKey(masterKey)
+	}
 }
 
 func (s *Store) Set(ctx context.Context, name, value string) error {
+	if s.readOnly {
+		return fmt.Errorf("credentials: %w", ErrReadOnly)
+	}
 	encrypted, err := s.encrypt([]byte(value))
 	if err != nil {
 		return fmt.Errorf("credentials: encrypting: %w", err)
@@ -62,39 +143,154 @@ func (s *Store) Set(ctx context.Context, name, value string) error {
 		CreatedAt:      time.Now().UTC(),
 	}
 
+	// Overwriting a value keeps the credential's scopes.
 	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "name"}},
 		DoUpdates: clause.AssignmentColumns([]string{"encrypted_value"}),
 	}).Create(cred).Error
 }
 
+// Get returns the value of a credential regardless of its scopes. Tools
+// resolve credentials through Resolve or Expand instead.
 func (s *Store) Get(ctx context.Context, name string) (string, error) {
+	cred, err := s.find(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return s.value(cred)
+}
+
+// Resolve returns the value of a credential if consumer is within its scopes.
+func (s *Store) Resolve(ctx context.Context, name, consumer string) (string, error) {
+	cred, err := s.find(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if !s.allowed(splitScopes(cred.Scopes), consumer) {
+		return "", fmt.Errorf("credentials: %q is %w for %s", name, ErrOutOfScope, consumer)
+	}
+	return s.value(cred)
+}
+
+// SetSkillTools records the tools each installed skill declares, so that a
+// credential scoped to skill:NAME resolves for those tools.
+func (s *Store) SetSkillTools(skills map[string][]string) {
+	s.mu.Lock()
+	s.skillTools = skills
+	s.mu.Unlock()
+}
+
+// allowed extends Allowed with skill scopes, which admit the tools of the
+// named skill.
+func (s *Store) allowed(scopes []string, consumer string) bool {
+	if Allowed(scopes, consumer) {
+		return true
+	}
+	tool, ok := strings.CutPrefix(consumer, ScopeTool+":")
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sc := range scopes {
+		if skill, ok := strings.CutPrefix(sc, ScopeSkill+":"); ok && slices.Contains(s.skillTools[skill], tool) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand replaces every {{cred:NAME}} placeholder in text with the value of
+// the credential, as seen by consumer. It also returns the substituted values
+// by name so that callers can mask them in output.
+func (s *Store) Expand(ctx context.Context, text, consumer string) (string, map[string]string, error) {
+	used := map[string]string{}
+	var firstErr error
+	out := placeholderRe.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if v, ok := used[name]; ok {
+			return v
+		}
+		v, err := s.Resolve(ctx, name, consumer)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return m
+		}
+		used[name] = v
+		return v
+	})
+	if firstErr != nil {
+		return "", nil, firstErr
+	}
+	return out, used, nil
+}
+
+// SetScopes replaces the scopes of a credential. An empty list makes it
+// available to every consumer.
+func (s *Store) SetScopes(ctx context.Context, name string, scopes []string) error {
+	if s.readOnly {
+		return fmt.Errorf("credentials: %w", ErrReadOnly)
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return err
+	}
+	result := s.db.WithContext(ctx).
+		Model(&Credential{}).
+		Where("name = ?", name).
+		Update("scopes", strings.Join(scopes, ","))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("credentials: %q %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+// Scopes returns the scopes of a credential.
+func (s *Store) Scopes(ctx context.Context, name string) ([]string, error) {
+	cred, err := s.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return splitScopes(cred.Scopes), nil
+}
+
+func (s *Store) find(ctx context.Context, name string) (*Credential, error) {
 	var cred Credential
 	err := s.db.WithContext(ctx).
 		Where("name = ?", name).
 		First(&cred).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", fmt.Errorf("credentials: %q not found", name)
+			return nil, fmt.Errorf("credentials: %q %w", name, ErrNotFound)
 		}
-		return "", err
+		return nil, err
 	}
+	return &cred, nil
+}
 
+func (s *Store) value(cred *Credential) (string, error) {
 	plaintext, err := s.decrypt(cred.EncryptedValue)
 	if err != nil {
-		return "", fmt.Errorf("credentials: decrypting %q: %w", name, err)
+		return "", fmt.Errorf("credentials: decrypting %q: %w", cred.Name, err)
 	}
 
 	return string(plaintext), nil
 }
 
 func (s *Store) Delete(ctx context.Context, name string) error {
+	if s.readOnly {
+		return fmt.Errorf("credentials: %w", ErrReadOnly)
+	}
 	result := s.db.WithContext(ctx).Where("name = ?", name).Delete(&Credential{})
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("credentials: %q not found", name)
+		return fmt.Errorf("credentials: %q %w", name, ErrNotFound)
 	}
 	return nil
 }
@@ -108,27 +304,161 @@ func (s *Store) List(ctx context.Context) ([]string, error) {
 	return names, err
 }
 
+// Entry describes a stored credential without its value.
+type Entry struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Store) Entries(ctx context.Context) ([]Entry, error) {
+	var creds []Credential
+	err := s.db.WithContext(ctx).
+		Select("name", "scopes", "created_at").
+		Order("name").
+		Find(&creds).Error
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(creds))
+	for _, c := range creds {
+		entries = append(entries, Entry{Name: c.Name, Scopes: splitScopes(c.Scopes), CreatedAt: c.CreatedAt})
+	}
+	return entries, nil
+}
+
+// RotateMasterKey re-encrypts every credential under newKey with a fresh
+// random salt and returns how many were re-encrypted. Other processes using
+// the old key must be restarted afterwards.
+func (s *Store) RotateMasterKey(ctx context.Context, newKey string) (int, error) {
+	if newKey == "" {
+		return 0, fmt.Errorf("credentials: master key must not be empty")
+	}
+	if s.readOnly {
+		return 0, fmt.Errorf("credentials: %w", ErrReadOnly)
+	}
+	if !s.db.Migrator().HasTable(&KDFParams{}) {
+		return 0, fmt.Errorf("credentials: key rotation needs the %s table; run pincer db migrate", KDFParams{}.TableName())
+	}
+
+	var (
+		rotated int
+		gcm     cipher.AEAD
+	)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var creds []Credential
+		if err := tx.Find(&creds).Error; err != nil {
+			return err
+		}
+		plaintexts := make([][]byte, len(creds))
+		for i, c := range creds {
+			p, err := s.decrypt(c.EncryptedValue)
+			if err != nil {
+				return fmt.Errorf("credentials: decrypting %q: %w", c.Name, err)
+			}
+			plaintexts[i] = p
+		}
+
+		var err error
+		gcm, err = saveNewKey(ctx, tx, newKey)
+		if err != nil {
+			return err
+		}
+		for i, c := range creds {
+			enc, err := seal(gcm, plaintexts[i])
+			if err != nil {
+				return fmt.Errorf("credentials: encrypting %q: %w", c.Name, err)
+			}
+			if err := tx.Model(&Credential{}).Where("id = ?", c.ID).Update("encrypted_value", enc).Error; err != nil {
+				return err
+			}
+		}
+		rotated = len(creds)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.gcm = gcm
+	return rotated, nil
+}
+
+// saveNewKey derives a key from masterKey with a new random salt, records the
+// salt and verifier through db and returns the cipher for the key.
+func saveNewKey(ctx context.Context, db *gorm.DB, masterKey string) (cipher.AEAD, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(deriveKey(masterKey, salt))
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := seal(gcm, verifierPlaintext)
+	if err != nil {
+		return nil, err
+	}
+	params := KDFParams{ID: kdfID, Salt: salt, Verifier: verifier, RotatedAt: time.Now().UTC()}
+	if err := db.WithContext(ctx).Save(&params).Error; err != nil {
+		return nil, fmt.Errorf("credentials: saving key parameters: %w", err)
+	}
+	return gcm, nil
+}
+
+func (s *Store) useLegacyKey(masterKey string) error {
+	gcm, err := newGCM(deriveKey(masterKey, legacySalt(masterKey)))
+	if err != nil {
+		return err
+	}
+	s.gcm = gcm
+	return nil
+}
+
 func (s *Store) encrypt(plaintext []byte) ([]byte, error) {
-	nonce := make([]byte, s.gcm.NonceSize())
+	return seal(s.gcm, plaintext)
+}
+
+func (s *Store) decrypt(ciphertext []byte) ([]byte, error) {
+	return open(s.gcm, ciphertext)
+}
+
+func seal(gcm cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
-	return s.gcm.Seal(nonce, nonce, plaintext, nil), nil
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
 }
 
-func (s *Store) decrypt(ciphertext []byte) ([]byte, error) {
-	nonceSize := s.gcm.NonceSize()
+func open(gcm cipher.AEAD, ciphertext []byte) ([]byte, error) {
+	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
 		return nil, fmt.Errorf("ciphertext too short")
 	}
 	nonce, data := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	return s.gcm.Open(nil, nonce, data, nil)
+	return gcm.Open(nil, nonce, data, nil)
 }
 
-func deriveKey(masterKey string) []byte {
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: creating cipher: %w", err)
+	}
 
-	saltHash := sha256.Sum256([]byte("pincer-credential-salt:" + masterKey))
-	salt := saltHash[:16]
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: creating GCM: %w", err)
+	}
+	return gcm, nil
+}
 
+func deriveKey(masterKey string, salt []byte) []byte {
 	return argon2.IDKey([]byte(masterKey), salt, 1, 64*1024, 4, 32)
 }
+
+// legacySalt is the salt used before salts were stored: a hash of the
+// master key itself.
+func legacySalt(masterKey string) []byte {
+	saltHash := sha256.Sum256([]byte("pincer-credential-salt:" + masterKey))
+	return saltHash[:16]
+}
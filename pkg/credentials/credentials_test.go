@@ -2,6 +2,7 @@ package credentials
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 
@@ -31,6 +32,17 @@ func testDB(t *testing.T) *gorm.DB {
 	return db
 }
 
+// testKDFDB returns a database at the current schema, where the key salt is
+// stored. testDB has the schema from before rotation support.
+func testKDFDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testDB(t)
+	if err := db.AutoMigrate(&KDFParams{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 func TestNewRequiresKey(t *testing.T) {
 	_, err := New(testDB(t), "")
 	if err == nil {
@@ -213,3 +225,194 @@ func TestListAfterDelete(t *testing.T) {
 		t.Errorf("remaining = %q, want %q", names[0], "keep")
 	}
 }
+
+func TestNewRejectsWrongMasterKey(t *testing.T) {
+	db := testKDFDB(t)
+	ctx := context.Background()
+
+	s, err := New(db, "right")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(db, "wrong"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("New with wrong key = %v, want ErrWrongMasterKey", err)
+	}
+}
+
+func TestNewReadOnlyNeverWrites(t *testing.T) {
+	db := testKDFDB(t)
+	ctx := context.Background()
+
+	if _, err := NewReadOnly(db, "master"); err != nil {
+		t.Fatalf("NewReadOnly on an empty store: %v", err)
+	}
+	var n int64
+	db.Model(&KDFParams{}).Count(&n)
+	if n != 0 {
+		t.Errorf("NewReadOnly recorded key parameters")
+	}
+
+	s, err := New(db, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	ro, err := NewReadOnly(db, "master")
+	if err != nil {
+		t.Fatalf("NewReadOnly: %v", err)
+	}
+	if v, err := ro.Get(ctx, "k"); err != nil || v != "v" {
+		t.Errorf("Get = %q, %v", v, err)
+	}
+	if err := ro.Set(ctx, "k", "other"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set = %v, want ErrReadOnly", err)
+	}
+	if err := ro.Delete(ctx, "k"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Delete = %v, want ErrReadOnly", err)
+	}
+	if _, err := NewReadOnly(db, "wrong"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("NewReadOnly with wrong key = %v, want ErrWrongMasterKey", err)
+	}
+
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReadOnly(db, "wrong"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("NewReadOnly with wrong key and no credentials = %v, want ErrWrongMasterKey", err)
+	}
+}
+
+func TestLegacySaltIsKept(t *testing.T) {
+	db := testKDFDB(t)
+	ctx := context.Background()
+
+	// A credential written before salts were stored.
+	legacy := &Store{db: db}
+	if err := legacy.useLegacyKey("master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.Set(ctx, "old", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(db, "master")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if v, err := s.Get(ctx, "old"); err != nil || v != "value" {
+		t.Errorf("Get = %q, %v", v, err)
+	}
+}
+
+func TestRotateMasterKey(t *testing.T) {
+	db := testKDFDB(t)
+	ctx := context.Background()
+
+	legacy := &Store{db: db}
+	if err := legacy.useLegacyKey("old-key"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := legacy.Set(ctx, name, "value-"+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(db, "old-key")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	n, err := s.RotateMasterKey(ctx, "new-key")
+	if err != nil {
+		t.Fatalf("RotateMasterKey: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("rotated %d, want 2", n)
+	}
+	if v, err := s.Get(ctx, "a"); err != nil || v != "value-a" {
+		t.Errorf("Get after rotation = %q, %v", v, err)
+	}
+
+	if _, err := New(db, "old-key"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("New with old key = %v, want ErrWrongMasterKey", err)
+	}
+	reopened, err := New(db, "new-key")
+	if err != nil {
+		t.Fatalf("New with new key: %v", err)
+	}
+	if v, err := reopened.Get(ctx, "b"); err != nil || v != "value-b" {
+		t.Errorf("Get with new key = %q, %v", v, err)
+	}
+}
+
+func TestScopesAndExpand(t *testing.T) {
+	s, err := New(testKDFDB(t), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	_ = s.Set(ctx, "gh", "ghp_1")
+	_ = s.Set(ctx, "open", "o-2")
+
+	if err := s.SetScopes(ctx, "gh", []string{"mcp:github", "tool:http_request"}); err != nil {
+		t.Fatalf("SetScopes: %v", err)
+	}
+	if err := s.SetScopes(ctx, "gh", []string{"bogus"}); err == nil {
+		t.Error("expected an error for an invalid scope")
+	}
+	if err := s.SetScopes(ctx, "missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetScopes missing = %v, want ErrNotFound", err)
+	}
+
+	out, used, err := s.Expand(ctx, "{{cred:gh}}/{{cred:open}}/{{cred:gh}}", "tool:http_request")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if out != "ghp_1/o-2/ghp_1" {
+		t.Errorf("Expand = %q", out)
+	}
+	if len(used) != 2 || used["gh"] != "ghp_1" {
+		t.Errorf("used = %v", used)
+	}
+
+	if _, _, err := s.Expand(ctx, "x {{cred:gh}}", "tool:shell"); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("Expand out of scope = %v, want ErrOutOfScope", err)
+	}
+	if _, _, err := s.Expand(ctx, "{{cred:nope}}", "tool:shell"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expand missing = %v, want ErrNotFound", err)
+	}
+
+	// A skill scope admits the tools the skill declares.
+	_ = s.Set(ctx, "deploy", "d-3")
+	if err := s.SetScopes(ctx, "deploy", []string{"skill:deploy"}); err != nil {
+		t.Fatalf("SetScopes skill: %v", err)
+	}
+	if _, err := s.Resolve(ctx, "deploy", "tool:shell"); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("Resolve before the skill is known = %v, want ErrOutOfScope", err)
+	}
+	s.SetSkillTools(map[string][]string{"deploy": {"shell"}})
+	if v, err := s.Resolve(ctx, "deploy", "tool:shell"); err != nil || v != "d-3" {
+		t.Errorf("Resolve for a skill tool = %q, %v", v, err)
+	}
+	for _, consumer := range []string{"tool:http_request", "mcp:shell"} {
+		if _, err := s.Resolve(ctx, "deploy", consumer); !errors.Is(err, ErrOutOfScope) {
+			t.Errorf("Resolve for %s = %v, want ErrOutOfScope", consumer, err)
+		}
+	}
+	_ = s.Delete(ctx, "deploy")
+
+	// Overwriting a value keeps its scopes.
+	_ = s.Set(ctx, "gh", "ghp_2")
+	entries, err := s.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || len(entries[0].Scopes) != 2 || entries[1].Scopes != nil {
+		t.Errorf("entries = %+v", entries)
+	}
+}
@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Scope kinds. A scope is "kind:name", e.g. "tool:http_request" or
+// "mcp:github". A credential without scopes is available to every consumer.
+const (
+	ScopeTool  = "tool"
+	ScopeSkill = "skill"
+	ScopeMCP   = "mcp"
+)
+
+var placeholderRe = regexp.MustCompile(`\{\{cred:([A-Za-z0-9_.\-]+)\}\}`)
+
+// Placeholder returns the placeholder that resolves to the named credential.
+func Placeholder(name string) string {
+	return "{{cred:" + name + "}}"
+}
+
+// HasPlaceholder reports whether text contains a credential placeholder.
+func HasPlaceholder(text string) bool {
+	return placeholderRe.MatchString(text)
+}
+
+func ToolScope(name string) string  { return ScopeTool + ":" + name }
+func SkillScope(name string) string { return ScopeSkill + ":" + name }
+func MCPScope(server string) string { return ScopeMCP + ":" + server }
+
+// ValidateScopes checks that every scope is a known kind with a name.
+func ValidateScopes(scopes []string) error {
+	for _, sc := range scopes {
+		kind, name, ok := strings.Cut(sc, ":")
+		if !ok || name == "" || strings.Contains(name, ",") {
+			return fmt.Errorf("credentials: invalid scope %q (want kind:name)", sc)
+		}
+		switch kind {
+		case ScopeTool, ScopeSkill, ScopeMCP:
+		default:
+			return fmt.Errorf("credentials: invalid scope %q (kind must be tool, skill or mcp)", sc)
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether consumer may use a credential with scopes.
+func Allowed(scopes []string, consumer string) bool {
+	return len(scopes) == 0 || slices.Contains(scopes, consumer)
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,255 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+const testSuite = `
+name: basics
+cases:
+  - name: lists files
+    sandbox:
+      - match: "ls"
+        stdout: "notes.txt\n"
+    turns:
+      - say: what files are there?
+        expect:
+          tool_calls:
+            - name: shell
+              input: '"ls'
+          text: notes\.txt
+          max_latency: 10s
+  - name: remembers
+    memory:
+      city: Lisbon
+    turns:
+      - say: my favourite colour is green
+        expect:
+          tool_calls:
+            - name: memory
+          memory:
+            colour: green
+            city: Lisbon
+          no_tool_calls: [shell]
+`
+
+func writeSuite(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testRunner(f *llm.Fixture) *Runner {
+	return &Runner{
+		NewProvider: func(string) (llm.Provider, error) {
+			return llm.NewReplayProvider("test", f), nil
+		},
+		NewRuntime: func(_ context.Context, env *Env, provider llm.Provider) (*agent.Runtime, error) {
+			reg := tools.NewRegistry()
+			reg.Register(&tools.ShellTool{})
+			reg.Register(&tools.MemoryTool{Memory: env.Memory})
+			return agent.NewRuntime(agent.RuntimeConfig{
+				Provider: provider,
+				Store:    env.Store,
+				Registry: reg,
+				Sandbox:  env.Sandbox,
+				Approver: agent.NewApprover(agent.ApprovalAuto, nil),
+				Memory:   env.Memory,
+				Model:    "test",
+			}), nil
+		},
+	}
+}
+
+func TestLoadSuite(t *testing.T) {
+	s, err := LoadSuite(writeSuite(t, "suite.yaml", testSuite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "basics" || len(s.Cases) != 2 {
+		t.Fatalf("suite = %+v", s)
+	}
+	if s.Cases[1].Memory["city"] != "Lisbon" {
+		t.Errorf("memory = %v", s.Cases[1].Memory)
+	}
+
+	data, _ := json.Marshal(map[string]any{"cases": []any{map[string]any{"turns": []any{map[string]any{"say": "hi"}}}}})
+	s, err = LoadSuite(writeSuite(t, "smoke.json", string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "smoke" || s.Cases[0].Name != "case 1" {
+		t.Errorf("defaults not applied: %+v", s)
+	}
+}
+
+func TestLoadSuiteInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no cases":      "name: x\n",
+		"no turns":      "cases:\n  - name: a\n",
+		"empty say":     "cases:\n  - turns:\n      - say: ''\n",
+		"bad regex":     "cases:\n  - turns:\n      - say: hi\n        expect:\n          text: '('\n",
+		"bad latency":   "cases:\n  - turns:\n      - say: hi\n        expect:\n          max_latency: soon\n",
+		"duplicate":     "cases:\n  - name: a\n    turns: [{say: hi}]\n  - name: a\n    turns: [{say: hi}]\n",
+		"nameless call": "cases:\n  - turns:\n      - say: hi\n        expect:\n          tool_calls: [{input: x}]\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadSuite(writeSuite(t, "s.yaml", content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRunPassing(t *testing.T) {
+	s, err := LoadSuite(writeSuite(t, "suite.yaml", testSuite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &llm.Fixture{Turns: []llm.FixtureTurn{
+		{ToolCalls: []llm.ToolCall{{Name: "shell", Input: json.RawMessage(`{"command":"ls -1"}`)}}},
+		{Match: "notes.txt", Text: "There is notes.txt."},
+		{ToolCalls: []llm.ToolCall{{Name: "memory", Input: json.RawMessage(`{"action":"set","key":"colour","value":"green"}`)}}},
+		{Text: "Noted."},
+	}}
+
+	rep, err := testRunner(f).Run(context.Background(), s, "replay/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Failed != 0 {
+		var buf bytes.Buffer
+		WriteReports(&buf, []*Report{rep})
+		t.Fatalf("expected all cases to pass:\n%s", buf.String())
+	}
+	if got := rep.Cases[0].Turns[0].ToolCalls; len(got) != 1 || got[0] != "shell" {
+		t.Errorf("tool calls = %v", got)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	s, err := LoadSuite(writeSuite(t, "suite.yaml", `
+cases:
+  - name: wrong
+    turns:
+      - say: delete the logs
+        expect:
+          tool_calls: [{name: shell, input: 'rm '}]
+          not_text: (?i)done
+          max_tokens: 10
+          judge: the reply confirms the logs were deleted
+          memory:
+            deleted: "yes"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &llm.Fixture{Turns: []llm.FixtureTurn{{Events: []llm.FixtureEvent{
+		{Type: "token", Token: "Done!"},
+		{Type: "done", Usage: &llm.Usage{InputTokens: 40, OutputTokens: 5}},
+	}}}}
+
+	rep, err := testRunner(f).Run(context.Background(), s, "replay/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Passed != 0 || rep.Failed != 1 {
+		t.Fatalf("report = %+v", rep)
+	}
+	failures := strings.Join(rep.Cases[0].Turns[0].Failures, "\n")
+	for _, want := range []string{
+		"expected a call to shell",
+		`reply matches "(?i)done"`,
+		"used 45 tokens, limit 10",
+		"no judge model",
+		`memory "deleted" was not written`,
+	} {
+		if !strings.Contains(failures, want) {
+			t.Errorf("failures missing %q:\n%s", want, failures)
+		}
+	}
+}
+
+type fakeJudge struct{ answer string }
+
+func (j fakeJudge) Check(context.Context, string) (string, error) { return j.answer, nil }
+
+func TestRunJudge(t *testing.T) {
+	s, err := LoadSuite(writeSuite(t, "suite.yaml", "cases:\n  - turns:\n      - say: greet me\n        expect:\n          judge: the reply is a greeting\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := &llm.Fixture{Turns: []llm.FixtureTurn{{Text: "Hello!"}}}
+
+	r := testRunner(script)
+	r.Judge = fakeJudge{answer: "PASS"}
+	rep, err := r.Run(context.Background(), s, "a")
+	if err != nil || rep.Failed != 0 {
+		t.Fatalf("judge PASS: report = %+v, err = %v", rep, err)
+	}
+
+	r = testRunner(&llm.Fixture{Turns: []llm.FixtureTurn{{Text: "Hello!"}}})
+	r.Judge = fakeJudge{answer: "FAIL: not a greeting"}
+	rep, err = r.Run(context.Background(), s, "b")
+	if err != nil || rep.Failed != 1 {
+		t.Fatalf("judge FAIL: report = %+v, err = %v", rep, err)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	a := &Report{Model: "model-a", Passed: 2, Cases: []CaseResult{{Name: "one", Passed: true}, {Name: "two", Passed: true}}}
+	b := &Report{Model: "model-b", Passed: 1, Failed: 1, Cases: []CaseResult{
+		{Name: "one", Passed: true},
+		{Name: "two", Turns: []TurnResult{{Reply: "nope", Failures: []string{"reply does not match \"yes\""}}}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteReports(&buf, []*Report{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"model-a", "model-b", "two ≠", "1/2 passed", "Failures for model-b:", `turn 1: reply does not match "yes"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "one ≠") {
+		t.Errorf("case with equal outcomes marked as differing:\n%s", out)
+	}
+}
+
+func TestEnvStoreSharedAcrossConnections(t *testing.T) {
+	env, cleanup, err := newEnv(Case{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := env.Store.CreateSession(ctx, &store.Session{ID: "s1", AgentID: "default", Channel: "eval", PeerID: "p", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pin one connection so the read below has to use another.
+	tx := env.Store.DB().Begin()
+	defer tx.Rollback()
+	if _, err := env.Store.GetSession(ctx, "s1"); err != nil {
+		t.Errorf("reading on a second connection: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteReports prints one row per case with a column per model, then the
+// failures of each model. Cases whose outcome differs between models are
+// marked with "≠".
+func WriteReports(w io.Writer, reports []*Report) error {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := []string{"CASE"}
+	for _, r := range reports {
+		header = append(header, r.Model)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+	for i, c := range reports[0].Cases {
+		row := []string{c.Name}
+		differs := false
+		for _, r := range reports {
+			if i >= len(r.Cases) {
+				row = append(row, "-")
+				differs = true
+				continue
+			}
+			rc := r.Cases[i]
+			row = append(row, caseCell(rc))
+			if rc.Passed != c.Passed {
+				differs = true
+			}
+		}
+		if differs {
+			row[0] += " ≠"
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+
+	totals := []string{"TOTAL"}
+	for _, r := range reports {
+		totals = append(totals, fmt.Sprintf("%d/%d passed", r.Passed, r.Passed+r.Failed))
+	}
+	fmt.Fprintln(tw, strings.Join(totals, "\t")+"\t")
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		if r.Failed == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\nFailures for %s:\n", r.Model)
+		for _, c := range r.Cases {
+			if c.Passed {
+				continue
+			}
+			fmt.Fprintf(w, "  %s\n", c.Name)
+			if c.Error != "" {
+				fmt.Fprintf(w, "    error: %s\n", c.Error)
+			}
+			for j, t := range c.Turns {
+				for _, f := range t.Failures {
+					fmt.Fprintf(w, "    turn %d: %s\n", j+1, f)
+				}
+				if len(t.Failures) > 0 {
+					fmt.Fprintf(w, "    turn %d reply: %q\n", j+1, truncate(t.Reply, 200))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func caseCell(c CaseResult) string {
+	status := "PASS"
+	if !c.Passed {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("%s %s %dtok", status, c.Duration.Round(time.Millisecond), c.Usage.InputTokens+c.Usage.OutputTokens)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,343 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/agent/verification"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+// Env is the isolated environment of one case: a throwaway store, the
+// agent memory kept in it, a stub sandbox and a scratch directory that is
+// removed afterwards.
+type Env struct {
+	Store   *store.Store
+	Memory  *memory.Store
+	Sandbox sandbox.Sandbox
+	Dir     string
+}
+
+// Runner runs suites against models.
+type Runner struct {
+	// NewProvider creates the provider for a model. It is called once per
+	// model, so replay fixtures are consumed across the whole suite.
+	NewProvider func(model string) (llm.Provider, error)
+	// NewRuntime builds the agent for a case around its environment.
+	NewRuntime func(ctx context.Context, env *Env, provider llm.Provider) (*agent.Runtime, error)
+	// Judge answers judge expectations. Without one they fail.
+	Judge verification.LLMChecker
+}
+
+type Report struct {
+	Suite  string       `json:"suite"`
+	Model  string       `json:"model"`
+	Cases  []CaseResult `json:"cases"`
+	Passed int          `json:"passed"`
+	Failed int          `json:"failed"`
+}
+
+type CaseResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Turns    []TurnResult  `json:"turns"`
+	Usage    llm.Usage     `json:"usage"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type TurnResult struct {
+	Say       string        `json:"say"`
+	Reply     string        `json:"reply"`
+	ToolCalls []string      `json:"tool_calls,omitempty"`
+	Usage     llm.Usage     `json:"usage"`
+	Latency   time.Duration `json:"latency_ns"`
+	Failures  []string      `json:"failures,omitempty"`
+}
+
+// Run runs every case of the suite against model.
+func (r *Runner) Run(ctx context.Context, s *Suite, model string) (*Report, error) {
+	provider, err := r.NewProvider(model)
+	if err != nil {
+		return nil, fmt.Errorf("creating provider for %s: %w", model, err)
+	}
+	meter := &meteredProvider{Provider: provider}
+
+	rep := &Report{Suite: s.Name, Model: model}
+	for _, c := range s.Cases {
+		start := time.Now()
+		res := r.runCase(ctx, c, meter)
+		res.Duration = time.Since(start)
+		if res.Passed {
+			rep.Passed++
+		} else {
+			rep.Failed++
+		}
+		rep.Cases = append(rep.Cases, res)
+		if ctx.Err() != nil {
+			return rep, ctx.Err()
+		}
+	}
+	return rep, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, c Case, meter *meteredProvider) CaseResult {
+	res := CaseResult{Name: c.Name}
+	fail := func(err error) CaseResult {
+		res.Error = err.Error()
+		return res
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	env, cleanup, err := newEnv(c)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+	for k, v := range c.Memory {
+		if err := env.Memory.Set(ctx, config.DefaultAgentID, k, v); err != nil {
+			return fail(fmt.Errorf("seeding memory: %w", err))
+		}
+	}
+	rt, err := r.NewRuntime(ctx, env, meter)
+	if err != nil {
+		return fail(err)
+	}
+
+	sessionID := "eval-" + uuid.NewString()
+	passed := true
+	for _, turn := range c.Turns {
+		tr, err := r.runTurn(ctx, rt, env, sessionID, turn, meter)
+		if err != nil {
+			return fail(err)
+		}
+		res.Turns = append(res.Turns, tr)
+		res.Usage.InputTokens += tr.Usage.InputTokens
+		res.Usage.OutputTokens += tr.Usage.OutputTokens
+		if len(tr.Failures) > 0 {
+			passed = false
+		}
+	}
+	res.Passed = passed
+	return res
+}
+
+func (r *Runner) runTurn(ctx context.Context, rt *agent.Runtime, env *Env, sessionID string, turn Turn, meter *meteredProvider) (TurnResult, error) {
+	tr := TurnResult{Say: turn.Say}
+	before := meter.usage()
+	start := time.Now()
+
+	events, err := rt.RunTurn(agent.WithAutoApprove(ctx), sessionID, turn.Say)
+	if err != nil {
+		return tr, err
+	}
+	var calls []llm.ToolCall
+	var turnErr error
+	for ev := range events {
+		switch ev.Type {
+		case agent.TurnToolCall:
+			if ev.ToolCall != nil {
+				calls = append(calls, *ev.ToolCall)
+				tr.ToolCalls = append(tr.ToolCalls, ev.ToolCall.Name)
+			}
+		case agent.TurnDone:
+			tr.Reply = ev.Message
+		case agent.TurnError:
+			turnErr = ev.Error
+		}
+	}
+	tr.Latency = time.Since(start)
+	after := meter.usage()
+	tr.Usage = llm.Usage{
+		InputTokens:  after.InputTokens - before.InputTokens,
+		OutputTokens: after.OutputTokens - before.OutputTokens,
+	}
+	if turnErr != nil {
+		tr.Failures = append(tr.Failures, "turn failed: "+turnErr.Error())
+		return tr, nil
+	}
+
+	tr.Failures = append(tr.Failures, r.check(ctx, env, turn, tr, calls)...)
+	return tr, nil
+}
+
+// check returns a description of every expectation the turn missed.
+func (r *Runner) check(ctx context.Context, env *Env, turn Turn, tr TurnResult, calls []llm.ToolCall) []string {
+	e := turn.Expect
+	var failures []string
+
+	next := 0
+	for _, call := range calls {
+		if next < len(e.ToolCalls) && e.ToolCalls[next].matches(call) {
+			next++
+		}
+	}
+	if next < len(e.ToolCalls) {
+		want := e.ToolCalls[next]
+		desc := want.Name
+		if want.Input != "" {
+			desc += fmt.Sprintf(" with input matching %q", want.Input)
+		}
+		failures = append(failures, fmt.Sprintf("expected a call to %s; calls were [%s]", desc, strings.Join(tr.ToolCalls, ", ")))
+	}
+	for _, name := range e.NoToolCalls {
+		for _, got := range tr.ToolCalls {
+			if got == name {
+				failures = append(failures, fmt.Sprintf("unexpected call to %s", name))
+				break
+			}
+		}
+	}
+
+	if e.text != nil && !e.text.MatchString(tr.Reply) {
+		failures = append(failures, fmt.Sprintf("reply does not match %q", e.Text))
+	}
+	if e.notText != nil && e.notText.MatchString(tr.Reply) {
+		failures = append(failures, fmt.Sprintf("reply matches %q", e.NotText))
+	}
+
+	for key, re := range e.memory {
+		entry, err := env.Memory.Get(ctx, config.DefaultAgentID, key)
+		switch {
+		case err != nil || entry == nil:
+			failures = append(failures, fmt.Sprintf("memory %q was not written", key))
+		case !re.MatchString(entry.Value):
+			failures = append(failures, fmt.Sprintf("memory %q = %q, want a match for %q", key, entry.Value, e.Memory[key]))
+		}
+	}
+
+	if total := tr.Usage.InputTokens + tr.Usage.OutputTokens; e.MaxTokens > 0 && total > e.MaxTokens {
+		failures = append(failures, fmt.Sprintf("used %d tokens, limit %d", total, e.MaxTokens))
+	}
+	if e.maxLatency > 0 && tr.Latency > e.maxLatency {
+		failures = append(failures, fmt.Sprintf("took %s, limit %s", tr.Latency.Round(time.Millisecond), e.maxLatency))
+	}
+
+	if e.Judge != "" {
+		if msg := r.judge(ctx, turn, tr); msg != "" {
+			failures = append(failures, msg)
+		}
+	}
+	return failures
+}
+
+func (tc ToolCallExpect) matches(call llm.ToolCall) bool {
+	return call.Name == tc.Name && (tc.input == nil || tc.input.Match(call.Input))
+}
+
+// judge asks the LLM self-check gate whether the reply meets the criterion,
+// returning a failure message unless it passes.
+func (r *Runner) judge(ctx context.Context, turn Turn, tr TurnResult) string {
+	if r.Judge == nil {
+		return "judge: no judge model configured"
+	}
+	gate := &verification.LLMSelfCheckGate{LLM: r.Judge}
+	res := gate.Verify(ctx, verification.TaskResult{
+		FinalMessage: fmt.Sprintf("Original request:\n%s\n\nThe result must meet this criterion: %s\n\nReply given:\n%s", turn.Say, turn.Expect.Judge, tr.Reply),
+		ToolsUsed:    tr.ToolCalls,
+	})
+	switch res.Status {
+	case verification.Confirmed:
+		return ""
+	case verification.Failed:
+		return "judge: " + res.Reason
+	default:
+		return "judge uncertain: " + res.Evidence
+	}
+}
+
+// newEnv gives each case its own file-backed store, kept next to the scratch
+// directory rather than in it. An in-memory SQLite database is per
+// connection, so pooled connections would not share its tables.
+func newEnv(c Case) (*Env, func(), error) {
+	root, err := os.MkdirTemp("", "pincer-eval-")
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := filepath.Join(root, "work")
+	if err := os.Mkdir(dir, 0750); err != nil {
+		os.RemoveAll(root)
+		return nil, nil, err
+	}
+	db, err := store.New(filepath.Join(root, "pincer.db"))
+	if err != nil {
+		os.RemoveAll(root)
+		return nil, nil, fmt.Errorf("creating store: %w", err)
+	}
+	env := &Env{
+		Store:   db,
+		Memory:  memory.New(db.DB(), nil),
+		Sandbox: &stubSandbox{outputs: c.Sandbox},
+		Dir:     dir,
+	}
+	return env, func() {
+		db.Close()
+		os.RemoveAll(root)
+	}, nil
+}
+
+// stubSandbox answers commands from a case's canned outputs instead of
+// running them.
+type stubSandbox struct {
+	outputs []CommandOutput
+}
+
+func (s *stubSandbox) Exec(_ context.Context, cmd sandbox.Command, _ sandbox.Policy) (*sandbox.Result, error) {
+	line := strings.Join(append([]string{cmd.Program}, cmd.Args...), " ")
+	for _, o := range s.outputs {
+		if o.re.MatchString(line) {
+			return &sandbox.Result{Stdout: o.Stdout, Stderr: o.Stderr, ExitCode: o.ExitCode}, nil
+		}
+	}
+	return &sandbox.Result{}, nil
+}
+
+// meteredProvider adds up the token usage reported by a provider.
+type meteredProvider struct {
+	llm.Provider
+
+	mu    sync.Mutex
+	total llm.Usage
+}
+
+func (m *meteredProvider) Chat(ctx context.Context, req llm.ChatRequest) (<-chan llm.ChatEvent, error) {
+	events, err := m.Provider.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan llm.ChatEvent)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			if ev.Usage != nil {
+				m.mu.Lock()
+				m.total.InputTokens += ev.Usage.InputTokens
+				m.total.OutputTokens += ev.Usage.OutputTokens
+				m.mu.Unlock()
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (m *meteredProvider) usage() llm.Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
@@ -0,0 +1,208 @@
+// Package eval runs scripted conversations through the agent runtime and
+// checks what the agent did against expectations, so that changes to souls,
+// prompts and models can be compared.
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Suite is a set of conversations loaded from a YAML or JSON file.
+type Suite struct {
+	Name  string `json:"name"`
+	Cases []Case `json:"cases"`
+}
+
+// Case is one conversation. Each case starts from an empty store, with
+// Memory seeded into the agent's memory and shell commands answered from
+// Sandbox.
+type Case struct {
+	Name    string            `json:"name"`
+	Memory  map[string]string `json:"memory,omitempty"`
+	Sandbox []CommandOutput   `json:"sandbox,omitempty"`
+	Turns   []Turn            `json:"turns"`
+}
+
+// CommandOutput is the canned result of sandboxed commands whose command
+// line, the program followed by its arguments, matches Match. Unmatched
+// commands succeed with no output.
+type CommandOutput struct {
+	Match    string `json:"match"`
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+
+	re *regexp.Regexp
+}
+
+type Turn struct {
+	Say    string `json:"say"`
+	Expect Expect `json:"expect"`
+}
+
+// Expect lists the checks made after a turn. Text and NotText are regular
+// expressions matched against the final reply, Judge is a criterion an LLM
+// judges the reply by, and Memory maps keys to regular expressions their
+// stored values must match.
+type Expect struct {
+	ToolCalls   []ToolCallExpect  `json:"tool_calls,omitempty"`
+	NoToolCalls []string          `json:"no_tool_calls,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	NotText     string            `json:"not_text,omitempty"`
+	Judge       string            `json:"judge,omitempty"`
+	Memory      map[string]string `json:"memory,omitempty"`
+	MaxTokens   int               `json:"max_tokens,omitempty"`
+	MaxLatency  string            `json:"max_latency,omitempty"`
+
+	text, notText *regexp.Regexp
+	memory        map[string]*regexp.Regexp
+	maxLatency    time.Duration
+}
+
+// ToolCallExpect expects a call of the named tool whose JSON input matches
+// Input. Expected calls must appear in order, with other calls in between
+// allowed.
+type ToolCallExpect struct {
+	Name  string `json:"name"`
+	Input string `json:"input,omitempty"`
+
+	input *regexp.Regexp
+}
+
+// LoadSuite reads a suite, as YAML unless the file ends in .json.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	var s Suite
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+func (s *Suite) compile() error {
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("suite has no cases")
+	}
+	names := make(map[string]bool)
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate case %q", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Turns) == 0 {
+			return fmt.Errorf("case %q has no turns", c.Name)
+		}
+		for j := range c.Sandbox {
+			re, err := regexp.Compile(c.Sandbox[j].Match)
+			if err != nil {
+				return fmt.Errorf("case %q: sandbox match: %w", c.Name, err)
+			}
+			c.Sandbox[j].re = re
+		}
+		for j := range c.Turns {
+			t := &c.Turns[j]
+			if strings.TrimSpace(t.Say) == "" {
+				return fmt.Errorf("case %q turn %d: say is required", c.Name, j+1)
+			}
+			if err := t.Expect.compile(); err != nil {
+				return fmt.Errorf("case %q turn %d: %w", c.Name, j+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Expect) compile() error {
+	var err error
+	if e.Text != "" {
+		if e.text, err = regexp.Compile(e.Text); err != nil {
+			return fmt.Errorf("text: %w", err)
+		}
+	}
+	if e.NotText != "" {
+		if e.notText, err = regexp.Compile(e.NotText); err != nil {
+			return fmt.Errorf("not_text: %w", err)
+		}
+	}
+	for i := range e.ToolCalls {
+		tc := &e.ToolCalls[i]
+		if tc.Name == "" {
+			return fmt.Errorf("tool_calls: name is required")
+		}
+		if tc.Input != "" {
+			if tc.input, err = regexp.Compile(tc.Input); err != nil {
+				return fmt.Errorf("tool_calls %s: %w", tc.Name, err)
+			}
+		}
+	}
+	if len(e.Memory) > 0 {
+		e.memory = make(map[string]*regexp.Regexp, len(e.Memory))
+		for k, v := range e.Memory {
+			if e.memory[k], err = regexp.Compile(v); err != nil {
+				return fmt.Errorf("memory %s: %w", k, err)
+			}
+		}
+	}
+	if e.MaxLatency != "" {
+		if e.maxLatency, err = time.ParseDuration(e.MaxLatency); err != nil {
+			return fmt.Errorf("max_latency: %w", err)
+		}
+	}
+	return nil
+}
+
+// yamlToJSON converts YAML to JSON so that suites need only one set of
+// field tags.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(v))
+}
+
+// jsonValue replaces the map[any]any values the YAML decoder produces with
+// maps encoding/json accepts.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonValue(val)
+		}
+		return m
+	case []any:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/config"
+)
+
+const maxRateWindows = 1024
+
+var (
+	ErrAccessDenied = errors.New("access denied")
+	ErrRateLimited  = errors.New("rate limit exceeded")
+)
+
+// Identity is who a channel peer resolves to.
+type Identity struct {
+	User string
+	Role string
+	config.RoleConfig
+}
+
+// AccessControl authorizes channel peers. Peers listed in [access.users] get
+// their configured role; peers in a channel allow_list are members; anyone
+// else gets the [access] unknown role or is denied. Without an unknown role,
+// channels that list no peers admit everyone as a member; admin, and with
+// it approving tool calls, is only ever granted explicitly.
+//
+// A nil *AccessControl allows everyone as admin.
+type AccessControl struct {
+	users   map[string]Identity
+	roles   map[string]config.RoleConfig
+	unknown string
+	// restricted holds the channels that list peers, in an allow_list or
+	// in [access.users].
+	restricted map[string]bool
+	now        func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func NewAccessControl(cfg *config.Config) *AccessControl {
+	roles := config.DefaultRoles()
+	for name, role := range cfg.Access.Roles {
+		roles[name] = role
+	}
+
+	ac := &AccessControl{
+		users:      make(map[string]Identity),
+		roles:      roles,
+		unknown:    cfg.Access.Unknown,
+		restricted: make(map[string]bool),
+		now:        time.Now,
+		windows:    make(map[string]*rateWindow),
+	}
+
+	for channel, ch := range cfg.Channels {
+		for _, peer := range ch.AllowList {
+			ac.users[channel+":"+peer] = ac.identity(peer, config.RoleMember)
+			ac.restricted[channel] = true
+		}
+	}
+	for _, u := range cfg.Access.Users {
+		for _, peer := range u.Peers {
+			ac.users[peer] = ac.identity(u.Name, u.Role)
+			if channel, _, ok := strings.Cut(peer, ":"); ok {
+				ac.restricted[channel] = true
+			}
+		}
+	}
+	return ac
+}
+
+func (ac *AccessControl) identity(user, role string) Identity {
+	return Identity{User: user, Role: role, RoleConfig: ac.roles[role]}
+}
+
+// Resolve maps a peer to an identity without counting it against any rate
+// limit. It returns false for peers that are denied.
+func (ac *AccessControl) Resolve(channel, peerID string) (Identity, bool) {
+	if ac == nil {
+		return Identity{User: peerID, Role: config.RoleAdmin, RoleConfig: config.RoleConfig{Approve: true}}, true
+	}
+	for _, key := range peerKeys(channel, peerID) {
+		if id, ok := ac.users[key]; ok {
+			return id, true
+		}
+	}
+	unknown := ac.unknown
+	if unknown == "" {
+		// Channels without listed peers stay open, but strangers must not
+		// be able to approve tool calls.
+		unknown = config.RoleMember
+		if ac.restricted[channel] {
+			unknown = config.AccessDeny
+		}
+	}
+	if unknown == config.AccessDeny {
+		return Identity{}, false
+	}
+	return ac.identity(peerID, unknown), true
+}
+
+// Limit counts a message from a resolved peer against its role's rate
+// limit.
+func (ac *AccessControl) Limit(channel, peerID string, id Identity) error {
+	if ac != nil && id.RateLimit > 0 && !ac.allow(channel+":"+peerID, id.RateLimit) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// CanApprove reports whether a peer may answer tool approval requests.
+func (ac *AccessControl) CanApprove(channel, peerID string) bool {
+	id, ok := ac.Resolve(channel, peerID)
+	return ok && id.Approve
+}
+
+func (ac *AccessControl) allow(key string, perMinute int) bool {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := ac.now()
+	w, ok := ac.windows[key]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		if len(ac.windows) >= maxRateWindows {
+			for k, old := range ac.windows {
+				if now.Sub(old.start) >= time.Minute {
+					delete(ac.windows, k)
+				}
+			}
+		}
+		ac.windows[key] = &rateWindow{start: now, count: 1}
+		return true
+	}
+	if w.count >= perMinute {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// peerKeys lists the config keys a peer may be listed under. WhatsApp peers
+// are JIDs but are usually configured by phone number alone.
+func peerKeys(channel, peerID string) []string {
+	keys := []string{channel + ":" + peerID}
+	if user, _, ok := strings.Cut(peerID, "@"); ok && user != "" {
+		keys = append(keys, channel+":"+user)
+	}
+	return keys
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/config"
+)
+
+func TestAccessControlResolve(t *testing.T) {
+	cfg := config.Default()
+	cfg.Channels = map[string]config.ChannelConfig{
+		"whatsapp": {AllowList: []string{"15551234567"}},
+	}
+	cfg.Access.Users = []config.AccessUserConfig{
+		{Name: "alice", Role: config.RoleAdmin, Peers: []string{"telegram:42", "slack:U1"}},
+	}
+	ac := NewAccessControl(cfg)
+
+	tests := []struct {
+		channel, peer string
+		wantOK        bool
+		wantUser      string
+		wantRole      string
+	}{
+		{"telegram", "42", true, "alice", config.RoleAdmin},
+		{"slack", "U1", true, "alice", config.RoleAdmin},
+		{"whatsapp", "15551234567@s.whatsapp.net", true, "15551234567", config.RoleMember},
+		{"telegram", "99", false, "", ""},
+		{"discord", "42", true, "42", config.RoleMember},
+	}
+	for _, tt := range tests {
+		id, ok := ac.Resolve(tt.channel, tt.peer)
+		if ok != tt.wantOK || id.User != tt.wantUser || id.Role != tt.wantRole {
+			t.Errorf("Resolve(%s, %s) = %+v, %v", tt.channel, tt.peer, id, ok)
+		}
+	}
+
+	if !ac.CanApprove("telegram", "42") {
+		t.Error("admin should be able to approve")
+	}
+	if ac.CanApprove("whatsapp", "15551234567@s.whatsapp.net") {
+		t.Error("member should not be able to approve")
+	}
+}
+
+func TestAccessControlDenyIsPerChannel(t *testing.T) {
+	cfg := config.Default()
+	cfg.Channels = map[string]config.ChannelConfig{
+		"telegram": {AllowList: []string{"42"}},
+	}
+	ac := NewAccessControl(cfg)
+
+	if _, ok := ac.Resolve("telegram", "99"); ok {
+		t.Error("unlisted peer allowed on a channel with an allow_list")
+	}
+	if id, ok := ac.Resolve("slack", "U9"); !ok || id.Role != config.RoleMember {
+		t.Errorf("Resolve on an unlisted channel = %+v, %v; want member", id, ok)
+	}
+
+	cfg.Access.Unknown = config.AccessDeny
+	if _, ok := NewAccessControl(cfg).Resolve("slack", "U9"); ok {
+		t.Error("explicit deny should apply to every channel")
+	}
+}
+
+func TestAccessControlOpenByDefault(t *testing.T) {
+	ac := NewAccessControl(config.Default())
+	id, ok := ac.Resolve("discord", "anyone")
+	if !ok || id.Role != config.RoleMember {
+		t.Errorf("Resolve = %+v, %v; want member", id, ok)
+	}
+	if ac.CanApprove("discord", "anyone") {
+		t.Error("unlisted peers must not be able to approve by default")
+	}
+
+	var nilAC *AccessControl
+	if !nilAC.CanApprove("discord", "anyone") {
+		t.Error("nil access control should allow approvals")
+	}
+}
+
+// authorize resolves a peer and counts one message against its rate limit,
+// as the router does.
+func authorize(ac *AccessControl, channel, peerID string) (Identity, error) {
+	id, ok := ac.Resolve(channel, peerID)
+	if !ok {
+		return Identity{}, ErrAccessDenied
+	}
+	return id, ac.Limit(channel, peerID, id)
+}
+
+func TestAccessControlGuestRateLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.Access.Unknown = config.RoleGuest
+	ac := NewAccessControl(cfg)
+	now := time.Unix(1000, 0)
+	ac.now = func() time.Time { return now }
+
+	for i := range config.DefaultGuestRateLimit {
+		id, err := authorize(ac, "telegram", "7")
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if id.Tools == nil || len(id.Tools) != 0 {
+			t.Errorf("guest tools = %v, want none", id.Tools)
+		}
+	}
+	if _, err := authorize(ac, "telegram", "7"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+	if _, err := authorize(ac, "telegram", "8"); err != nil {
+		t.Errorf("other peer: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := authorize(ac, "telegram", "7"); err != nil {
+		t.Errorf("after window: %v", err)
+	}
+}
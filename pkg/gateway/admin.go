@@ -0,0 +1,559 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/backup"
+	"github.com/igorsilveira/pincer/pkg/credentials"
+	"github.com/igorsilveira/pincer/pkg/mcp"
+	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/store"
+	"gorm.io/gorm"
+)
+
+// Admin API. Every route lives under /api/v1 and is only served when the
+// gateway has an auth token. Credential values are write-only.
+
+const (
+	adminActor        = "admin"
+	defaultAdminLimit = 50
+	maxAdminLimit     = 500
+)
+
+// SpawnManager lists and cancels background tasks started by the spawn tool.
+type SpawnManager interface {
+	ListSpawns() []SpawnInfo
+	CancelSpawn(spawnID string) error
+}
+
+// BackupManager takes and lists backups of the data directory.
+type BackupManager interface {
+	Run(ctx context.Context) (backup.Info, error)
+	List() ([]backup.Info, error)
+}
+
+// MCPStatus reports the state of supervised MCP server connections.
+type MCPStatus interface {
+	Status() []mcp.ServerStatus
+}
+
+type adminSession struct {
+	ID           string    `json:"id"`
+	AgentID      string    `json:"agent_id"`
+	Channel      string    `json:"channel"`
+	PeerID       string    `json:"peer_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	MessageCount *int64    `json:"message_count,omitempty"`
+	TokenUsage   *int      `json:"token_usage,omitempty"`
+}
+
+type adminMessage struct {
+	ID          string    `json:"id"`
+	Role        string    `json:"role"`
+	ContentType string    `json:"content_type"`
+	Content     string    `json:"content"`
+	TokenCount  int       `json:"token_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type adminMemoryEntry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Immutable bool      `json:"immutable"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type adminApproval struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"session_id"`
+	ToolName    string    `json:"tool_name"`
+	Input       string    `json:"input"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+type adminAuditEntry struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	EventType string    `json:"event_type"`
+	SessionID string    `json:"session_id,omitempty"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+func (g *Gateway) registerAdminRoutes(r chi.Router) {
+	r.Route("/api/v1", func(r chi.Router) {
+		if g.store != nil {
+			r.Get("/sessions", g.handleAdminListSessions)
+			r.Get("/sessions/{id}", g.handleAdminGetSession)
+			r.Get("/sessions/{id}/messages", g.handleAdminSessionMessages)
+		}
+		if g.memory != nil {
+			r.Get("/agents/{agent}/memory", g.handleAdminListMemory)
+			r.Get("/agents/{agent}/memory/{key}", g.handleAdminGetMemory)
+			r.Put("/agents/{agent}/memory/{key}", g.handleAdminSetMemory)
+			r.Delete("/agents/{agent}/memory/{key}", g.handleAdminDeleteMemory)
+		}
+		if g.credentials != nil {
+			r.Get("/credentials", g.handleAdminListCredentials)
+			r.Put("/credentials/{name}", g.handleAdminSetCredential)
+			r.Delete("/credentials/{name}", g.handleAdminDeleteCredential)
+		}
+		if g.approver != nil {
+			r.Get("/approvals", g.handleAdminListApprovals)
+			r.Post("/approvals/{id}", g.handleAdminAnswerApproval)
+		}
+		if g.spawns != nil {
+			r.Get("/spawns", g.handleAdminListSpawns)
+			r.Post("/spawns/{id}/cancel", g.handleAdminCancelSpawn)
+		}
+		if g.auditLog != nil {
+			r.Get("/audit", g.handleAdminQueryAudit)
+		}
+		if g.backups != nil {
+			r.Get("/backups", g.handleAdminListBackups)
+			r.Post("/backups", g.handleAdminCreateBackup)
+		}
+		if g.mcp != nil {
+			r.Get("/mcp", g.handleAdminMCPStatus)
+		}
+	})
+}
+
+func (g *Gateway) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := adminPage(r)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sessions, err := g.store.ListSessions(r.Context(), store.SessionFilter{
+		AgentID: r.URL.Query().Get("agent"),
+		Channel: r.URL.Query().Get("channel"),
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		g.adminInternalError(w, "listing sessions", err)
+		return
+	}
+	out := make([]adminSession, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, toAdminSession(s))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": out})
+}
+
+func (g *Gateway) handleAdminGetSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sess, err := g.store.GetSession(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeAdminError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		g.adminInternalError(w, "loading session", err)
+		return
+	}
+	count, err := g.store.MessageCount(ctx, sess.ID)
+	if err != nil {
+		g.adminInternalError(w, "counting messages", err)
+		return
+	}
+	usage, err := g.store.SessionTokenUsage(ctx, sess.ID)
+	if err != nil {
+		g.adminInternalError(w, "summing token usage", err)
+		return
+	}
+	out := toAdminSession(*sess)
+	out.MessageCount = &count
+	out.TokenUsage = &usage
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminSessionMessages returns the most recent messages of a session in
+// chronological order. offset pages back through older messages.
+func (g *Gateway) handleAdminSessionMessages(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := adminPage(r)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	if _, err := g.store.GetSession(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeAdminError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		g.adminInternalError(w, "loading session", err)
+		return
+	}
+	msgs, err := g.store.RecentMessagesPage(ctx, id, limit, offset)
+	if err != nil {
+		g.adminInternalError(w, "loading messages", err)
+		return
+	}
+	out := make([]adminMessage, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, adminMessage{
+			ID:          m.ID,
+			Role:        m.Role,
+			ContentType: m.ContentType,
+			Content:     m.Content,
+			TokenCount:  m.TokenCount,
+			CreatedAt:   m.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": out})
+}
+
+func (g *Gateway) handleAdminListMemory(w http.ResponseWriter, r *http.Request) {
+	agentID := chi.URLParam(r, "agent")
+	var (
+		entries []memory.Entry
+		err     error
+	)
+	if q := r.URL.Query().Get("q"); q != "" {
+		entries, err = g.memory.Search(r.Context(), agentID, q)
+	} else {
+		entries, err = g.memory.List(r.Context(), agentID)
+	}
+	if err != nil {
+		g.adminInternalError(w, "listing memory", err)
+		return
+	}
+	out := make([]adminMemoryEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, g.toAdminMemoryEntry(e))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"memory": out})
+}
+
+func (g *Gateway) handleAdminGetMemory(w http.ResponseWriter, r *http.Request) {
+	e, err := g.memory.Get(r.Context(), chi.URLParam(r, "agent"), chi.URLParam(r, "key"))
+	if err != nil {
+		g.adminMemoryError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.toAdminMemoryEntry(*e))
+}
+
+func (g *Gateway) handleAdminSetMemory(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Value *string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Value == nil {
+		writeAdminError(w, http.StatusBadRequest, `body must be {"value": "..."}`)
+		return
+	}
+	ctx := r.Context()
+	agentID, key := chi.URLParam(r, "agent"), chi.URLParam(r, "key")
+	if err := g.memory.Set(ctx, agentID, key, *body.Value); err != nil {
+		g.adminMemoryError(w, err)
+		return
+	}
+	g.adminAudit(ctx, audit.EventMemorySet, "", agentID, map[string]string{"key": key})
+
+	e, err := g.memory.Get(ctx, agentID, key)
+	if err != nil {
+		g.adminMemoryError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.toAdminMemoryEntry(*e))
+}
+
+func (g *Gateway) handleAdminDeleteMemory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	agentID, key := chi.URLParam(r, "agent"), chi.URLParam(r, "key")
+	if err := g.memory.Delete(ctx, agentID, key); err != nil {
+		g.adminMemoryError(w, err)
+		return
+	}
+	g.adminAudit(ctx, audit.EventMemoryDel, "", agentID, map[string]string{"key": key})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleAdminListCredentials(w http.ResponseWriter, r *http.Request) {
+	entries, err := g.credentials.Entries(r.Context())
+	if err != nil {
+		g.adminInternalError(w, "listing credentials", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+func (g *Gateway) handleAdminSetCredential(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Value string `json:"value"`
+		// Scopes replaces the credential's scopes when present.
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Value == "" {
+		writeAdminError(w, http.StatusBadRequest, `body must be {"value": "...", "scopes": [...]}`)
+		return
+	}
+	if err := credentials.ValidateScopes(body.Scopes); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	if err := g.credentials.Set(ctx, name, body.Value); err != nil {
+		g.adminInternalError(w, "storing credential", err)
+		return
+	}
+	detail := map[string]any{"name": name}
+	if body.Scopes != nil {
+		if err := g.credentials.SetScopes(ctx, name, body.Scopes); err != nil {
+			g.adminInternalError(w, "storing credential scopes", err)
+			return
+		}
+		detail["scopes"] = body.Scopes
+	}
+	g.adminAudit(ctx, audit.EventCredSet, "", "", detail)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleAdminDeleteCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	if err := g.credentials.Delete(ctx, name); err != nil {
+		if errors.Is(err, credentials.ErrNotFound) {
+			writeAdminError(w, http.StatusNotFound, "credential not found")
+			return
+		}
+		g.adminInternalError(w, "deleting credential", err)
+		return
+	}
+	g.adminAudit(ctx, audit.EventCredDel, "", "", map[string]string{"name": name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleAdminListApprovals(w http.ResponseWriter, r *http.Request) {
+	pending := g.approver.Pending()
+	out := make([]adminApproval, 0, len(pending))
+	for _, req := range pending {
+		out = append(out, adminApproval{
+			ID:          req.ID,
+			SessionID:   req.SessionID,
+			ToolName:    req.ToolName,
+			Input:       req.Input,
+			RequestedAt: req.RequestedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"approvals": out})
+}
+
+func (g *Gateway) handleAdminAnswerApproval(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Approved *bool `json:"approved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Approved == nil {
+		writeAdminError(w, http.StatusBadRequest, `body must be {"approved": true|false}`)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	var req agent.ApprovalRequest
+	for _, p := range g.approver.Pending() {
+		if p.ID == id {
+			req = p
+			break
+		}
+	}
+	if !g.approver.Respond(agent.ApprovalResponse{RequestID: id, Approved: *body.Approved}) {
+		writeAdminError(w, http.StatusNotFound, "approval request not found")
+		return
+	}
+	g.logger.Info("approval answered via admin api",
+		slog.String("request_id", id),
+		slog.Bool("approved", *body.Approved),
+	)
+	g.adminAudit(r.Context(), audit.EventApprovalAnswer, req.SessionID, "", map[string]any{
+		"request_id": id,
+		"tool":       req.ToolName,
+		"approved":   *body.Approved,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleAdminListSpawns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"spawns": g.spawns.ListSpawns()})
+}
+
+func (g *Gateway) handleAdminMCPStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"servers": g.mcp.Status()})
+}
+
+func (g *Gateway) handleAdminCancelSpawn(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var sessionID string
+	for _, sp := range g.spawns.ListSpawns() {
+		if sp.ID == id {
+			sessionID = sp.SessionID
+			break
+		}
+	}
+	if err := g.spawns.CancelSpawn(id); err != nil {
+		if errors.Is(err, ErrSpawnNotFound) {
+			writeAdminError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		g.adminInternalError(w, "cancelling spawn", err)
+		return
+	}
+	g.adminAudit(r.Context(), audit.EventSpawnCancel, sessionID, "", map[string]string{"spawn_id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleAdminListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := g.backups.List()
+	if err != nil {
+		g.adminInternalError(w, "listing backups", err)
+		return
+	}
+	if backups == nil {
+		backups = []backup.Info{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"backups": backups})
+}
+
+// handleAdminCreateBackup takes a backup synchronously and returns its
+// manifest.
+func (g *Gateway) handleAdminCreateBackup(w http.ResponseWriter, r *http.Request) {
+	info, err := g.backups.Run(r.Context())
+	if err != nil {
+		g.adminInternalError(w, "creating backup", err)
+		return
+	}
+	g.adminAudit(r.Context(), audit.EventBackup, "", "", map[string]any{
+		"name":  info.Name,
+		"bytes": info.Size,
+	})
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// handleAdminQueryAudit filters the audit log by event, session, agent and
+// an RFC 3339 since/until range, newest first.
+func (g *Gateway) handleAdminQueryAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _, err := adminPage(r)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f := audit.Filter{
+		EventType: q.Get("event"),
+		SessionID: q.Get("session"),
+		AgentID:   q.Get("agent"),
+		Limit:     limit,
+	}
+	for param, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, param+" must be an RFC 3339 timestamp")
+			return
+		}
+		*dst = t.UTC()
+	}
+
+	entries, err := g.auditLog.Query(r.Context(), f)
+	if err != nil {
+		g.adminInternalError(w, "querying audit log", err)
+		return
+	}
+	out := make([]adminAuditEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, adminAuditEntry{
+			ID:        e.ID,
+			Timestamp: e.Timestamp,
+			EventType: e.EventType,
+			SessionID: e.SessionID,
+			AgentID:   e.AgentID,
+			Actor:     e.Actor,
+			Detail:    e.Detail,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": out})
+}
+
+func (g *Gateway) toAdminMemoryEntry(e memory.Entry) adminMemoryEntry {
+	return adminMemoryEntry{
+		Key:       e.Key,
+		Value:     e.Value,
+		Immutable: g.memory.IsImmutable(e.Key),
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+func toAdminSession(s store.Session) adminSession {
+	return adminSession{
+		ID:        s.ID,
+		AgentID:   s.AgentID,
+		Channel:   s.Channel,
+		PeerID:    s.PeerID,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// adminPage reads the limit and offset query parameters.
+func adminPage(r *http.Request) (limit, offset int, err error) {
+	q := r.URL.Query()
+	limit = defaultAdminLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAdminLimit {
+			return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxAdminLimit))
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+func (g *Gateway) adminMemoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, memory.ErrNotFound):
+		writeAdminError(w, http.StatusNotFound, "memory key not found")
+	case errors.Is(err, memory.ErrImmutable):
+		writeAdminError(w, http.StatusConflict, err.Error())
+	default:
+		g.adminInternalError(w, "memory operation", err)
+	}
+}
+
+func (g *Gateway) adminAudit(ctx context.Context, eventType, sessionID, agentID string, detail any) {
+	if g.auditLog == nil {
+		return
+	}
+	if err := g.auditLog.Log(ctx, eventType, sessionID, agentID, adminActor, detail); err != nil {
+		g.logger.Warn("admin api: audit log failed", slog.String("err", err.Error()))
+	}
+}
+
+func (g *Gateway) adminInternalError(w http.ResponseWriter, op string, err error) {
+	g.logger.Error("admin api: "+op, slog.String("err", err.Error()))
+	writeAdminError(w, http.StatusInternalServerError, op+" failed")
+}
+
+func writeAdminError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
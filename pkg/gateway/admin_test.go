@@ -0,0 +1,416 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/audit"
+	"github.com/igorsilveira/pincer/pkg/backup"
+	"github.com/igorsilveira/pincer/pkg/credentials"
+	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+type fakeSpawns struct {
+	spawns    []SpawnInfo
+	cancelled []string
+}
+
+func (f *fakeSpawns) ListSpawns() []SpawnInfo { return f.spawns }
+
+func (f *fakeSpawns) CancelSpawn(id string) error {
+	for _, s := range f.spawns {
+		if s.ID == id {
+			f.cancelled = append(f.cancelled, id)
+			return nil
+		}
+	}
+	return ErrSpawnNotFound
+}
+
+type adminFixture struct {
+	gw       *Gateway
+	db       *store.Store
+	mem      *memory.Store
+	creds    *credentials.Store
+	auditLog *audit.Logger
+	approver *agent.Approver
+	spawns   *fakeSpawns
+	backups  *backup.Manager
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	db := testStore(t)
+	creds, err := credentials.New(db.DB(), "test-master-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, err := audit.New(db.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &adminFixture{
+		db:       db,
+		mem:      memory.New(db.DB(), []string{"identity"}),
+		creds:    creds,
+		auditLog: auditLog,
+		approver: agent.NewApprover(agent.ApprovalAsk, nil),
+		spawns:   &fakeSpawns{},
+	}
+	dataDir := t.TempDir()
+	f.backups = &backup.Manager{
+		Options: backup.Options{DataDir: dataDir, Store: db},
+		Dir:     filepath.Join(dataDir, "backups"),
+		Keep:    2,
+	}
+	f.gw = New(Config{
+		AuthToken:   "secret",
+		Approver:    f.approver,
+		Store:       f.db,
+		Memory:      f.mem,
+		Credentials: f.creds,
+		AuditLog:    f.auditLog,
+		Spawns:      f.spawns,
+		Backups:     f.backups,
+	})
+	return f
+}
+
+func (f *adminFixture) do(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	f.gw.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	return v
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	f := newAdminFixture(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	rec := httptest.NewRecorder()
+	f.gw.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+
+	open := New(Config{Store: f.db})
+	rec = httptest.NewRecorder()
+	open.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without auth token status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, s := range []store.Session{
+		{ID: "s-1", AgentID: "default", Channel: "telegram", PeerID: "1", CreatedAt: now, UpdatedAt: now},
+		{ID: "s-2", AgentID: "default", Channel: "slack", PeerID: "2", CreatedAt: now, UpdatedAt: now.Add(time.Minute)},
+	} {
+		if err := f.db.CreateSession(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, content := range []string{"hello", "hi", "bye"} {
+		if err := f.db.AppendMessage(ctx, &store.Message{
+			ID: content, SessionID: "s-1", Role: "user", Content: content,
+			TokenCount: 2, CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := f.do(t, http.MethodGet, "/api/v1/sessions?channel=telegram", "")
+	list := decodeBody[struct{ Sessions []adminSession }](t, rec)
+	if rec.Code != http.StatusOK || len(list.Sessions) != 1 || list.Sessions[0].ID != "s-1" {
+		t.Fatalf("list = %d %+v", rec.Code, list)
+	}
+
+	rec = f.do(t, http.MethodGet, "/api/v1/sessions/s-1", "")
+	sess := decodeBody[adminSession](t, rec)
+	if sess.MessageCount == nil || *sess.MessageCount != 3 || sess.TokenUsage == nil || *sess.TokenUsage != 6 {
+		t.Errorf("session = %+v", sess)
+	}
+
+	rec = f.do(t, http.MethodGet, "/api/v1/sessions/s-1/messages?limit=2", "")
+	msgs := decodeBody[struct{ Messages []adminMessage }](t, rec)
+	if len(msgs.Messages) != 2 || msgs.Messages[0].Content != "hi" || msgs.Messages[1].Content != "bye" {
+		t.Errorf("messages = %+v", msgs.Messages)
+	}
+	rec = f.do(t, http.MethodGet, "/api/v1/sessions/s-1/messages?limit=2&offset=2", "")
+	msgs = decodeBody[struct{ Messages []adminMessage }](t, rec)
+	if len(msgs.Messages) != 1 || msgs.Messages[0].Content != "hello" {
+		t.Errorf("messages at offset 2 = %+v", msgs.Messages)
+	}
+
+	if rec := f.do(t, http.MethodGet, "/api/v1/sessions/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing session status = %d", rec.Code)
+	}
+	if rec := f.do(t, http.MethodGet, "/api/v1/sessions?limit=0", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("limit=0 status = %d", rec.Code)
+	}
+}
+
+func TestAdminMemory(t *testing.T) {
+	f := newAdminFixture(t)
+
+	rec := f.do(t, http.MethodPut, "/api/v1/agents/default/memory/color", `{"value":"blue"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if e := decodeBody[adminMemoryEntry](t, rec); e.Value != "blue" {
+		t.Errorf("put returned %+v", e)
+	}
+
+	rec = f.do(t, http.MethodGet, "/api/v1/agents/default/memory", "")
+	list := decodeBody[struct{ Memory []adminMemoryEntry }](t, rec)
+	if len(list.Memory) != 1 || list.Memory[0].Key != "color" {
+		t.Errorf("list = %+v", list)
+	}
+
+	if rec := f.do(t, http.MethodDelete, "/api/v1/agents/default/memory/color", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", rec.Code)
+	}
+	if rec := f.do(t, http.MethodGet, "/api/v1/agents/default/memory/color", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete status = %d", rec.Code)
+	}
+
+	f.do(t, http.MethodPut, "/api/v1/agents/default/memory/identity", `{"value":"pincer"}`)
+	if rec := f.do(t, http.MethodPut, "/api/v1/agents/default/memory/identity", `{"value":"other"}`); rec.Code != http.StatusConflict {
+		t.Errorf("immutable put status = %d", rec.Code)
+	}
+
+	entries, err := f.auditLog.Query(context.Background(), audit.Filter{AgentID: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Actor != adminActor {
+		t.Errorf("audit entries = %+v, want 3 by %s", entries, adminActor)
+	}
+}
+
+func TestAdminCredentials(t *testing.T) {
+	f := newAdminFixture(t)
+
+	if rec := f.do(t, http.MethodPut, "/api/v1/credentials/github", `{"value":"ghp_secret"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("put status = %d", rec.Code)
+	}
+	rec := f.do(t, http.MethodGet, "/api/v1/credentials", "")
+	if strings.Contains(rec.Body.String(), "ghp_secret") {
+		t.Fatal("credential value leaked")
+	}
+	list := decodeBody[struct{ Entries []credentials.Entry }](t, rec)
+	if len(list.Entries) != 1 || list.Entries[0].Name != "github" {
+		t.Errorf("list = %+v", list)
+	}
+
+	if rec := f.do(t, http.MethodPut, "/api/v1/credentials/github", `{"value":"ghp_2","scopes":["mcp:github"]}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("put with scopes status = %d", rec.Code)
+	}
+	if scopes, err := f.creds.Scopes(context.Background(), "github"); err != nil || len(scopes) != 1 || scopes[0] != "mcp:github" {
+		t.Errorf("scopes = %v, %v", scopes, err)
+	}
+	if rec := f.do(t, http.MethodPut, "/api/v1/credentials/github", `{"value":"x","scopes":["nope"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid scope status = %d", rec.Code)
+	}
+
+	if rec := f.do(t, http.MethodDelete, "/api/v1/credentials/github", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", rec.Code)
+	}
+	if rec := f.do(t, http.MethodDelete, "/api/v1/credentials/github", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d", rec.Code)
+	}
+}
+
+func TestAdminApprovals(t *testing.T) {
+	f := newAdminFixture(t)
+
+	result := make(chan bool, 1)
+	go func() {
+		approved, _ := f.approver.RequestApproval(context.Background(), agent.ApprovalRequest{
+			ID: "req-1", SessionID: "s-1", ToolName: "shell", Input: `{"cmd":"ls"}`,
+		})
+		result <- approved
+	}()
+
+	var pending []adminApproval
+	for range 100 {
+		rec := f.do(t, http.MethodGet, "/api/v1/approvals", "")
+		pending = decodeBody[struct{ Approvals []adminApproval }](t, rec).Approvals
+		if len(pending) > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(pending) != 1 || pending[0].ID != "req-1" || pending[0].ToolName != "shell" {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	if rec := f.do(t, http.MethodPost, "/api/v1/approvals/req-1", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing approved status = %d", rec.Code)
+	}
+	if rec := f.do(t, http.MethodPost, "/api/v1/approvals/req-1", `{"approved":true}`); rec.Code != http.StatusNoContent {
+		t.Errorf("answer status = %d", rec.Code)
+	}
+	if !<-result {
+		t.Error("request was not approved")
+	}
+	if rec := f.do(t, http.MethodPost, "/api/v1/approvals/req-1", `{"approved":true}`); rec.Code != http.StatusNotFound {
+		t.Errorf("answered request status = %d", rec.Code)
+	}
+
+	entries, _ := f.auditLog.Query(context.Background(), audit.Filter{EventType: audit.EventApprovalAnswer})
+	if len(entries) != 1 || entries[0].SessionID != "s-1" || entries[0].Actor != adminActor ||
+		!strings.Contains(entries[0].Detail, `"request_id":"req-1"`) || !strings.Contains(entries[0].Detail, `"approved":true`) {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestAdminSpawns(t *testing.T) {
+	f := newAdminFixture(t)
+	f.spawns.spawns = []SpawnInfo{{ID: "sp-1", SessionID: "s-1", Prompt: "research"}}
+
+	rec := f.do(t, http.MethodGet, "/api/v1/spawns", "")
+	list := decodeBody[struct{ Spawns []SpawnInfo }](t, rec)
+	if len(list.Spawns) != 1 || list.Spawns[0].Prompt != "research" {
+		t.Errorf("list = %+v", list)
+	}
+
+	if rec := f.do(t, http.MethodPost, "/api/v1/spawns/sp-1/cancel", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("cancel status = %d", rec.Code)
+	}
+	if rec := f.do(t, http.MethodPost, "/api/v1/spawns/nope/cancel", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown cancel status = %d", rec.Code)
+	}
+	if len(f.spawns.cancelled) != 1 {
+		t.Errorf("cancelled = %v", f.spawns.cancelled)
+	}
+
+	entries, _ := f.auditLog.Query(context.Background(), audit.Filter{EventType: audit.EventSpawnCancel})
+	if len(entries) != 1 || entries[0].SessionID != "s-1" || entries[0].Actor != adminActor || !strings.Contains(entries[0].Detail, "sp-1") {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+	_ = f.auditLog.Log(ctx, audit.EventToolExec, "s-1", "default", "agent", "shell")
+	_ = f.auditLog.Log(ctx, audit.EventToolDeny, "s-2", "default", "agent", "shell")
+
+	rec := f.do(t, http.MethodGet, "/api/v1/audit?session=s-1", "")
+	entries := decodeBody[struct{ Entries []adminAuditEntry }](t, rec).Entries
+	if len(entries) != 1 || entries[0].EventType != audit.EventToolExec {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	if rec := f.do(t, http.MethodGet, "/api/v1/audit?since=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad since status = %d", rec.Code)
+	}
+}
+
+func TestAdminBackups(t *testing.T) {
+	f := newAdminFixture(t)
+
+	rec := f.do(t, http.MethodGet, "/api/v1/backups", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d", rec.Code)
+	}
+	if got := decodeBody[map[string][]backup.Info](t, rec)["backups"]; len(got) != 0 {
+		t.Errorf("backups = %v, want none", got)
+	}
+
+	rec = f.do(t, http.MethodPost, "/api/v1/backups", "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	info := decodeBody[backup.Info](t, rec)
+	if info.Manifest == nil || info.Manifest.SchemaVersion != store.LatestSchemaVersion() {
+		t.Errorf("manifest = %+v", info.Manifest)
+	}
+
+	rec = f.do(t, http.MethodGet, "/api/v1/backups", "")
+	if got := decodeBody[map[string][]backup.Info](t, rec)["backups"]; len(got) != 1 || got[0].Name != info.Name {
+		t.Errorf("backups = %+v", got)
+	}
+
+	entries, _ := f.auditLog.Query(context.Background(), audit.Filter{EventType: audit.EventBackup})
+	if len(entries) != 1 || entries[0].Actor != "admin" {
+		t.Fatalf("audit entries = %+v", entries)
+	}
+	var detail struct {
+		Name  string `json:"name"`
+		Bytes int64  `json:"bytes"`
+	}
+	if err := json.Unmarshal([]byte(entries[0].Detail), &detail); err != nil || detail.Name != info.Name || detail.Bytes != info.Size {
+		t.Errorf("audit detail = %q, %v", entries[0].Detail, err)
+	}
+}
+
+func TestRouterCancelSpawn(t *testing.T) {
+	cr := &ChannelRouter{spawnResults: make(map[string]*spawnResult)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cr.spawnResults["sp-1"] = &spawnResult{SessionID: "s-1", Prompt: "task", StartedAt: time.Now(), cancel: cancel}
+
+	spawns := cr.ListSpawns()
+	if len(spawns) != 1 || spawns[0].ID != "sp-1" || spawns[0].Done {
+		t.Fatalf("ListSpawns = %+v", spawns)
+	}
+	if err := cr.CancelSpawn("sp-1"); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Error("spawn context not cancelled")
+	}
+	if err := cr.CancelSpawn("missing"); err != ErrSpawnNotFound {
+		t.Errorf("CancelSpawn(missing) = %v", err)
+	}
+}
+
+func TestMCPServerRoute(t *testing.T) {
+	mcpServer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	gw := New(Config{AuthToken: "secret", MCPServer: mcpServer})
+
+	rec := httptest.NewRecorder()
+	gw.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token status = %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	gw.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("status = %d, want 202", rec.Code)
+	}
+
+	open := New(Config{MCPServer: mcpServer})
+	rec = httptest.NewRecorder()
+	open.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if rec.Code == http.StatusAccepted {
+		t.Error("the MCP server must not be served without an auth token")
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/llm"
+)
+
+// prepareAttachments writes inbound attachments under the router's
+// attachment directory in the agent workspace. Images are returned for the model to see directly;
+// everything else is described in the returned content so the agent can
+// open it with the file tools.
+func (cr *ChannelRouter) prepareAttachments(msg channels.InboundMessage) (string, []llm.ImageContent) {
+	content := msg.Content
+	if len(msg.Attachments) == 0 {
+		return content, nil
+	}
+
+	dir, err := filepath.Abs(sessionAttachmentDir(cr.attachmentDir, msg.SessionID))
+	if err == nil {
+		err = os.MkdirAll(dir, 0750)
+	}
+	if err != nil {
+		cr.logger.Error("failed to create attachment directory",
+			slog.String("dir", dir),
+			slog.String("err", err.Error()),
+		)
+		return content, nil
+	}
+
+	var images []llm.ImageContent
+	var notes []string
+	for _, att := range msg.Attachments {
+		name := sanitizeFilename(att.Filename)
+		if name == "" {
+			name = "attachment"
+		}
+		path := filepath.Join(dir, uuid.NewString()[:8]+"-"+name)
+		if err := os.WriteFile(path, att.Data, 0600); err != nil {
+			cr.logger.Error("failed to save attachment",
+				slog.String("path", path),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		if att.IsImage() {
+			img := llm.ImageContent{MediaType: att.MediaType, Path: path}
+			img.SetData(att.Data)
+			images = append(images, img)
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("[Attachment saved to %s (%s, %d bytes)]", path, att.MediaType, len(att.Data)))
+	}
+
+	if len(notes) > 0 {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += strings.Join(notes, "\n")
+	}
+	return content, images
+}
+
+// SessionAttachmentDir is where files received for sessionID are kept.
+func SessionAttachmentDir(sessionID string) string {
+	return sessionAttachmentDir(config.AttachmentDir(), sessionID)
+}
+
+// sessionAttachmentDir names the directory of sessionID after the session,
+// with a hash of the full ID so IDs that sanitize alike stay apart.
+func sessionAttachmentDir(root, sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return filepath.Join(root, sanitizeName(sessionID)+"-"+hex.EncodeToString(sum[:6]))
+}
+
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "." || name == string(filepath.Separator) {
+		return ""
+	}
+	return sanitizeName(name)
+}
+
+// sanitizeName replaces everything but letters, digits, '.', '-' and '_'.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/channels"
+)
+
+func TestPrepareAttachments(t *testing.T) {
+	router := NewChannelRouter(nil, nil, nil, slog.Default(), nil, nil)
+	router.attachmentDir = t.TempDir()
+
+	content, images := router.prepareAttachments(channels.InboundMessage{
+		SessionID: "tg-42",
+		Content:   "see attached",
+		Attachments: []channels.Attachment{
+			{Filename: "shot.png", MediaType: "image/png", Data: []byte("png")},
+			{Filename: "../report.pdf", MediaType: "application/pdf", Data: []byte("pdf")},
+		},
+	})
+
+	if len(images) != 1 {
+		t.Fatalf("images = %d, want 1", len(images))
+	}
+	if string(images[0].Data()) != "png" || images[0].MediaType != "image/png" {
+		t.Errorf("image = %+v", images[0])
+	}
+	if _, err := os.Stat(images[0].Path); err != nil {
+		t.Errorf("image not saved: %v", err)
+	}
+	if !filepath.IsAbs(images[0].Path) {
+		t.Errorf("image path %q is not absolute", images[0].Path)
+	}
+
+	if !strings.HasPrefix(content, "see attached\n\n[Attachment saved to ") {
+		t.Fatalf("content = %q", content)
+	}
+	if !strings.Contains(content, "report.pdf (application/pdf, 3 bytes)") {
+		t.Errorf("content missing document note: %q", content)
+	}
+	if strings.Contains(content, "..") {
+		t.Errorf("document path escaped the attachment dir: %q", content)
+	}
+}
+
+func TestSessionAttachmentDirKeepsSessionsApart(t *testing.T) {
+	a := sessionAttachmentDir("/data", "slack-T1/C2")
+	b := sessionAttachmentDir("/data", "slack-T1_C2")
+	if a == b {
+		t.Errorf("sessions share attachment dir %s", a)
+	}
+	if a != sessionAttachmentDir("/data", "slack-T1/C2") {
+		t.Error("attachment dir is not stable")
+	}
+	if filepath.Dir(a) != "/data" || !strings.HasPrefix(filepath.Base(a), "slack-T1_C2-") {
+		t.Errorf("attachment dir = %s", a)
+	}
+}
+
+func TestPrepareAttachments_NoAttachments(t *testing.T) {
+	router := NewChannelRouter(nil, nil, nil, slog.Default(), nil, nil)
+	content, images := router.prepareAttachments(channels.InboundMessage{Content: "hi"})
+	if content != "hi" || images != nil {
+		t.Errorf("got %q, %v; want unchanged content and no images", content, images)
+	}
+}
@@ -13,7 +13,12 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/audit"
 	"github.com/igorsilveira/pincer/pkg/channels/webchat"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/credentials"
+	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/store"
 	"github.com/igorsilveira/pincer/pkg/telemetry"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -28,6 +33,18 @@ type Gateway struct {
 	webhooks   http.Handler
 	a2aHandler http.Handler
 	authToken  string
+
+	// attachmentDir holds images received through the OpenAI API.
+	attachmentDir string
+
+	store       *store.Store
+	memory      *memory.Store
+	credentials *credentials.Store
+	auditLog    *audit.Logger
+	spawns      SpawnManager
+	backups     BackupManager
+	mcp         MCPStatus
+	mcpServer   http.Handler
 }
 
 type Config struct {
@@ -40,6 +57,19 @@ type Config struct {
 	Webhooks   http.Handler
 	A2AHandler http.Handler
 	AuthToken  string
+	// MCPServer serves Pincer's tools over streamable HTTP at /mcp. Like the
+	// admin API it needs AuthToken.
+	MCPServer http.Handler
+
+	// Admin API backends. The API is only served when AuthToken is set,
+	// and each nil backend leaves its routes out.
+	Store       *store.Store
+	Memory      *memory.Store
+	Credentials *credentials.Store
+	AuditLog    *audit.Logger
+	Spawns      SpawnManager
+	Backups     BackupManager
+	MCP         MCPStatus
 }
 
 func New(cfg Config) *Gateway {
@@ -51,6 +81,7 @@ func New(cfg Config) *Gateway {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(traceRequests)
 
 	g := &Gateway{
 		router:     r,
@@ -61,6 +92,17 @@ func New(cfg Config) *Gateway {
 		webhooks:   cfg.Webhooks,
 		a2aHandler: cfg.A2AHandler,
 		authToken:  cfg.AuthToken,
+
+		attachmentDir: config.AttachmentDir(),
+
+		store:       cfg.Store,
+		memory:      cfg.Memory,
+		credentials: cfg.Credentials,
+		auditLog:    cfg.AuditLog,
+		spawns:      cfg.Spawns,
+		backups:     cfg.Backups,
+		mcp:         cfg.MCP,
+		mcpServer:   cfg.MCPServer,
 	}
 
 	g.registerRoutes()
@@ -94,6 +136,13 @@ func (g *Gateway) registerRoutes() {
 		if g.webhooks != nil {
 			r.Post("/webhooks", g.webhooks.ServeHTTP)
 		}
+		g.registerOpenAIRoutes(r)
+		if g.authToken != "" {
+			g.registerAdminRoutes(r)
+			if g.mcpServer != nil {
+				r.Handle("/mcp", g.mcpServer)
+			}
+		}
 	})
 }
 
@@ -0,0 +1,467 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/llm"
+)
+
+// OpenAI-compatible chat completions. Pincer keeps conversation history
+// server-side, so only the last user message of a request is sent to the
+// agent; earlier messages and client system prompts are ignored in favour of
+// the stored session and the agent's soul.
+
+const (
+	headerSession    = "X-Pincer-Session"
+	headerToolEvents = "X-Pincer-Tool-Events"
+	apiModelPrefix   = "pincer"
+
+	// maxChatRequestBytes bounds a chat completion request. It leaves room
+	// for a channel-sized attachment after base64 encoding.
+	maxChatRequestBytes = 32 << 20
+)
+
+// APIChannel is the channel of sessions driven through the OpenAI-compatible
+// API.
+const APIChannel = "api"
+
+// APISessionID returns the ID under which the API serves session id. API
+// clients are kept out of sessions that belong to other channels, so every
+// API session ID carries the channel prefix.
+func APISessionID(id string) string {
+	if strings.HasPrefix(id, APIChannel+"-") {
+		return id
+	}
+	return APIChannel + "-" + id
+}
+
+type chatCompletionRequest struct {
+	Model    string                  `json:"model"`
+	Messages []chatCompletionMessage `json:"messages"`
+	Stream   bool                    `json:"stream"`
+	User     string                  `json:"user"`
+}
+
+type chatCompletionMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type chatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+	Usage   *chatCompletionUsage   `json:"usage,omitempty"`
+
+	// PincerEvent carries tool activity when requested with the
+	// X-Pincer-Tool-Events header. OpenAI clients ignore it.
+	PincerEvent *pincerEvent `json:"pincer_event,omitempty"`
+}
+
+type chatCompletionChoice struct {
+	Index        int                `json:"index"`
+	Message      *chatResponseDelta `json:"message,omitempty"`
+	Delta        *chatResponseDelta `json:"delta,omitempty"`
+	FinishReason *string            `json:"finish_reason"`
+}
+
+type chatResponseDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type pincerEvent struct {
+	Type      string `json:"type"`
+	Tool      string `json:"tool,omitempty"`
+	Input     string `json:"input,omitempty"`
+	Message   string `json:"message,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type openAIError struct {
+	Error openAIErrorBody `json:"error"`
+}
+
+type openAIErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func (g *Gateway) registerOpenAIRoutes(r chi.Router) {
+	r.Get("/v1/models", g.handleListModels)
+	r.Post("/v1/chat/completions", g.handleChatCompletions)
+	// Answering approvals lets a client run tools, so it needs a token.
+	if g.authToken != "" {
+		r.Post("/v1/approvals/{id}", g.handleAPIApproval)
+	}
+}
+
+func (g *Gateway) handleListModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+	var models []model
+	for _, id := range g.runtime.Agents() {
+		models = append(models, model{ID: apiModelName(id), Object: "model", OwnedBy: "pincer"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": models})
+}
+
+func (g *Gateway) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatCompletionRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxChatRequestBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeOpenAIError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeOpenAIError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	text, images, err := lastUserMessage(req.Messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	agentID, ok := g.agentForModel(req.Model)
+	if !ok {
+		writeOpenAIError(w, http.StatusNotFound, fmt.Sprintf("model %q not found", req.Model))
+		return
+	}
+
+	sessionID := r.Header.Get(headerSession)
+	peerID := req.User
+	if peerID == "" {
+		peerID = "anonymous"
+	}
+	switch {
+	case sessionID != "":
+		sessionID = APISessionID(sessionID)
+	case req.User != "":
+		sessionID = APIChannel + "-" + req.User
+	default:
+		sessionID = APIChannel + "-" + uuid.NewString()
+	}
+
+	// Approval requests can only be answered by authenticated streaming
+	// clients that asked for tool events; everyone else has them denied
+	// instead of hanging.
+	toolEvents := req.Stream && r.Header.Get(headerToolEvents) == "true" && g.authToken != ""
+	ctx := r.Context()
+	if !toolEvents {
+		ctx = agent.WithApprovalsDenied(ctx)
+	}
+	if _, err := g.runtime.EnsureSession(ctx, sessionID, agentID, APIChannel, peerID); err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+	if err := g.saveAPIImages(sessionID, images); err != nil {
+		g.logger.Error("failed to save api images",
+			slog.String("session_id", sessionID),
+			slog.String("err", err.Error()),
+		)
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to save images")
+		return
+	}
+
+	events, err := g.runtime.RunTurn(ctx, sessionID, text, images...)
+	if err != nil {
+		g.logger.Error("api turn failed",
+			slog.String("session_id", sessionID),
+			slog.String("err", err.Error()),
+		)
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to process message")
+		return
+	}
+
+	resp := chatCompletionResponse{
+		ID:      "chatcmpl-" + uuid.NewString(),
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+	if resp.Model == "" {
+		resp.Model = apiModelName(agentID)
+	}
+	w.Header().Set(headerSession, sessionID)
+
+	if req.Stream {
+		g.streamChatCompletion(w, resp, events, toolEvents)
+		return
+	}
+
+	var content string
+	for ev := range events {
+		switch ev.Type {
+		case agent.TurnDone:
+			content = ev.Message
+			resp.Usage = completionUsage(ev.Usage)
+		case agent.TurnError:
+			writeOpenAIError(w, http.StatusInternalServerError, ev.Error.Error())
+			drain(events)
+			return
+		}
+	}
+
+	stop := "stop"
+	resp.Object = "chat.completion"
+	resp.Choices = []chatCompletionChoice{{
+		Message:      &chatResponseDelta{Role: "assistant", Content: content},
+		FinishReason: &stop,
+	}}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (g *Gateway) streamChatCompletion(w http.ResponseWriter, base chatCompletionResponse, events <-chan agent.TurnEvent, toolEvents bool) {
+	flusher, canFlush := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	base.Object = "chat.completion.chunk"
+
+	write := func(v any) {
+		b, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+	send := func(delta chatResponseDelta, finish *string, ev *pincerEvent) {
+		chunk := base
+		chunk.Choices = []chatCompletionChoice{{Delta: &delta, FinishReason: finish}}
+		chunk.PincerEvent = ev
+		write(chunk)
+	}
+
+	send(chatResponseDelta{Role: "assistant"}, nil, nil)
+
+	for ev := range events {
+		switch ev.Type {
+		case agent.TurnToken:
+			send(chatResponseDelta{Content: ev.Token}, nil, nil)
+		case agent.TurnToolStart:
+			if toolEvents && ev.ToolCall != nil {
+				send(chatResponseDelta{}, nil, &pincerEvent{Type: "tool_start", Tool: ev.ToolCall.Name, Input: string(ev.ToolCall.Input)})
+			}
+		case agent.TurnToolResult:
+			if toolEvents {
+				send(chatResponseDelta{}, nil, &pincerEvent{Type: "tool_result", Message: ev.Message})
+			}
+		case agent.TurnApprovalNeeded:
+			send(chatResponseDelta{}, nil, &pincerEvent{
+				Type:      "approval_needed",
+				Tool:      ev.ApprovalRequest.ToolName,
+				Input:     ev.ApprovalRequest.Input,
+				RequestID: ev.ApprovalRequest.ID,
+			})
+		case agent.TurnError:
+			write(openAIError{Error: openAIErrorBody{Message: ev.Error.Error(), Type: "server_error"}})
+		}
+	}
+
+	stop := "stop"
+	send(chatResponseDelta{}, &stop, nil)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if canFlush {
+		flusher.Flush()
+	}
+}
+
+// handleAPIApproval answers a tool approval announced by an approval_needed
+// event.
+func (g *Gateway) handleAPIApproval(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Approved bool `json:"approved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if g.approver == nil {
+		writeOpenAIError(w, http.StatusNotFound, "approvals are not enabled")
+		return
+	}
+	g.approver.Respond(agent.ApprovalResponse{
+		RequestID: chi.URLParam(r, "id"),
+		Approved:  body.Approved,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// agentForModel maps a model name to an agent. "pincer" and the empty string
+// select the routed agent; "pincer/<id>" or a bare agent ID select that agent.
+func (g *Gateway) agentForModel(model string) (string, bool) {
+	if model == "" || model == apiModelPrefix {
+		return "", true
+	}
+	id := strings.TrimPrefix(model, apiModelPrefix+"/")
+	if slices.Contains(g.runtime.Agents(), id) {
+		return id, true
+	}
+	return "", false
+}
+
+func apiModelName(agentID string) string {
+	return apiModelPrefix + "/" + agentID
+}
+
+func lastUserMessage(msgs []chatCompletionMessage) (string, []llm.ImageContent, error) {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != "user" {
+			continue
+		}
+		text, images, err := parseMessageContent(msgs[i].Content)
+		if err != nil {
+			return "", nil, err
+		}
+		if text == "" && len(images) == 0 {
+			return "", nil, fmt.Errorf("last user message is empty")
+		}
+		return text, images, nil
+	}
+	return "", nil, fmt.Errorf("messages must include a user message")
+}
+
+func parseMessageContent(raw json.RawMessage) (string, []llm.ImageContent, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, nil
+	}
+
+	var parts []chatContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, fmt.Errorf("content must be a string or an array of parts")
+	}
+
+	var texts []string
+	var images []llm.ImageContent
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			texts = append(texts, p.Text)
+		case "image_url":
+			img, err := decodeDataURL(p.ImageURL.URL)
+			if err != nil {
+				return "", nil, err
+			}
+			images = append(images, img)
+		}
+	}
+	return strings.Join(texts, "\n"), images, nil
+}
+
+// decodeDataURL accepts base64 "data:" URLs only; the gateway does not fetch
+// remote images.
+func decodeDataURL(url string) (llm.ImageContent, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return llm.ImageContent{}, fmt.Errorf("only data: image URLs are supported")
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !isBase64 {
+		return llm.ImageContent{}, fmt.Errorf("image URL must be base64-encoded")
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return llm.ImageContent{}, fmt.Errorf("image URL has media type %q, want image/*", mediaType)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return llm.ImageContent{}, fmt.Errorf("decoding image: %w", err)
+	}
+	img := llm.ImageContent{MediaType: mediaType}
+	img.SetData(data)
+	return img, nil
+}
+
+// saveAPIImages writes decoded images under the session's attachment
+// directory so they survive a reload of the session history.
+func (g *Gateway) saveAPIImages(sessionID string, images []llm.ImageContent) error {
+	if len(images) == 0 {
+		return nil
+	}
+	dir := sessionAttachmentDir(g.attachmentDir, sessionID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	for i := range images {
+		path := filepath.Join(dir, uuid.NewString()[:8]+"-image"+imageExtension(images[i].MediaType))
+		if err := os.WriteFile(path, images[i].Data(), 0600); err != nil {
+			return err
+		}
+		images[i].Path = path
+	}
+	return nil
+}
+
+func imageExtension(mediaType string) string {
+	_, sub, ok := strings.Cut(mediaType, "/")
+	if !ok {
+		return ""
+	}
+	return "." + sanitizeFilename(sub)
+}
+
+func completionUsage(u *llm.Usage) *chatCompletionUsage {
+	if u == nil {
+		return nil
+	}
+	return &chatCompletionUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+func drain(events <-chan agent.TurnEvent) {
+	for range events {
+	}
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, msg string) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	writeJSON(w, status, openAIError{Error: openAIErrorBody{Message: msg, Type: errType}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
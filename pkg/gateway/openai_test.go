@@ -0,0 +1,269 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/store"
+)
+
+func testAPIGateway(t *testing.T) (*Gateway, *recordingProvider) {
+	t.Helper()
+	provider := &recordingProvider{}
+	st := testStore(t)
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: provider,
+		Store:    st,
+		Approver: agent.NewApprover(agent.ApprovalAuto, nil),
+		Model:    "fake-1",
+		Agents:   []agent.AgentProfile{{ID: "ops"}},
+	})
+	g := New(Config{Runtime: runtime, Store: st, AuthToken: "secret"})
+	g.attachmentDir = t.TempDir()
+	return g, provider
+}
+
+func postCompletion(g *Gateway, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	g.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChatCompletions(t *testing.T) {
+	g, provider := testAPIGateway(t)
+
+	rec := postCompletion(g, `{
+		"model": "pincer/ops",
+		"user": "ide-1",
+		"messages": [
+			{"role": "system", "content": "ignored"},
+			{"role": "user", "content": "earlier"},
+			{"role": "assistant", "content": "reply"},
+			{"role": "user", "content": [{"type": "text", "text": "hello"}]}
+		]
+	}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var resp chatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "chat.completion" || resp.Model != "pincer/ops" {
+		t.Errorf("resp = %+v", resp)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "hi there" {
+		t.Errorf("choices = %+v", resp.Choices)
+	}
+	if got := rec.Header().Get(headerSession); got != "api-ide-1" {
+		t.Errorf("session header = %q", got)
+	}
+
+	msgs := provider.requests[0].Messages
+	if len(msgs) != 1 || msgs[0].Content != "hello" {
+		t.Errorf("agent saw %+v, want only the last user message", msgs)
+	}
+
+	sess, err := g.runtime.EnsureSession(context.Background(), "api-ide-1", "", APIChannel, "ide-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.AgentID != "ops" || sess.Channel != APIChannel {
+		t.Errorf("session = %+v", sess)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	g, _ := testAPIGateway(t)
+
+	rec := postCompletion(g, `{"stream": true, "messages": [{"role": "user", "content": "hello"}]}`,
+		map[string]string{headerSession: "my-session"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var content strings.Builder
+	var sawDone, sawStop bool
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			sawDone = true
+			continue
+		}
+		var chunk chatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("object = %q", chunk.Object)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		if fr := chunk.Choices[0].FinishReason; fr != nil && *fr == "stop" {
+			sawStop = true
+		}
+	}
+	if content.String() != "hi there" || !sawStop || !sawDone {
+		t.Errorf("content = %q, stop = %v, done = %v", content.String(), sawStop, sawDone)
+	}
+}
+
+func TestChatCompletionsSessionHeader(t *testing.T) {
+	g, _ := testAPIGateway(t)
+
+	for header, want := range map[string]string{
+		"tg-12345":  "api-tg-12345",
+		"api-ide-2": "api-ide-2",
+	} {
+		rec := postCompletion(g, `{"messages": [{"role": "user", "content": "hello"}]}`,
+			map[string]string{headerSession: header})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get(headerSession); got != want {
+			t.Errorf("session for header %q = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestChatCompletionsContinuesFork(t *testing.T) {
+	g, provider := testAPIGateway(t)
+	ctx := context.Background()
+
+	if _, err := g.runtime.EnsureSession(ctx, "tg-1", "ops", "telegram", "42"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.store.AppendMessage(ctx, &store.Message{
+		ID: "m1", SessionID: "tg-1", Role: "user", Content: "remember the blue door",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	forkID := APISessionID("fork-1")
+	if _, err := g.store.ForkSession(ctx, "tg-1", forkID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := postCompletion(g, `{"model": "pincer/ops", "messages": [{"role": "user", "content": "which door?"}]}`,
+		map[string]string{headerSession: forkID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(headerSession); got != forkID {
+		t.Errorf("session header = %q, want %q", got, forkID)
+	}
+
+	msgs := provider.requests[0].Messages
+	if len(msgs) != 2 || msgs[0].Content != "remember the blue door" || msgs[1].Content != "which door?" {
+		t.Errorf("agent saw %+v, want the forked history followed by the new message", msgs)
+	}
+}
+
+func TestChatCompletionsImagesSurviveReload(t *testing.T) {
+	g, _ := testAPIGateway(t)
+
+	rec := postCompletion(g, `{
+		"user": "ide-img",
+		"messages": [{"role": "user", "content": [
+			{"type": "text", "text": "what is this?"},
+			{"type": "image_url", "image_url": {"url": "data:image/png;base64,aGVsbG8="}}
+		]}]
+	}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	msgs, err := g.store.Messages(context.Background(), "api-ide-img")
+	if err != nil || len(msgs) == 0 {
+		t.Fatalf("messages = %v, err = %v", msgs, err)
+	}
+	images := agent.MessageToLLM(msgs[0]).Images
+	if len(images) != 1 || images[0].Path == "" {
+		t.Fatalf("reloaded images = %+v, want one saved image", images)
+	}
+	data, err := os.ReadFile(images[0].Path)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("saved image = %q, err = %v", data, err)
+	}
+}
+
+func TestAPIApprovalsRequireAuth(t *testing.T) {
+	g := New(Config{Runtime: agent.NewRuntime(agent.RuntimeConfig{
+		Provider: &recordingProvider{},
+		Store:    testStore(t),
+		Model:    "fake-1",
+	}), Approver: agent.NewApprover(agent.ApprovalAuto, nil)})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/approvals/req-1", strings.NewReader(`{"approved": true}`))
+	rec := httptest.NewRecorder()
+	g.router.ServeHTTP(rec, req)
+	if rec.Code == http.StatusNoContent {
+		t.Error("approval accepted without an auth token")
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	g, _ := testAPIGateway(t)
+
+	tests := map[string]struct {
+		body string
+		code int
+	}{
+		"bad json":        {`{`, http.StatusBadRequest},
+		"no user message": {`{"messages": [{"role": "system", "content": "x"}]}`, http.StatusBadRequest},
+		"unknown model":   {`{"model": "gpt-4o", "messages": [{"role": "user", "content": "x"}]}`, http.StatusNotFound},
+		"remote image":    {`{"messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}]}]}`, http.StatusBadRequest},
+		"non-image data":  {`{"messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "data:text/html;base64,PGI+"}}]}]}`, http.StatusBadRequest},
+		"too large":       {`{"messages": [{"role": "user", "content": "` + strings.Repeat("x", maxChatRequestBytes) + `"}]}`, http.StatusRequestEntityTooLarge},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := postCompletion(g, tt.body, nil)
+			if rec.Code != tt.code {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.code, rec.Body)
+			}
+			var e openAIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || e.Error.Message == "" {
+				t.Errorf("body = %s, want OpenAI error", rec.Body)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	g.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d", rec.Code)
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	img, err := decodeDataURL("data:image/png;base64,aGVsbG8=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.MediaType != "image/png" {
+		t.Errorf("MediaType = %q", img.MediaType)
+	}
+	if _, err := decodeDataURL("data:image/png,hello"); err == nil {
+		t.Error("expected error for non-base64 data URL")
+	}
+}
@@ -2,8 +2,10 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,19 +15,40 @@ import (
 	"github.com/igorsilveira/pincer/pkg/agent/tools"
 	"github.com/igorsilveira/pincer/pkg/audit"
 	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/config"
 	"github.com/igorsilveira/pincer/pkg/store"
 	"github.com/igorsilveira/pincer/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const spawnResultTTL = 30 * time.Minute
 
 type spawnResult struct {
-	Done   bool
-	Result string
-	Error  string
-	DoneAt time.Time
+	SessionID string
+	Prompt    string
+	StartedAt time.Time
+	Done      bool
+	Result    string
+	Error     string
+	DoneAt    time.Time
+	cancel    context.CancelFunc
 }
 
+// SpawnInfo describes a background task started by the spawn tool.
+type SpawnInfo struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Prompt    string    `json:"prompt"`
+	StartedAt time.Time `json:"started_at"`
+	Done      bool      `json:"done"`
+	Error     string    `json:"error,omitempty"`
+	DoneAt    time.Time `json:"done_at,omitzero"`
+}
+
+var ErrSpawnNotFound = errors.New("spawn not found")
+
 type ChannelRouter struct {
 	runtime        *agent.Runtime
 	adapters       []channels.Adapter
@@ -35,20 +58,38 @@ type ChannelRouter struct {
 	auditLog       *audit.ToolLogger
 	spawnResults   map[string]*spawnResult
 	spawnResultsMu sync.Mutex
+	attachmentDir  string
+	groupRespond   map[string]channels.GroupRespondMode
+	access         *AccessControl
 }
 
 func NewChannelRouter(runtime *agent.Runtime, adapters []channels.Adapter, approver *agent.Approver, logger *slog.Logger, db *store.Store, auditLog *audit.Logger) *ChannelRouter {
 	return &ChannelRouter{
-		runtime:      runtime,
-		adapters:     adapters,
-		approver:     approver,
-		logger:       logger,
-		store:        db,
-		auditLog:     audit.NewToolLogger(auditLog, "router"),
-		spawnResults: make(map[string]*spawnResult),
+		runtime:       runtime,
+		adapters:      adapters,
+		approver:      approver,
+		logger:        logger,
+		store:         db,
+		auditLog:      audit.NewToolLogger(auditLog, "router"),
+		spawnResults:  make(map[string]*spawnResult),
+		attachmentDir: config.AttachmentDir(),
+		groupRespond:  make(map[string]channels.GroupRespondMode),
 	}
 }
 
+// SetGroupRespondMode sets when the agent answers in group chats on channel.
+// Channels without a mode answer only when mentioned. It must be called
+// before Start.
+func (cr *ChannelRouter) SetGroupRespondMode(channel string, mode channels.GroupRespondMode) {
+	cr.groupRespond[channel] = mode
+}
+
+// SetAccessControl enables per-peer authorization. Without it every peer is
+// treated as an admin. It must be called before Start.
+func (cr *ChannelRouter) SetAccessControl(ac *AccessControl) {
+	cr.access = ac
+}
+
 func (cr *ChannelRouter) Start(ctx context.Context) {
 	for _, adapter := range cr.adapters {
 		go cr.listenAdapter(ctx, adapter)
@@ -87,17 +128,11 @@ func (cr *ChannelRouter) listenAdapter(ctx context.Context, adapter channels.Ada
 				return
 			}
 			if msg.ApprovalResponse != nil {
-				cr.approver.Respond(agent.ApprovalResponse{
-					RequestID: msg.ApprovalResponse.RequestID,
-					Approved:  msg.ApprovalResponse.Approved,
-				})
+				cr.respondApproval(ctx, adapter, msg, *msg.ApprovalResponse)
 				continue
 			}
 			if resp, ok := parseTextApproval(msg.Content); ok {
-				cr.approver.Respond(agent.ApprovalResponse{
-					RequestID: resp.RequestID,
-					Approved:  resp.Approved,
-				})
+				cr.respondApproval(ctx, adapter, msg, resp)
 				continue
 			}
 			go cr.handleMessage(ctx, adapter, msg)
@@ -105,25 +140,97 @@ func (cr *ChannelRouter) listenAdapter(ctx context.Context, adapter channels.Ada
 	}
 }
 
+func (cr *ChannelRouter) respondApproval(ctx context.Context, adapter channels.Adapter, msg channels.InboundMessage, resp channels.InboundApprovalResponse) {
+	if !cr.access.CanApprove(msg.ChannelName, msg.PeerID) {
+		cr.logger.Warn("approval response rejected",
+			slog.String("channel", msg.ChannelName),
+			slog.String("peer_id", msg.PeerID),
+			slog.String("request_id", resp.RequestID),
+		)
+		cr.auditLog.Log(ctx, audit.EventAccessDeny, msg.SessionID,
+			fmt.Sprintf("channel=%s peer=%s approval=%s", msg.ChannelName, msg.PeerID, resp.RequestID))
+		if msg.SessionID != "" {
+			_ = cr.send(ctx, adapter, channels.OutboundMessage{
+				SessionID: msg.SessionID,
+				Content:   "You are not allowed to answer approval requests.",
+			})
+		}
+		return
+	}
+	cr.approver.Respond(agent.ApprovalResponse{
+		RequestID: resp.RequestID,
+		Approved:  resp.Approved,
+	})
+}
+
 func (cr *ChannelRouter) handleMessage(ctx context.Context, adapter channels.Adapter, msg channels.InboundMessage) {
 	start := time.Now()
+	ctx, span := telemetry.Tracer().Start(ctx, "channel.receive "+msg.ChannelName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("channel.name", msg.ChannelName),
+			attribute.Bool("channel.group", msg.IsGroup),
+			semconv.GenAIConversationID(msg.SessionID),
+		),
+	)
+	defer span.End()
+	ctx = telemetry.WithTraceID(ctx)
 	logger := telemetry.FromContext(ctx)
 
+	reject := func(err error) {
+		logger.Info("message rejected",
+			slog.String("channel", msg.ChannelName),
+			slog.String("peer_id", msg.PeerID),
+			slog.String("reason", err.Error()),
+		)
+		cr.auditLog.Log(ctx, audit.EventAccessDeny, msg.SessionID,
+			fmt.Sprintf("channel=%s peer=%s reason=%s", msg.ChannelName, msg.PeerID, err))
+		span.SetAttributes(attribute.String("channel.rejected", err.Error()))
+	}
+
+	identity, ok := cr.access.Resolve(msg.ChannelName, msg.PeerID)
+	if !ok {
+		if !msg.IsGroup || msg.Mentioned {
+			reject(ErrAccessDenied)
+		}
+		return
+	}
+	if identity.Tools != nil {
+		ctx = agent.WithAllowedTools(ctx, identity.Tools)
+	}
+
 	logger.Info("routing message",
 		slog.String("channel", msg.ChannelName),
 		slog.String("session_id", msg.SessionID),
 		slog.String("peer_id", msg.PeerID),
+		slog.String("role", identity.Role),
 	)
 
 	if cr.store != nil {
 		cr.ensureSession(ctx, msg)
 	}
 
+	if !cr.groupRespond[msg.ChannelName].ShouldRespond(msg) {
+		cr.recordGroupMessage(ctx, msg)
+		return
+	}
+	// Only messages the agent answers count against the rate limit.
+	if err := cr.access.Limit(msg.ChannelName, msg.PeerID, identity); err != nil {
+		reject(err)
+		return
+	}
+
+	content, images := cr.prepareAttachments(msg)
+	if msg.IsGroup {
+		content = attributeSender(msg, content)
+	}
+
 	stopTyping := cr.startTypingLoop(ctx, adapter, msg.SessionID)
 
-	events, err := cr.runtime.RunTurn(ctx, msg.SessionID, msg.Content)
+	events, err := cr.runtime.RunTurn(ctx, msg.SessionID, content, images...)
 	if err != nil {
 		stopTyping()
+		telemetry.RecordError(span, err)
 		telemetry.Metrics.RequestsTotal.WithLabelValues(msg.ChannelName, "error").Inc()
 		telemetry.Metrics.RequestDuration.WithLabelValues(msg.ChannelName).Observe(time.Since(start).Seconds())
 		logger.Error("agent turn failed",
@@ -133,7 +240,9 @@ func (cr *ChannelRouter) handleMessage(ctx context.Context, adapter channels.Ada
 		return
 	}
 
-	fullResponse := cr.consumeTurnEvents(ctx, logger, adapter, msg.SessionID, events)
+	stream := newStreamWriter(adapter, msg.SessionID, logger)
+	stream.start(ctx)
+	fullResponse := cr.consumeTurnEvents(ctx, logger, adapter, msg.SessionID, events, stream)
 
 	stopTyping()
 
@@ -141,28 +250,53 @@ func (cr *ChannelRouter) handleMessage(ctx context.Context, adapter channels.Ada
 	telemetry.Metrics.RequestsTotal.WithLabelValues(msg.ChannelName, "ok").Inc()
 	telemetry.Metrics.RequestDuration.WithLabelValues(msg.ChannelName).Observe(elapsed.Seconds())
 
-	if fullResponse == "" {
-		return
+	for _, rest := range stream.finish(ctx, fullResponse) {
+		if err := cr.send(ctx, adapter, channels.OutboundMessage{
+			SessionID: msg.SessionID,
+			Content:   rest,
+		}); err != nil {
+			logger.Error("failed to send response",
+				slog.String("session_id", msg.SessionID),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
 	}
+}
 
-	if err := adapter.Send(ctx, channels.OutboundMessage{
-		SessionID: msg.SessionID,
-		Content:   fullResponse,
-	}); err != nil {
-		logger.Error("failed to send response",
+// recordGroupMessage keeps a group message the agent is not answering in the
+// session history, so it has the conversation as context when addressed.
+func (cr *ChannelRouter) recordGroupMessage(ctx context.Context, msg channels.InboundMessage) {
+	content := msg.Content
+	for _, att := range msg.Attachments {
+		content += fmt.Sprintf("\n[Attachment: %s (%s)]", att.Filename, att.MediaType)
+	}
+	if err := cr.runtime.RecordMessage(ctx, msg.SessionID, attributeSender(msg, strings.TrimSpace(content))); err != nil {
+		cr.logger.Warn("failed to record group message",
 			slog.String("session_id", msg.SessionID),
 			slog.String("err", err.Error()),
 		)
 	}
 }
 
-func (cr *ChannelRouter) consumeTurnEvents(ctx context.Context, logger *slog.Logger, adapter channels.Adapter, sessionID string, events <-chan agent.TurnEvent) string {
+func attributeSender(msg channels.InboundMessage, content string) string {
+	sender := msg.Sender()
+	if sender == "" {
+		return content
+	}
+	return fmt.Sprintf("[%s]: %s", sender, content)
+}
+
+func (cr *ChannelRouter) consumeTurnEvents(ctx context.Context, logger *slog.Logger, adapter channels.Adapter, sessionID string, events <-chan agent.TurnEvent, stream *streamWriter) string {
 	var fullResponse string
 	for ev := range events {
 		switch ev.Type {
+		case agent.TurnToken:
+			stream.token(ctx, ev.Token)
 		case agent.TurnApprovalNeeded:
 			cr.sendApprovalRequest(ctx, adapter, sessionID, ev.ApprovalRequest)
 		case agent.TurnToolStart:
+			stream.status(ctx, ev.Message)
 			if pr, ok := adapter.(channels.ProgressRenderer); ok {
 				name := ""
 				if ev.ToolCall != nil {
@@ -175,6 +309,7 @@ func (cr *ChannelRouter) consumeTurnEvents(ctx context.Context, logger *slog.Log
 				})
 			}
 		case agent.TurnProgress:
+			stream.status(ctx, ev.Message)
 		case agent.TurnDone:
 			fullResponse = ev.Message
 		case agent.TurnError:
@@ -201,6 +336,7 @@ func (cr *ChannelRouter) sendApprovalRequest(ctx context.Context, adapter channe
 
 	if sender, ok := adapter.(channels.ApprovalSender); ok {
 		if err := sender.SendApprovalRequest(ctx, channelReq); err != nil {
+			telemetry.Metrics.ChannelSendFailures.WithLabelValues(adapter.Name()).Inc()
 			cr.logger.Error("failed to send approval request via adapter",
 				slog.String("channel", adapter.Name()),
 				slog.String("err", err.Error()),
@@ -210,7 +346,7 @@ func (cr *ChannelRouter) sendApprovalRequest(ctx context.Context, adapter channe
 	}
 
 	text := fmt.Sprintf("Tool approval needed: %s\nInput: %s\n\nReply with:\n  approve %s\n  deny %s", req.ToolName, req.Input, req.ID, req.ID)
-	if err := adapter.Send(ctx, channels.OutboundMessage{
+	if err := cr.send(ctx, adapter, channels.OutboundMessage{
 		SessionID: sessionID,
 		Content:   text,
 	}); err != nil {
@@ -221,8 +357,18 @@ func (cr *ChannelRouter) sendApprovalRequest(ctx context.Context, adapter channe
 	}
 }
 
+// send delivers out through adapter, counting failed deliveries per channel.
+func (cr *ChannelRouter) send(ctx context.Context, adapter channels.Adapter, out channels.OutboundMessage) error {
+	err := adapter.Send(ctx, out)
+	if err != nil {
+		telemetry.Metrics.ChannelSendFailures.WithLabelValues(adapter.Name()).Inc()
+	}
+	return err
+}
+
 func (cr *ChannelRouter) ensureSession(ctx context.Context, msg channels.InboundMessage) {
-	if _, _, err := cr.store.GetOrCreateSession(ctx, msg.SessionID, msg.ChannelName, msg.PeerID); err != nil {
+	agentID := cr.runtime.AgentFor(msg.ChannelName, msg.ChatID, msg.PeerID)
+	if _, _, err := cr.store.GetOrCreateSession(ctx, msg.SessionID, agentID, msg.ChannelName, msg.PeerID); err != nil {
 		cr.logger.Warn("failed to ensure session",
 			slog.String("session_id", msg.SessionID),
 			slog.String("err", err.Error()),
@@ -249,6 +395,15 @@ func (cr *ChannelRouter) adapterForSession(ctx context.Context, sessionID string
 	return nil, fmt.Errorf("no adapter found for channel %q", sess.Channel)
 }
 
+// appendMessage records a message sent outside a turn, redacted like the
+// runtime's own messages.
+func (cr *ChannelRouter) appendMessage(ctx context.Context, msg *store.Message) error {
+	if cr.runtime != nil {
+		return cr.runtime.AppendMessage(ctx, msg)
+	}
+	return cr.store.AppendMessage(ctx, msg)
+}
+
 func (cr *ChannelRouter) SendToSession(ctx context.Context, sessionID, content string) error {
 	adapter, err := cr.adapterForSession(ctx, sessionID)
 	if err != nil {
@@ -264,7 +419,7 @@ func (cr *ChannelRouter) SendToSession(ctx context.Context, sessionID, content s
 			Content:     content,
 			CreatedAt:   time.Now().UTC(),
 		}
-		if err := cr.store.AppendMessage(ctx, msg); err != nil {
+		if err := cr.appendMessage(ctx, msg); err != nil {
 			cr.logger.Error("notify: failed to persist send message",
 				slog.String("session_id", sessionID),
 				slog.String("err", err.Error()),
@@ -274,12 +429,55 @@ func (cr *ChannelRouter) SendToSession(ctx context.Context, sessionID, content s
 
 	cr.auditLog.Log(ctx, audit.EventNotifySend, sessionID, fmt.Sprintf("len=%d", len(content)))
 
-	return adapter.Send(ctx, channels.OutboundMessage{
+	return cr.send(ctx, adapter, channels.OutboundMessage{
 		SessionID: sessionID,
 		Content:   content,
 	})
 }
 
+// SendFilesToSession delivers files to the channel behind sessionID. Channels
+// without media support receive a text note listing the files instead.
+func (cr *ChannelRouter) SendFilesToSession(ctx context.Context, sessionID, caption string, files []channels.Attachment) error {
+	adapter, err := cr.adapterForSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("resolving adapter: %w", err)
+	}
+
+	notes := make([]string, 0, len(files))
+	for _, f := range files {
+		notes = append(notes, fmt.Sprintf("[File: %s (%s, %d bytes)]", f.Filename, f.MediaType, len(f.Data)))
+		cr.auditLog.Log(ctx, audit.EventFileSend, sessionID,
+			fmt.Sprintf("channel=%s name=%s type=%s bytes=%d", adapter.Name(), f.Filename, f.MediaType, len(f.Data)))
+	}
+	summary := strings.Join(notes, "\n")
+	if caption != "" {
+		summary = caption + "\n\n" + summary
+	}
+
+	if cr.store != nil {
+		msg := &store.Message{
+			ID:          uuid.NewString(),
+			SessionID:   sessionID,
+			Role:        "assistant",
+			ContentType: store.ContentTypeText,
+			Content:     summary,
+			CreatedAt:   time.Now().UTC(),
+		}
+		if err := cr.appendMessage(ctx, msg); err != nil {
+			cr.logger.Error("send_file: failed to persist message",
+				slog.String("session_id", sessionID),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+
+	out := channels.OutboundMessage{SessionID: sessionID, Content: caption, Attachments: files}
+	if !adapter.Capabilities().SupportsMedia {
+		out = channels.OutboundMessage{SessionID: sessionID, Content: summary}
+	}
+	return cr.send(ctx, adapter, out)
+}
+
 func (cr *ChannelRouter) RunAndDeliver(ctx context.Context, sessionID, prompt string) {
 	ctx = agent.WithAutoApprove(ctx)
 	logger := telemetry.FromContext(ctx)
@@ -313,7 +511,7 @@ func (cr *ChannelRouter) RunAndDeliver(ctx context.Context, sessionID, prompt st
 		return
 	}
 
-	fullResponse := cr.consumeTurnEvents(ctx, logger, adapter, sessionID, events)
+	fullResponse := cr.consumeTurnEvents(ctx, logger, adapter, sessionID, events, nil)
 
 	stopTyping()
 
@@ -321,7 +519,7 @@ func (cr *ChannelRouter) RunAndDeliver(ctx context.Context, sessionID, prompt st
 		return
 	}
 
-	if err := adapter.Send(ctx, channels.OutboundMessage{
+	if err := cr.send(ctx, adapter, channels.OutboundMessage{
 		SessionID: sessionID,
 		Content:   fullResponse,
 	}); err != nil {
@@ -374,15 +572,20 @@ func (cr *ChannelRouter) startTypingLoop(ctx context.Context, adapter channels.A
 
 func (cr *ChannelRouter) RunSpawnAgent(ctx context.Context, sessionID, prompt string, allowedTools []string) string {
 	spawnID := uuid.NewString()
+	spawnCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 
 	cr.spawnResultsMu.Lock()
-	cr.spawnResults[spawnID] = &spawnResult{Done: false}
+	cr.spawnResults[spawnID] = &spawnResult{
+		SessionID: sessionID,
+		Prompt:    prompt,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
 	cr.spawnResultsMu.Unlock()
 
 	cr.auditLog.Log(ctx, audit.EventSpawnStart, sessionID, fmt.Sprintf("spawn_id=%s task=%s", spawnID, prompt))
 
 	go func() {
-		spawnCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 		defer cancel()
 
 		spawnCtx = telemetry.WithLogger(spawnCtx, cr.logger)
@@ -398,15 +601,30 @@ func (cr *ChannelRouter) RunSpawnAgent(ctx context.Context, sessionID, prompt st
 
 		depth := tools.SubagentDepthFromContext(ctx)
 		spawnCtx = tools.WithSubagentDepth(spawnCtx, depth)
+		if names, ok := agent.AllowedToolsFromContext(ctx); ok {
+			spawnCtx = agent.WithAllowedTools(spawnCtx, names)
+		}
 
 		result, err := cr.runtime.RunSubturn(spawnCtx, prompt, allowedTools)
 
+		status := "ok"
+		if errors.Is(spawnCtx.Err(), context.Canceled) {
+			err = errors.New("canceled")
+			status = "canceled"
+		} else if err != nil {
+			status = "error"
+		}
+		telemetry.Metrics.SpawnsTotal.WithLabelValues(status).Inc()
+
 		cr.spawnResultsMu.Lock()
-		now := time.Now()
-		if err != nil {
-			cr.spawnResults[spawnID] = &spawnResult{Done: true, Error: err.Error(), DoneAt: now}
-		} else {
-			cr.spawnResults[spawnID] = &spawnResult{Done: true, Result: result, DoneAt: now}
+		if sr, ok := cr.spawnResults[spawnID]; ok {
+			sr.Done = true
+			sr.DoneAt = time.Now()
+			if err != nil {
+				sr.Error = err.Error()
+			} else {
+				sr.Result = result
+			}
 		}
 		cr.spawnResultsMu.Unlock()
 
@@ -450,6 +668,43 @@ func (cr *ChannelRouter) CheckSpawn(spawnID string) (string, bool, error) {
 	return sr.Result, true, nil
 }
 
+// ListSpawns returns spawned tasks that are running or whose results have
+// not been collected yet, oldest first.
+func (cr *ChannelRouter) ListSpawns() []SpawnInfo {
+	cr.spawnResultsMu.Lock()
+	spawns := make([]SpawnInfo, 0, len(cr.spawnResults))
+	for id, sr := range cr.spawnResults {
+		spawns = append(spawns, SpawnInfo{
+			ID:        id,
+			SessionID: sr.SessionID,
+			Prompt:    sr.Prompt,
+			StartedAt: sr.StartedAt,
+			Done:      sr.Done,
+			Error:     sr.Error,
+			DoneAt:    sr.DoneAt,
+		})
+	}
+	cr.spawnResultsMu.Unlock()
+
+	sort.Slice(spawns, func(i, j int) bool {
+		return spawns[i].StartedAt.Before(spawns[j].StartedAt)
+	})
+	return spawns
+}
+
+// CancelSpawn stops a running spawned task. Its result becomes a
+// "canceled" error. Cancelling a finished task is a no-op.
+func (cr *ChannelRouter) CancelSpawn(spawnID string) error {
+	cr.spawnResultsMu.Lock()
+	sr, ok := cr.spawnResults[spawnID]
+	cr.spawnResultsMu.Unlock()
+
+	if !ok {
+		return ErrSpawnNotFound
+	}
+	sr.cancel()
+	return nil
+}
 
 func parseTextApproval(text string) (channels.InboundApprovalResponse, bool) {
 	text = strings.TrimSpace(text)
@@ -3,12 +3,17 @@ package gateway
 import (
 	"context"
 	"log/slog"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
 	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/redact"
 	"github.com/igorsilveira/pincer/pkg/store"
 )
 
@@ -418,6 +423,50 @@ func TestSendToSessionRoutesToCorrectAdapter(t *testing.T) {
 	}
 }
 
+func TestSendToSessionRedactsStoredMessages(t *testing.T) {
+	db := testStore(t)
+	redactor, err := redact.New([]string{"email"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: &recordingProvider{},
+		Store:    db,
+		Model:    "fake-1",
+		Redactor: redactor,
+	})
+	router := NewChannelRouter(runtime, []channels.Adapter{newFakeAdapter("discord")}, nil, slog.Default(), db, nil)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := db.CreateSession(ctx, &store.Session{
+		ID: "sess-dc-2", AgentID: "default", Channel: "discord", PeerID: "user-99",
+		CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+
+	if err := router.SendToSession(ctx, "sess-dc-2", "mail bob@example.com"); err != nil {
+		t.Fatalf("SendToSession: %v", err)
+	}
+	if err := router.SendFilesToSession(ctx, "sess-dc-2", "for bob@example.com", []channels.Attachment{{Filename: "a.txt", MediaType: "text/plain", Data: []byte("x")}}); err != nil {
+		t.Fatalf("SendFilesToSession: %v", err)
+	}
+
+	msgs, err := db.Messages(ctx, "sess-dc-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(msgs))
+	}
+	for _, m := range msgs {
+		if strings.Contains(m.Content, "bob@example.com") {
+			t.Errorf("stored message not redacted: %q", m.Content)
+		}
+	}
+}
+
 func TestSendToSessionErrorsOnUnknownChannel(t *testing.T) {
 	db := testStore(t)
 	adapter := newFakeAdapter("telegram")
@@ -447,3 +496,281 @@ func TestSendToSessionErrorsOnUnknownChannel(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+type fakeMediaAdapter struct {
+	*fakeAdapter
+}
+
+func (f *fakeMediaAdapter) Capabilities() channels.ChannelCaps {
+	return channels.ChannelCaps{SupportsMedia: true}
+}
+
+func TestSendFilesToSession(t *testing.T) {
+	db := testStore(t)
+	media := &fakeMediaAdapter{fakeAdapter: newFakeAdapter("telegram")}
+	plain := newFakeAdapter("irc")
+	router := NewChannelRouter(nil, []channels.Adapter{media, plain}, nil, slog.Default(), db, nil)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for id, ch := range map[string]string{"sess-tg": "telegram", "sess-irc": "irc"} {
+		if err := db.CreateSession(ctx, &store.Session{
+			ID: id, AgentID: "default", Channel: ch, PeerID: "u", CreatedAt: now, UpdatedAt: now,
+		}); err != nil {
+			t.Fatalf("creating session: %v", err)
+		}
+	}
+
+	files := []channels.Attachment{{Filename: "chart.png", MediaType: "image/png", Data: []byte("png")}}
+
+	if err := router.SendFilesToSession(ctx, "sess-tg", "here you go", files); err != nil {
+		t.Fatalf("SendFilesToSession: %v", err)
+	}
+	sent := media.getSent()
+	if len(sent) != 1 || len(sent[0].Attachments) != 1 {
+		t.Fatalf("sent = %+v, want one message with one attachment", sent)
+	}
+	if sent[0].Content != "here you go" {
+		t.Errorf("Content = %q, want caption", sent[0].Content)
+	}
+
+	if err := router.SendFilesToSession(ctx, "sess-irc", "", files); err != nil {
+		t.Fatalf("SendFilesToSession: %v", err)
+	}
+	sent = plain.getSent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 message to irc, got %d", len(sent))
+	}
+	if len(sent[0].Attachments) != 0 {
+		t.Error("attachments should not be sent to a channel without media support")
+	}
+	if !contains(sent[0].Content, "chart.png") {
+		t.Errorf("fallback content = %q, should name the file", sent[0].Content)
+	}
+
+	msgs, err := db.RecentMessages(ctx, "sess-tg", 10)
+	if err != nil {
+		t.Fatalf("RecentMessages: %v", err)
+	}
+	if len(msgs) != 1 || !contains(msgs[0].Content, "chart.png") {
+		t.Errorf("persisted messages = %+v, want a note naming the file", msgs)
+	}
+}
+
+type recordingProvider struct {
+	mu       sync.Mutex
+	requests []llm.ChatRequest
+}
+
+func (p *recordingProvider) Name() string            { return "fake" }
+func (p *recordingProvider) SupportsStreaming() bool { return true }
+func (p *recordingProvider) SupportsToolUse() bool   { return true }
+func (p *recordingProvider) Models() []llm.ModelInfo { return nil }
+
+func (p *recordingProvider) Chat(_ context.Context, req llm.ChatRequest) (<-chan llm.ChatEvent, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+	ch := make(chan llm.ChatEvent, 2)
+	ch <- llm.ChatEvent{Type: llm.EventToken, Token: "hi there"}
+	ch <- llm.ChatEvent{Type: llm.EventDone, Usage: &llm.Usage{}}
+	close(ch)
+	return ch, nil
+}
+
+func TestGroupMessagesAnswerOnlyWhenMentioned(t *testing.T) {
+	db := testStore(t)
+	provider := &recordingProvider{}
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: provider,
+		Store:    db,
+		Approver: agent.NewApprover(agent.ApprovalAuto, nil),
+		Model:    "fake-1",
+	})
+	adapter := newFakeAdapter("discord")
+	router := NewChannelRouter(runtime, []channels.Adapter{adapter}, nil, slog.Default(), db, nil)
+	ctx := context.Background()
+
+	router.handleMessage(ctx, adapter, channels.InboundMessage{
+		ChannelName: "discord",
+		SessionID:   "dc-general",
+		PeerID:      "u1",
+		SenderName:  "alice",
+		Content:     "lunch at noon?",
+		IsGroup:     true,
+	})
+	if len(adapter.getSent()) != 0 || len(provider.requests) != 0 {
+		t.Fatal("unaddressed group message should not be answered")
+	}
+
+	router.handleMessage(ctx, adapter, channels.InboundMessage{
+		ChannelName: "discord",
+		SessionID:   "dc-general",
+		PeerID:      "u2",
+		SenderName:  "bob",
+		Content:     "@pincer what did alice ask?",
+		IsGroup:     true,
+		Mentioned:   true,
+	})
+	if len(adapter.getSent()) != 1 {
+		t.Fatalf("sent = %d, want 1", len(adapter.getSent()))
+	}
+
+	msgs := provider.requests[0].Messages
+	if len(msgs) != 2 {
+		t.Fatalf("history = %d messages, want 2", len(msgs))
+	}
+	if msgs[0].Content != "[alice (u1)]: lunch at noon?" {
+		t.Errorf("recorded = %q", msgs[0].Content)
+	}
+	if msgs[1].Content != "[bob (u2)]: @pincer what did alice ask?" {
+		t.Errorf("prompt = %q", msgs[1].Content)
+	}
+}
+
+func TestGroupPassiveModeNeverAnswers(t *testing.T) {
+	db := testStore(t)
+	provider := &recordingProvider{}
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: provider,
+		Store:    db,
+		Approver: agent.NewApprover(agent.ApprovalAuto, nil),
+		Model:    "fake-1",
+	})
+	adapter := newFakeAdapter("slack")
+	router := NewChannelRouter(runtime, []channels.Adapter{adapter}, nil, slog.Default(), db, nil)
+	router.SetGroupRespondMode("slack", channels.GroupRespondPassive)
+	ctx := context.Background()
+
+	router.handleMessage(ctx, adapter, channels.InboundMessage{
+		ChannelName: "slack",
+		SessionID:   "sl-C1",
+		PeerID:      "U1",
+		Content:     "<@B1> ping",
+		IsGroup:     true,
+		Mentioned:   true,
+	})
+	if len(adapter.getSent()) != 0 || len(provider.requests) != 0 {
+		t.Fatal("passive mode should not answer")
+	}
+	if n, _ := db.MessageCount(ctx, "sl-C1"); n != 1 {
+		t.Errorf("recorded messages = %d, want 1", n)
+	}
+}
+
+func TestGroupChatterDoesNotCountAgainstRateLimit(t *testing.T) {
+	db := testStore(t)
+	provider := &recordingProvider{}
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: provider,
+		Store:    db,
+		Approver: agent.NewApprover(agent.ApprovalAuto, nil),
+		Model:    "fake-1",
+	})
+	adapter := newFakeAdapter("discord")
+	router := NewChannelRouter(runtime, []channels.Adapter{adapter}, nil, slog.Default(), db, nil)
+	cfg := config.Default()
+	cfg.Access.Unknown = config.RoleGuest
+	router.SetAccessControl(NewAccessControl(cfg))
+	ctx := context.Background()
+
+	for range config.DefaultGuestRateLimit + 1 {
+		router.handleMessage(ctx, adapter, channels.InboundMessage{
+			ChannelName: "discord", SessionID: "dc-general", PeerID: "u1", Content: "chatter", IsGroup: true,
+		})
+	}
+	router.handleMessage(ctx, adapter, channels.InboundMessage{
+		ChannelName: "discord", SessionID: "dc-general", PeerID: "u1", Content: "@pincer hi", IsGroup: true, Mentioned: true,
+	})
+	if len(provider.requests) != 1 {
+		t.Errorf("requests = %d, want the mention answered", len(provider.requests))
+	}
+}
+
+func TestApprovalRequiresApproverRole(t *testing.T) {
+	approver := agent.NewApprover(agent.ApprovalAsk, nil)
+	adapter := newFakeAdapter("telegram")
+	router := NewChannelRouter(nil, []channels.Adapter{adapter}, approver, slog.Default(), nil, nil)
+
+	cfg := config.Default()
+	cfg.Access.Users = []config.AccessUserConfig{
+		{Name: "alice", Role: config.RoleAdmin, Peers: []string{"telegram:1"}},
+		{Name: "bob", Role: config.RoleMember, Peers: []string{"telegram:2"}},
+	}
+	router.SetAccessControl(NewAccessControl(cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router.Start(ctx)
+
+	doneCh := make(chan bool, 1)
+	go func() {
+		approved, _ := approver.RequestApproval(ctx, agent.ApprovalRequest{ID: "req-1", SessionID: "tg-1", ToolName: "shell"})
+		doneCh <- approved
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	adapter.inbound <- channels.InboundMessage{ChannelName: "telegram", SessionID: "tg-1", PeerID: "2", Content: "approve req-1"}
+	select {
+	case <-doneCh:
+		t.Fatal("member should not be able to approve")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if sent := adapter.getSent(); len(sent) != 1 || !contains(sent[0].Content, "not allowed") {
+		t.Errorf("sent = %+v, want a rejection notice", sent)
+	}
+
+	adapter.inbound <- channels.InboundMessage{ChannelName: "telegram", SessionID: "tg-1", PeerID: "1", Content: "approve req-1"}
+	select {
+	case approved := <-doneCh:
+		if !approved {
+			t.Error("expected approval")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for admin approval")
+	}
+}
+
+func TestAccessControlGatesTurns(t *testing.T) {
+	db := testStore(t)
+	provider := &recordingProvider{}
+	registry := tools.NewRegistry()
+	registry.Register(&tools.SoulTool{})
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: provider,
+		Store:    db,
+		Registry: registry,
+		Approver: agent.NewApprover(agent.ApprovalAuto, nil),
+		Model:    "fake-1",
+	})
+	adapter := newFakeAdapter("telegram")
+	router := NewChannelRouter(runtime, []channels.Adapter{adapter}, nil, slog.Default(), db, nil)
+
+	cfg := config.Default()
+	cfg.Access.Unknown = config.RoleGuest
+	cfg.Access.Users = []config.AccessUserConfig{
+		{Name: "alice", Role: config.RoleAdmin, Peers: []string{"telegram:1"}},
+	}
+	router.SetAccessControl(NewAccessControl(cfg))
+	ctx := context.Background()
+
+	router.handleMessage(ctx, adapter, channels.InboundMessage{ChannelName: "telegram", SessionID: "tg-1", PeerID: "1", Content: "hi"})
+	router.handleMessage(ctx, adapter, channels.InboundMessage{ChannelName: "telegram", SessionID: "tg-9", PeerID: "9", Content: "hi"})
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(provider.requests))
+	}
+	if n := len(provider.requests[0].Tools); n != 1 {
+		t.Errorf("admin tools = %d, want 1", n)
+	}
+	if n := len(provider.requests[1].Tools); n != 0 {
+		t.Errorf("guest tools = %d, want 0", n)
+	}
+
+	cfg.Access.Unknown = config.AccessDeny
+	router.SetAccessControl(NewAccessControl(cfg))
+	router.handleMessage(ctx, adapter, channels.InboundMessage{ChannelName: "telegram", SessionID: "tg-9", PeerID: "9", Content: "hi"})
+	if len(provider.requests) != 2 {
+		t.Error("denied peer should not start a turn")
+	}
+}
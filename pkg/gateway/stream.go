@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/igorsilveira/pincer/pkg/channels"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+)
+
+const (
+	defaultEditInterval = time.Second
+	defaultStreamMaxLen = 4096
+	streamCursor        = " …"
+	streamPlaceholder   = "Thinking..."
+)
+
+// streamWriter shows a turn in progress as a single chat message that is
+// posted as a placeholder when the turn starts and edited as tokens and tool
+// progress arrive. Edits are throttled to the adapter's EditInterval. Once
+// the turn is done the message is replaced by the final answer, with any
+// overflow sent as follow-up messages.
+//
+// A nil *streamWriter is valid and does nothing, for channels that cannot
+// edit messages.
+type streamWriter struct {
+	editor    channels.MessageEditor
+	channel   string
+	sessionID string
+	logger    *slog.Logger
+	interval  time.Duration
+	maxLen    int
+	now       func() time.Time
+
+	text      strings.Builder
+	progress  string
+	stale     bool
+	messageID string
+	rendered  string
+	lastEdit  time.Time
+	failed    bool
+}
+
+func newStreamWriter(adapter channels.Adapter, sessionID string, logger *slog.Logger) *streamWriter {
+	caps := adapter.Capabilities()
+	editor, ok := adapter.(channels.MessageEditor)
+	if !ok || !caps.SupportsEditing {
+		return nil
+	}
+
+	interval := caps.EditInterval
+	if interval <= 0 {
+		interval = defaultEditInterval
+	}
+	maxLen := caps.MaxMessageLength
+	if maxLen <= 0 {
+		maxLen = defaultStreamMaxLen
+	}
+
+	return &streamWriter{
+		editor:    editor,
+		channel:   adapter.Name(),
+		sessionID: sessionID,
+		logger:    logger,
+		interval:  interval,
+		maxLen:    maxLen,
+		now:       time.Now,
+	}
+}
+
+// start posts the placeholder that the turn's output is streamed into.
+func (sw *streamWriter) start(ctx context.Context) {
+	if sw == nil {
+		return
+	}
+	sw.progress = streamPlaceholder
+	sw.stale = true
+	sw.flush(ctx, true)
+}
+
+func (sw *streamWriter) token(ctx context.Context, tok string) {
+	if sw == nil {
+		return
+	}
+	if sw.stale {
+		sw.text.Reset()
+		sw.progress = ""
+		sw.stale = false
+	}
+	sw.text.WriteString(tok)
+	sw.flush(ctx, false)
+}
+
+// status shows msg below the streamed text. Text streamed so far belongs to
+// an LLM call that has ended, so the next token starts a fresh answer.
+func (sw *streamWriter) status(ctx context.Context, msg string) {
+	if sw == nil {
+		return
+	}
+	sw.progress = msg
+	sw.stale = true
+	sw.flush(ctx, false)
+}
+
+// finish replaces the live message with response and returns the chunks of
+// it that were not delivered, for the caller to send itself: all of response
+// when nothing was streamed, or what is left after a failed edit or send.
+func (sw *streamWriter) finish(ctx context.Context, response string) []string {
+	if sw == nil || sw.messageID == "" {
+		if response == "" {
+			return nil
+		}
+		return []string{response}
+	}
+
+	if response == "" {
+		response = sw.text.String()
+		if response == "" {
+			response = "(no response)"
+		}
+	}
+
+	chunks := channels.SplitMessage(response, sw.maxLen)
+	if chunks[0] != sw.rendered {
+		if err := sw.editor.EditMessage(ctx, sw.sessionID, sw.messageID, chunks[0]); err != nil {
+			telemetry.Metrics.ChannelSendFailures.WithLabelValues(sw.channel).Inc()
+			sw.logger.Warn("failed to finalize streamed message",
+				slog.String("session_id", sw.sessionID),
+				slog.String("err", err.Error()),
+			)
+			return chunks
+		}
+	}
+	for i, chunk := range chunks[1:] {
+		if _, err := sw.editor.SendEditable(ctx, sw.sessionID, chunk); err != nil {
+			telemetry.Metrics.ChannelSendFailures.WithLabelValues(sw.channel).Inc()
+			sw.logger.Warn("failed to send streamed response chunk",
+				slog.String("session_id", sw.sessionID),
+				slog.String("err", err.Error()),
+			)
+			return chunks[i+1:]
+		}
+	}
+	return nil
+}
+
+func (sw *streamWriter) flush(ctx context.Context, force bool) {
+	if sw.failed {
+		return
+	}
+	if !force && sw.now().Sub(sw.lastEdit) < sw.interval {
+		return
+	}
+
+	content := sw.render()
+	if content == "" || content == sw.rendered {
+		return
+	}
+
+	sw.lastEdit = sw.now()
+	var err error
+	if sw.messageID == "" {
+		sw.messageID, err = sw.editor.SendEditable(ctx, sw.sessionID, content)
+	} else {
+		err = sw.editor.EditMessage(ctx, sw.sessionID, sw.messageID, content)
+	}
+	if err != nil {
+		telemetry.Metrics.ChannelSendFailures.WithLabelValues(sw.channel).Inc()
+		sw.failed = true
+		sw.logger.Warn("streaming disabled for turn",
+			slog.String("session_id", sw.sessionID),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+	sw.rendered = content
+}
+
+// render builds the in-progress view. When it outgrows a single message only
+// the tail is shown; the full answer is split properly by finish.
+func (sw *streamWriter) render() string {
+	content := sw.text.String()
+	if sw.progress != "" {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += "⏳ " + sw.progress
+	}
+	if content == "" {
+		return ""
+	}
+	content += streamCursor
+
+	if len(content) > sw.maxLen {
+		cut := len(content) - sw.maxLen + len("…")
+		for cut < len(content) && !utf8.RuneStart(content[cut]) {
+			cut++
+		}
+		content = "…" + content[cut:]
+	}
+	return content
+}
@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/channels"
+)
+
+type fakeEditAdapter struct {
+	*fakeAdapter
+	maxLen int
+
+	mu     sync.Mutex
+	posted []string
+	edits  []string
+	nextID int
+
+	// failEdits and failPostsAfter make EditMessage, and SendEditable once
+	// that many messages have been posted, return an error.
+	failEdits      bool
+	failPostsAfter int
+}
+
+func newFakeEditAdapter(maxLen int) *fakeEditAdapter {
+	return &fakeEditAdapter{fakeAdapter: newFakeAdapter("telegram"), maxLen: maxLen}
+}
+
+func (f *fakeEditAdapter) Capabilities() channels.ChannelCaps {
+	return channels.ChannelCaps{SupportsEditing: true, MaxMessageLength: f.maxLen, EditInterval: time.Second}
+}
+
+func (f *fakeEditAdapter) SendEditable(_ context.Context, _, content string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failPostsAfter > 0 && len(f.posted) >= f.failPostsAfter {
+		return "", fmt.Errorf("send failed")
+	}
+	f.posted = append(f.posted, content)
+	f.nextID++
+	return fmt.Sprintf("m%d", f.nextID), nil
+}
+
+func (f *fakeEditAdapter) EditMessage(_ context.Context, _, _, content string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failEdits {
+		return fmt.Errorf("edit failed")
+	}
+	f.edits = append(f.edits, content)
+	return nil
+}
+
+func testStreamWriter(t *testing.T, adapter channels.Adapter) (*streamWriter, *time.Time) {
+	t.Helper()
+	sw := newStreamWriter(adapter, "sess-1", slog.Default())
+	if sw == nil {
+		t.Fatal("expected stream writer for editing adapter")
+	}
+	clock := time.Unix(1000, 0)
+	sw.now = func() time.Time { return clock }
+	return sw, &clock
+}
+
+func TestNewStreamWriterRequiresEditor(t *testing.T) {
+	if sw := newStreamWriter(newFakeAdapter("irc"), "s", slog.Default()); sw != nil {
+		t.Error("adapters without MessageEditor should not stream")
+	}
+	var sw *streamWriter
+	sw.token(context.Background(), "x")
+	if rest := sw.finish(context.Background(), "done"); len(rest) != 1 || rest[0] != "done" {
+		t.Errorf("nil writer finish = %q, want the whole response", rest)
+	}
+}
+
+func TestStreamWriterThrottlesEdits(t *testing.T) {
+	adapter := newFakeEditAdapter(4096)
+	sw, clock := testStreamWriter(t, adapter)
+	ctx := context.Background()
+
+	sw.token(ctx, "Hello")
+	sw.token(ctx, " there")
+	sw.token(ctx, " friend")
+	if len(adapter.posted) != 1 || len(adapter.edits) != 0 {
+		t.Fatalf("posted=%d edits=%d, want a single placeholder", len(adapter.posted), len(adapter.edits))
+	}
+	if adapter.posted[0] != "Hello"+streamCursor {
+		t.Errorf("placeholder = %q", adapter.posted[0])
+	}
+
+	*clock = clock.Add(time.Second)
+	sw.token(ctx, "!")
+	if len(adapter.edits) != 1 || adapter.edits[0] != "Hello there friend!"+streamCursor {
+		t.Fatalf("edits = %q", adapter.edits)
+	}
+
+	if rest := sw.finish(ctx, "Hello there friend!"); rest != nil {
+		t.Fatalf("finish left %q undelivered", rest)
+	}
+	if last := adapter.edits[len(adapter.edits)-1]; last != "Hello there friend!" {
+		t.Errorf("final edit = %q", last)
+	}
+}
+
+func TestStreamWriterStatusStartsNewAnswer(t *testing.T) {
+	adapter := newFakeEditAdapter(4096)
+	sw, clock := testStreamWriter(t, adapter)
+	ctx := context.Background()
+
+	sw.token(ctx, "Let me check.")
+	*clock = clock.Add(time.Second)
+	sw.status(ctx, "Running shell...")
+	if got := adapter.edits[0]; !strings.Contains(got, "Let me check.") || !strings.Contains(got, "Running shell...") {
+		t.Errorf("status edit = %q", got)
+	}
+
+	*clock = clock.Add(time.Second)
+	sw.token(ctx, "All good")
+	if got := adapter.edits[1]; got != "All good"+streamCursor {
+		t.Errorf("edit after tool = %q, want fresh answer", got)
+	}
+}
+
+func TestStreamWriterSplitsLongFinal(t *testing.T) {
+	adapter := newFakeEditAdapter(20)
+	sw, _ := testStreamWriter(t, adapter)
+	ctx := context.Background()
+
+	long := strings.Repeat("abcde ", 10)
+	sw.token(ctx, long)
+	if len(adapter.posted[0]) > 20 {
+		t.Errorf("preview length %d exceeds limit", len(adapter.posted[0]))
+	}
+
+	if rest := sw.finish(ctx, long); rest != nil {
+		t.Fatalf("finish left %q undelivered", rest)
+	}
+	var got strings.Builder
+	got.WriteString(adapter.edits[len(adapter.edits)-1])
+	for _, p := range adapter.posted[1:] {
+		got.WriteString(p)
+	}
+	if got.String() != long {
+		t.Errorf("reassembled = %q, want %q", got.String(), long)
+	}
+}
+
+func TestStreamWriterFinishWithoutPlaceholder(t *testing.T) {
+	adapter := newFakeEditAdapter(4096)
+	sw, _ := testStreamWriter(t, adapter)
+	if rest := sw.finish(context.Background(), "quick"); len(rest) != 1 || rest[0] != "quick" {
+		t.Errorf("finish = %q, want a normal send when nothing was streamed", rest)
+	}
+	if rest := sw.finish(context.Background(), ""); rest != nil {
+		t.Errorf("finish of empty response = %q, want nothing to send", rest)
+	}
+}
+
+func TestStreamWriterStartPostsPlaceholder(t *testing.T) {
+	adapter := newFakeEditAdapter(4096)
+	sw, clock := testStreamWriter(t, adapter)
+	ctx := context.Background()
+
+	sw.start(ctx)
+	if len(adapter.posted) != 1 || !strings.Contains(adapter.posted[0], streamPlaceholder) {
+		t.Fatalf("posted = %q, want the placeholder", adapter.posted)
+	}
+
+	*clock = clock.Add(time.Second)
+	sw.token(ctx, "Hi")
+	if len(adapter.edits) != 1 || adapter.edits[0] != "Hi"+streamCursor {
+		t.Errorf("edits = %q, want the placeholder replaced by the answer", adapter.edits)
+	}
+}
+
+func TestStreamWriterFinishFailedEditReturnsAllChunks(t *testing.T) {
+	adapter := newFakeEditAdapter(20)
+	sw, _ := testStreamWriter(t, adapter)
+	ctx := context.Background()
+
+	sw.start(ctx)
+	adapter.failEdits = true
+
+	long := strings.Repeat("abcde ", 5)
+	rest := sw.finish(ctx, long)
+	if got := strings.Join(rest, ""); got != long {
+		t.Errorf("undelivered = %q, want the whole response %q", got, long)
+	}
+	if len(adapter.posted) != 1 {
+		t.Errorf("posted = %q, want only the placeholder", adapter.posted)
+	}
+}
+
+func TestStreamWriterFinishPartialFailureReturnsRemainder(t *testing.T) {
+	adapter := newFakeEditAdapter(20)
+	sw, _ := testStreamWriter(t, adapter)
+	ctx := context.Background()
+
+	sw.start(ctx)
+	adapter.failPostsAfter = 2
+
+	long := strings.Repeat("abcde ", 10)
+	rest := sw.finish(ctx, long)
+	if len(rest) == 0 {
+		t.Fatal("expected undelivered chunks after the failed send")
+	}
+
+	var got strings.Builder
+	got.WriteString(adapter.edits[len(adapter.edits)-1])
+	for _, p := range adapter.posted[1:] {
+		got.WriteString(p)
+	}
+	for _, r := range rest {
+		got.WriteString(r)
+	}
+	if got.String() != long {
+		t.Errorf("delivered + undelivered = %q, want %q", got.String(), long)
+	}
+}
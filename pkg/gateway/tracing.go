@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// untracedPaths are polled by probes and scrapers and would only add noise.
+var untracedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// traceRequests starts a server span for each request, continuing the
+// caller's trace when it sends trace context headers.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if untracedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := telemetry.ExtractHTTP(r.Context(), r.Header)
+		ctx, span := telemetry.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+		ctx = telemetry.WithTraceID(ctx)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if route := chi.RouteContext(r.Context()).RoutePattern(); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		if status >= 500 {
+			span.SetAttributes(semconv.ErrorTypeKey.String(http.StatusText(status)))
+		}
+	})
+}
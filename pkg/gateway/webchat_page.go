@@ -194,6 +194,22 @@ header h1 {
   font-size: inherit;
 }
 
+.attachment {
+  margin: 6px 0;
+}
+.attachment img {
+  max-width: 100%;
+  max-height: 360px;
+  border-radius: var(--radius);
+  border: 1px solid var(--border);
+}
+.attachment a {
+  color: var(--accent);
+  font-family: var(--mono);
+  font-size: 12.5px;
+  text-decoration: none;
+}
+
 .tool-card {
   margin: 6px 0;
   background: var(--bg-elevated);
@@ -814,6 +830,29 @@ header h1 {
           scrollBottom();
           break;
 
+        case "attachment":
+          var attTurn = document.createElement("div");
+          attTurn.className = "turn";
+          var attBlock = document.createElement("div");
+          attBlock.className = "attachment";
+          var dataURL = "data:" + msg.media_type + ";base64," + msg.data;
+          if (msg.media_type.indexOf("image/") === 0) {
+            var img = document.createElement("img");
+            img.src = dataURL;
+            img.alt = msg.filename;
+            attBlock.appendChild(img);
+          } else {
+            var link = document.createElement("a");
+            link.href = dataURL;
+            link.download = msg.filename;
+            link.textContent = msg.filename;
+            attBlock.appendChild(link);
+          }
+          attTurn.appendChild(attBlock);
+          messagesEl.appendChild(attTurn);
+          scrollBottom();
+          break;
+
         case "done":
           resetTurnState();
           setInputEnabled(true);
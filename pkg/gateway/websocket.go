@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"log/slog"
 	"net/http"
@@ -30,6 +31,9 @@ type wsOutgoing struct {
 	ToolName  string `json:"tool_name,omitempty"`
 	ToolInput string `json:"tool_input,omitempty"`
 	RequestID string `json:"request_id,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
 }
 
 func (g *Gateway) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -73,11 +77,22 @@ func (g *Gateway) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				if !ok {
 					return
 				}
-				wsWrite(wsOutgoing{
-					Type:      "message",
-					SessionID: sessionID,
-					Content:   msg,
-				})
+				if msg.Content != "" {
+					wsWrite(wsOutgoing{
+						Type:      "message",
+						SessionID: sessionID,
+						Content:   msg.Content,
+					})
+				}
+				for _, att := range msg.Attachments {
+					wsWrite(wsOutgoing{
+						Type:      "attachment",
+						SessionID: sessionID,
+						Filename:  att.Filename,
+						MediaType: att.MediaType,
+						Data:      base64.StdEncoding.EncodeToString(att.Data),
+					})
+				}
 			case <-ctx.Done():
 				return
 			}
@@ -214,6 +214,28 @@ func convertToAnthropicMessage(m ChatMessage) anthropicMessage {
 		return anthropicMessage{Role: m.Role, Content: blocks}
 	}
 
+	if m.Role == RoleUser && len(m.Images) > 0 {
+		var blocks []anthropicInlineBlock
+		for _, img := range m.Images {
+			if img.Data() != nil {
+				blocks = append(blocks, anthropicInlineBlock{
+					Type: "image",
+					Source: &anthropicImageSource{
+						Type:      "base64",
+						MediaType: img.MediaType,
+						Data:      base64.StdEncoding.EncodeToString(img.Data()),
+					},
+				})
+			}
+		}
+		if m.Content != "" {
+			blocks = append(blocks, anthropicInlineBlock{Type: "text", Text: m.Content})
+		}
+		if len(blocks) > 0 {
+			return anthropicMessage{Role: m.Role, Content: blocks}
+		}
+	}
+
 	return anthropicMessage{Role: m.Role, Content: m.Content}
 }
 
@@ -215,3 +215,59 @@ func TestConvertToGeminiContent_RoleMapping(t *testing.T) {
 		}
 	}
 }
+
+func userImageMessage() ChatMessage {
+	img := ImageContent{MediaType: "image/png"}
+	img.SetData([]byte("png"))
+	return ChatMessage{Role: RoleUser, Content: "what is this?", Images: []ImageContent{img}}
+}
+
+func TestConvertToAnthropicMessage_UserImages(t *testing.T) {
+	got := convertToAnthropicMessage(userImageMessage())
+
+	blocks, ok := got.Content.([]anthropicInlineBlock)
+	if !ok {
+		t.Fatalf("Content type = %T, want []anthropicInlineBlock", got.Content)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("blocks len = %d, want 2", len(blocks))
+	}
+	if blocks[0].Type != "image" || blocks[0].Source == nil || blocks[0].Source.MediaType != "image/png" {
+		t.Errorf("blocks[0] = %+v, want png image", blocks[0])
+	}
+	if blocks[1].Type != "text" || blocks[1].Text != "what is this?" {
+		t.Errorf("blocks[1] = %+v, want text", blocks[1])
+	}
+}
+
+func TestConvertToOpenAIMessages_UserImages(t *testing.T) {
+	got := convertToOpenAIMessages(userImageMessage())
+
+	if len(got) != 1 {
+		t.Fatalf("len = %d, want 1", len(got))
+	}
+	parts, ok := got[0].Content.([]openaiContentPart)
+	if !ok {
+		t.Fatalf("Content type = %T, want []openaiContentPart", got[0].Content)
+	}
+	if len(parts) != 2 || parts[1].ImageURL == nil {
+		t.Fatalf("parts = %+v, want text and image_url", parts)
+	}
+	if parts[1].ImageURL.URL != "data:image/png;base64,cG5n" {
+		t.Errorf("image url = %q", parts[1].ImageURL.URL)
+	}
+}
+
+func TestConvertToGeminiContent_UserImages(t *testing.T) {
+	got := convertToGeminiContent(userImageMessage(), nil)
+
+	if len(got.Parts) != 2 {
+		t.Fatalf("parts len = %d, want 2", len(got.Parts))
+	}
+	if got.Parts[0].InlineData == nil || got.Parts[0].InlineData.MimeType != "image/png" {
+		t.Errorf("Parts[0] = %+v, want inline png", got.Parts[0])
+	}
+	if got.Parts[1].Text != "what is this?" {
+		t.Errorf("Parts[1].Text = %q", got.Parts[1].Text)
+	}
+}
@@ -3,6 +3,7 @@ package llm
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -66,10 +67,16 @@ type geminiContent struct {
 
 type geminiPart struct {
 	Text             string              `json:"text,omitempty"`
+	InlineData       *geminiBlob         `json:"inlineData,omitempty"`
 	FunctionCall     *geminiFunctionCall `json:"functionCall,omitempty"`
 	FunctionResponse *geminiFuncResponse `json:"functionResponse,omitempty"`
 }
 
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
 type geminiFunctionCall struct {
 	Name string          `json:"name"`
 	Args json.RawMessage `json:"args"`
@@ -217,6 +224,24 @@ func convertToGeminiContent(m ChatMessage, toolCallNames map[string]string) gemi
 		return geminiContent{Role: role, Parts: parts}
 	}
 
+	if m.Role == RoleUser && len(m.Images) > 0 {
+		var parts []geminiPart
+		for _, img := range m.Images {
+			if img.Data() != nil {
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{
+					MimeType: img.MediaType,
+					Data:     base64.StdEncoding.EncodeToString(img.Data()),
+				}})
+			}
+		}
+		if m.Content != "" {
+			parts = append(parts, geminiPart{Text: m.Content})
+		}
+		if len(parts) > 0 {
+			return geminiContent{Role: role, Parts: parts}
+		}
+	}
+
 	return geminiContent{Role: role, Parts: []geminiPart{{Text: m.Content}}}
 }
 
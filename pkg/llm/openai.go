@@ -3,6 +3,7 @@ package llm
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -66,11 +67,21 @@ type openaiRequest struct {
 
 type openaiMessage struct {
 	Role       string           `json:"role"`
-	Content    string           `json:"content,omitempty"`
+	Content    interface{}      `json:"content,omitempty"`
 	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 }
 
+type openaiContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openaiImageURL `json:"image_url,omitempty"`
+}
+
+type openaiImageURL struct {
+	URL string `json:"url"`
+}
+
 type openaiTool struct {
 	Type     string         `json:"type"`
 	Function openaiFunction `json:"function"`
@@ -183,11 +194,14 @@ func convertToOpenAIMessages(m ChatMessage) []openaiMessage {
 				},
 			})
 		}
-		return []openaiMessage{{
+		msg := openaiMessage{
 			Role:      "assistant",
-			Content:   m.Content,
 			ToolCalls: calls,
-		}}
+		}
+		if m.Content != "" {
+			msg.Content = m.Content
+		}
+		return []openaiMessage{msg}
 	}
 
 	if m.Role == RoleUser && len(m.ToolResults) > 0 {
@@ -202,6 +216,26 @@ func convertToOpenAIMessages(m ChatMessage) []openaiMessage {
 		return msgs
 	}
 
+	if m.Role == RoleUser && len(m.Images) > 0 {
+		var parts []openaiContentPart
+		if m.Content != "" {
+			parts = append(parts, openaiContentPart{Type: "text", Text: m.Content})
+		}
+		for _, img := range m.Images {
+			if img.Data() != nil {
+				parts = append(parts, openaiContentPart{
+					Type: "image_url",
+					ImageURL: &openaiImageURL{
+						URL: "data:" + img.MediaType + ";base64," + base64.StdEncoding.EncodeToString(img.Data()),
+					},
+				})
+			}
+		}
+		if len(parts) > 0 {
+			return []openaiMessage{{Role: m.Role, Content: parts}}
+		}
+	}
+
 	return []openaiMessage{{Role: m.Role, Content: m.Content}}
 }
 
@@ -63,10 +63,11 @@ func (tr *ToolResult) ErrorKind() ToolErrorKind     { return tr.errorKind }
 func (tr *ToolResult) SetErrorKind(k ToolErrorKind) { tr.errorKind = k }
 
 type ChatMessage struct {
-	Role        string       `json:"role"`
-	Content     string       `json:"content,omitempty"`
-	ToolCalls   []ToolCall   `json:"tool_calls,omitempty"`
-	ToolResults []ToolResult `json:"tool_results,omitempty"`
+	Role        string         `json:"role"`
+	Content     string         `json:"content,omitempty"`
+	Images      []ImageContent `json:"images,omitempty"`
+	ToolCalls   []ToolCall     `json:"tool_calls,omitempty"`
+	ToolResults []ToolResult   `json:"tool_results,omitempty"`
 }
 
 type ToolChoiceType string
@@ -0,0 +1,324 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fixture is a sequence of provider responses, either recorded from a real
+// provider or written by hand. Turn i answers the i-th Chat call.
+type Fixture struct {
+	Model string        `json:"model,omitempty"`
+	Turns []FixtureTurn `json:"turns"`
+}
+
+// FixtureTurn is the response to one Chat call. Recorded turns carry Events;
+// scripted turns may use Text and ToolCalls instead, which expand to a token,
+// the tool calls and a done event. Error, with an optional HTTP Status, makes
+// Chat itself fail. Match, when set, must be contained in the last message of
+// the request, so a script fails loudly once the agent diverges from it.
+type FixtureTurn struct {
+	Match     string           `json:"match,omitempty"`
+	Request   *RecordedRequest `json:"request,omitempty"`
+	Text      string           `json:"text,omitempty"`
+	ToolCalls []ToolCall       `json:"tool_calls,omitempty"`
+	Events    []FixtureEvent   `json:"events,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Status    int              `json:"status,omitempty"`
+}
+
+// RecordedRequest summarises the request a recorded turn answered. It is
+// informational and not used when replaying.
+type RecordedRequest struct {
+	Model    string   `json:"model,omitempty"`
+	Tools    []string `json:"tools,omitempty"`
+	Messages int      `json:"messages"`
+	Last     string   `json:"last,omitempty"`
+}
+
+type FixtureEvent struct {
+	Type     string    `json:"type"`
+	Token    string    `json:"token,omitempty"`
+	ToolCall *ToolCall `json:"tool_call,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Usage    *Usage    `json:"usage,omitempty"`
+}
+
+var eventTypeNames = map[EventType]string{
+	EventToken:    "token",
+	EventToolCall: "tool_call",
+	EventDone:     "done",
+	EventError:    "error",
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("replay: parsing %s: %w", path, err)
+	}
+	for i, turn := range f.Turns {
+		for _, ev := range turn.Events {
+			if _, err := ev.event(); err != nil {
+				return nil, fmt.Errorf("replay: %s turn %d: %w", path, i+1, err)
+			}
+		}
+	}
+	return &f, nil
+}
+
+// Save writes the fixture atomically, so an interrupted recording leaves the
+// previous version intact.
+func (f *Fixture) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("replay: creating fixture dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("replay: writing fixture: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (e FixtureEvent) event() (ChatEvent, error) {
+	switch e.Type {
+	case "token":
+		return ChatEvent{Type: EventToken, Token: e.Token}, nil
+	case "tool_call":
+		if e.ToolCall == nil {
+			return ChatEvent{}, fmt.Errorf("tool_call event without tool_call")
+		}
+		tc := *e.ToolCall
+		return ChatEvent{Type: EventToolCall, ToolCall: &tc}, nil
+	case "done":
+		return ChatEvent{Type: EventDone, Usage: e.Usage}, nil
+	case "error":
+		return ChatEvent{Type: EventError, Error: errors.New(e.Error)}, nil
+	default:
+		return ChatEvent{}, fmt.Errorf("unknown event type %q", e.Type)
+	}
+}
+
+func fixtureEvent(ev ChatEvent) FixtureEvent {
+	fe := FixtureEvent{Type: eventTypeNames[ev.Type], Token: ev.Token, ToolCall: ev.ToolCall, Usage: ev.Usage}
+	if ev.Error != nil {
+		fe.Error = ev.Error.Error()
+	}
+	return fe
+}
+
+// events expands a turn into the stream Chat returns.
+func (t FixtureTurn) events(turn int) ([]ChatEvent, error) {
+	if len(t.Events) > 0 {
+		out := make([]ChatEvent, 0, len(t.Events))
+		for _, fe := range t.Events {
+			ev, err := fe.event()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ev)
+		}
+		return out, nil
+	}
+
+	var out []ChatEvent
+	if t.Text != "" {
+		out = append(out, ChatEvent{Type: EventToken, Token: t.Text})
+	}
+	for i, tc := range t.ToolCalls {
+		tc := tc
+		if tc.ID == "" {
+			tc.ID = fmt.Sprintf("call_%d_%d", turn, i+1)
+		}
+		if len(tc.Input) == 0 {
+			tc.Input = json.RawMessage(`{}`)
+		}
+		out = append(out, ChatEvent{Type: EventToolCall, ToolCall: &tc})
+	}
+	return append(out, ChatEvent{Type: EventDone, Usage: &Usage{}}), nil
+}
+
+// ReplayProvider answers Chat calls from a fixture, in order, without any
+// network access.
+type ReplayProvider struct {
+	name    string
+	fixture *Fixture
+
+	mu   sync.Mutex
+	next int
+}
+
+func NewReplayProvider(name string, f *Fixture) *ReplayProvider {
+	return &ReplayProvider{name: name, fixture: f}
+}
+
+func NewReplayProviderFromFile(path string) (*ReplayProvider, error) {
+	f, err := LoadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayProvider(strings.TrimSuffix(filepath.Base(path), ".json"), f), nil
+}
+
+func (p *ReplayProvider) Name() string            { return "replay" }
+func (p *ReplayProvider) SupportsStreaming() bool { return true }
+func (p *ReplayProvider) SupportsToolUse() bool   { return true }
+
+func (p *ReplayProvider) Models() []ModelInfo {
+	return []ModelInfo{{ID: "replay/" + p.name, Name: p.name, MaxContextTokens: 200000}}
+}
+
+// Remaining reports how many turns have not been replayed yet.
+func (p *ReplayProvider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.fixture.Turns) - p.next
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, req ChatRequest) (<-chan ChatEvent, error) {
+	p.mu.Lock()
+	n := p.next
+	if n >= len(p.fixture.Turns) {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("replay: fixture %s has no response for request %d", p.name, n+1)
+	}
+	turn := p.fixture.Turns[n]
+	p.next++
+	p.mu.Unlock()
+
+	if turn.Match != "" {
+		if last := lastMessageText(req); !strings.Contains(last, turn.Match) {
+			return nil, fmt.Errorf("replay: fixture %s turn %d expects the last message to contain %q, got %q", p.name, n+1, turn.Match, truncateText(last, 200))
+		}
+	}
+	if turn.Error != "" {
+		if turn.Status != 0 {
+			return nil, &APIError{Provider: "replay", StatusCode: turn.Status, Body: turn.Error}
+		}
+		return nil, errors.New(turn.Error)
+	}
+
+	events, err := turn.events(n + 1)
+	if err != nil {
+		return nil, fmt.Errorf("replay: fixture %s turn %d: %w", p.name, n+1, err)
+	}
+	ch := make(chan ChatEvent, len(events))
+	for _, ev := range events {
+		if ctx.Err() != nil {
+			ch <- ChatEvent{Type: EventError, Error: ctx.Err()}
+			break
+		}
+		ch <- ev
+	}
+	close(ch)
+	return ch, nil
+}
+
+// RecordingProvider passes Chat calls through to another provider and
+// appends every response to a fixture file, which ReplayProvider can play
+// back. The file is rewritten after each response.
+type RecordingProvider struct {
+	inner Provider
+	model string
+	path  string
+
+	mu      sync.Mutex
+	fixture Fixture
+}
+
+// NewRecordingProvider records the responses of inner into path, replacing
+// any earlier recording. Requests are sent with model, since the configured
+// model names the recording instead.
+func NewRecordingProvider(inner Provider, model, path string) (*RecordingProvider, error) {
+	p := &RecordingProvider{inner: inner, model: model, path: path, fixture: Fixture{Model: model, Turns: []FixtureTurn{}}}
+	if err := p.fixture.Save(path); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *RecordingProvider) Name() string            { return p.inner.Name() }
+func (p *RecordingProvider) SupportsStreaming() bool { return p.inner.SupportsStreaming() }
+func (p *RecordingProvider) SupportsToolUse() bool   { return p.inner.SupportsToolUse() }
+func (p *RecordingProvider) Models() []ModelInfo     { return p.inner.Models() }
+
+func (p *RecordingProvider) Chat(ctx context.Context, req ChatRequest) (<-chan ChatEvent, error) {
+	req.Model = p.model
+	turn := FixtureTurn{Request: summarizeRequest(req)}
+
+	events, err := p.inner.Chat(ctx, req)
+	if err != nil {
+		turn.Error = err.Error()
+		if apiErr, ok := errors.AsType[*APIError](err); ok {
+			turn.Error = apiErr.Body
+			turn.Status = apiErr.StatusCode
+		}
+		p.record(turn)
+		return nil, err
+	}
+
+	out := make(chan ChatEvent)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			turn.Events = append(turn.Events, fixtureEvent(ev))
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+			}
+		}
+		p.record(turn)
+	}()
+	return out, nil
+}
+
+func (p *RecordingProvider) record(turn FixtureTurn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fixture.Turns = append(p.fixture.Turns, turn)
+	// The file was writable when recording started. A failed save must not
+	// break the conversation being recorded, and the next response retries it.
+	_ = p.fixture.Save(p.path)
+}
+
+func summarizeRequest(req ChatRequest) *RecordedRequest {
+	r := &RecordedRequest{Model: req.Model, Messages: len(req.Messages), Last: truncateText(lastMessageText(req), 500)}
+	for _, t := range req.Tools {
+		r.Tools = append(r.Tools, t.Name)
+	}
+	return r
+}
+
+// lastMessageText returns the text of the last message, including tool
+// results, which is what a scripted turn reacts to.
+func lastMessageText(req ChatRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	m := req.Messages[len(req.Messages)-1]
+	parts := []string{m.Content}
+	for _, tr := range m.ToolResults {
+		parts = append(parts, tr.Content)
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
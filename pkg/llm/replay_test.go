@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func collect(t *testing.T, ch <-chan ChatEvent) []ChatEvent {
+	t.Helper()
+	var events []ChatEvent
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func userRequest(text string) ChatRequest {
+	return ChatRequest{Messages: []ChatMessage{{Role: RoleUser, Content: text}}}
+}
+
+func TestReplayProvider_Scripted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.json")
+	script := `{"turns": [
+		{"match": "deploy", "text": "Checking status.", "tool_calls": [{"name": "shell", "input": {"command": "git status"}}]},
+		{"match": "nothing to commit", "text": "Clean tree."}
+	]}`
+	if err := os.WriteFile(path, []byte(script), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewReplayProviderFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Models()[0].ID; got != "replay/deploy" {
+		t.Errorf("model id = %q", got)
+	}
+
+	ch, err := p.Chat(context.Background(), userRequest("please deploy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := collect(t, ch)
+	if len(events) != 3 || events[0].Token != "Checking status." || events[2].Type != EventDone {
+		t.Fatalf("events = %+v", events)
+	}
+	tc := events[1].ToolCall
+	if tc == nil || tc.ID != "call_1_1" || tc.Name != "shell" || string(tc.Input) != `{"command": "git status"}` {
+		t.Errorf("tool call = %+v", tc)
+	}
+
+	// The second turn reacts to the tool result.
+	req := ChatRequest{Messages: []ChatMessage{{Role: RoleUser, ToolResults: []ToolResult{{ToolCallID: "call_1_1", Content: "nothing to commit"}}}}}
+	if _, err := p.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if p.Remaining() != 0 {
+		t.Errorf("Remaining = %d, want 0", p.Remaining())
+	}
+	if _, err := p.Chat(context.Background(), userRequest("again")); err == nil || !strings.Contains(err.Error(), "no response for request 3") {
+		t.Errorf("exhausted fixture: err = %v", err)
+	}
+}
+
+func TestReplayProvider_MatchAndErrors(t *testing.T) {
+	p := NewReplayProvider("t", &Fixture{Turns: []FixtureTurn{
+		{Match: "weather"},
+		{Error: "overloaded", Status: 529},
+	}})
+	if _, err := p.Chat(context.Background(), userRequest("tell me a joke")); err == nil || !strings.Contains(err.Error(), `"weather"`) {
+		t.Errorf("mismatch: err = %v", err)
+	}
+	_, err := p.Chat(context.Background(), userRequest("x"))
+	if _, ok := IsRetryable(err); !ok {
+		t.Errorf("status 529 should replay as a retryable API error, got %v", err)
+	}
+}
+
+func TestRecordingProvider_RoundTrip(t *testing.T) {
+	source := NewReplayProvider("source", &Fixture{Turns: []FixtureTurn{
+		{Events: []FixtureEvent{
+			{Type: "token", Token: "Hel"},
+			{Type: "token", Token: "lo"},
+			{Type: "tool_call", ToolCall: &ToolCall{ID: "tc1", Name: "memory", Input: json.RawMessage(`{"action":"list"}`)}},
+			{Type: "done", Usage: &Usage{InputTokens: 12, OutputTokens: 3}},
+		}},
+		{Error: "rate limited", Status: 429},
+	}})
+
+	path := filepath.Join(t.TempDir(), "fixtures", "rec.json")
+	rec, err := NewRecordingProvider(source, "claude-test", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := userRequest("hi")
+	req.Model = "record/rec/claude-test"
+	req.Tools = []ToolDefinition{{Name: "memory"}}
+	ch, err := rec.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := collect(t, ch)
+	if _, err := rec.Chat(context.Background(), req); err == nil {
+		t.Fatal("expected the recorded error")
+	}
+
+	f, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Model != "claude-test" || len(f.Turns) != 2 {
+		t.Fatalf("fixture = %+v", f)
+	}
+	if r := f.Turns[0].Request; r == nil || r.Model != "claude-test" || r.Last != "hi" || len(r.Tools) != 1 {
+		t.Errorf("recorded request = %+v", r)
+	}
+
+	replay := NewReplayProvider("rec", f)
+	ch, err = replay.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, ch)
+	if len(got) != len(want) {
+		t.Fatalf("replayed %d events, recorded %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Type != want[i].Type || got[i].Token != want[i].Token {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[2].ToolCall.Name != "memory" || got[3].Usage.InputTokens != 12 {
+		t.Errorf("tool call or usage lost: %+v %+v", got[2].ToolCall, got[3].Usage)
+	}
+	if _, err := replay.Chat(context.Background(), req); err == nil {
+		t.Error("expected the replayed error")
+	} else if _, ok := IsRetryable(err); !ok {
+		t.Errorf("replayed error should keep its status: %v", err)
+	}
+}
+
+func TestLoadFixture_RejectsUnknownEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(path, []byte(`{"turns":[{"events":[{"type":"thinking"}]}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFixture(path); err == nil {
+		t.Error("expected error for unknown event type")
+	}
+}
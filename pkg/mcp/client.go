@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"sync"
+	"time"
 
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
 	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -17,11 +22,55 @@ type ServerConfig struct {
 	Args    []string
 	Env     map[string]string
 	URL     string // if set, use StreamableClientTransport instead of stdio
+	// Headers are added to every request to URL, e.g. for authentication.
+	Headers map[string]string
+
+	// AllowTools and DenyTools filter the server's tools by name with glob
+	// patterns. Deny wins; an empty allow list allows everything.
+	AllowTools []string
+	DenyTools  []string
+	// Timeout bounds each tool call. Zero leaves it to the caller.
+	Timeout time.Duration
+	// RequireApproval makes every call to the server's tools ask for
+	// approval.
+	RequireApproval bool
+	// PingInterval is how often the server is pinged. Zero uses
+	// config.DefaultMCPPingInterval; negative disables pings.
+	PingInterval time.Duration
+
+	// Transport, if set, is called for every connection attempt instead of
+	// using Command or URL.
+	Transport func() mcpsdk.Transport
+}
+
+// allows reports whether the server's tool name passes the allow and deny
+// lists.
+func (c ServerConfig) allows(name string) bool {
+	for _, p := range c.DenyTools {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(c.AllowTools) == 0 {
+		return true
+	}
+	for _, p := range c.AllowTools {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 type serverConn struct {
-	session *mcpsdk.ClientSession
-	tools   []*mcpsdk.Tool
+	cfg       ServerConfig
+	cancel    context.CancelFunc
+	status    ServerStatus
+	session   *mcpsdk.ClientSession
+	tools     []*mcpsdk.Tool
+	prompts   []*mcpsdk.Prompt
+	resources []*mcpsdk.Resource
+	templates []*mcpsdk.ResourceTemplate
 }
 
 type Manager struct {
@@ -29,38 +78,134 @@ type Manager struct {
 	client  *mcpsdk.Client
 	servers map[string]*serverConn
 	logger  *slog.Logger
+
+	onToolsChanged func(server string, tools []*mcpsdk.Tool, removed []string)
+
+	pingTimeout    time.Duration
+	connectTimeout time.Duration
+	backoffBase    time.Duration
+	backoffMax     time.Duration
 }
 
 func NewManager(logger *slog.Logger) *Manager {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	client := mcpsdk.NewClient(&mcpsdk.Implementation{
+	m := &Manager{
+		servers:        make(map[string]*serverConn),
+		logger:         logger,
+		pingTimeout:    config.MCPPingTimeout,
+		connectTimeout: config.MCPConnectTimeout,
+		backoffBase:    config.MCPReconnectBaseDelay,
+		backoffMax:     config.MCPReconnectMaxDelay,
+	}
+	m.client = mcpsdk.NewClient(&mcpsdk.Implementation{
 		Name:    "pincer",
 		Version: "1.0.0",
-	}, nil)
-	return &Manager{
-		client:  client,
-		servers: make(map[string]*serverConn),
-		logger:  logger,
-	}
+	}, &mcpsdk.ClientOptions{
+		ToolListChangedHandler: func(ctx context.Context, req *mcpsdk.ToolListChangedRequest) {
+			m.refresh(ctx, req.Session, "tools", m.refreshTools)
+		},
+		PromptListChangedHandler: func(ctx context.Context, req *mcpsdk.PromptListChangedRequest) {
+			m.refresh(ctx, req.Session, "prompts", m.refreshPrompts)
+		},
+		ResourceListChangedHandler: func(ctx context.Context, req *mcpsdk.ResourceListChangedRequest) {
+			m.refresh(ctx, req.Session, "resources", m.refreshResources)
+		},
+	})
+	return m
 }
 
-func (m *Manager) Connect(ctx context.Context, cfg ServerConfig) ([]*mcpsdk.Tool, error) {
+// OnToolsChanged registers a callback run when a server's tool list changes
+// after a notifications/tools/list_changed notification. It receives the
+// server's current tools and the names of those it no longer offers.
+func (m *Manager) OnToolsChanged(fn func(server string, tools []*mcpsdk.Tool, removed []string)) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.onToolsChanged = fn
+}
+
+// Connect connects to a server and keeps it connected until Disconnect: a
+// server that exits or stops answering pings is reconnected with exponential
+// backoff. ctx only bounds the initial connection. When that fails the
+// server is still registered and retried in the background; the error wraps
+// ErrReconnecting and its tools are reported through OnToolsChanged once it
+// comes up.
+func (m *Manager) Connect(ctx context.Context, cfg ServerConfig) ([]*mcpsdk.Tool, error) {
+	m.mu.Lock()
+	_, exists := m.servers[cfg.Name]
+	m.mu.Unlock()
+	if exists {
+		return nil, fmt.Errorf("mcp: server %q already connected", cfg.Name)
+	}
+
+	superCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	conn := &serverConn{cfg: cfg, cancel: cancel}
+	session, err := m.dial(ctx, superCtx, cfg)
+	if err != nil {
+		err = fmt.Errorf("mcp: connecting to %q: %w", cfg.Name, err)
+	} else {
+		conn.session = session
+		if err = m.load(ctx, conn); err != nil {
+			_ = session.Close()
+			conn.session = nil
+			err = fmt.Errorf("mcp: listing tools from %q: %w", cfg.Name, err)
+		}
+	}
+
+	tools, prompts, resources := conn.tools, len(conn.prompts), len(conn.resources)+len(conn.templates)
 
+	// The lock is not held while talking to the server, so that list_changed
+	// notifications arriving meanwhile do not deadlock.
+	m.mu.Lock()
 	if _, ok := m.servers[cfg.Name]; ok {
+		m.mu.Unlock()
+		if conn.session != nil {
+			_ = conn.session.Close()
+		}
+		cancel()
 		return nil, fmt.Errorf("mcp: server %q already connected", cfg.Name)
 	}
+	conn.status = ServerStatus{State: StateConnected, Since: time.Now()}
+	if err != nil {
+		conn.status.State = StateReconnecting
+		conn.status.LastError = err.Error()
+	}
+	m.servers[cfg.Name] = conn
+	m.mu.Unlock()
 
+	go m.supervise(superCtx, conn)
+	if err != nil {
+		telemetry.Metrics.MCPServerUp.WithLabelValues(cfg.Name).Set(0)
+		return nil, reconnectingError{err}
+	}
+	telemetry.Metrics.MCPServerUp.WithLabelValues(cfg.Name).Set(1)
+
+	m.logger.Info("mcp server connected",
+		slog.String("server", cfg.Name),
+		slog.Int("tools", len(tools)),
+		slog.Int("prompts", prompts),
+		slog.Int("resources", resources),
+	)
+
+	return tools, nil
+}
+
+// dial opens a session. A stdio server process lives until procCtx ends or
+// the session is closed.
+func (m *Manager) dial(ctx, procCtx context.Context, cfg ServerConfig) (*mcpsdk.ClientSession, error) {
 	var transport mcpsdk.Transport
-	if cfg.URL != "" {
-		transport = &mcpsdk.StreamableClientTransport{
-			Endpoint: cfg.URL,
+	switch {
+	case cfg.Transport != nil:
+		transport = cfg.Transport()
+	case cfg.URL != "":
+		t := &mcpsdk.StreamableClientTransport{Endpoint: cfg.URL}
+		if len(cfg.Headers) > 0 {
+			t.HTTPClient = &http.Client{Transport: &headerTransport{headers: cfg.Headers, base: http.DefaultTransport}}
 		}
-	} else {
-		cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+		transport = t
+	default:
+		cmd := exec.CommandContext(procCtx, cfg.Command, cfg.Args...)
 		if len(cfg.Env) > 0 {
 			cmd.Env = os.Environ()
 			for k, v := range cfg.Env {
@@ -69,30 +214,169 @@ func (m *Manager) Connect(ctx context.Context, cfg ServerConfig) ([]*mcpsdk.Tool
 		}
 		transport = &mcpsdk.CommandTransport{Command: cmd}
 	}
-	session, err := m.client.Connect(ctx, transport, nil)
-	if err != nil {
-		return nil, fmt.Errorf("mcp: connecting to %q: %w", cfg.Name, err)
+	return m.client.Connect(ctx, transport, nil)
+}
+
+// load lists what a newly connected server offers into conn. Only failing
+// to list tools is an error: prompts and resources are optional, and a
+// server failing to list them still provides its tools.
+func (m *Manager) load(ctx context.Context, conn *serverConn) error {
+	if err := m.refreshTools(ctx, conn); err != nil {
+		return err
+	}
+	if err := m.refreshPrompts(ctx, conn); err != nil {
+		m.logger.Warn("mcp: listing prompts failed", slog.String("server", conn.cfg.Name), slog.String("err", err.Error()))
 	}
+	if err := m.refreshResources(ctx, conn); err != nil {
+		m.logger.Warn("mcp: listing resources failed", slog.String("server", conn.cfg.Name), slog.String("err", err.Error()))
+	}
+	return nil
+}
 
+// headerTransport adds fixed headers, such as Authorization, to every
+// request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (m *Manager) refreshTools(ctx context.Context, conn *serverConn) error {
 	var tools []*mcpsdk.Tool
-	result, err := session.ListTools(ctx, nil)
-	if err != nil {
-		_ = session.Close()
-		return nil, fmt.Errorf("mcp: listing tools from %q: %w", cfg.Name, err)
+	for t, err := range conn.session.Tools(ctx, nil) {
+		if err != nil {
+			return err
+		}
+		if conn.cfg.allows(t.Name) {
+			tools = append(tools, t)
+		}
 	}
-	tools = result.Tools
+	conn.tools = tools
+	return nil
+}
 
-	m.servers[cfg.Name] = &serverConn{
-		session: session,
-		tools:   tools,
+func (m *Manager) refreshPrompts(ctx context.Context, conn *serverConn) error {
+	if caps := serverCapabilities(conn.session); caps == nil || caps.Prompts == nil {
+		conn.prompts = nil
+		return nil
 	}
+	var prompts []*mcpsdk.Prompt
+	for p, err := range conn.session.Prompts(ctx, nil) {
+		if err != nil {
+			return err
+		}
+		prompts = append(prompts, p)
+	}
+	conn.prompts = prompts
+	return nil
+}
 
-	m.logger.Info("mcp server connected",
-		slog.String("server", cfg.Name),
-		slog.Int("tools", len(tools)),
-	)
+func (m *Manager) refreshResources(ctx context.Context, conn *serverConn) error {
+	if caps := serverCapabilities(conn.session); caps == nil || caps.Resources == nil {
+		conn.resources, conn.templates = nil, nil
+		return nil
+	}
+	var resources []*mcpsdk.Resource
+	for r, err := range conn.session.Resources(ctx, nil) {
+		if err != nil {
+			return err
+		}
+		resources = append(resources, r)
+	}
+	var templates []*mcpsdk.ResourceTemplate
+	for t, err := range conn.session.ResourceTemplates(ctx, nil) {
+		if err != nil {
+			return err
+		}
+		templates = append(templates, t)
+	}
+	conn.resources, conn.templates = resources, templates
+	return nil
+}
 
-	return tools, nil
+func serverCapabilities(session *mcpsdk.ClientSession) *mcpsdk.ServerCapabilities {
+	if session == nil {
+		return nil
+	}
+	if res := session.InitializeResult(); res != nil {
+		return res.Capabilities
+	}
+	return nil
+}
+
+// refresh re-lists part of a server's offering after a list_changed
+// notification. Listing happens outside the lock, on a copy of the
+// connection, so a slow server does not block tool calls to others.
+func (m *Manager) refresh(ctx context.Context, session *mcpsdk.ClientSession, what string, list func(context.Context, *serverConn) error) {
+	m.mu.Lock()
+	name, conn := m.serverFor(session)
+	m.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	updated := &serverConn{cfg: conn.cfg, session: session}
+	if err := list(ctx, updated); err != nil {
+		m.logger.Warn("mcp: refreshing list failed",
+			slog.String("server", name),
+			slog.String("list", what),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	m.mu.Lock()
+	if m.servers[name] != conn {
+		m.mu.Unlock()
+		return
+	}
+	old := conn.tools
+	switch what {
+	case "tools":
+		conn.tools = updated.tools
+	case "prompts":
+		conn.prompts = updated.prompts
+	case "resources":
+		conn.resources, conn.templates = updated.resources, updated.templates
+	}
+	current := conn.tools
+	notify := m.onToolsChanged
+	m.mu.Unlock()
+
+	m.logger.Info("mcp server list changed", slog.String("server", name), slog.String("list", what))
+	if what == "tools" && notify != nil {
+		notify(name, current, removedTools(old, current))
+	}
+}
+
+func (m *Manager) serverFor(session *mcpsdk.ClientSession) (string, *serverConn) {
+	for name, conn := range m.servers {
+		if conn.session == session {
+			return name, conn
+		}
+	}
+	return "", nil
+}
+
+func removedTools(old, current []*mcpsdk.Tool) []string {
+	keep := make(map[string]bool, len(current))
+	for _, t := range current {
+		keep[t.Name] = true
+	}
+	var removed []string
+	for _, t := range old {
+		if !keep[t.Name] {
+			removed = append(removed, t.Name)
+		}
+	}
+	return removed
 }
 
 func (m *Manager) Session(name string) (*mcpsdk.ClientSession, error) {
@@ -102,19 +386,45 @@ func (m *Manager) Session(name string) (*mcpsdk.ClientSession, error) {
 	if !ok {
 		return nil, fmt.Errorf("mcp: server %q not connected", name)
 	}
+	if conn.status.State != StateConnected {
+		return nil, fmt.Errorf("mcp: server %q is reconnecting: %s", name, conn.status.LastError)
+	}
 	return conn.session, nil
 }
 
-func (m *Manager) Disconnect(name string) error {
+// NewTool wraps one of a server's tools with the server's timeout and
+// approval settings.
+func (m *Manager) NewTool(server string, tool *mcpsdk.Tool) *MCPTool {
+	t := NewMCPTool(server, tool, func() (*mcpsdk.ClientSession, error) { return m.Session(server) })
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if conn, ok := m.servers[server]; ok {
+		t.Timeout = conn.cfg.Timeout
+		t.RequireApproval = conn.cfg.RequireApproval
+	}
+	return t
+}
+
+func (m *Manager) Disconnect(name string) error {
+	m.mu.Lock()
 	conn, ok := m.servers[name]
 	if !ok {
+		m.mu.Unlock()
 		return fmt.Errorf("mcp: server %q not connected", name)
 	}
 	delete(m.servers, name)
+	// Cancelling under the lock keeps a reconnect from installing a new
+	// session after this one is closed.
+	conn.cancel()
+	session := conn.session
+	m.mu.Unlock()
+
+	telemetry.Metrics.MCPServerUp.DeleteLabelValues(name)
 	m.logger.Info("mcp server disconnected", slog.String("server", name))
-	return conn.session.Close()
+	if session == nil {
+		return nil
+	}
+	return session.Close()
 }
 
 func (m *Manager) DisconnectAll() {
@@ -154,3 +464,62 @@ type ToolInfo struct {
 	ServerName string
 	Tool       *mcpsdk.Tool
 }
+
+type PromptInfo struct {
+	ServerName string
+	Prompt     *mcpsdk.Prompt
+}
+
+type ResourceInfo struct {
+	ServerName string
+	Resource   *mcpsdk.Resource
+}
+
+type ResourceTemplateInfo struct {
+	ServerName string
+	Template   *mcpsdk.ResourceTemplate
+}
+
+func (m *Manager) AllPrompts() []PromptInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []PromptInfo
+	for serverName, conn := range m.servers {
+		for _, p := range conn.prompts {
+			all = append(all, PromptInfo{ServerName: serverName, Prompt: p})
+		}
+	}
+	return all
+}
+
+func (m *Manager) AllResources() ([]ResourceInfo, []ResourceTemplateInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var resources []ResourceInfo
+	var templates []ResourceTemplateInfo
+	for serverName, conn := range m.servers {
+		for _, r := range conn.resources {
+			resources = append(resources, ResourceInfo{ServerName: serverName, Resource: r})
+		}
+		for _, t := range conn.templates {
+			templates = append(templates, ResourceTemplateInfo{ServerName: serverName, Template: t})
+		}
+	}
+	return resources, templates
+}
+
+// FindPrompt returns the prompt a server offers under name.
+func (m *Manager) FindPrompt(server, name string) (*mcpsdk.Prompt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conn, ok := m.servers[server]
+	if !ok {
+		return nil, fmt.Errorf("mcp: server %q not connected", server)
+	}
+	for _, p := range conn.prompts {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("mcp: server %q has no prompt %q", server, name)
+}
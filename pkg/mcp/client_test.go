@@ -0,0 +1,290 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var pngData = []byte("\x89PNG\r\n\x1a\nfake")
+
+func newTestServer() *mcpsdk.Server {
+	srv := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "test", Version: "1"}, nil)
+	srv.AddTool(&mcpsdk.Tool{Name: "chart", InputSchema: map[string]any{"type": "object"}},
+		func(context.Context, *mcpsdk.CallToolRequest) (*mcpsdk.CallToolResult, error) {
+			return &mcpsdk.CallToolResult{
+				Content: []mcpsdk.Content{
+					&mcpsdk.TextContent{Text: "here is the chart"},
+					&mcpsdk.ImageContent{MIMEType: "image/png", Data: pngData},
+					&mcpsdk.EmbeddedResource{Resource: &mcpsdk.ResourceContents{URI: "file:///data.csv", Text: "a,b\n1,2"}},
+				},
+				StructuredContent: map[string]any{"points": 2},
+			}, nil
+		})
+	srv.AddPrompt(&mcpsdk.Prompt{Name: "review", Arguments: []*mcpsdk.PromptArgument{
+		{Name: "file", Required: true},
+		{Name: "focus"},
+	}}, func(_ context.Context, req *mcpsdk.GetPromptRequest) (*mcpsdk.GetPromptResult, error) {
+		return &mcpsdk.GetPromptResult{Messages: []*mcpsdk.PromptMessage{{
+			Role:    "user",
+			Content: &mcpsdk.TextContent{Text: "Review " + req.Params.Arguments["file"] + " for " + req.Params.Arguments["focus"]},
+		}}}, nil
+	})
+	srv.AddResource(&mcpsdk.Resource{URI: "file:///README.md", Name: "readme", MIMEType: "text/markdown"},
+		func(context.Context, *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+			return &mcpsdk.ReadResourceResult{Contents: []*mcpsdk.ResourceContents{{URI: "file:///README.md", Text: "# Hello"}}}, nil
+		})
+	srv.AddResource(&mcpsdk.Resource{URI: "file:///logo.png", Name: "logo", MIMEType: "image/png"},
+		func(context.Context, *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+			return &mcpsdk.ReadResourceResult{Contents: []*mcpsdk.ResourceContents{{URI: "file:///logo.png", MIMEType: "image/png", Blob: pngData}}}, nil
+		})
+	return srv
+}
+
+// inMemory returns a Transport func that connects each new client to srv,
+// passing the server side of every connection to sessions if given.
+func inMemory(t *testing.T, srv *mcpsdk.Server, sessions chan<- *mcpsdk.ServerSession) func() mcpsdk.Transport {
+	return func() mcpsdk.Transport {
+		clientT, serverT := mcpsdk.NewInMemoryTransports()
+		ss, err := srv.Connect(context.Background(), serverT, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if sessions != nil {
+			sessions <- ss
+		}
+		return clientT
+	}
+}
+
+func connectTestServer(t *testing.T, srv *mcpsdk.Server) *Manager {
+	t.Helper()
+	mgr := NewManager(nil)
+	if _, err := mgr.Connect(t.Context(), ServerConfig{Name: "srv", Transport: inMemory(t, srv, nil)}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.DisconnectAll)
+	return mgr
+}
+
+func TestMCPTool_ExecuteContent(t *testing.T) {
+	mgr := connectTestServer(t, newTestServer())
+	all := mgr.AllTools()
+	if len(all) != 1 {
+		t.Fatalf("tools = %v", all)
+	}
+	tool := NewMCPTool("srv", all[0].Tool, func() (*mcpsdk.ClientSession, error) { return mgr.Session("srv") })
+	tool.ImageDir = t.TempDir()
+
+	ctx := tools.WithSessionInfo(t.Context(), "s1", "default")
+	out, err := tool.Execute(ctx, json.RawMessage(`{}`), nil, sandbox.Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"here is the chart", "[image attached]", "a,b\n1,2", `{"points":2}`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	if imgs := tool.ConsumeImages(tools.WithSessionInfo(t.Context(), "other", "default")); len(imgs) != 0 {
+		t.Errorf("images leaked to another session: %v", imgs)
+	}
+	imgs := tool.ConsumeImages(ctx)
+	if len(imgs) != 1 || imgs[0].MediaType != "image/png" {
+		t.Fatalf("images = %+v", imgs)
+	}
+	if data, err := os.ReadFile(imgs[0].Path); err != nil || string(data) != string(pngData) {
+		t.Errorf("stored image = %q, %v", data, err)
+	}
+	if len(tool.ConsumeImages(ctx)) != 0 {
+		t.Error("images should be consumed once")
+	}
+}
+
+func TestMCPTool_ParallelCallsKeepImagesApart(t *testing.T) {
+	mgr := connectTestServer(t, newTestServer())
+	tool := NewMCPTool("srv", mgr.AllTools()[0].Tool, func() (*mcpsdk.ClientSession, error) { return mgr.Session("srv") })
+	tool.ImageDir = t.TempDir()
+
+	ctx := tools.WithSessionInfo(t.Context(), "s1", "default")
+	first := tools.WithToolCallID(ctx, "call-1")
+	second := tools.WithToolCallID(ctx, "call-2")
+	for _, c := range []context.Context{first, second} {
+		if _, err := tool.Execute(c, json.RawMessage(`{}`), nil, sandbox.Policy{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if imgs := tool.ConsumeImages(first); len(imgs) != 1 {
+		t.Errorf("call-1 images = %d, want 1", len(imgs))
+	}
+	if imgs := tool.ConsumeImages(second); len(imgs) != 1 {
+		t.Errorf("call-2 images = %d, want 1", len(imgs))
+	}
+}
+
+func TestStructuredContentNotDuplicated(t *testing.T) {
+	c := &converter{}
+	c.add(&mcpsdk.TextContent{Text: `{ "points": 2 }`})
+	c.addStructured(map[string]any{"points": 2})
+	if len(c.parts) != 1 {
+		t.Errorf("parts = %q", c.parts)
+	}
+}
+
+func TestResourceTool(t *testing.T) {
+	mgr := connectTestServer(t, newTestServer())
+	if got := mgr.ResourceServers(); !slices.Equal(got, []string{"srv"}) {
+		t.Fatalf("ResourceServers = %v", got)
+	}
+	tool := &ResourceTool{Manager: mgr, ImageDir: t.TempDir()}
+	ctx := tools.WithSessionInfo(t.Context(), "s1", "default")
+
+	out, err := tool.Execute(ctx, json.RawMessage(`{"action":"list"}`), nil, sandbox.Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "srv file:///README.md — readme (text/markdown)") || !strings.Contains(out, "file:///logo.png") {
+		t.Errorf("list output:\n%s", out)
+	}
+
+	out, err = tool.Execute(ctx, json.RawMessage(`{"action":"read","server":"srv","uri":"file:///README.md"}`), nil, sandbox.Policy{})
+	if err != nil || out != "# Hello" {
+		t.Errorf("read = %q, %v", out, err)
+	}
+
+	out, err = tool.Execute(ctx, json.RawMessage(`{"action":"read","server":"srv","uri":"file:///logo.png"}`), nil, sandbox.Policy{})
+	if err != nil || !strings.Contains(out, "file:///logo.png attached") {
+		t.Errorf("read image = %q, %v", out, err)
+	}
+	if imgs := tool.ConsumeImages(ctx); len(imgs) != 1 {
+		t.Errorf("images = %v", imgs)
+	}
+
+	if _, err := tool.Execute(ctx, json.RawMessage(`{"action":"read","server":"srv"}`), nil, sandbox.Policy{}); err == nil {
+		t.Error("expected an error without uri")
+	}
+}
+
+func TestPromptCommands(t *testing.T) {
+	mgr := connectTestServer(t, newTestServer())
+	cmds := &PromptCommands{Manager: mgr}
+	ctx := t.Context()
+
+	got, ok, err := cmds.ExpandCommand(ctx, "mcp_srv__review", "main.go security issues")
+	if err != nil || !ok || got != "Review main.go for security issues" {
+		t.Errorf("positional = %q, %v, %v", got, ok, err)
+	}
+	got, ok, err = cmds.ExpandCommand(ctx, "mcp_srv__review", "focus=naming things file=util.go")
+	if err != nil || !ok || got != "Review util.go for naming things" {
+		t.Errorf("named = %q, %v, %v", got, ok, err)
+	}
+	_, ok, err = cmds.ExpandCommand(ctx, "mcp_srv__review", "")
+	if !ok || err == nil || !strings.Contains(err.Error(), "usage: /mcp_srv__review <file> [focus]") {
+		t.Errorf("missing argument: ok=%v err=%v", ok, err)
+	}
+	for _, name := range []string{"help", "mcp_srv__nope", "mcp_other__review", "mcp_srv"} {
+		if _, ok, err := cmds.ExpandCommand(ctx, name, ""); ok || err != nil {
+			t.Errorf("%s: ok=%v err=%v, want unknown", name, ok, err)
+		}
+	}
+}
+
+func TestParsePromptArgs(t *testing.T) {
+	one := []*mcpsdk.PromptArgument{{Name: "text", Required: true}}
+	two := []*mcpsdk.PromptArgument{{Name: "a"}, {Name: "b"}}
+	tests := []struct {
+		name    string
+		defs    []*mcpsdk.PromptArgument
+		args    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"single takes everything", one, "hello  big world", map[string]string{"text": "hello big world"}, false},
+		{"positional", two, "x y z", map[string]string{"a": "x", "b": "y z"}, false},
+		{"fewer than declared", two, "x", map[string]string{"a": "x"}, false},
+		{"named", two, "b=2 a=1", map[string]string{"a": "1", "b": "2"}, false},
+		{"text before name", two, "oops a=1", nil, true},
+		{"missing required", one, "", nil, true},
+		{"no arguments declared", nil, "x", nil, true},
+		{"unknown key is positional", two, "c=3 d", map[string]string{"a": "c=3", "b": "d"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePromptArgs(tt.defs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if !tt.wantErr && !equalMaps(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestToolListChanged(t *testing.T) {
+	srv := newTestServer()
+	mgr := connectTestServer(t, srv)
+
+	type change struct {
+		tools   []string
+		removed []string
+	}
+	changes := make(chan change, 4)
+	mgr.OnToolsChanged(func(server string, ts []*mcpsdk.Tool, removed []string) {
+		var names []string
+		for _, tool := range ts {
+			names = append(names, tool.Name)
+		}
+		slices.Sort(names)
+		changes <- change{names, removed}
+	})
+
+	wait := func() change {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("no tool list change received")
+			return change{}
+		}
+	}
+
+	srv.AddTool(&mcpsdk.Tool{Name: "ping", InputSchema: map[string]any{"type": "object"}},
+		func(context.Context, *mcpsdk.CallToolRequest) (*mcpsdk.CallToolResult, error) {
+			return &mcpsdk.CallToolResult{}, nil
+		})
+	if c := wait(); !slices.Equal(c.tools, []string{"chart", "ping"}) || len(c.removed) != 0 {
+		t.Errorf("after add: %+v", c)
+	}
+
+	srv.RemoveTools("chart")
+	if c := wait(); !slices.Equal(c.tools, []string{"ping"}) || !slices.Equal(c.removed, []string{"chart"}) {
+		t.Errorf("after remove: %+v", c)
+	}
+	if all := mgr.AllTools(); len(all) != 1 || all[0].Tool.Name != "ping" {
+		t.Errorf("AllTools = %v", all)
+	}
+}
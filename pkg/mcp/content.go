@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var imageExts = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// converter turns MCP content into tool output: text for the model to read
+// and images for it to see. Images are written to imageDir so they survive
+// in the session history; without a directory they are kept in memory only.
+// With noImages set they are left out.
+type converter struct {
+	imageDir string
+	noImages bool
+	parts    []string
+	images   []llm.ImageContent
+}
+
+func (c *converter) text() string { return strings.Join(c.parts, "\n") }
+
+func (c *converter) add(content mcpsdk.Content) error {
+	switch v := content.(type) {
+	case *mcpsdk.TextContent:
+		c.parts = append(c.parts, v.Text)
+	case *mcpsdk.ImageContent:
+		return c.addImage(v.MIMEType, v.Data, "")
+	case *mcpsdk.AudioContent:
+		c.parts = append(c.parts, fmt.Sprintf("[audio %s, %d bytes omitted]", v.MIMEType, len(v.Data)))
+	case *mcpsdk.ResourceLink:
+		c.parts = append(c.parts, fmt.Sprintf("[resource %s: %s]", v.URI, firstNonEmpty(v.Title, v.Name, v.Description)))
+	case *mcpsdk.EmbeddedResource:
+		if v.Resource != nil {
+			return c.addResource(v.Resource)
+		}
+	}
+	return nil
+}
+
+func (c *converter) addResource(r *mcpsdk.ResourceContents) error {
+	switch {
+	case r.Blob == nil:
+		c.parts = append(c.parts, r.Text)
+	case imageExts[r.MIMEType] != "":
+		return c.addImage(r.MIMEType, r.Blob, r.URI)
+	default:
+		c.parts = append(c.parts, fmt.Sprintf("[resource %s: %s, %d bytes of binary data omitted]", r.URI, firstNonEmpty(r.MIMEType, "unknown type"), len(r.Blob)))
+	}
+	return nil
+}
+
+func (c *converter) addImage(mimeType string, data []byte, uri string) error {
+	ext, ok := imageExts[mimeType]
+	if !ok {
+		c.parts = append(c.parts, fmt.Sprintf("[image %s, %d bytes omitted: unsupported type]", mimeType, len(data)))
+		return nil
+	}
+	if c.noImages {
+		c.parts = append(c.parts, fmt.Sprintf("[image %s omitted]", mimeType))
+		return nil
+	}
+	img := llm.ImageContent{MediaType: mimeType}
+	img.SetData(data)
+	if c.imageDir != "" {
+		if err := os.MkdirAll(c.imageDir, 0750); err != nil {
+			return fmt.Errorf("creating image dir: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		img.Path = filepath.Join(c.imageDir, hex.EncodeToString(sum[:12])+ext)
+		if err := os.WriteFile(img.Path, data, 0600); err != nil {
+			return fmt.Errorf("writing image: %w", err)
+		}
+	}
+	c.images = append(c.images, img)
+	if uri != "" {
+		c.parts = append(c.parts, fmt.Sprintf("[image %s attached]", uri))
+	} else {
+		c.parts = append(c.parts, "[image attached]")
+	}
+	return nil
+}
+
+// addStructured appends a tool's structured result unless a text block
+// already carries the same JSON, as the spec recommends servers do.
+func (c *converter) addStructured(v any) {
+	if v == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	for _, p := range c.parts {
+		var compact bytes.Buffer
+		if json.Compact(&compact, []byte(p)) == nil && bytes.Equal(compact.Bytes(), data) {
+			return
+		}
+	}
+	c.parts = append(c.parts, string(data))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// imageQueue holds the images of each tool call until the agent collects
+// them through ConsumeImages. Calls are keyed by session and tool-call ID so
+// that parallel calls of one tool keep their images apart.
+type imageQueue struct {
+	mu     sync.Mutex
+	byCall map[imageKey][]llm.ImageContent
+}
+
+type imageKey struct {
+	sessionID string
+	callID    string
+}
+
+func callKey(ctx context.Context) imageKey {
+	return imageKey{tools.SessionIDFromContext(ctx), tools.ToolCallIDFromContext(ctx)}
+}
+
+func (q *imageQueue) add(ctx context.Context, images []llm.ImageContent) {
+	if len(images) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.byCall == nil {
+		q.byCall = make(map[imageKey][]llm.ImageContent)
+	}
+	key := callKey(ctx)
+	q.byCall[key] = append(q.byCall[key], images...)
+}
+
+func (q *imageQueue) consume(ctx context.Context) []llm.ImageContent {
+	key := callKey(ctx)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	images := q.byCall[key]
+	delete(q.byCall, key)
+	return images
+}
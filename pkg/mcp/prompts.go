@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// PromptCommands exposes MCP prompts as slash-commands named like MCP tools,
+// "/mcp_<server>__<prompt> args". Arguments are given as name=value pairs, or
+// positionally with the last argument taking the rest of the line.
+type PromptCommands struct {
+	Manager *Manager
+}
+
+func (p *PromptCommands) ExpandCommand(ctx context.Context, name, args string) (string, bool, error) {
+	rest, ok := strings.CutPrefix(name, "mcp_")
+	if !ok {
+		return "", false, nil
+	}
+	server, promptName, ok := strings.Cut(rest, "__")
+	if !ok {
+		return "", false, nil
+	}
+	prompt, err := p.Manager.FindPrompt(server, promptName)
+	if err != nil {
+		return "", false, nil
+	}
+
+	values, err := parsePromptArgs(prompt.Arguments, args)
+	if err != nil {
+		return "", true, fmt.Errorf("%w\nusage: %s", err, promptUsage(server, prompt))
+	}
+	sess, err := p.Manager.Session(server)
+	if err != nil {
+		return "", true, err
+	}
+	res, err := sess.GetPrompt(ctx, &mcpsdk.GetPromptParams{Name: prompt.Name, Arguments: values})
+	if err != nil {
+		return "", true, fmt.Errorf("getting prompt: %w", err)
+	}
+	text, err := promptText(res)
+	if err != nil {
+		return "", true, err
+	}
+	return text, true, nil
+}
+
+// parsePromptArgs maps a command line onto a prompt's declared arguments.
+func parsePromptArgs(defs []*mcpsdk.PromptArgument, args string) (map[string]string, error) {
+	values := make(map[string]string)
+	fields := strings.Fields(args)
+	known := make(map[string]bool, len(defs))
+	for _, d := range defs {
+		known[d.Name] = true
+	}
+
+	named := false
+	for _, f := range fields {
+		if k, _, ok := strings.Cut(f, "="); ok && known[k] {
+			named = true
+			break
+		}
+	}
+
+	switch {
+	case len(fields) == 0:
+	case len(defs) == 0:
+		return nil, fmt.Errorf("this prompt takes no arguments")
+	case named:
+		current := ""
+		for _, f := range fields {
+			if k, v, ok := strings.Cut(f, "="); ok && known[k] {
+				current = k
+				values[k] = v
+				continue
+			}
+			if current == "" {
+				return nil, fmt.Errorf("unexpected %q before the first name=value argument", f)
+			}
+			values[current] += " " + f
+		}
+	default:
+		for i, d := range defs {
+			if i == len(defs)-1 || i == len(fields)-1 {
+				values[d.Name] = strings.Join(fields[i:], " ")
+				break
+			}
+			values[d.Name] = fields[i]
+		}
+	}
+
+	var missing []string
+	for _, d := range defs {
+		if d.Required && values[d.Name] == "" {
+			missing = append(missing, d.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required arguments: %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+func promptUsage(server string, p *mcpsdk.Prompt) string {
+	parts := []string{"/" + ToolName(server, p.Name)}
+	for _, a := range p.Arguments {
+		if a.Required {
+			parts = append(parts, "<"+a.Name+">")
+		} else {
+			parts = append(parts, "["+a.Name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// promptText flattens a prompt's messages into a single user message. Roles
+// are only spelled out when the prompt includes assistant turns.
+func promptText(res *mcpsdk.GetPromptResult) (string, error) {
+	mixed := false
+	for _, m := range res.Messages {
+		if m.Role != "user" {
+			mixed = true
+		}
+	}
+	var parts []string
+	for _, m := range res.Messages {
+		conv := &converter{noImages: true}
+		if err := conv.add(m.Content); err != nil {
+			return "", err
+		}
+		text := conv.text()
+		if mixed {
+			text = fmt.Sprintf("%s: %s", m.Role, text)
+		}
+		parts = append(parts, text)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("prompt has no messages")
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
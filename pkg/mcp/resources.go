@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const ResourceToolName = "mcp_resources"
+
+// ResourceServers returns the connected servers that offer resources.
+func (m *Manager) ResourceServers() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name, conn := range m.servers {
+		if caps := serverCapabilities(conn.session); caps != nil && caps.Resources != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Manager) ReadResource(ctx context.Context, server, uri string) (*mcpsdk.ReadResourceResult, error) {
+	sess, err := m.Session(server)
+	if err != nil {
+		return nil, err
+	}
+	res, err := sess.ReadResource(ctx, &mcpsdk.ReadResourceParams{URI: uri})
+	if err != nil {
+		return nil, fmt.Errorf("mcp: reading %s from %q: %w", uri, server, err)
+	}
+	return res, nil
+}
+
+// ResourceTool lets the agent list and read the resources of connected MCP
+// servers: files, database schemas, documents and the like.
+type ResourceTool struct {
+	Manager *Manager
+	// ImageDir is where image resources are stored, as for MCPTool.
+	ImageDir string
+
+	images imageQueue
+}
+
+type resourceInput struct {
+	Action string `json:"action"`
+	Server string `json:"server,omitempty"`
+	URI    string `json:"uri,omitempty"`
+}
+
+func (t *ResourceTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        ResourceToolName,
+		Description: "List or read resources (files, documents, schemas, records) offered by connected MCP servers. List first to find URIs; URI templates can be filled in and read.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"action": {
+					"type": "string",
+					"enum": ["list", "read"],
+					"description": "list resources and URI templates, or read one resource"
+				},
+				"server": {
+					"type": "string",
+					"description": "MCP server name; required for read, optional filter for list"
+				},
+				"uri": {
+					"type": "string",
+					"description": "Resource URI to read"
+				}
+			},
+			"required": ["action"]
+		}`),
+	}
+}
+
+func (t *ResourceTool) Execute(ctx context.Context, input json.RawMessage, _ sandbox.Sandbox, _ sandbox.Policy) (string, error) {
+	var params resourceInput
+	if err := json.Unmarshal(input, &params); err != nil {
+		return "", fmt.Errorf("%s: invalid input: %w", ResourceToolName, err)
+	}
+
+	switch params.Action {
+	case "list":
+		return t.list(params.Server), nil
+	case "read":
+		if params.Server == "" || params.URI == "" {
+			return "", fmt.Errorf("%s: server and uri are required for read", ResourceToolName)
+		}
+		return t.read(ctx, params.Server, params.URI)
+	default:
+		return "", fmt.Errorf("%s: unknown action %q", ResourceToolName, params.Action)
+	}
+}
+
+func (t *ResourceTool) list(server string) string {
+	resources, templates := t.Manager.AllResources()
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].ServerName != resources[j].ServerName {
+			return resources[i].ServerName < resources[j].ServerName
+		}
+		return resources[i].Resource.URI < resources[j].Resource.URI
+	})
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].ServerName != templates[j].ServerName {
+			return templates[i].ServerName < templates[j].ServerName
+		}
+		return templates[i].Template.URITemplate < templates[j].Template.URITemplate
+	})
+
+	var b strings.Builder
+	for _, r := range resources {
+		if server != "" && r.ServerName != server {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s — %s", r.ServerName, r.Resource.URI, firstNonEmpty(r.Resource.Title, r.Resource.Name))
+		if r.Resource.MIMEType != "" {
+			fmt.Fprintf(&b, " (%s)", r.Resource.MIMEType)
+		}
+		if r.Resource.Description != "" {
+			fmt.Fprintf(&b, ": %s", r.Resource.Description)
+		}
+		b.WriteString("\n")
+	}
+	for _, tpl := range templates {
+		if server != "" && tpl.ServerName != server {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s (template) — %s", tpl.ServerName, tpl.Template.URITemplate, firstNonEmpty(tpl.Template.Title, tpl.Template.Name))
+		if tpl.Template.Description != "" {
+			fmt.Fprintf(&b, ": %s", tpl.Template.Description)
+		}
+		b.WriteString("\n")
+	}
+	if b.Len() == 0 {
+		return "No MCP resources available."
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (t *ResourceTool) read(ctx context.Context, server, uri string) (string, error) {
+	res, err := t.Manager.ReadResource(ctx, server, uri)
+	if err != nil {
+		return "", err
+	}
+	conv := &converter{imageDir: t.ImageDir}
+	for _, c := range res.Contents {
+		if err := conv.addResource(c); err != nil {
+			return "", fmt.Errorf("%s: %w", ResourceToolName, err)
+		}
+	}
+	t.images.add(ctx, conv.images)
+	return conv.text(), nil
+}
+
+func (t *ResourceTool) ConsumeImages(ctx context.Context) []llm.ImageContent {
+	return t.images.consume(ctx)
+}
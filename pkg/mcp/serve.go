@@ -0,0 +1,313 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/memory"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	ChatToolName    = "chat"
+	ServeChannel    = "mcp"
+	MemoryURIPrefix = "pincer://memory/"
+)
+
+// unservedTools deliver their results to chat channels, which MCP clients
+// are not part of.
+var unservedTools = map[string]bool{
+	"notify":    true,
+	"send_file": true,
+	"spawn":     true,
+}
+
+// approvalSchema asks for a plain accept or decline.
+var approvalSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// ServeConfig configures the MCP server that exposes Pincer itself.
+type ServeConfig struct {
+	Runtime *agent.Runtime
+	// Approver answers approval requests with the client's elicitation
+	// replies. Without it, or when the client cannot elicit, tools that need
+	// approval are denied.
+	Approver *agent.Approver
+	Memory   *memory.Store
+	// AgentID is the agent whose tools, sessions and memory are served.
+	AgentID string
+	Version string
+	Logger  *slog.Logger
+}
+
+type server struct {
+	cfg ServeConfig
+	// stdioSession names the session of transports without session IDs,
+	// which carry a single client.
+	stdioSession string
+}
+
+// NewServer returns an MCP server offering the agent's tools, a chat tool
+// that runs a full agent turn, and the agent's memory as resources. Tools
+// proxied from other MCP servers are not re-exported.
+func NewServer(cfg ServeConfig) *mcpsdk.Server {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	s := &server{cfg: cfg, stdioSession: uuid.NewString()}
+
+	srv := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "pincer", Version: cfg.Version}, &mcpsdk.ServerOptions{
+		Logger: cfg.Logger,
+	})
+
+	for _, def := range cfg.Runtime.ToolDefinitions(cfg.AgentID) {
+		if unservedTools[def.Name] || def.Name == ChatToolName || strings.HasPrefix(def.Name, "mcp_") {
+			continue
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(def.InputSchema, &schema); err != nil || schema["type"] != "object" {
+			cfg.Logger.Warn("mcp serve: skipping tool without an object schema", slog.String("tool", def.Name))
+			continue
+		}
+		srv.AddTool(&mcpsdk.Tool{
+			Name:        def.Name,
+			Description: def.Description,
+			InputSchema: def.InputSchema,
+		}, s.callTool)
+	}
+
+	srv.AddTool(&mcpsdk.Tool{
+		Name:        ChatToolName,
+		Description: "Send a message to the Pincer agent and return its reply. The agent keeps the conversation and may use its own tools; pass session to hold several separate conversations.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"message":{"type":"string","description":"The message to send"},"session":{"type":"string","description":"Conversation to continue; defaults to one per MCP session"}},"required":["message"]}`),
+	}, s.chat)
+
+	if cfg.Memory != nil {
+		srv.AddResourceTemplate(&mcpsdk.ResourceTemplate{
+			Name:        "memory",
+			Description: "A long-term memory entry of the Pincer agent",
+			URITemplate: MemoryURIPrefix + "{key}",
+			MIMEType:    "text/plain",
+		}, s.readMemory)
+		srv.AddReceivingMiddleware(s.listMemory)
+	}
+	return srv
+}
+
+func (s *server) callTool(ctx context.Context, req *mcpsdk.CallToolRequest) (*mcpsdk.CallToolResult, error) {
+	ctx, span := startServerSpan(ctx, req)
+	defer span.End()
+	sessionID, err := s.ensureSession(ctx, req.Session, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = s.approvalContext(ctx, req.Session)
+	out := make(chan agent.TurnEvent, 1)
+	go func() {
+		for {
+			select {
+			case ev := <-out:
+				if ev.Type == agent.TurnApprovalNeeded {
+					s.approve(ctx, req.Session, ev.ApprovalRequest)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	result, err := s.cfg.Runtime.CallTool(ctx, sessionID, llm.ToolCall{
+		Name:  req.Params.Name,
+		Input: req.Params.Arguments,
+	}, out)
+	if err != nil {
+		return nil, err
+	}
+	return toolResult(s.cfg.Logger, result), nil
+}
+
+type chatInput struct {
+	Message string `json:"message"`
+	Session string `json:"session,omitempty"`
+}
+
+func (s *server) chat(ctx context.Context, req *mcpsdk.CallToolRequest) (*mcpsdk.CallToolResult, error) {
+	ctx, span := startServerSpan(ctx, req)
+	defer span.End()
+	var in chatInput
+	if len(req.Params.Arguments) > 0 {
+		if err := json.Unmarshal(req.Params.Arguments, &in); err != nil {
+			return nil, fmt.Errorf("chat: invalid input: %w", err)
+		}
+	}
+	if strings.TrimSpace(in.Message) == "" {
+		return nil, errors.New("chat: message is required")
+	}
+	sessionID, err := s.ensureSession(ctx, req.Session, in.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = s.approvalContext(ctx, req.Session)
+	events, err := s.cfg.Runtime.RunTurn(ctx, sessionID, in.Message)
+	if err != nil {
+		return nil, fmt.Errorf("chat: %w", err)
+	}
+
+	var reply string
+	var turnErr error
+	for ev := range events {
+		switch ev.Type {
+		case agent.TurnApprovalNeeded:
+			s.approve(ctx, req.Session, ev.ApprovalRequest)
+		case agent.TurnDone:
+			reply = ev.Message
+		case agent.TurnError:
+			turnErr = ev.Error
+		}
+	}
+	if turnErr != nil {
+		return &mcpsdk.CallToolResult{
+			Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: turnErr.Error()}},
+			IsError: true,
+		}, nil
+	}
+	return &mcpsdk.CallToolResult{Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: reply}}}, nil
+}
+
+// ensureSession creates the agent session for an MCP session, or for the
+// named conversation when the client picks one.
+func (s *server) ensureSession(ctx context.Context, ss *mcpsdk.ServerSession, name string) (string, error) {
+	if name == "" {
+		name = ss.ID()
+		if name == "" {
+			name = s.stdioSession
+		}
+	}
+	sessionID := ServeChannel + "-" + name
+
+	peer := "anonymous"
+	if p := ss.InitializeParams(); p != nil && p.ClientInfo != nil && p.ClientInfo.Name != "" {
+		peer = p.ClientInfo.Name
+	}
+	if _, err := s.cfg.Runtime.EnsureSession(ctx, sessionID, s.cfg.AgentID, ServeChannel, peer); err != nil {
+		return "", fmt.Errorf("creating session: %w", err)
+	}
+	return sessionID, nil
+}
+
+// approvalContext denies approvals the client has no way to answer, and
+// scopes the rest to the client's session so that chat channels sharing
+// the approver never see or answer them.
+func (s *server) approvalContext(ctx context.Context, ss *mcpsdk.ServerSession) context.Context {
+	if s.cfg.Approver == nil || !canElicit(ss) {
+		return agent.WithApprovalsDenied(ctx)
+	}
+	return agent.WithApprovalScope(ctx, s.approvalScope(ss))
+}
+
+func (s *server) approvalScope(ss *mcpsdk.ServerSession) string {
+	id := ss.ID()
+	if id == "" {
+		id = s.stdioSession
+	}
+	return ServeChannel + ":" + id
+}
+
+func canElicit(ss *mcpsdk.ServerSession) bool {
+	p := ss.InitializeParams()
+	return p != nil && p.Capabilities != nil && p.Capabilities.Elicitation != nil
+}
+
+// approve asks the client to confirm a tool call and hands the answer to the
+// approver. Anything but an explicit accept denies the call.
+func (s *server) approve(ctx context.Context, ss *mcpsdk.ServerSession, req *agent.ApprovalRequest) {
+	res, err := ss.Elicit(ctx, &mcpsdk.ElicitParams{
+		Message:         fmt.Sprintf("Pincer wants to run %s with input:\n%s", req.ToolName, req.Input),
+		RequestedSchema: approvalSchema,
+	})
+	if err != nil {
+		s.cfg.Logger.Warn("mcp serve: approval elicitation failed",
+			slog.String("tool", req.ToolName),
+			slog.String("err", err.Error()),
+		)
+	}
+	s.cfg.Approver.RespondIn(s.approvalScope(ss), agent.ApprovalResponse{
+		RequestID: req.ID,
+		Approved:  err == nil && res.Action == "accept",
+	})
+}
+
+func (s *server) readMemory(ctx context.Context, req *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+	uri := req.Params.URI
+	key, err := url.PathUnescape(strings.TrimPrefix(uri, MemoryURIPrefix))
+	if err != nil || !strings.HasPrefix(uri, MemoryURIPrefix) {
+		return nil, mcpsdk.ResourceNotFoundError(uri)
+	}
+	e, err := s.cfg.Memory.Get(ctx, s.cfg.Runtime.MemoryNamespace(s.cfg.AgentID), key)
+	if errors.Is(err, memory.ErrNotFound) {
+		return nil, mcpsdk.ResourceNotFoundError(uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mcpsdk.ReadResourceResult{Contents: []*mcpsdk.ResourceContents{{
+		URI:      uri,
+		MIMEType: "text/plain",
+		Text:     e.Value,
+	}}}, nil
+}
+
+// listMemory answers resources/list from the memory store, whose entries
+// change outside the server's resource registry.
+func (s *server) listMemory(next mcpsdk.MethodHandler) mcpsdk.MethodHandler {
+	return func(ctx context.Context, method string, req mcpsdk.Request) (mcpsdk.Result, error) {
+		if method != "resources/list" {
+			return next(ctx, method, req)
+		}
+		entries, err := s.cfg.Memory.List(ctx, s.cfg.Runtime.MemoryNamespace(s.cfg.AgentID))
+		if err != nil {
+			return nil, fmt.Errorf("listing memory: %w", err)
+		}
+		res := &mcpsdk.ListResourcesResult{Resources: make([]*mcpsdk.Resource, 0, len(entries))}
+		for _, e := range entries {
+			res.Resources = append(res.Resources, &mcpsdk.Resource{
+				URI:      MemoryURIPrefix + url.PathEscape(e.Key),
+				Name:     e.Key,
+				MIMEType: "text/plain",
+				Size:     int64(len(e.Value)),
+			})
+		}
+		return res, nil
+	}
+}
+
+func toolResult(logger *slog.Logger, r llm.ToolResult) *mcpsdk.CallToolResult {
+	res := &mcpsdk.CallToolResult{IsError: r.IsError}
+	if r.Content != "" || len(r.Images) == 0 {
+		res.Content = append(res.Content, &mcpsdk.TextContent{Text: r.Content})
+	}
+	for _, img := range r.Images {
+		data := img.Data()
+		if data == nil && img.Path != "" {
+			var err error
+			if data, err = os.ReadFile(img.Path); err != nil {
+				logger.Warn("mcp serve: reading tool image", slog.String("err", err.Error()))
+				continue
+			}
+		}
+		res.Content = append(res.Content, &mcpsdk.ImageContent{Data: data, MIMEType: img.MediaType})
+	}
+	return res
+}
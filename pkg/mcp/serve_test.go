@@ -0,0 +1,212 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/igorsilveira/pincer/pkg/agent"
+	"github.com/igorsilveira/pincer/pkg/agent/tools"
+	"github.com/igorsilveira/pincer/pkg/llm"
+	"github.com/igorsilveira/pincer/pkg/memory"
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+	"github.com/igorsilveira/pincer/pkg/store"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type replyProvider struct{ reply string }
+
+func (p *replyProvider) Name() string            { return "fake" }
+func (p *replyProvider) SupportsStreaming() bool { return true }
+func (p *replyProvider) SupportsToolUse() bool   { return false }
+func (p *replyProvider) Models() []llm.ModelInfo { return nil }
+
+func (p *replyProvider) Chat(context.Context, llm.ChatRequest) (<-chan llm.ChatEvent, error) {
+	ch := make(chan llm.ChatEvent, 2)
+	ch <- llm.ChatEvent{Type: llm.EventToken, Token: p.reply}
+	ch <- llm.ChatEvent{Type: llm.EventDone, Usage: &llm.Usage{}}
+	close(ch)
+	return ch, nil
+}
+
+type echoTool struct {
+	name     string
+	approval bool
+}
+
+func (t *echoTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        t.name,
+		Description: "Echo the text",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}}}`),
+	}
+}
+
+func (t *echoTool) Execute(_ context.Context, input json.RawMessage, _ sandbox.Sandbox, _ sandbox.Policy) (string, error) {
+	var in struct{ Text string }
+	if err := json.Unmarshal(input, &in); err != nil {
+		return "", err
+	}
+	return "echo: " + in.Text, nil
+}
+
+func (t *echoTool) RequiresApproval() bool { return t.approval }
+
+func serveTestClient(t *testing.T, elicit func(context.Context, *mcpsdk.ElicitRequest) (*mcpsdk.ElicitResult, error)) (*mcpsdk.ClientSession, *memory.Store) {
+	t.Helper()
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	mem := memory.New(s.DB(), nil)
+
+	registry := tools.NewRegistry()
+	registry.Register(&echoTool{name: "echo"})
+	registry.Register(&echoTool{name: "guarded", approval: true})
+	registry.Register(&echoTool{name: ToolName("other", "echo")})
+	registry.Register(&echoTool{name: "notify"})
+
+	approver := agent.NewApprover(agent.ApprovalAuto, nil)
+	runtime := agent.NewRuntime(agent.RuntimeConfig{
+		Provider: &replyProvider{reply: "hello from agent"},
+		Store:    s,
+		Registry: registry,
+		Approver: approver,
+		Memory:   mem,
+		Model:    "fake-1",
+	})
+	srv := NewServer(ServeConfig{Runtime: runtime, Approver: approver, Memory: mem, AgentID: "default"})
+
+	client := mcpsdk.NewClient(&mcpsdk.Implementation{Name: "editor"}, &mcpsdk.ClientOptions{ElicitationHandler: elicit})
+	cs, err := client.Connect(t.Context(), inMemory(t, srv, nil)(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return cs, mem
+}
+
+func callText(t *testing.T, cs *mcpsdk.ClientSession, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	res, err := cs.CallTool(t.Context(), &mcpsdk.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []string
+	for _, c := range res.Content {
+		if tc, ok := c.(*mcpsdk.TextContent); ok {
+			parts = append(parts, tc.Text)
+		}
+	}
+	return strings.Join(parts, "\n"), res.IsError
+}
+
+func TestServeTools(t *testing.T) {
+	var asked []string
+	cs, _ := serveTestClient(t, func(_ context.Context, req *mcpsdk.ElicitRequest) (*mcpsdk.ElicitResult, error) {
+		asked = append(asked, req.Params.Message)
+		return &mcpsdk.ElicitResult{Action: "accept"}, nil
+	})
+
+	res, err := cs.ListTools(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "chat,echo,guarded" {
+		t.Errorf("tools = %s", got)
+	}
+
+	if text, isErr := callText(t, cs, "echo", map[string]any{"text": "hi"}); isErr || text != "echo: hi" {
+		t.Errorf("echo = %q, error %v", text, isErr)
+	}
+	if text, isErr := callText(t, cs, "guarded", map[string]any{"text": "rm"}); isErr || text != "echo: rm" {
+		t.Errorf("guarded = %q, error %v", text, isErr)
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "guarded") {
+		t.Errorf("elicitations = %q", asked)
+	}
+
+	if text, isErr := callText(t, cs, ChatToolName, map[string]any{"message": "hello"}); isErr || text != "hello from agent" {
+		t.Errorf("chat = %q, error %v", text, isErr)
+	}
+}
+
+func TestServeDeniesApprovalWithoutElicitation(t *testing.T) {
+	cs, _ := serveTestClient(t, nil)
+	text, isErr := callText(t, cs, "guarded", map[string]any{"text": "rm"})
+	if !isErr || !strings.Contains(text, "approvals are not available") {
+		t.Errorf("guarded = %q, error %v", text, isErr)
+	}
+}
+
+func TestServeMemoryResources(t *testing.T) {
+	cs, mem := serveTestClient(t, nil)
+	if err := mem.Set(t.Context(), "default", "notes/city", "Lisbon"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := cs.ListResources(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Resources) != 1 || list.Resources[0].Name != "notes/city" {
+		t.Fatalf("resources = %+v", list.Resources)
+	}
+
+	res, err := cs.ReadResource(t.Context(), &mcpsdk.ReadResourceParams{URI: list.Resources[0].URI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Contents) != 1 || res.Contents[0].Text != "Lisbon" {
+		t.Errorf("contents = %+v", res.Contents)
+	}
+
+	if _, err := cs.ReadResource(t.Context(), &mcpsdk.ReadResourceParams{URI: MemoryURIPrefix + "missing"}); err == nil {
+		t.Error("reading a missing entry should fail")
+	}
+}
+
+func TestServeContinuesClientTrace(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+		tp.Shutdown(context.Background())
+	})
+
+	cs, _ := serveTestClient(t, nil)
+	ctx, span := tp.Tracer("test").Start(t.Context(), "client")
+	_, err := cs.CallTool(ctx, &mcpsdk.CallToolParams{
+		Meta:      traceMeta(ctx),
+		Name:      "echo",
+		Arguments: map[string]any{"text": "hi"},
+	})
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range exp.GetSpans() {
+		if s.Name == "tools/call echo" {
+			if s.Parent.SpanID() != span.SpanContext().SpanID() {
+				t.Errorf("server span parent = %v, want the client span", s.Parent.SpanID())
+			}
+			return
+		}
+	}
+	t.Errorf("no tools/call span in %v", exp.GetSpans())
+}
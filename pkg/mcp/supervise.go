@@ -0,0 +1,204 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/config"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+)
+
+// ErrReconnecting matches Connect errors for servers that stay registered
+// and are retried in the background.
+var ErrReconnecting = errors.New("mcp: server is reconnecting")
+
+// reconnectingError keeps the message of the first connection failure while
+// matching ErrReconnecting.
+type reconnectingError struct{ err error }
+
+func (e reconnectingError) Error() string        { return e.err.Error() }
+func (e reconnectingError) Unwrap() error        { return e.err }
+func (e reconnectingError) Is(target error) bool { return target == ErrReconnecting }
+
+// ServerStatus describes a supervised connection. Since is when the server
+// entered its current state.
+type ServerStatus struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	Since      time.Time `json:"since"`
+	Tools      int       `json:"tools"`
+	Reconnects int       `json:"reconnects"`
+	LastPing   time.Time `json:"last_ping,omitzero"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Status reports every server's connection state, sorted by name.
+func (m *Manager) Status() []ServerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ServerStatus, 0, len(m.servers))
+	for name, conn := range m.servers {
+		s := conn.status
+		s.Name = name
+		s.Tools = len(conn.tools)
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// supervise watches a connection until ctx ends, replacing the session
+// whenever the server exits or stops answering pings. A server that never
+// connected starts out reconnecting.
+func (m *Manager) supervise(ctx context.Context, conn *serverConn) {
+	for {
+		m.mu.Lock()
+		session := conn.session
+		m.mu.Unlock()
+
+		if session != nil {
+			err := m.watch(ctx, conn, session)
+			if ctx.Err() != nil {
+				return
+			}
+			_ = session.Close()
+
+			m.mu.Lock()
+			conn.status.State = StateReconnecting
+			conn.status.Since = time.Now()
+			conn.status.LastError = err.Error()
+			m.mu.Unlock()
+			telemetry.Metrics.MCPServerUp.WithLabelValues(conn.cfg.Name).Set(0)
+			m.logger.Warn("mcp server connection lost",
+				slog.String("server", conn.cfg.Name),
+				slog.String("err", err.Error()),
+			)
+		}
+
+		if !m.reconnect(ctx, conn) {
+			return
+		}
+	}
+}
+
+// watch returns why session died, or nil once ctx ends.
+func (m *Manager) watch(ctx context.Context, conn *serverConn, session *mcpsdk.ClientSession) error {
+	closed := make(chan error, 1)
+	go func() { closed <- session.Wait() }()
+
+	interval := conn.cfg.PingInterval
+	if interval == 0 {
+		interval = config.DefaultMCPPingInterval
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-closed:
+			if err == nil {
+				err = errors.New("connection closed")
+			}
+			return err
+		case <-tick:
+			pctx, cancel := context.WithTimeout(ctx, m.pingTimeout)
+			start := time.Now()
+			err := session.Ping(pctx, nil)
+			cancel()
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+			telemetry.Metrics.MCPPingLatency.WithLabelValues(conn.cfg.Name).Observe(time.Since(start).Seconds())
+			m.mu.Lock()
+			conn.status.LastPing = time.Now()
+			m.mu.Unlock()
+		}
+	}
+}
+
+// reconnect dials the server with exponential backoff until it succeeds or
+// ctx ends, then swaps the new session in and reports any tool changes.
+func (m *Manager) reconnect(ctx context.Context, conn *serverConn) bool {
+	name := conn.cfg.Name
+	delay := m.backoffBase
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		fresh := &serverConn{cfg: conn.cfg}
+		dctx, cancel := context.WithTimeout(ctx, m.connectTimeout)
+		session, err := m.dial(dctx, ctx, conn.cfg)
+		if err == nil {
+			fresh.session = session
+			if err = m.load(dctx, fresh); err != nil {
+				_ = session.Close()
+			}
+		}
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			delay = min(delay*2, m.backoffMax)
+			telemetry.Metrics.MCPReconnects.WithLabelValues(name, "error").Inc()
+			m.mu.Lock()
+			conn.status.LastError = err.Error()
+			m.mu.Unlock()
+			m.logger.Warn("mcp reconnect failed",
+				slog.String("server", name),
+				slog.String("err", err.Error()),
+				slog.Duration("retry_in", delay),
+			)
+			continue
+		}
+
+		m.mu.Lock()
+		if ctx.Err() != nil {
+			m.mu.Unlock()
+			_ = session.Close()
+			return false
+		}
+		old := conn.tools
+		if conn.session != nil {
+			conn.status.Reconnects++
+		}
+		conn.session = session
+		conn.tools, conn.prompts = fresh.tools, fresh.prompts
+		conn.resources, conn.templates = fresh.resources, fresh.templates
+		conn.status.State = StateConnected
+		conn.status.Since = time.Now()
+		conn.status.LastError = ""
+		notify := m.onToolsChanged
+		m.mu.Unlock()
+
+		telemetry.Metrics.MCPReconnects.WithLabelValues(name, "success").Inc()
+		telemetry.Metrics.MCPServerUp.WithLabelValues(name).Set(1)
+		m.logger.Info("mcp server reconnected", slog.String("server", name), slog.Int("tools", len(fresh.tools)))
+		if notify != nil {
+			notify(name, fresh.tools, removedTools(old, fresh.tools))
+		}
+		return true
+	}
+}
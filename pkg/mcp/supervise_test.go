@@ -0,0 +1,239 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/igorsilveira/pincer/pkg/sandbox"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type refusingTransport struct{}
+
+func (refusingTransport) Connect(context.Context) (mcpsdk.Connection, error) {
+	return nil, errors.New("connection refused")
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newTestServer()
+	sessions := make(chan *mcpsdk.ServerSession, 8)
+	var refuse atomic.Bool
+	connect := inMemory(t, srv, sessions)
+
+	mgr := NewManager(nil)
+	mgr.backoffBase, mgr.backoffMax = 5*time.Millisecond, 20*time.Millisecond
+	cfg := ServerConfig{Name: "srv", Transport: func() mcpsdk.Transport {
+		if refuse.Load() {
+			return refusingTransport{}
+		}
+		return connect()
+	}}
+	if _, err := mgr.Connect(t.Context(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.DisconnectAll)
+	changed := make(chan []string, 4)
+	mgr.OnToolsChanged(func(_ string, _ []*mcpsdk.Tool, removed []string) { changed <- removed })
+
+	refuse.Store(true)
+	_ = (<-sessions).Close()
+	waitFor(t, "failed reconnect attempts", func() bool {
+		st := mgr.Status()
+		return len(st) == 1 && st[0].State == StateReconnecting && strings.Contains(st[0].LastError, "refused")
+	})
+	if _, err := mgr.Session("srv"); err == nil || !strings.Contains(err.Error(), "reconnecting") {
+		t.Errorf("Session while down: %v", err)
+	}
+
+	refuse.Store(false)
+	select {
+	case removed := <-changed:
+		if len(removed) != 0 {
+			t.Errorf("removed = %v", removed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reconnect")
+	}
+	st := mgr.Status()[0]
+	if st.State != StateConnected || st.Reconnects != 1 || st.LastError != "" || st.Tools != 1 {
+		t.Errorf("status = %+v", st)
+	}
+
+	tool := mgr.NewTool("srv", &mcpsdk.Tool{Name: "chart"})
+	if out, err := tool.Execute(t.Context(), nil, nil, sandbox.Policy{}); err != nil || !strings.Contains(out, "here is the chart") {
+		t.Errorf("call after reconnect = %q, %v", out, err)
+	}
+}
+
+func TestInitialConnectFailureIsSupervised(t *testing.T) {
+	srv := newTestServer()
+	var refuse atomic.Bool
+	refuse.Store(true)
+	connect := inMemory(t, srv, nil)
+
+	mgr := NewManager(nil)
+	mgr.backoffBase, mgr.backoffMax = 5*time.Millisecond, 20*time.Millisecond
+	changed := make(chan []*mcpsdk.Tool, 4)
+	mgr.OnToolsChanged(func(_ string, tools []*mcpsdk.Tool, _ []string) { changed <- tools })
+	cfg := ServerConfig{Name: "late", Transport: func() mcpsdk.Transport {
+		if refuse.Load() {
+			return refusingTransport{}
+		}
+		return connect()
+	}}
+	if _, err := mgr.Connect(t.Context(), cfg); !errors.Is(err, ErrReconnecting) {
+		t.Fatalf("Connect err = %v, want ErrReconnecting", err)
+	}
+	t.Cleanup(mgr.DisconnectAll)
+
+	if st := mgr.Status(); len(st) != 1 || st[0].State != StateReconnecting || !strings.Contains(st[0].LastError, "refused") {
+		t.Errorf("status while down = %+v", st)
+	}
+	if up := gaugeValue(t, "late"); up != 0 {
+		t.Errorf("mcp_server_up = %v while down", up)
+	}
+
+	refuse.Store(false)
+	select {
+	case tools := <-changed:
+		if len(tools) != 1 {
+			t.Errorf("tools = %d, want 1", len(tools))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server never came up")
+	}
+	if st := mgr.Status()[0]; st.State != StateConnected || st.Reconnects != 0 {
+		t.Errorf("status = %+v", st)
+	}
+	if up := gaugeValue(t, "late"); up != 1 {
+		t.Errorf("mcp_server_up = %v once connected", up)
+	}
+}
+
+func gaugeValue(t *testing.T, server string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := telemetry.Metrics.MCPServerUp.WithLabelValues(server).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestPingFailureReconnects(t *testing.T) {
+	srv := newTestServer()
+	var hang atomic.Bool
+	srv.AddReceivingMiddleware(func(next mcpsdk.MethodHandler) mcpsdk.MethodHandler {
+		return func(ctx context.Context, method string, req mcpsdk.Request) (mcpsdk.Result, error) {
+			if method == "ping" && hang.Load() {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return next(ctx, method, req)
+		}
+	})
+
+	mgr := NewManager(nil)
+	mgr.pingTimeout = 20 * time.Millisecond
+	mgr.backoffBase = 5 * time.Millisecond
+	if _, err := mgr.Connect(t.Context(), ServerConfig{Name: "srv", Transport: inMemory(t, srv, nil), PingInterval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.DisconnectAll)
+
+	waitFor(t, "a successful ping", func() bool { return !mgr.Status()[0].LastPing.IsZero() })
+	hang.Store(true)
+	waitFor(t, "the ping to fail", func() bool { return mgr.Status()[0].State == StateReconnecting })
+	hang.Store(false)
+	waitFor(t, "a reconnect", func() bool { return mgr.Status()[0].Reconnects == 1 })
+}
+
+func TestToolFilters(t *testing.T) {
+	cfg := ServerConfig{AllowTools: []string{"browser_*", "search"}, DenyTools: []string{"browser_install"}}
+	for name, want := range map[string]bool{
+		"browser_click":   true,
+		"search":          true,
+		"browser_install": false,
+		"shell":           false,
+	} {
+		if got := cfg.allows(name); got != want {
+			t.Errorf("allows(%q) = %v", name, got)
+		}
+	}
+	if !(ServerConfig{}).allows("anything") {
+		t.Error("no lists should allow everything")
+	}
+
+	srv := newTestServer()
+	srv.AddTool(&mcpsdk.Tool{Name: "delete_all", InputSchema: map[string]any{"type": "object"}},
+		func(context.Context, *mcpsdk.CallToolRequest) (*mcpsdk.CallToolResult, error) {
+			return &mcpsdk.CallToolResult{}, nil
+		})
+	mgr := NewManager(nil)
+	tools, err := mgr.Connect(t.Context(), ServerConfig{Name: "srv", Transport: inMemory(t, srv, nil), DenyTools: []string{"delete_*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.DisconnectAll)
+	if len(tools) != 1 || tools[0].Name != "chart" {
+		t.Errorf("tools = %v", tools)
+	}
+}
+
+func TestHTTPHeaders(t *testing.T) {
+	srv := newTestServer()
+	handler := mcpsdk.NewStreamableHTTPHandler(func(*http.Request) *mcpsdk.Server { return srv }, nil)
+	var unauthorized atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			unauthorized.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	mgr := NewManager(nil)
+	tools, err := mgr.Connect(t.Context(), ServerConfig{
+		Name:            "remote",
+		URL:             ts.URL,
+		Headers:         map[string]string{"Authorization": "Bearer s3cret"},
+		Timeout:         time.Second,
+		RequireApproval: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mgr.DisconnectAll)
+
+	tool := mgr.NewTool("remote", tools[0])
+	if !tool.RequiresApproval() || tool.Timeout != time.Second {
+		t.Errorf("tool settings: approval=%v timeout=%v", tool.RequiresApproval(), tool.Timeout)
+	}
+	if _, err := tool.Execute(t.Context(), json.RawMessage(`{}`), nil, sandbox.Policy{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := unauthorized.Load(); n != 0 {
+		t.Errorf("%d requests without the header", n)
+	}
+}
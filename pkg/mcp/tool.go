@@ -4,19 +4,34 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"time"
 
 	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/igorsilveira/pincer/pkg/llm"
 	"github.com/igorsilveira/pincer/pkg/sandbox"
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MCPTool struct {
+	// ImageDir is where images returned by the tool are stored. Empty keeps
+	// them in memory, so they are lost from the session history.
+	ImageDir string
+	// Timeout bounds each call. Zero leaves it to the caller's context.
+	Timeout time.Duration
+	// RequireApproval makes every call ask for approval, whatever the
+	// agent's approval mode.
+	RequireApproval bool
+
 	serverName string
 	toolName   string
 	desc       string
 	schema     json.RawMessage
 	session    func() (*mcpsdk.ClientSession, error)
+
+	images imageQueue
 }
 
 func NewMCPTool(serverName string, tool *mcpsdk.Tool, sessionFn func() (*mcpsdk.ClientSession, error)) *MCPTool {
@@ -57,28 +72,56 @@ func (t *MCPTool) Execute(ctx context.Context, input json.RawMessage, _ sandbox.
 		return "", fmt.Errorf("mcp tool %s: %w", t.toolName, err)
 	}
 
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	ctx, span := telemetry.Tracer().Start(ctx, "tools/call "+t.toolName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.McpMethodNameToolsCall,
+			semconv.GenAIToolName(t.toolName),
+			attribute.String("mcp.server", t.serverName),
+		),
+	)
 	result, err := sess.CallTool(ctx, &mcpsdk.CallToolParams{
+		Meta:      traceMeta(ctx),
 		Name:      t.toolName,
 		Arguments: args,
 	})
+	if err == nil && result.IsError {
+		span.SetAttributes(semconv.ErrorTypeKey.String("tool_error"))
+	}
+	telemetry.EndSpan(span, err)
 	if err != nil {
 		return "", fmt.Errorf("mcp tool %s: call failed: %w", t.toolName, err)
 	}
 
-	var parts []string
+	conv := &converter{imageDir: t.ImageDir}
 	for _, c := range result.Content {
-		if tc, ok := c.(*mcpsdk.TextContent); ok {
-			parts = append(parts, tc.Text)
+		if err := conv.add(c); err != nil {
+			return "", fmt.Errorf("mcp tool %s: %w", t.toolName, err)
 		}
 	}
+	conv.addStructured(result.StructuredContent)
 
-	text := strings.Join(parts, "\n")
+	text := conv.text()
 	if result.IsError {
 		return "", fmt.Errorf("mcp tool %s: %s", t.toolName, text)
 	}
+	t.images.add(ctx, conv.images)
 	return text, nil
 }
 
+func (t *MCPTool) RequiresApproval() bool { return t.RequireApproval }
+
+// ConsumeImages returns the images of the tool call in ctx so the agent can
+// attach them to the call's result.
+func (t *MCPTool) ConsumeImages(ctx context.Context) []llm.ImageContent {
+	return t.images.consume(ctx)
+}
+
 func ToolName(serverName, toolName string) string {
 	return fmt.Sprintf("mcp_%s__%s", serverName, toolName)
 }
@@ -0,0 +1,44 @@
+package mcp
+
+import (
+	"context"
+
+	"github.com/igorsilveira/pincer/pkg/telemetry"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceMeta carries ctx's trace context to the server in a request's _meta.
+func traceMeta(ctx context.Context) mcpsdk.Meta {
+	m := telemetry.InjectMap(ctx)
+	if m == nil {
+		return nil
+	}
+	meta := make(mcpsdk.Meta, len(m))
+	for k, v := range m {
+		meta[k] = v
+	}
+	return meta
+}
+
+// startServerSpan starts the span of a tool call received from a client,
+// continuing the trace the client sent in _meta, if any.
+func startServerSpan(ctx context.Context, req *mcpsdk.CallToolRequest) (context.Context, trace.Span) {
+	carrier := make(map[string]string)
+	for k, v := range req.Params.Meta {
+		if s, ok := v.(string); ok {
+			carrier[k] = s
+		}
+	}
+	ctx = telemetry.ExtractMap(ctx, carrier)
+	ctx, span := telemetry.Tracer().Start(ctx, "tools/call "+req.Params.Name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.McpMethodNameToolsCall,
+			semconv.GenAIToolName(req.Params.Name),
+			semconv.McpSessionID(req.Session.ID()),
+		),
+	)
+	return telemetry.WithTraceID(ctx), span
+}
@@ -9,10 +9,16 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/igorsilveira/pincer/pkg/redact"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrImmutable = errors.New("immutable")
+)
+
 type Entry struct {
 	ID        string    `gorm:"primaryKey;column:id"`
 	AgentID   string    `gorm:"column:agent_id;not null;uniqueIndex:idx_memory_agent_key"`
@@ -29,6 +35,7 @@ func (Entry) TableName() string {
 type Store struct {
 	db            *gorm.DB
 	immutableKeys map[string]bool
+	redactor      *redact.Redactor
 }
 
 func New(db *gorm.DB, immutableKeys []string) *Store {
@@ -39,6 +46,11 @@ func New(db *gorm.DB, immutableKeys []string) *Store {
 	return &Store{db: db, immutableKeys: ik}
 }
 
+// SetRedactor masks personal data in values before they are stored.
+func (s *Store) SetRedactor(r *redact.Redactor) {
+	s.redactor = r
+}
+
 func (s *Store) Get(ctx context.Context, agentID, key string) (*Entry, error) {
 	e := &Entry{}
 	err := s.db.WithContext(ctx).
@@ -46,7 +58,7 @@ func (s *Store) Get(ctx context.Context, agentID, key string) (*Entry, error) {
 		First(e).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("memory: %q not found for agent %q", key, agentID)
+			return nil, fmt.Errorf("memory: %q %w for agent %q", key, ErrNotFound, agentID)
 		}
 		return nil, err
 	}
@@ -54,12 +66,13 @@ func (s *Store) Get(ctx context.Context, agentID, key string) (*Entry, error) {
 }
 
 func (s *Store) Set(ctx context.Context, agentID, key, value string) error {
+	value, _ = s.redactor.String(value)
 	hash := contentHash(value)
 
 	if s.immutableKeys[key] {
 		existing, err := s.Get(ctx, agentID, key)
 		if err == nil && existing != nil {
-			return fmt.Errorf("memory: key %q is immutable and already set", key)
+			return fmt.Errorf("memory: key %q is %w and already set", key, ErrImmutable)
 		}
 	}
 
@@ -80,7 +93,7 @@ func (s *Store) Set(ctx context.Context, agentID, key, value string) error {
 
 func (s *Store) Delete(ctx context.Context, agentID, key string) error {
 	if s.immutableKeys[key] {
-		return fmt.Errorf("memory: key %q is immutable and cannot be deleted", key)
+		return fmt.Errorf("memory: key %q is %w and cannot be deleted", key, ErrImmutable)
 	}
 
 	result := s.db.WithContext(ctx).
@@ -90,7 +103,7 @@ func (s *Store) Delete(ctx context.Context, agentID, key string) error {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("memory: %q not found for agent %q", key, agentID)
+		return fmt.Errorf("memory: %q %w for agent %q", key, ErrNotFound, agentID)
 	}
 	return nil
 }
@@ -104,12 +117,15 @@ func (s *Store) List(ctx context.Context, agentID string) ([]Entry, error) {
 	return entries, err
 }
 
+// Search matches query case-insensitively against keys and values. LOWER and
+// an explicit ESCAPE keep the behaviour the same on SQLite, where LIKE ignores
+// case, and Postgres, where it does not.
 func (s *Store) Search(ctx context.Context, agentID, query string) ([]Entry, error) {
-	escaped := strings.NewReplacer("%", "\\%", "_", "\\_").Replace(query)
+	escaped := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(strings.ToLower(query))
 	pattern := "%" + escaped + "%"
 	var entries []Entry
 	err := s.db.WithContext(ctx).
-		Where("agent_id = ? AND (key LIKE ? ESCAPE '\\' OR value LIKE ? ESCAPE '\\')", agentID, pattern, pattern).
+		Where("agent_id = ? AND (LOWER(key) LIKE ? ESCAPE '\\' OR LOWER(value) LIKE ? ESCAPE '\\')", agentID, pattern, pattern).
 		Order("updated_at DESC").
 		Find(&entries).Error
 	return entries, err
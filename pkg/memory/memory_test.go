@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/igorsilveira/pincer/pkg/redact"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -55,6 +56,26 @@ func TestSetAndGet(t *testing.T) {
 	}
 }
 
+func TestSetRedactsValue(t *testing.T) {
+	s := New(testDB(t), nil)
+	r, err := redact.New([]string{"email"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRedactor(r)
+	ctx := context.Background()
+
+	mustSet(t, s, ctx, "agent-1", "contact", "bob@example.com")
+
+	e, err := s.Get(ctx, "agent-1", "contact")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if strings.Contains(e.Value, "bob@example.com") {
+		t.Errorf("Value = %q, want the email redacted", e.Value)
+	}
+}
+
 func TestImmutableKey(t *testing.T) {
 	s := New(testDB(t), []string{"identity"})
 	ctx := context.Background()
@@ -279,3 +300,22 @@ func TestSetPreservesHash(t *testing.T) {
 		t.Error("hash should differ for different value")
 	}
 }
+
+func TestSearchCaseAndWildcards(t *testing.T) {
+	s := New(testDB(t), nil)
+	ctx := context.Background()
+
+	mustSet(t, s, ctx, "agent-1", "Greeting", "Hello World")
+	mustSet(t, s, ctx, "agent-1", "discount", "50% off")
+	mustSet(t, s, ctx, "agent-1", "path", `C:\temp`)
+
+	for query, want := range map[string]int{"WORLD": 1, "greet": 1, "%": 1, "_": 0, `\t`: 1} {
+		results, err := s.Search(ctx, "agent-1", query)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+		if len(results) != want {
+			t.Errorf("Search(%q) = %d results, want %d", query, len(results), want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package redact masks personal data and secrets in text before it is
+// persisted.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	RuleEmail  = "email"
+	RulePhone  = "phone"
+	RuleAPIKey = "api_key"
+)
+
+var builtinRules = map[string]string{
+	RuleEmail: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	// Dots are not accepted as separators so that IP addresses and version
+	// numbers are left alone.
+	RulePhone: `(?:\+\d{1,3}[ -]?)?(?:\(\d{1,4}\)[ -]?|\b\d{2,4}[ -])\d{3,4}[ -]?\d{3,4}\b`,
+	RuleAPIKey: `\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|sk_live_[A-Za-z0-9]{24,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|` +
+		`glpat-[A-Za-z0-9_-]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})\b`,
+}
+
+// BuiltinRules lists the names of the rules that ship with Pincer.
+func BuiltinRules() []string {
+	return []string{RuleEmail, RulePhone, RuleAPIKey}
+}
+
+// Pattern is a custom rule. Matches are replaced with [REDACTED:Name].
+type Pattern struct {
+	Name  string
+	Regex string
+}
+
+type rule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Redactor applies an ordered set of rules. A nil Redactor is valid and
+// leaves everything unchanged.
+type Redactor struct {
+	rules []rule
+}
+
+// New compiles the named builtin rules followed by the custom patterns.
+func New(builtins []string, patterns []Pattern) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range builtins {
+		expr, ok := builtinRules[name]
+		if !ok {
+			return nil, fmt.Errorf("redact: unknown builtin rule %q", name)
+		}
+		r.rules = append(r.rules, rule{name: name, re: regexp.MustCompile(expr)})
+	}
+	for _, p := range patterns {
+		if p.Name == "" {
+			return nil, fmt.Errorf("redact: pattern %q needs a name", p.Regex)
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redact: pattern %q: %w", p.Name, err)
+		}
+		r.rules = append(r.rules, rule{name: p.Name, re: re})
+	}
+	return r, nil
+}
+
+// Counts maps a rule name to the number of spans it redacted.
+type Counts map[string]int
+
+func (c Counts) add(other Counts) {
+	for k, v := range other {
+		c[k] += v
+	}
+}
+
+// Total is the number of redacted spans across all rules.
+func (c Counts) Total() int {
+	n := 0
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// String renders the counts as "email=1 phone=2", sorted by rule name.
+func (c Counts) String() string {
+	names := make([]string, 0, len(c))
+	for k := range c {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, c[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// String redacts s.
+func (r *Redactor) String(s string) (string, Counts) {
+	counts := Counts{}
+	if r == nil {
+		return s, counts
+	}
+	for _, rl := range r.rules {
+		n := 0
+		s = rl.re.ReplaceAllStringFunc(s, func(string) string {
+			n++
+			return "[REDACTED:" + rl.name + "]"
+		})
+		if n > 0 {
+			counts[rl.name] += n
+		}
+	}
+	return s, counts
+}
+
+// JSON redacts the string values inside a JSON document, leaving keys and
+// structure intact. Input that is not valid JSON is redacted as plain text.
+func (r *Redactor) JSON(s string) (string, Counts) {
+	if r == nil {
+		return s, Counts{}
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return r.String(s)
+	}
+
+	counts := Counts{}
+	v = r.walk(v, counts)
+	if counts.Total() == 0 {
+		return s, counts
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return r.String(s)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), counts
+}
+
+func (r *Redactor) walk(v any, counts Counts) any {
+	switch t := v.(type) {
+	case string:
+		out, c := r.String(t)
+		counts.add(c)
+		return out
+	case []any:
+		for i := range t {
+			t[i] = r.walk(t[i], counts)
+		}
+	case map[string]any:
+		for k := range t {
+			t[k] = r.walk(t[k], counts)
+		}
+	}
+	return v
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -63,6 +64,12 @@ func (s *ContainerSandbox) Exec(ctx context.Context, cmd Command, policy Policy)
 
 	proc := exec.CommandContext(ctx, s.runtime, args...)
 
+	// Values reach the container through the runtime's environment so that
+	// they do not appear in its command line.
+	if len(cmd.Env) > 0 {
+		proc.Env = append(os.Environ(), cmd.Env...)
+	}
+
 	if cmd.Stdin != "" {
 		proc.Stdin = strings.NewReader(cmd.Stdin)
 	}
@@ -131,7 +138,8 @@ func (s *ContainerSandbox) buildRunArgs(cmd Command, policy Policy) []string {
 	}
 
 	for _, e := range cmd.Env {
-		args = append(args, "-e", e)
+		name, _, _ := strings.Cut(e, "=")
+		args = append(args, "-e", name)
 	}
 
 	args = append(args, s.image)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -49,7 +50,7 @@ func (s *ProcessSandbox) Exec(ctx context.Context, cmd Command, policy Policy) (
 	}
 
 	if len(cmd.Env) > 0 {
-		proc.Env = cmd.Env
+		proc.Env = append(os.Environ(), cmd.Env...)
 	}
 
 	if cmd.Stdin != "" {
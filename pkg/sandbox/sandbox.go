@@ -37,7 +37,8 @@ type Command struct {
 	Args    []string
 	Stdin   string
 	WorkDir string
-	Env     []string
+	// Env holds KEY=VALUE pairs added to the command's environment.
+	Env []string
 }
 
 type Result struct {
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// Pincer than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of pincer")
+
+// Migration is one step of the schema history. Up and Down run inside a
+// transaction. Migrations must not reference the live model structs, which
+// change over time; each step declares the tables as they were when it was
+// written.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// MigrationState pairs a migration with the time it was applied, if it was.
+type MigrationState struct {
+	Migration
+	AppliedAt time.Time
+}
+
+func (m MigrationState) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+type schemaVersion struct {
+	Version   int       `gorm:"primaryKey;column:version;autoIncrement:false"`
+	Name      string    `gorm:"column:name;not null"`
+	AppliedAt time.Time `gorm:"column:applied_at;not null"`
+}
+
+func (schemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// Migrations returns the embedded migration sequence in version order.
+func Migrations() []Migration {
+	return migrations
+}
+
+// LatestSchemaVersion is the version a fully migrated database is at.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion reports the highest applied migration, or 0 for a database
+// that has never been migrated.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersionOf(s.db.WithContext(ctx))
+}
+
+// migrationLockKey is the Postgres advisory lock key that serializes
+// migrations across processes sharing one database.
+const migrationLockKey = 0x70696e636572 // "pincer"
+
+// lockMigrations holds a Postgres advisory lock on a dedicated connection
+// until the returned func is called, so that instances starting together
+// migrate one at a time. SQLite already serializes writers and needs no lock.
+func (s *Store) lockMigrations(ctx context.Context) (func(), error) {
+	if s.driver != DriverPostgres {
+		return func() {}, nil
+	}
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		conn.Close()
+	}, nil
+}
+
+func schemaVersionOf(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&schemaVersion{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&schemaVersion{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// CheckSchema fails with ErrSchemaTooNew when the database is ahead of the
+// migrations compiled into this binary.
+func (s *Store) CheckSchema(ctx context.Context) error {
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("%w (database at %d, pincer supports %d)", ErrSchemaTooNew, version, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// MigrationStatus lists every known migration with its applied time.
+func (s *Store) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	applied := make(map[int]time.Time)
+	db := s.db.WithContext(ctx)
+	if db.Migrator().HasTable(&schemaVersion{}) {
+		var rows []schemaVersion
+		if err := db.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			applied[r.Version] = r.AppliedAt
+		}
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		states = append(states, MigrationState{Migration: m, AppliedAt: applied[m.Version]})
+	}
+	return states, nil
+}
+
+// Migrate applies pending migrations up to and including target. A target of
+// 0 or less means the latest version. It returns the migrations it applied.
+func (s *Store) Migrate(ctx context.Context, target int) ([]Migration, error) {
+	if target <= 0 {
+		target = LatestSchemaVersion()
+	}
+	unlock, err := s.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := s.CheckSchema(ctx); err != nil {
+		return nil, err
+	}
+
+	db := s.db.WithContext(ctx)
+	if err := db.Migrator().AutoMigrate(&schemaVersion{}); err != nil {
+		return nil, fmt.Errorf("creating schema_version table: %w", err)
+	}
+	current, err := schemaVersionOf(db)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		skipped := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Another process may have applied this step since current was
+			// read; treat a recorded version as done rather than re-running it.
+			var recorded int64
+			if err := tx.Model(&schemaVersion{}).Where("version = ?", m.Version).Count(&recorded).Error; err != nil {
+				return err
+			}
+			if recorded > 0 {
+				skipped = true
+				return nil
+			}
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaVersion{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if !skipped {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// Rollback reverts applied migrations, newest first, until the schema is at
+// target. It returns the migrations it reverted.
+func (s *Store) Rollback(ctx context.Context, target int) ([]Migration, error) {
+	if target < 0 {
+		return nil, fmt.Errorf("invalid rollback target %d", target)
+	}
+	unlock, err := s.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := s.CheckSchema(ctx); err != nil {
+		return nil, err
+	}
+
+	db := s.db.WithContext(ctx)
+	current, err := schemaVersionOf(db)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	var reverted []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaVersion{}, m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("rolling back migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestOpenMigratesToLatest(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatalf("SchemaVersion: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("version = %d, want %d", version, LatestSchemaVersion())
+	}
+
+	states, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, st := range states {
+		if !st.Applied() {
+			t.Errorf("migration %d not applied", st.Version)
+		}
+	}
+}
+
+func TestRollbackAndMigrate(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	m := s.DB().Migrator()
+
+	reverted, err := s.Rollback(ctx, 1)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if len(reverted) != LatestSchemaVersion()-1 {
+		t.Errorf("reverted %d migrations", len(reverted))
+	}
+	if m.HasIndex("audit_log", "idx_audit_session") {
+		t.Error("idx_audit_session still present after rollback to 1")
+	}
+
+	if _, err := s.Rollback(ctx, 0); err != nil {
+		t.Fatalf("Rollback to 0: %v", err)
+	}
+	if m.HasTable("sessions") {
+		t.Error("sessions table still present after rollback to 0")
+	}
+	if v, _ := s.SchemaVersion(ctx); v != 0 {
+		t.Errorf("version after full rollback = %d", v)
+	}
+
+	applied, err := s.Migrate(ctx, 0)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(applied) != LatestSchemaVersion() {
+		t.Errorf("applied %d migrations", len(applied))
+	}
+	if !m.HasTable("sessions") || !m.HasIndex("audit_log", "idx_audit_session") {
+		t.Error("schema not restored by Migrate")
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "newer.db")
+	s, err := New(dsn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	future := schemaVersion{Version: LatestSchemaVersion() + 1, Name: "from_the_future", AppliedAt: time.Now().UTC()}
+	if err := s.DB().Create(&future).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := New(dsn); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("New on newer schema = %v, want ErrSchemaTooNew", err)
+	}
+
+	inspect, err := Open(Options{DSN: dsn, SkipMigrations: true})
+	if err != nil {
+		t.Fatalf("Open with SkipMigrations: %v", err)
+	}
+	defer inspect.Close()
+	if err := inspect.CheckSchema(context.Background()); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("CheckSchema = %v", err)
+	}
+}
+
+func TestOpenAdoptsUnversionedDatabase(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.AutoMigrate(&Session{}, &Message{}, &Memory{}, &Credential{}, &Checkpoint{}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if err := legacy.Create(&Session{ID: "old", AgentID: "a", Channel: "c", PeerID: "p", CreatedAt: now, UpdatedAt: now}).Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := legacy.DB()
+	sqlDB.Close()
+
+	s, err := New(dsn)
+	if err != nil {
+		t.Fatalf("New on unversioned database: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.GetSession(context.Background(), "old"); err != nil {
+		t.Errorf("existing session lost: %v", err)
+	}
+	if !s.DB().Migrator().HasTable("audit_log") {
+		t.Error("missing audit_log table not created")
+	}
+}
+
+// TestPostgresConcurrentMigrate starts several stores against one fresh
+// schema at once; the advisory lock must let exactly one apply each step.
+func TestPostgresConcurrentMigrate(t *testing.T) {
+	dsn := os.Getenv("PINCER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("PINCER_TEST_POSTGRES_DSN not set")
+	}
+	ctx := context.Background()
+	admin, err := Open(Options{Driver: DriverPostgres, DSN: dsn})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	if _, err := admin.Rollback(ctx, 0); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	const n = 4
+	stores := make([]*Store, n)
+	for i := range stores {
+		s, err := Open(Options{Driver: DriverPostgres, DSN: dsn, SkipMigrations: true})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		stores[i] = s
+	}
+
+	var wg sync.WaitGroup
+	applied := make([]int, n)
+	errs := make([]error, n)
+	for i, s := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ms, err := s.Migrate(ctx, 0)
+			applied[i], errs[i] = len(ms), err
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range stores {
+		if errs[i] != nil {
+			t.Errorf("store %d: Migrate: %v", i, errs[i])
+		}
+		total += applied[i]
+	}
+	if total != LatestSchemaVersion() {
+		t.Errorf("applied %d migrations in total, want %d", total, LatestSchemaVersion())
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations is the schema history. Append new steps; never edit or reorder
+// released ones.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up:      upInitialSchema,
+		Down:    downInitialSchema,
+	},
+	{
+		Version: 2,
+		Name:    "audit_log_session_index",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_audit_session ON audit_log (session_id)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS idx_audit_session").Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "credential_scopes_and_kdf",
+		Up:      upCredentialScopesAndKDF,
+		Down:    downCredentialScopesAndKDF,
+	},
+}
+
+// Tables as of version 1. Databases created before versioned migrations
+// already have them, so only missing tables are created.
+
+type v1Session struct {
+	ID        string    `gorm:"primaryKey;column:id"`
+	AgentID   string    `gorm:"column:agent_id;not null"`
+	Channel   string    `gorm:"column:channel;not null"`
+	PeerID    string    `gorm:"column:peer_id;not null"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+	UpdatedAt time.Time `gorm:"column:updated_at;not null"`
+}
+
+func (v1Session) TableName() string { return "sessions" }
+
+type v1Message struct {
+	ID          string    `gorm:"primaryKey;column:id"`
+	SessionID   string    `gorm:"column:session_id;not null;index:idx_messages_session"`
+	Role        string    `gorm:"column:role;not null"`
+	ContentType string    `gorm:"column:content_type;not null;default:text"`
+	Content     string    `gorm:"column:content;not null"`
+	TokenCount  int       `gorm:"column:token_count;not null;default:0"`
+	CreatedAt   time.Time `gorm:"column:created_at;not null;index:idx_messages_session"`
+}
+
+func (v1Message) TableName() string { return "messages" }
+
+type v1Memory struct {
+	ID        string    `gorm:"primaryKey;column:id"`
+	AgentID   string    `gorm:"column:agent_id;not null;uniqueIndex:idx_memory_agent_key"`
+	Key       string    `gorm:"column:key;not null;uniqueIndex:idx_memory_agent_key"`
+	Value     string    `gorm:"column:value;not null"`
+	Hash      string    `gorm:"column:hash;not null"`
+	UpdatedAt time.Time `gorm:"column:updated_at;not null"`
+}
+
+func (v1Memory) TableName() string { return "memory" }
+
+type v1Credential struct {
+	ID             string    `gorm:"primaryKey;column:id"`
+	Name           string    `gorm:"column:name;not null;uniqueIndex"`
+	EncryptedValue []byte    `gorm:"column:encrypted_value;not null"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null"`
+}
+
+func (v1Credential) TableName() string { return "credentials" }
+
+type v1Checkpoint struct {
+	ID             string    `gorm:"primaryKey;column:id"`
+	SessionID      string    `gorm:"column:session_id;not null;uniqueIndex:idx_checkpoint_session_step"`
+	StepIndex      int       `gorm:"column:step_index;not null;uniqueIndex:idx_checkpoint_session_step"`
+	StateSnapshot  string    `gorm:"column:state_snapshot;not null"`
+	ToolOutputs    string    `gorm:"column:tool_outputs;not null"`
+	ContextSummary string    `gorm:"column:context_summary;not null"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null"`
+}
+
+func (v1Checkpoint) TableName() string { return "checkpoints" }
+
+type v1AuditEntry struct {
+	ID        string    `gorm:"primaryKey;column:id"`
+	Timestamp time.Time `gorm:"column:timestamp;not null;index:idx_audit_timestamp"`
+	EventType string    `gorm:"column:event_type;not null"`
+	SessionID string    `gorm:"column:session_id;not null;default:''"`
+	AgentID   string    `gorm:"column:agent_id;not null;default:''"`
+	Actor     string    `gorm:"column:actor;not null;default:''"`
+	Detail    string    `gorm:"column:detail;not null;default:''"`
+}
+
+func (v1AuditEntry) TableName() string { return "audit_log" }
+
+func v1Tables() []any {
+	return []any{&v1Session{}, &v1Message{}, &v1Memory{}, &v1Credential{}, &v1Checkpoint{}, &v1AuditEntry{}}
+}
+
+func upInitialSchema(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, table := range v1Tables() {
+		if m.HasTable(table) {
+			continue
+		}
+		if err := m.CreateTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downInitialSchema(tx *gorm.DB) error {
+	tables := v1Tables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(tables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tables as of version 3.
+
+type v3Credential struct {
+	ID             string    `gorm:"primaryKey;column:id"`
+	Name           string    `gorm:"column:name;not null;uniqueIndex"`
+	EncryptedValue []byte    `gorm:"column:encrypted_value;not null"`
+	Scopes         string    `gorm:"column:scopes;not null;default:''"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null"`
+}
+
+func (v3Credential) TableName() string { return "credentials" }
+
+type v3CredentialKDF struct {
+	ID        int       `gorm:"primaryKey;column:id;autoIncrement:false"`
+	Salt      []byte    `gorm:"column:salt;not null"`
+	Verifier  []byte    `gorm:"column:verifier;not null"`
+	RotatedAt time.Time `gorm:"column:rotated_at;not null"`
+}
+
+func (v3CredentialKDF) TableName() string { return "credential_kdf" }
+
+func upCredentialScopesAndKDF(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasColumn(&v3Credential{}, "Scopes") {
+		if err := m.AddColumn(&v3Credential{}, "Scopes"); err != nil {
+			return err
+		}
+	}
+	if m.HasTable(&v3CredentialKDF{}) {
+		return nil
+	}
+	return m.CreateTable(&v3CredentialKDF{})
+}
+
+func downCredentialScopesAndKDF(tx *gorm.DB) error {
+	// Credentials encrypted with a stored salt are unreadable without it.
+	var salts int64
+	if err := tx.Model(&v3CredentialKDF{}).Count(&salts).Error; err != nil {
+		return err
+	}
+	var creds int64
+	if err := tx.Model(&v3Credential{}).Count(&creds).Error; err != nil {
+		return err
+	}
+	if salts > 0 && creds > 0 {
+		return fmt.Errorf("credentials are encrypted with a stored salt; delete them before rolling back")
+	}
+	if err := tx.Migrator().DropTable(&v3CredentialKDF{}); err != nil {
+		return err
+	}
+	return tx.Migrator().DropColumn(&v3Credential{}, "Scopes")
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RetentionWindow is how long conversation data is kept. A zero duration
+// keeps it forever.
+type RetentionWindow struct {
+	// Messages covers text and media messages.
+	Messages time.Duration
+	// ToolResults covers tool calls and their results.
+	ToolResults time.Duration
+}
+
+// RetentionPolicy describes what ApplyRetention deletes. Channels override
+// Default for sessions on that channel. Files maps directories of stored
+// attachments and images to how long files in them are kept, judged by
+// modification time.
+type RetentionPolicy struct {
+	Default  RetentionWindow
+	Channels map[string]RetentionWindow
+	Memory   time.Duration
+	Audit    time.Duration
+	Files    map[string]time.Duration
+}
+
+// RetentionResult counts the rows removed by ApplyRetention.
+type RetentionResult struct {
+	Messages    int64
+	ToolResults int64
+	Sessions    int64
+	Memory      int64
+	Audit       int64
+	Files       int64
+}
+
+var (
+	messageContentTypes = []string{ContentTypeText, ContentTypeMedia}
+	toolContentTypes    = []string{ContentTypeToolCalls, ContentTypeToolResults}
+)
+
+// ApplyRetention deletes data older than the policy allows, relative to now.
+// Sessions left without messages are removed along with their checkpoints.
+func (s *Store) ApplyRetention(ctx context.Context, p RetentionPolicy, now time.Time) (RetentionResult, error) {
+	var res RetentionResult
+	db := s.db.WithContext(ctx)
+
+	overridden := make([]string, 0, len(p.Channels))
+	for channel, w := range p.Channels {
+		overridden = append(overridden, channel)
+		if err := purgeWindow(db, w, now, []string{channel}, nil, &res); err != nil {
+			return res, err
+		}
+	}
+	if err := purgeWindow(db, p.Default, now, nil, overridden, &res); err != nil {
+		return res, err
+	}
+
+	if p.Memory > 0 {
+		result := db.Where("updated_at < ?", now.Add(-p.Memory)).Delete(&Memory{})
+		if result.Error != nil {
+			return res, result.Error
+		}
+		res.Memory = result.RowsAffected
+	}
+	if p.Audit > 0 {
+		result := db.Exec("DELETE FROM audit_log WHERE timestamp < ?", now.Add(-p.Audit))
+		if result.Error != nil {
+			return res, result.Error
+		}
+		res.Audit = result.RowsAffected
+	}
+	for dir, keep := range p.Files {
+		n, err := purgeFiles(dir, now.Add(-keep))
+		res.Files += n
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// purgeFiles removes files under dir last modified before cutoff, then the
+// subdirectories left empty.
+func purgeFiles(dir string, before time.Time) (int64, error) {
+	var removed int64
+	var dirs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(before) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	// Deepest first; directories that still hold files fail to go.
+	for _, d := range slices.Backward(dirs) {
+		_ = os.Remove(d)
+	}
+	return removed, err
+}
+
+func purgeWindow(db *gorm.DB, w RetentionWindow, now time.Time, channels, exclude []string, res *RetentionResult) error {
+	n, err := purgeMessages(db, messageContentTypes, w.Messages, now, channels, exclude)
+	if err != nil {
+		return err
+	}
+	res.Messages += n
+
+	n, err = purgeMessages(db, toolContentTypes, w.ToolResults, now, channels, exclude)
+	if err != nil {
+		return err
+	}
+	res.ToolResults += n
+
+	// A session can only be empty for good when every kind of message
+	// expires.
+	if w.Messages <= 0 || w.ToolResults <= 0 {
+		return nil
+	}
+	n, err = purgeEmptySessions(db, now.Add(-max(w.Messages, w.ToolResults)), channels, exclude)
+	if err != nil {
+		return err
+	}
+	res.Sessions += n
+	return nil
+}
+
+func sessionsOn(db *gorm.DB, channels, exclude []string) *gorm.DB {
+	q := db.Model(&Session{}).Select("id")
+	if len(channels) > 0 {
+		q = q.Where("channel IN ?", channels)
+	}
+	if len(exclude) > 0 {
+		q = q.Where("channel NOT IN ?", exclude)
+	}
+	return q
+}
+
+func purgeMessages(db *gorm.DB, contentTypes []string, keep time.Duration, now time.Time, channels, exclude []string) (int64, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+	q := db.Where("content_type IN ? AND created_at < ?", contentTypes, now.Add(-keep))
+	if len(channels) > 0 || len(exclude) > 0 {
+		q = q.Where("session_id IN (?)", sessionsOn(db, channels, exclude))
+	}
+	result := q.Delete(&Message{})
+	return result.RowsAffected, result.Error
+}
+
+func purgeEmptySessions(db *gorm.DB, before time.Time, channels, exclude []string) (int64, error) {
+	var ids []string
+	err := sessionsOn(db, channels, exclude).
+		Where("updated_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM messages WHERE messages.session_id = sessions.id)").
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	var deleted int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id IN ?", ids).Delete(&Checkpoint{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id IN ?", ids).Delete(&Session{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	old := now.Add(-10 * day)
+	recent := now.Add(-2 * day)
+
+	for _, sess := range []Session{
+		{ID: "web", Channel: "webchat", CreatedAt: old, UpdatedAt: old},
+		{ID: "tg", Channel: "telegram", CreatedAt: old, UpdatedAt: old},
+		{ID: "tg-live", Channel: "telegram", CreatedAt: old, UpdatedAt: recent},
+	} {
+		sess.AgentID, sess.PeerID = "default", "p"
+		if err := s.CreateSession(ctx, &sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := []Message{
+		{ID: "web-old-text", SessionID: "web", ContentType: ContentTypeText, CreatedAt: old},
+		{ID: "web-old-tool", SessionID: "web", ContentType: ContentTypeToolResults, CreatedAt: old},
+		{ID: "web-new-text", SessionID: "web", ContentType: ContentTypeText, CreatedAt: recent},
+		{ID: "tg-old-text", SessionID: "tg", ContentType: ContentTypeText, CreatedAt: old},
+		{ID: "tg-old-tool", SessionID: "tg", ContentType: ContentTypeToolCalls, CreatedAt: old},
+		{ID: "tg-live-new", SessionID: "tg-live", ContentType: ContentTypeText, CreatedAt: recent},
+	}
+	for i := range msgs {
+		msgs[i].Role = "user"
+		if err := s.AppendMessage(ctx, &msgs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SaveCheckpoint(ctx, &Checkpoint{ID: "cp", SessionID: "tg", CreatedAt: old}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB().Create(&Memory{ID: "m1", AgentID: "default", Key: "stale", UpdatedAt: old}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB().Create(&Memory{ID: "m2", AgentID: "default", Key: "fresh", UpdatedAt: recent}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB().Exec("INSERT INTO audit_log (id, timestamp, event_type) VALUES ('a1', ?, 'x'), ('a2', ?, 'x')", old, recent).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.ApplyRetention(ctx, RetentionPolicy{
+		// Default keeps text for 30 days and tool output for 5.
+		Default: RetentionWindow{Messages: 30 * day, ToolResults: 5 * day},
+		Channels: map[string]RetentionWindow{
+			"telegram": {Messages: 7 * day, ToolResults: 7 * day},
+		},
+		Memory: 7 * day,
+		Audit:  7 * day,
+	}, now)
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+
+	want := RetentionResult{Messages: 1, ToolResults: 2, Sessions: 1, Memory: 1, Audit: 1}
+	if res != want {
+		t.Errorf("result = %+v, want %+v", res, want)
+	}
+
+	var ids []string
+	s.DB().Model(&Message{}).Order("id").Pluck("id", &ids)
+	wantIDs := []string{"tg-live-new", "web-new-text", "web-old-text"}
+	if len(ids) != len(wantIDs) {
+		t.Fatalf("remaining messages = %v, want %v", ids, wantIDs)
+	}
+	for i := range ids {
+		if ids[i] != wantIDs[i] {
+			t.Errorf("remaining messages = %v, want %v", ids, wantIDs)
+			break
+		}
+	}
+
+	if _, err := s.GetSession(ctx, "tg"); err == nil {
+		t.Error("expired empty session was not deleted")
+	}
+	if _, err := s.GetSession(ctx, "tg-live"); err != nil {
+		t.Errorf("active session deleted: %v", err)
+	}
+	if cp, _ := s.LatestCheckpoint(ctx, "tg"); cp != nil {
+		t.Error("checkpoint of deleted session was kept")
+	}
+}
+
+func TestApplyRetentionZeroKeepsEverything(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	old := time.Now().Add(-365 * 24 * time.Hour)
+
+	if err := s.CreateSession(ctx, &Session{ID: "s", AgentID: "a", Channel: "c", PeerID: "p", CreatedAt: old, UpdatedAt: old}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendMessage(ctx, &Message{ID: "m", SessionID: "s", Role: "user", CreatedAt: old}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.ApplyRetention(ctx, RetentionPolicy{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (RetentionResult{}) {
+		t.Errorf("result = %+v, want nothing deleted", res)
+	}
+}
+
+func TestApplyRetentionFiles(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	dir := t.TempDir()
+	write := func(name string, age time.Duration) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	stale := write("tg-1/old.png", 10*24*time.Hour)
+	fresh := write("tg-2/new.png", time.Hour)
+	gone := filepath.Join(t.TempDir(), "missing")
+
+	res, err := s.ApplyRetention(context.Background(), RetentionPolicy{
+		Files: map[string]time.Duration{dir: 7 * 24 * time.Hour, gone: time.Hour},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 1 {
+		t.Errorf("Files = %d, want 1", res.Files)
+	}
+	if _, err := os.Stat(filepath.Dir(stale)); !os.IsNotExist(err) {
+		t.Error("expired file and its emptied directory were kept")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("recent file deleted: %v", err)
+	}
+}
@@ -2,31 +2,133 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+const (
+	defaultMaxOpenConns    = 20
+	defaultMaxIdleConns    = 5
+	defaultConnMaxLifetime = 30 * time.Minute
+)
+
 type Store struct {
-	db *gorm.DB
+	db     *gorm.DB
+	driver string
 }
 
+// Options selects and tunes the database backend. The pool settings only
+// apply to Postgres; zero values use the defaults.
+//
+// Open applies pending migrations unless SkipMigrations is set, which leaves
+// the schema untouched for inspection.
+type Options struct {
+	Driver          string
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	SkipMigrations  bool
+}
+
+// New opens a SQLite database at dsn.
 func New(dsn string) (*Store, error) {
-	db, err := gorm.Open(sqlite.Open(dsn+"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"), &gorm.Config{
+	return Open(Options{Driver: DriverSQLite, DSN: dsn})
+}
+
+func Open(opts Options) (*Store, error) {
+	var dialector gorm.Dialector
+	switch opts.Driver {
+	case DriverSQLite, "":
+		opts.Driver = DriverSQLite
+		dialector = sqlite.Open(opts.DSN + "?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	case DriverPostgres:
+		dialector = postgres.Open(opts.DSN)
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", opts.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Discard,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
-	if err := db.AutoMigrate(&Session{}, &Message{}, &Memory{}, &Credential{}, &Checkpoint{}); err != nil {
-		return nil, fmt.Errorf("running migrations: %w", err)
+	if opts.Driver == DriverPostgres {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, fmt.Errorf("opening database: %w", err)
+		}
+		sqlDB.SetMaxOpenConns(orDefault(opts.MaxOpenConns, defaultMaxOpenConns))
+		sqlDB.SetMaxIdleConns(orDefault(opts.MaxIdleConns, defaultMaxIdleConns))
+		sqlDB.SetConnMaxLifetime(orDefault(opts.ConnMaxLifetime, defaultConnMaxLifetime))
 	}
 
-	return &Store{db: db}, nil
+	s := &Store{db: db, driver: opts.Driver}
+	if !opts.SkipMigrations {
+		if _, err := s.Migrate(context.Background(), 0); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("running migrations: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func orDefault[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+	return v
+}
+
+// Driver reports which backend the store is using.
+func (s *Store) Driver() string {
+	return s.driver
+}
+
+// ErrSnapshotUnsupported is returned by Snapshot for drivers whose data does
+// not live in a local file.
+var ErrSnapshotUnsupported = errors.New("snapshot is only supported for sqlite")
+
+// Snapshot writes a consistent copy of the SQLite database to path using
+// VACUUM INTO, which is safe while other connections are writing. path must
+// not exist.
+func (s *Store) Snapshot(ctx context.Context, path string) error {
+	if s.driver != DriverSQLite {
+		return ErrSnapshotUnsupported
+	}
+	return s.db.WithContext(ctx).Exec("VACUUM INTO ?", path).Error
+}
+
+// CopyTable copies every row of model T from src to dst in batches. Rows that
+// already exist in dst are left alone, so an interrupted copy can be re-run.
+func CopyTable[T any](ctx context.Context, src, dst *gorm.DB) (int64, error) {
+	var copied int64
+	var batch []T
+	result := src.WithContext(ctx).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		res := dst.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&batch)
+		if res.Error != nil {
+			return res.Error
+		}
+		copied += res.RowsAffected
+		return nil
+	})
+	return copied, result.Error
 }
 
 func (s *Store) DB() *gorm.DB {
@@ -45,6 +147,7 @@ const (
 	ContentTypeText        = "text"
 	ContentTypeToolCalls   = "tool_calls"
 	ContentTypeToolResults = "tool_results"
+	ContentTypeMedia       = "media"
 )
 
 type Session struct {
@@ -83,9 +186,21 @@ type Credential struct {
 	ID             string    `gorm:"primaryKey;column:id"`
 	Name           string    `gorm:"column:name;not null;uniqueIndex"`
 	EncryptedValue []byte    `gorm:"column:encrypted_value;not null"`
+	Scopes         string    `gorm:"column:scopes;not null;default:''"`
 	CreatedAt      time.Time `gorm:"column:created_at;not null"`
 }
 
+type CredentialKDF struct {
+	ID        int       `gorm:"primaryKey;column:id;autoIncrement:false"`
+	Salt      []byte    `gorm:"column:salt;not null"`
+	Verifier  []byte    `gorm:"column:verifier;not null"`
+	RotatedAt time.Time `gorm:"column:rotated_at;not null"`
+}
+
+func (CredentialKDF) TableName() string {
+	return "credential_kdf"
+}
+
 func (s *Store) CreateSession(ctx context.Context, sess *Session) error {
 	return s.db.WithContext(ctx).Create(sess).Error
 }
@@ -111,7 +226,115 @@ func (s *Store) FindSession(ctx context.Context, agentID, channel, peerID string
 	return sess, nil
 }
 
-func (s *Store) GetOrCreateSession(ctx context.Context, id, channel, peerID string) (sess *Session, created bool, err error) {
+type SessionFilter struct {
+	AgentID string
+	Channel string
+	PeerID  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+// ListSessions returns sessions matching f, most recently active first. Since
+// and Until bound the time of last activity.
+func (s *Store) ListSessions(ctx context.Context, f SessionFilter) ([]Session, error) {
+	q := s.db.WithContext(ctx)
+
+	if f.AgentID != "" {
+		q = q.Where("agent_id = ?", f.AgentID)
+	}
+	if f.Channel != "" {
+		q = q.Where("channel = ?", f.Channel)
+	}
+	if f.PeerID != "" {
+		q = q.Where("peer_id = ?", f.PeerID)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("updated_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("updated_at <= ?", f.Until)
+	}
+
+	q = q.Order("updated_at DESC")
+
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	if f.Offset > 0 {
+		q = q.Offset(f.Offset)
+	}
+
+	var sessions []Session
+	err := q.Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteSession removes a session together with its messages and
+// checkpoints.
+func (s *Store) DeleteSession(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", id).Delete(&Checkpoint{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("session_id = ?", id).Delete(&Message{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&Session{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// ForkSession copies a session and its full message history into a new
+// session with ID newID. Checkpoints are not copied.
+func (s *Store) ForkSession(ctx context.Context, srcID, newID string) (*Session, error) {
+	var fork *Session
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		src := &Session{}
+		if err := tx.First(src, "id = ?", srcID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		fork = &Session{
+			ID:        newID,
+			AgentID:   src.AgentID,
+			Channel:   src.Channel,
+			PeerID:    src.PeerID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := tx.Create(fork).Error; err != nil {
+			return err
+		}
+
+		var msgs []Message
+		if err := tx.Where("session_id = ?", srcID).Order("created_at ASC").Find(&msgs).Error; err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		for i := range msgs {
+			msgs[i].ID = uuid.NewString()
+			msgs[i].SessionID = newID
+		}
+		return tx.CreateInBatches(msgs, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
+func (s *Store) GetOrCreateSession(ctx context.Context, id, agentID, channel, peerID string) (sess *Session, created bool, err error) {
 	sess, err = s.GetSession(ctx, id)
 	if err == nil {
 		if sess.Channel != channel || sess.PeerID != peerID {
@@ -121,13 +344,19 @@ func (s *Store) GetOrCreateSession(ctx context.Context, id, channel, peerID stri
 			sess.Channel = channel
 			sess.PeerID = peerID
 		}
+		if sess.AgentID != agentID {
+			if err := s.UpdateSessionAgent(ctx, id, agentID); err != nil {
+				return sess, false, fmt.Errorf("updating session agent: %w", err)
+			}
+			sess.AgentID = agentID
+		}
 		return sess, false, nil
 	}
 
 	now := time.Now().UTC()
 	sess = &Session{
 		ID:        id,
-		AgentID:   "default",
+		AgentID:   agentID,
 		Channel:   channel,
 		PeerID:    peerID,
 		CreatedAt: now,
@@ -157,6 +386,16 @@ func (s *Store) UpdateSessionChannel(ctx context.Context, id, channel, peerID st
 		}).Error
 }
 
+func (s *Store) UpdateSessionAgent(ctx context.Context, id, agentID string) error {
+	return s.db.WithContext(ctx).
+		Model(&Session{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"agent_id":   agentID,
+			"updated_at": time.Now().UTC(),
+		}).Error
+}
+
 func (s *Store) AppendMessage(ctx context.Context, msg *Message) error {
 	if msg.ContentType == "" {
 		msg.ContentType = ContentTypeText
@@ -165,11 +404,18 @@ func (s *Store) AppendMessage(ctx context.Context, msg *Message) error {
 }
 
 func (s *Store) RecentMessages(ctx context.Context, sessionID string, limit int) ([]Message, error) {
+	return s.RecentMessagesPage(ctx, sessionID, limit, 0)
+}
+
+// RecentMessagesPage returns up to limit messages of a session in
+// chronological order, skipping the offset most recent ones.
+func (s *Store) RecentMessagesPage(ctx context.Context, sessionID string, limit, offset int) ([]Message, error) {
 	var msgs []Message
 	err := s.db.WithContext(ctx).
 		Where("session_id = ?", sessionID).
 		Order("created_at DESC").
 		Limit(limit).
+		Offset(offset).
 		Find(&msgs).Error
 	if err != nil {
 		return nil, err
@@ -182,6 +428,16 @@ func (s *Store) RecentMessages(ctx context.Context, sessionID string, limit int)
 	return msgs, nil
 }
 
+// Messages returns the full history of a session, oldest first.
+func (s *Store) Messages(ctx context.Context, sessionID string) ([]Message, error) {
+	var msgs []Message
+	err := s.db.WithContext(ctx).
+		Where("session_id = ?", sessionID).
+		Order("created_at ASC").
+		Find(&msgs).Error
+	return msgs, err
+}
+
 func (s *Store) MessageCount(ctx context.Context, sessionID string) (int64, error) {
 	var count int64
 	err := s.db.WithContext(ctx).
@@ -191,6 +447,29 @@ func (s *Store) MessageCount(ctx context.Context, sessionID string) (int64, erro
 	return count, err
 }
 
+// MessageCounts returns the number of messages in each of sessionIDs with a
+// single query. Sessions without messages are absent from the map.
+func (s *Store) MessageCounts(ctx context.Context, sessionIDs []string) (map[string]int64, error) {
+	var rows []struct {
+		SessionID string
+		Count     int64
+	}
+	err := s.db.WithContext(ctx).
+		Model(&Message{}).
+		Select("session_id, COUNT(*) AS count").
+		Where("session_id IN ?", sessionIDs).
+		Group("session_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.SessionID] = r.Count
+	}
+	return counts, nil
+}
+
 func (s *Store) SessionTokenUsage(ctx context.Context, sessionID string) (int, error) {
 	var total int
 	err := s.db.WithContext(ctx).
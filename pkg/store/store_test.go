@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -81,6 +82,42 @@ func TestFindSession(t *testing.T) {
 	}
 }
 
+func TestListSessions(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	base := time.Now().UTC()
+	for i, ch := range []string{"telegram", "slack", "telegram"} {
+		sess := &Session{
+			ID:        fmt.Sprintf("sess-%d", i),
+			AgentID:   "agent-1",
+			Channel:   ch,
+			PeerID:    "peer",
+			CreatedAt: base,
+			UpdatedAt: base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := s.CreateSession(ctx, sess); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	all, err := s.ListSessions(ctx, SessionFilter{})
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(all) != 3 || all[0].ID != "sess-2" || all[2].ID != "sess-0" {
+		t.Errorf("ListSessions = %+v, want newest first", all)
+	}
+
+	tg, err := s.ListSessions(ctx, SessionFilter{Channel: "telegram", Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(tg) != 1 || tg[0].ID != "sess-0" {
+		t.Errorf("filtered ListSessions = %+v, want [sess-0]", tg)
+	}
+}
+
 func TestAppendAndRecentMessages(t *testing.T) {
 	s := testStore(t)
 	ctx := context.Background()
@@ -151,6 +188,14 @@ func TestMessageCount(t *testing.T) {
 	if count != 2 {
 		t.Errorf("count = %d, want 2", count)
 	}
+
+	counts, err := s.MessageCounts(ctx, []string{"sess-4", "missing"})
+	if err != nil {
+		t.Fatalf("MessageCounts: %v", err)
+	}
+	if len(counts) != 1 || counts["sess-4"] != 2 {
+		t.Errorf("counts = %v, want map[sess-4:2]", counts)
+	}
 }
 
 func TestDeleteMessages(t *testing.T) {
@@ -539,3 +584,203 @@ func TestAppendMessageDefaultContentType(t *testing.T) {
 		t.Errorf("ContentType = %q, want %q", msgs[0].ContentType, ContentTypeText)
 	}
 }
+
+func TestGetOrCreateSessionRebindsAgent(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	sess, created, err := s.GetOrCreateSession(ctx, "slack-C1", "default", "slack", "U1")
+	if err != nil || !created {
+		t.Fatalf("GetOrCreateSession: created=%v err=%v", created, err)
+	}
+	if sess.AgentID != "default" {
+		t.Errorf("AgentID = %q, want default", sess.AgentID)
+	}
+
+	sess, created, err = s.GetOrCreateSession(ctx, "slack-C1", "ops", "slack", "U1")
+	if err != nil || created {
+		t.Fatalf("GetOrCreateSession: created=%v err=%v", created, err)
+	}
+	if sess.AgentID != "ops" {
+		t.Errorf("AgentID = %q, want ops", sess.AgentID)
+	}
+
+	got, err := s.GetSession(ctx, "slack-C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AgentID != "ops" {
+		t.Errorf("persisted AgentID = %q, want ops", got.AgentID)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	if err := s.CreateSession(ctx, &Session{ID: "del-1", AgentID: "a", Channel: "c", PeerID: "p", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := s.AppendMessage(ctx, &Message{ID: "m-1", SessionID: "del-1", Role: "user", Content: "hi", CreatedAt: now}); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if err := s.SaveCheckpoint(ctx, &Checkpoint{ID: "cp-1", SessionID: "del-1", StepIndex: 1}); err != nil {
+		t.Fatalf("SaveCheckpoint: %v", err)
+	}
+
+	if err := s.DeleteSession(ctx, "del-1"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if _, err := s.GetSession(ctx, "del-1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetSession after delete = %v", err)
+	}
+	if n, _ := s.MessageCount(ctx, "del-1"); n != 0 {
+		t.Errorf("MessageCount after delete = %d", n)
+	}
+	if _, err := s.LatestCheckpoint(ctx, "del-1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("LatestCheckpoint after delete = %v", err)
+	}
+	if err := s.DeleteSession(ctx, "del-1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("second DeleteSession = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestForkSession(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	if err := s.CreateSession(ctx, &Session{ID: "orig", AgentID: "a", Channel: "telegram", PeerID: "p", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	for i, content := range []string{"one", "two", "three"} {
+		msg := &Message{
+			ID:        fmt.Sprintf("m-%d", i),
+			SessionID: "orig",
+			Role:      "user",
+			Content:   content,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}
+		if err := s.AppendMessage(ctx, msg); err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+	}
+
+	fork, err := s.ForkSession(ctx, "orig", "copy")
+	if err != nil {
+		t.Fatalf("ForkSession: %v", err)
+	}
+	if fork.AgentID != "a" || fork.Channel != "telegram" {
+		t.Errorf("fork = %+v", fork)
+	}
+
+	msgs, err := s.Messages(ctx, "copy")
+	if err != nil {
+		t.Fatalf("Messages: %v", err)
+	}
+	if len(msgs) != 3 || msgs[0].Content != "one" || msgs[2].Content != "three" || msgs[0].ID == "m-0" {
+		t.Errorf("forked messages = %+v", msgs)
+	}
+
+	if err := s.AppendMessage(ctx, &Message{ID: "m-new", SessionID: "copy", Role: "user", Content: "branch", CreatedAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if n, _ := s.MessageCount(ctx, "orig"); n != 3 {
+		t.Errorf("original MessageCount = %d, want 3", n)
+	}
+
+	if _, err := s.ForkSession(ctx, "missing", "x"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("ForkSession(missing) = %v", err)
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	if _, err := Open(Options{Driver: "mysql", DSN: "x"}); err == nil {
+		t.Fatal("expected error for unknown driver")
+	}
+}
+
+func TestCopyTable(t *testing.T) {
+	src := testStore(t)
+	dst := testStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	for i := range 3 {
+		sess := &Session{ID: fmt.Sprintf("s-%d", i), AgentID: "a", Channel: "c", PeerID: "p", CreatedAt: now, UpdatedAt: now}
+		if err := src.CreateSession(ctx, sess); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+	if err := dst.CreateSession(ctx, &Session{ID: "s-0", AgentID: "kept", Channel: "c", PeerID: "p", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	n, err := CopyTable[Session](ctx, src.DB(), dst.DB())
+	if err != nil {
+		t.Fatalf("CopyTable: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("copied %d rows, want 2 (s-0 already existed)", n)
+	}
+	got, err := dst.GetSession(ctx, "s-0")
+	if err != nil || got.AgentID != "kept" {
+		t.Errorf("existing row overwritten: %+v, %v", got, err)
+	}
+	if _, err := dst.GetSession(ctx, "s-2"); err != nil {
+		t.Errorf("s-2 not copied: %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	if _, _, err := s.GetOrCreateSession(ctx, "snap", "a", "c", "p"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := s.Snapshot(ctx, path); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	copyDB, err := Open(Options{Driver: DriverSQLite, DSN: path, SkipMigrations: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copyDB.Close()
+	if _, err := copyDB.GetSession(ctx, "snap"); err != nil {
+		t.Errorf("snapshot is missing the session: %v", err)
+	}
+	if err := s.Snapshot(ctx, path); err == nil {
+		t.Error("expected an error when the target exists")
+	}
+}
+
+// TestPostgres runs against a real server when PINCER_TEST_POSTGRES_DSN is
+// set.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("PINCER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("PINCER_TEST_POSTGRES_DSN not set")
+	}
+	s, err := Open(Options{Driver: DriverPostgres, DSN: dsn})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	ctx := context.Background()
+	id := "pg-" + fmt.Sprint(time.Now().UnixNano())
+	if _, _, err := s.GetOrCreateSession(ctx, id, "a", "c", "p"); err != nil {
+		t.Fatalf("GetOrCreateSession: %v", err)
+	}
+	t.Cleanup(func() { s.DeleteSession(ctx, id) })
+	if err := s.AppendMessage(ctx, &Message{ID: id + "-m", SessionID: id, Role: "user", Content: "hi", TokenCount: 2, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if usage, err := s.SessionTokenUsage(ctx, id); err != nil || usage != 2 {
+		t.Errorf("SessionTokenUsage = %d, %v", usage, err)
+	}
+}
@@ -6,11 +6,16 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
 
-const loggerKey contextKey = "logger"
+const (
+	loggerKey  contextKey = "logger"
+	traceIDKey contextKey = "trace_id"
+)
 
 func SetupLogger(level, format string, w io.Writer) *slog.Logger {
 	if w == nil {
@@ -44,6 +49,22 @@ func FromContext(ctx context.Context) *slog.Logger {
 	return slog.Default()
 }
 
+// WithTraceID tags ctx's logger with the trace ID of ctx's span, so records
+// can be matched with the trace. Loggers already tagged with that trace are
+// left alone.
+func WithTraceID(ctx context.Context) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ctx
+	}
+	id := sc.TraceID().String()
+	if tagged, _ := ctx.Value(traceIDKey).(string); tagged == id {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, traceIDKey, id)
+	return WithLogger(ctx, FromContext(ctx).With(slog.String("trace_id", id)))
+}
+
 func parseLevel(s string) slog.Level {
 	switch strings.ToLower(s) {
 	case "debug":
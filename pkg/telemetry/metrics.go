@@ -6,16 +6,31 @@ import (
 )
 
 var Metrics = struct {
-	RequestsTotal     *prometheus.CounterVec
-	RequestDuration   *prometheus.HistogramVec
-	TokensUsed        *prometheus.CounterVec
-	ToolExecutions    *prometheus.CounterVec
-	ToolDuration      *prometheus.HistogramVec
-	ActiveSessions    prometheus.Gauge
-	ActiveConnections prometheus.Gauge
-	ErrorsTotal       *prometheus.CounterVec
-	LLMRequestsTotal  *prometheus.CounterVec
-	LLMLatency        *prometheus.HistogramVec
+	RequestsTotal       *prometheus.CounterVec
+	RequestDuration     *prometheus.HistogramVec
+	TokensUsed          *prometheus.CounterVec
+	ToolExecutions      *prometheus.CounterVec
+	ToolDuration        *prometheus.HistogramVec
+	ActiveSessions      prometheus.Gauge
+	ActiveConnections   prometheus.Gauge
+	ErrorsTotal         *prometheus.CounterVec
+	LLMRequestsTotal    *prometheus.CounterVec
+	LLMLatency          *prometheus.HistogramVec
+	MCPServerUp         *prometheus.GaugeVec
+	MCPReconnects       *prometheus.CounterVec
+	MCPPingLatency      *prometheus.HistogramVec
+	LLMFirstToken       *prometheus.HistogramVec
+	LLMCost             *prometheus.CounterVec
+	ApprovalWait        *prometheus.HistogramVec
+	TurnsQueued         prometheus.Gauge
+	SessionLockWait     prometheus.Histogram
+	Compactions         *prometheus.CounterVec
+	CompactionSummary   prometheus.Histogram
+	SpawnsTotal         *prometheus.CounterVec
+	SubagentsTotal      *prometheus.CounterVec
+	VerificationGates   *prometheus.CounterVec
+	RetryStrategies     *prometheus.CounterVec
+	ChannelSendFailures *prometheus.CounterVec
 }{
 	RequestsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "pincer",
@@ -52,7 +67,7 @@ var Metrics = struct {
 	ActiveSessions: promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace: "pincer",
 		Name:      "active_sessions",
-		Help:      "Number of currently active sessions.",
+		Help:      "Number of sessions with an agent turn in progress.",
 	}),
 
 	ActiveConnections: promauto.NewGauge(prometheus.GaugeOpts{
@@ -76,7 +91,102 @@ var Metrics = struct {
 	LLMLatency: promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "pincer",
 		Name:      "llm_latency_seconds",
-		Help:      "LLM request latency in seconds (time to first token).",
+		Help:      "LLM request duration in seconds, until the response is complete.",
 		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
 	}, []string{"provider", "model"}),
+
+	MCPServerUp: promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "pincer",
+		Name:      "mcp_server_up",
+		Help:      "Whether an MCP server connection is up (1) or reconnecting (0).",
+	}, []string{"server"}),
+
+	MCPReconnects: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "mcp_reconnects_total",
+		Help:      "MCP reconnect attempts by server and status.",
+	}, []string{"server", "status"}),
+
+	MCPPingLatency: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "pincer",
+		Name:      "mcp_ping_latency_seconds",
+		Help:      "MCP server ping round-trip time in seconds.",
+		Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10},
+	}, []string{"server"}),
+
+	LLMFirstToken: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "pincer",
+		Name:      "llm_time_to_first_token_seconds",
+		Help:      "Time from an LLM request to its first token or tool call in seconds.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"provider", "model"}),
+
+	LLMCost: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "llm_cost_usd_total",
+		Help:      "Estimated LLM spend in US dollars by model, from [agent.pricing].",
+	}, []string{"model"}),
+
+	ApprovalWait: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "pincer",
+		Name:      "approval_wait_seconds",
+		Help:      "Time tool calls waited for approval in seconds, by mode and outcome.",
+		Buckets:   []float64{0.01, 1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"mode", "outcome"}),
+
+	TurnsQueued: promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "pincer",
+		Name:      "turns_queued",
+		Help:      "Number of turns waiting for an earlier turn in the same session to finish.",
+	}),
+
+	SessionLockWait: promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "pincer",
+		Name:      "session_lock_wait_seconds",
+		Help:      "Time turns waited for their session lock in seconds.",
+		Buckets:   []float64{0.001, 0.01, 0.1, 1, 5, 15, 30, 60, 300},
+	}),
+
+	Compactions: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "compactions_total",
+		Help:      "Session compaction runs by status.",
+	}, []string{"status"}),
+
+	CompactionSummary: promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "pincer",
+		Name:      "compaction_summary_tokens",
+		Help:      "Estimated size of compaction summaries in tokens.",
+		Buckets:   []float64{100, 250, 500, 1000, 2000, 4000, 8000},
+	}),
+
+	SpawnsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "spawns_total",
+		Help:      "Finished background spawns by status.",
+	}, []string{"status"}),
+
+	SubagentsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "subagents_total",
+		Help:      "Finished subagent runs, including those behind spawns, by status.",
+	}, []string{"status"}),
+
+	VerificationGates: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "verification_gate_results_total",
+		Help:      "Verification gate results by gate and outcome.",
+	}, []string{"gate", "outcome"}),
+
+	RetryStrategies: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "retry_strategies_total",
+		Help:      "Retry strategies applied after failed tool calls, by strategy.",
+	}, []string{"strategy"}),
+
+	ChannelSendFailures: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pincer",
+		Name:      "channel_send_failures_total",
+		Help:      "Messages that could not be delivered to a channel.",
+	}, []string{"channel"}),
 }
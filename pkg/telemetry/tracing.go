@@ -3,14 +3,16 @@ package telemetry
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -81,3 +83,39 @@ func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (c
 	}
 	return Tracer().Start(ctx, name, opts...)
 }
+
+// RecordError marks span as failed with err, if any.
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// EndSpan records err, if any, and ends span.
+func EndSpan(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// ExtractHTTP continues the trace announced by h's trace context headers.
+func ExtractHTTP(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// ExtractMap continues the trace carried in m, for protocols that pass trace
+// context in message metadata rather than headers.
+func ExtractMap(ctx context.Context, m map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(m))
+}
+
+// InjectMap returns ctx's trace context as metadata for ExtractMap, or nil
+// when there is nothing to propagate.
+func InjectMap(ctx context.Context) map[string]string {
+	m := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, m)
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}